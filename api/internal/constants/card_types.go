@@ -24,6 +24,7 @@ const (
 	MEMBER_STATUS_ACTIVE   = "ACTIVE"
 	MEMBER_STATUS_PENDING  = "PENDING"
 	MEMBER_STATUS_SUSPENDED = "SUSPENDED"
+	MEMBER_STATUS_EXPIRED   = "EXPIRED"
 )
 
 // Ranking Types
@@ -31,3 +32,11 @@ const (
 	RANK_TYPE_INTERACTIONS = "interactions"
 	RANK_TYPE_LIKES        = "likes"
 )
+
+// Membership application status
+const (
+	APPLICATION_STATUS_PENDING    = "PENDING"
+	APPLICATION_STATUS_WAITLISTED = "WAITLISTED"
+	APPLICATION_STATUS_APPROVED   = "APPROVED"
+	APPLICATION_STATUS_REJECTED   = "REJECTED"
+)
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PingLatency pings Redis and returns the round-trip time
+func PingLatency(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	if err := Rdb.Ping(ctx).Err(); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// CheckRediSearchModule verifies that the RediSearch module is loaded
+func CheckRediSearchModule(ctx context.Context) error {
+	res, err := Rdb.Do(ctx, "MODULE", "LIST").Result()
+	if err != nil {
+		return err
+	}
+
+	modules, ok := res.([]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected MODULE LIST response: %T", res)
+	}
+
+	for _, m := range modules {
+		name := ""
+		switch v := m.(type) {
+		case map[interface{}]interface{}:
+			// RESP3: each module is a map
+			name, _ = v["name"].(string)
+		case []interface{}:
+			// RESP2: each module is a flat [key, value, ...] list
+			for i := 0; i+1 < len(v); i += 2 {
+				if k, _ := v[i].(string); k == "name" {
+					name, _ = v[i+1].(string)
+				}
+			}
+		}
+		if strings.EqualFold(name, "search") || strings.EqualFold(name, "ft") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("RediSearch module not loaded")
+}
+
+// CheckIndexReady verifies that a RediSearch index exists and has finished indexing
+func CheckIndexReady(ctx context.Context, index string) error {
+	res, err := Rdb.Do(ctx, "FT.INFO", index).Result()
+	if err != nil {
+		return err
+	}
+
+	var indexing interface{}
+	switch v := res.(type) {
+	case map[interface{}]interface{}:
+		indexing = v["indexing"]
+	case []interface{}:
+		for i := 0; i+1 < len(v); i += 2 {
+			if k, _ := v[i].(string); k == "indexing" {
+				indexing = v[i+1]
+			}
+		}
+	default:
+		return fmt.Errorf("unexpected FT.INFO response: %T", res)
+	}
+
+	busy := false
+	switch v := indexing.(type) {
+	case int64:
+		busy = v != 0
+	case float64:
+		busy = v != 0
+	case string:
+		n, _ := strconv.ParseFloat(v, 64)
+		busy = n != 0
+	}
+
+	if busy {
+		return fmt.Errorf("index %s is still indexing", index)
+	}
+	return nil
+}
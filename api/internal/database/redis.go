@@ -10,6 +10,9 @@ import (
 
 var Rdb *redis.Client
 
+// IShopIndex is the RediSearch index over ishop:* hashes
+const IShopIndex = "idx:ishop"
+
 func InitRedis() {
 	redisAddr := os.Getenv("REDIS_ADDR")
 	if redisAddr == "" {
@@ -58,7 +61,7 @@ func InitRediSearch() {
 	indexExists := false
 	if idxSlice, ok := indexes.([]interface{}); ok {
 		for _, idx := range idxSlice {
-			if idx == "idx:ishop" {
+			if idx == IShopIndex {
 				indexExists = true
 				break
 			}
@@ -68,7 +71,7 @@ func InitRediSearch() {
 	if !indexExists {
 		fmt.Println("RediSearch index 'idx:ishop' not found. Creating it...")
 		// FT.CREATE idx:ishop ON HASH PREFIX 1 ishop: SCHEMA ...
-		err = Rdb.Do(ctx, "FT.CREATE", "idx:ishop", "ON", "HASH", "PREFIX", "1", "ishop:", "SCHEMA",
+		err = Rdb.Do(ctx, "FT.CREATE", IShopIndex, "ON", "HASH", "PREFIX", "1", "ishop:", "SCHEMA",
 			"name", "TEXT", "WEIGHT", "5.0",
 			"industry", "TEXT", "WEIGHT", "2.0",
 			"subIndustry", "TEXT", "WEIGHT", "2.0",
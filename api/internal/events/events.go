@@ -0,0 +1,180 @@
+// Package events defines the domain events emitted by the services and the
+// Redis Stream they are written to.
+//
+// Events are appended with XADD inside the same MULTI/EXEC transaction as the
+// state change that produced them, so the stream acts as a transactional
+// outbox: an event is visible if and only if its change was committed.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/hashcodec"
+)
+
+// StreamKey is the Redis Stream holding all domain events
+const StreamKey = "events:domain"
+
+// DeadLetterSuffix is appended to a stream key to name its dead-letter stream
+const DeadLetterSuffix = ":dlq"
+
+// maxStreamLen caps the stream (approximately) so it cannot grow unbounded
+const maxStreamLen = 100000
+
+// Type identifies a domain event
+type Type string
+
+// iCom events
+const (
+	IComCreated Type = "IComCreated"
+	IComUpdated Type = "IComUpdated"
+	IComDeleted Type = "IComDeleted"
+)
+
+// iShop events
+const (
+	IShopCreated Type = "IShopCreated"
+	IShopUpdated Type = "IShopUpdated"
+	IShopDeleted Type = "IShopDeleted"
+)
+
+// Membership events
+const (
+	MemberAdded         Type = "MemberAdded"
+	MemberRemoved       Type = "MemberRemoved"
+	MemberStatusChanged Type = "MemberStatusChanged"
+	MemberOrderChanged  Type = "MemberOrderChanged"
+	MemberApplied       Type = "MemberApplied"
+	MemberWaitlisted    Type = "MemberWaitlisted"
+	MemberApproved      Type = "MemberApproved"
+	MemberRejected      Type = "MemberRejected"
+	MemberRenewed       Type = "MemberRenewed"
+	MembershipExpiring  Type = "MembershipExpiring"
+)
+
+// Board and action button events
+const (
+	BoardMemberAdded   Type = "BoardMemberAdded"
+	BoardMemberUpdated Type = "BoardMemberUpdated"
+	BoardMemberRemoved Type = "BoardMemberRemoved"
+	BoardReordered     Type = "BoardReordered"
+	ActionAdded        Type = "ActionAdded"
+	ActionUpdated      Type = "ActionUpdated"
+	ActionRemoved      Type = "ActionRemoved"
+	ActionsReordered   Type = "ActionsReordered"
+)
+
+// Engagement events
+const (
+	InteractionRecorded Type = "InteractionRecorded"
+	ShopLiked           Type = "ShopLiked"
+	ShopUnliked         Type = "ShopUnliked"
+	ScoreAdjusted       Type = "ScoreAdjusted"
+)
+
+// Dues events
+const (
+	InvoiceIssued   Type = "InvoiceIssued"
+	InvoicePaid     Type = "InvoicePaid"
+	InvoiceOverdue  Type = "InvoiceOverdue"
+	InvoiceWaived   Type = "InvoiceWaived"
+	PaymentRecorded Type = "PaymentRecorded"
+)
+
+// Calendar events
+const (
+	CalendarEventCreated Type = "CalendarEventCreated"
+	CalendarEventUpdated Type = "CalendarEventUpdated"
+	CalendarEventDeleted Type = "CalendarEventDeleted"
+	RSVPAdded            Type = "RSVPAdded"
+	RSVPCancelled        Type = "RSVPCancelled"
+	RSVPPromoted         Type = "RSVPPromoted" // a waitlisted attendee got a seat
+	AttendeeCheckedIn    Type = "AttendeeCheckedIn"
+)
+
+// Announcement events
+const (
+	AnnouncementCreated Type = "AnnouncementCreated"
+	AnnouncementUpdated Type = "AnnouncementUpdated"
+	AnnouncementDeleted Type = "AnnouncementDeleted"
+)
+
+// Event is a single domain event as stored in the stream
+type Event struct {
+	ID         string          `json:"id" redis:"-"`
+	Type       Type            `json:"type" redis:"type"`
+	IComID     string          `json:"icom_id,omitempty" redis:"icomId"`
+	ShopID     string          `json:"shop_id,omitempty" redis:"shopId"`
+	OccurredAt time.Time       `json:"occurred_at" redis:"occurredAt"`
+	Data       json.RawMessage `json:"data,omitempty" redis:"data"`
+}
+
+// New builds an event with the given payload. The payload is one of the
+// *Data structs below (or nil) and is stored as JSON.
+func New(t Type, icomID, shopID string, payload interface{}) Event {
+	evt := Event{
+		Type:       t,
+		IComID:     icomID,
+		ShopID:     shopID,
+		OccurredAt: time.Now().UTC(),
+	}
+	if payload != nil {
+		evt.Data, _ = json.Marshal(payload)
+	}
+	return evt
+}
+
+// Decode unmarshals the event payload into v
+func (e Event) Decode(v interface{}) error {
+	if len(e.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(e.Data, v)
+}
+
+// Append queues the event on pipe. When pipe is a TxPipeline the event is
+// committed atomically with the other commands in the transaction.
+func Append(ctx context.Context, pipe redis.Pipeliner, evt Event) {
+	fields, err := hashcodec.Marshal(evt)
+	if err != nil {
+		return
+	}
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: StreamKey,
+		MaxLen: maxStreamLen,
+		Approx: true,
+		Values: fields,
+	})
+}
+
+// fromMessage decodes a stream entry into an Event
+func fromMessage(msg redis.XMessage) (Event, error) {
+	data := make(map[string]string, len(msg.Values))
+	for k, v := range msg.Values {
+		if s, ok := v.(string); ok {
+			data[k] = s
+		}
+	}
+
+	var evt Event
+	err := hashcodec.Unmarshal(data, &evt)
+	evt.ID = msg.ID
+	return evt, err
+}
+
+// ChangedFields returns the sorted hash field names of a partial update,
+// ignoring the bookkeeping "modified" timestamp
+func ChangedFields(updates map[string]interface{}) []string {
+	fields := make([]string, 0, len(updates))
+	for k := range updates {
+		if k != "modified" {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
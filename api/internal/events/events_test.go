@@ -0,0 +1,148 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/database"
+)
+
+func setupRedis(t *testing.T) *redis.Client {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	prev := database.Rdb
+	database.Rdb = rdb
+	t.Cleanup(func() { database.Rdb = prev })
+	return rdb
+}
+
+func TestAppendIsPartOfTransaction(t *testing.T) {
+	rdb := setupRedis(t)
+	ctx := context.Background()
+
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, "icom:1:member:2", "status", "ACTIVE")
+	Append(ctx, pipe, New(MemberAdded, "1", "2", MemberAddedData{Rank: "MEMBER", Status: "ACTIVE"}))
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	evts, err := Read(ctx, "", "0", 10)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(evts) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(evts))
+	}
+
+	evt := evts[0]
+	if evt.Type != MemberAdded || evt.IComID != "1" || evt.ShopID != "2" || evt.ID == "" {
+		t.Errorf("unexpected event: %+v", evt)
+	}
+	var data MemberAddedData
+	if err := evt.Decode(&data); err != nil || data.Status != "ACTIVE" {
+		t.Errorf("unexpected payload %+v (err %v)", data, err)
+	}
+
+	// Reading after the last ID returns nothing
+	evts, _ = Read(ctx, "", evt.ID, 10)
+	if len(evts) != 0 {
+		t.Errorf("expected no events after %s, got %d", evt.ID, len(evts))
+	}
+}
+
+func TestSubscriberAcknowledgesHandledEvents(t *testing.T) {
+	rdb := setupRedis(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := EnsureGroup(ctx, StreamKey, "test", "0"); err != nil {
+		t.Fatalf("EnsureGroup: %v", err)
+	}
+	pipe := rdb.TxPipeline()
+	Append(ctx, pipe, New(IComCreated, "1", "", nil))
+	Append(ctx, pipe, New(IComUpdated, "1", "", nil))
+	pipe.Exec(ctx)
+
+	got := make(chan Type, 2)
+	sub := NewSubscriber(SubscriberConfig{Group: "test", Block: 10 * time.Millisecond}, func(ctx context.Context, evt Event) error {
+		got <- evt.Type
+		return nil
+	})
+	go sub.Run(ctx)
+
+	for _, want := range []Type{IComCreated, IComUpdated} {
+		select {
+		case typ := <-got:
+			if typ != want {
+				t.Errorf("got %s, want %s", typ, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+
+	// Give the subscriber a moment to ack
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		pending, _ := rdb.XPending(ctx, StreamKey, "test").Result()
+		if pending != nil && pending.Count == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("expected no pending events after handling")
+}
+
+func TestSubscriberDeadLettersAfterMaxDeliveries(t *testing.T) {
+	rdb := setupRedis(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := EnsureGroup(ctx, StreamKey, "failing", "0"); err != nil {
+		t.Fatalf("EnsureGroup: %v", err)
+	}
+	pipe := rdb.TxPipeline()
+	Append(ctx, pipe, New(IShopDeleted, "", "9", nil))
+	pipe.Exec(ctx)
+
+	attempts := 0
+	sub := NewSubscriber(SubscriberConfig{
+		Group:         "failing",
+		Block:         10 * time.Millisecond,
+		RetryAfter:    time.Millisecond,
+		MaxDeliveries: 3,
+	}, func(ctx context.Context, evt Event) error {
+		attempts++
+		return errors.New("downstream unavailable")
+	})
+	go sub.Run(ctx)
+
+	for ctx.Err() == nil {
+		n, _ := rdb.XLen(ctx, StreamKey+DeadLetterSuffix).Result()
+		if n == 1 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+
+	msgs, err := rdb.XRange(context.Background(), StreamKey+DeadLetterSuffix, "-", "+").Result()
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("expected 1 dead-lettered event, got %d (err %v)", len(msgs), err)
+	}
+	if msgs[0].Values["group"] != "failing" || msgs[0].Values["error"] != "downstream unavailable" {
+		t.Errorf("unexpected dead-letter entry: %v", msgs[0].Values)
+	}
+	if attempts < 3 {
+		t.Errorf("expected at least 3 attempts before dead-lettering, got %d", attempts)
+	}
+}
@@ -0,0 +1,141 @@
+package events
+
+// IComChangedData is the payload of IComCreated and IComUpdated
+type IComChangedData struct {
+	Name    string   `json:"name,omitempty"`
+	Changed []string `json:"changed,omitempty"` // hash fields written by the update
+}
+
+// IShopChangedData is the payload of IShopCreated and IShopUpdated
+type IShopChangedData struct {
+	Name    string   `json:"name,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// MemberAddedData is the payload of MemberAdded
+type MemberAddedData struct {
+	Rank   string `json:"rank"`
+	Status string `json:"status"`
+	Role   string `json:"role,omitempty"`
+}
+
+// MemberRemovedData is the payload of MemberRemoved
+type MemberRemovedData struct {
+	Status string `json:"status"`
+}
+
+// MemberStatusChangedData is the payload of MemberStatusChanged
+type MemberStatusChangedData struct {
+	OldStatus string `json:"old_status,omitempty"`
+	NewStatus string `json:"new_status,omitempty"`
+	OldRank   string `json:"old_rank,omitempty"`
+	NewRank   string `json:"new_rank,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+// MemberRenewedData is the payload of MemberRenewed
+type MemberRenewedData struct {
+	OldExpiresAt string `json:"old_expires_at,omitempty"`
+	NewExpiresAt string `json:"new_expires_at"`
+	Auto         bool   `json:"auto,omitempty"` // renewed by the scheduler under an automatic renewal policy
+}
+
+// MembershipExpiringData is the payload of MembershipExpiring, the reminder
+// sent ahead of a membership's expiry
+type MembershipExpiringData struct {
+	ExpiresAt string `json:"expires_at"`
+	DaysLeft  int    `json:"days_left"`
+	AutoRenew bool   `json:"auto_renew,omitempty"`
+}
+
+// MemberOrderChangedData is the payload of MemberOrderChanged
+type MemberOrderChangedData struct {
+	DisplayOrder int `json:"display_order"`
+}
+
+// BoardMemberData is the payload of the BoardMember* events
+type BoardMemberData struct {
+	MemberID string `json:"member_id"`
+	Name     string `json:"name,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Term     string `json:"term,omitempty"`
+}
+
+// BoardReorderedData is the payload of BoardReordered
+type BoardReorderedData struct {
+	MemberIDs []string `json:"member_ids"`
+}
+
+// ActionData is the payload of the Action* events
+type ActionData struct {
+	ActionID string `json:"action_id"`
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+// ActionsReorderedData is the payload of ActionsReordered
+type ActionsReorderedData struct {
+	ActionIDs []string `json:"action_ids"`
+}
+
+// LikeData is the payload of ShopLiked and ShopUnliked
+type LikeData struct {
+	VisitorID string `json:"visitor_id"`
+	Source    string `json:"source"`
+}
+
+// ScoreAdjustedData is the payload of ScoreAdjusted
+type ScoreAdjustedData struct {
+	Action   string  `json:"action"`
+	Delta    float64 `json:"delta"`
+	NewScore float64 `json:"new_score"`
+	Reason   string  `json:"reason,omitempty"`
+	Actor    string  `json:"actor,omitempty"`
+}
+
+// MemberApplicationData is the payload of MemberApplied
+type MemberApplicationData struct {
+	Message string `json:"message,omitempty"`
+}
+
+// MemberDecisionData is the payload of MemberApproved and MemberRejected
+type MemberDecisionData struct {
+	Reason string `json:"reason,omitempty"`
+	Auto   bool   `json:"auto,omitempty"` // accepted without review; MemberAdded already carried ACTIVE
+}
+
+// InvoiceData is the payload of the Invoice* events and PaymentRecorded
+type InvoiceData struct {
+	InvoiceID   string `json:"invoice_id"`
+	Rank        string `json:"rank,omitempty"`
+	Amount      int64  `json:"amount"` // the payment's amount for PaymentRecorded
+	Currency    string `json:"currency"`
+	PeriodStart string `json:"period_start,omitempty"`
+	Status      string `json:"status"`
+	Method      string `json:"method,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// CalendarEventData is the payload of the CalendarEvent* events
+type CalendarEventData struct {
+	EventID  string   `json:"event_id"`
+	Title    string   `json:"title"`
+	StartsAt string   `json:"starts_at"`
+	Changed  []string `json:"changed,omitempty"` // fields set by CalendarEventUpdated
+}
+
+// RSVPData is the payload of the RSVP events and AttendeeCheckedIn. ShopID of
+// the event is set when the attendee is a member.
+type RSVPData struct {
+	EventID    string `json:"event_id"`
+	AttendeeID string `json:"attendee_id"`
+	Status     string `json:"status"`
+}
+
+// AnnouncementData is the payload of the Announcement* events
+type AnnouncementData struct {
+	AnnouncementID string `json:"announcement_id"`
+	Title          string `json:"title"`
+	Audience       string `json:"audience"`
+	PublishAt      string `json:"publish_at"`
+}
@@ -0,0 +1,244 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/database"
+)
+
+// Handler processes one event. Returning an error leaves the event pending so
+// it is redelivered later; after MaxDeliveries attempts it is dead-lettered.
+type Handler func(ctx context.Context, evt Event) error
+
+// SubscriberConfig configures a consumer-group subscriber
+type SubscriberConfig struct {
+	Group         string        // consumer group name (required)
+	Consumer      string        // consumer name, defaults to hostname-pid
+	Stream        string        // defaults to StreamKey
+	StartID       string        // where a new group starts: "$" (default, new events only) or "0"
+	BatchSize     int64         // events per read, default 20
+	Block         time.Duration // how long a read blocks waiting for events, default 5s
+	RetryAfter    time.Duration // idle time before a failed event is redelivered, default 30s
+	MaxDeliveries int64         // attempts before dead-lettering, default 5
+}
+
+// Subscriber reads events through a Redis consumer group and acknowledges
+// them once the handler succeeds. It implements workers.Worker.
+type Subscriber struct {
+	rdb     *redis.Client
+	cfg     SubscriberConfig
+	handler Handler
+}
+
+// NewSubscriber creates a subscriber for the given group
+func NewSubscriber(cfg SubscriberConfig, handler Handler) *Subscriber {
+	if cfg.Stream == "" {
+		cfg.Stream = StreamKey
+	}
+	if cfg.StartID == "" {
+		cfg.StartID = "$"
+	}
+	if cfg.Consumer == "" {
+		host, _ := os.Hostname()
+		cfg.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 20
+	}
+	if cfg.Block <= 0 {
+		cfg.Block = 5 * time.Second
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = 30 * time.Second
+	}
+	if cfg.MaxDeliveries <= 0 {
+		cfg.MaxDeliveries = 5
+	}
+
+	return &Subscriber{
+		rdb:     database.Rdb,
+		cfg:     cfg,
+		handler: handler,
+	}
+}
+
+// Name returns the worker name
+func (s *Subscriber) Name() string {
+	return "events:" + s.cfg.Group
+}
+
+// Run consumes events until ctx is cancelled
+func (s *Subscriber) Run(ctx context.Context) error {
+	if err := EnsureGroup(ctx, s.cfg.Stream, s.cfg.Group, s.cfg.StartID); err != nil {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		if err := s.reclaim(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("events: %s reclaim failed: %v", s.cfg.Group, err)
+		}
+		if err := s.poll(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// poll reads and handles a batch of new events
+func (s *Subscriber) poll(ctx context.Context) error {
+	streams, err := s.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    s.cfg.Group,
+		Consumer: s.cfg.Consumer,
+		Streams:  []string{s.cfg.Stream, ">"},
+		Count:    s.cfg.BatchSize,
+		Block:    s.cfg.Block,
+	}).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			s.handle(ctx, msg, 1)
+		}
+	}
+	return nil
+}
+
+// reclaim takes over events that failed or whose consumer died and retries them
+func (s *Subscriber) reclaim(ctx context.Context) error {
+	msgs, _, err := s.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   s.cfg.Stream,
+		Group:    s.cfg.Group,
+		Consumer: s.cfg.Consumer,
+		MinIdle:  s.cfg.RetryAfter,
+		Start:    "0-0",
+		Count:    s.cfg.BatchSize,
+	}).Result()
+	if err != nil || len(msgs) == 0 {
+		return err
+	}
+
+	// Look up delivery counts for the claimed events in one call
+	pending, err := s.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   s.cfg.Stream,
+		Group:    s.cfg.Group,
+		Start:    msgs[0].ID,
+		End:      msgs[len(msgs)-1].ID,
+		Count:    int64(len(msgs)) * 2,
+		Consumer: s.cfg.Consumer,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	deliveries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		deliveries[p.ID] = p.RetryCount
+	}
+
+	for _, msg := range msgs {
+		s.handle(ctx, msg, deliveries[msg.ID])
+	}
+	return nil
+}
+
+// handle runs the handler for one message and acks, retries or dead-letters it
+func (s *Subscriber) handle(ctx context.Context, msg redis.XMessage, deliveries int64) {
+	evt, err := fromMessage(msg)
+	if err == nil {
+		err = s.handler(ctx, evt)
+	}
+	if err == nil {
+		s.rdb.XAck(ctx, s.cfg.Stream, s.cfg.Group, msg.ID)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	if deliveries < s.cfg.MaxDeliveries {
+		// Left pending; reclaim will retry it after RetryAfter
+		return
+	}
+
+	log.Printf("events: %s dead-lettering %s (%s) after %d attempts: %v", s.cfg.Group, msg.ID, evt.Type, deliveries, err)
+	if dlErr := s.deadLetter(ctx, msg, deliveries, err); dlErr != nil {
+		log.Printf("events: %s dead-letter failed for %s: %v", s.cfg.Group, msg.ID, dlErr)
+	}
+}
+
+// deadLetter moves a message to the dead-letter stream and acknowledges it
+func (s *Subscriber) deadLetter(ctx context.Context, msg redis.XMessage, deliveries int64, cause error) error {
+	values := make(map[string]interface{}, len(msg.Values)+4)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values["originalId"] = msg.ID
+	values["group"] = s.cfg.Group
+	values["deliveries"] = deliveries
+	values["error"] = cause.Error()
+
+	pipe := s.rdb.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.cfg.Stream + DeadLetterSuffix,
+		MaxLen: maxStreamLen,
+		Approx: true,
+		Values: values,
+	})
+	pipe.XAck(ctx, s.cfg.Stream, s.cfg.Group, msg.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// EnsureGroup creates a consumer group (and the stream) if it does not exist
+func EnsureGroup(ctx context.Context, stream, group, startID string) error {
+	err := database.Rdb.XGroupCreateMkStream(ctx, stream, group, startID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// ReplayGroup rewinds a consumer group so that every event after fromID is
+// delivered again. Use "0" to replay the full retained history.
+func ReplayGroup(ctx context.Context, stream, group, fromID string) error {
+	if stream == "" {
+		stream = StreamKey
+	}
+	return database.Rdb.XGroupSetID(ctx, stream, group, fromID).Err()
+}
+
+// Read returns up to count events with IDs strictly after fromID, without
+// involving a consumer group. Pass "0" to read from the beginning.
+func Read(ctx context.Context, stream, fromID string, count int64) ([]Event, error) {
+	if stream == "" {
+		stream = StreamKey
+	}
+	if fromID == "" {
+		fromID = "0"
+	}
+
+	msgs, err := database.Rdb.XRangeN(ctx, stream, "("+fromID, "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Event, 0, len(msgs))
+	for _, msg := range msgs {
+		evt, err := fromMessage(msg)
+		if err != nil {
+			continue
+		}
+		out = append(out, evt)
+	}
+	return out, nil
+}
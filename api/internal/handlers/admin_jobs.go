@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/services"
+	"i-manage/internal/workers"
+)
+
+// jobErrorStatus maps job errors to HTTP status codes
+func jobErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, workers.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrJobStatus):
+		return http.StatusBadRequest
+	case errors.Is(err, workers.ErrJobRunning):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ListJobs godoc
+// @Summary      List background jobs
+// @Description  List the recurring and one-off jobs of the scheduler with their status, soonest next run first
+// @Tags         admin-jobs
+// @Produce      json
+// @Param        status query string false "Filter by status" Enums(scheduled, running, retrying, succeeded, failed)
+// @Success      200  {object}  models.JobList
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /admin/jobs [get]
+// @Security     CookieAuth
+func ListJobs(c *gin.Context) {
+	service := services.NewJobService()
+	jobs, err := service.ListJobs(c.Request.Context(), c.Query("status"))
+	if err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetJob godoc
+// @Summary      Get a background job
+// @Description  Get a job of the scheduler with its latest runs, newest first
+// @Tags         admin-jobs
+// @Produce      json
+// @Param        id path string true "Job ID"
+// @Success      200  {object}  models.Job
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /admin/jobs/{id} [get]
+// @Security     CookieAuth
+func GetJob(c *gin.Context) {
+	service := services.NewJobService()
+	job, err := service.GetJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// RunJob godoc
+// @Summary      Run a background job now
+// @Description  Make a job due now. A recurring job then carries on with its schedule; a failed one-off job is
+// @Description  attempted again.
+// @Tags         admin-jobs
+// @Produce      json
+// @Param        id path string true "Job ID"
+// @Success      202  {object}  models.Job
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /admin/jobs/{id}/run [post]
+// @Security     CookieAuth
+func RunJob(c *gin.Context) {
+	service := services.NewJobService()
+	job, err := service.RunJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
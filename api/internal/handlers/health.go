@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/database"
+)
+
+// draining is set once the server starts shutting down so that /readyz
+// reports unavailable and the load balancer stops routing new traffic here
+var draining atomic.Bool
+
+// MarkDraining flags the instance as shutting down
+func MarkDraining() {
+	draining.Store(true)
+}
+
+// maxPingLatency is the Redis round-trip above which the instance reports not ready
+func maxPingLatency() time.Duration {
+	if v := os.Getenv("READY_MAX_PING_MS"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return 250 * time.Millisecond
+}
+
+// Healthz godoc
+// @Summary      Liveness probe
+// @Description  Reports that the process is alive
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]string
+// @Router       /healthz [get]
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz godoc
+// @Summary      Readiness probe
+// @Description  Checks Redis latency, the RediSearch module and the idx:ishop index
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Failure      503  {object}  map[string]interface{}
+// @Router       /readyz [get]
+func Readyz(c *gin.Context) {
+	if draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	checks := gin.H{}
+	ready := true
+
+	latency, err := database.PingLatency(ctx)
+	switch {
+	case err != nil:
+		checks["redis"] = gin.H{"status": "fail", "error": err.Error()}
+		ready = false
+	case latency > maxPingLatency():
+		checks["redis"] = gin.H{"status": "fail", "latency_ms": latency.Milliseconds(), "error": "ping latency too high"}
+		ready = false
+	default:
+		checks["redis"] = gin.H{"status": "ok", "latency_ms": latency.Milliseconds()}
+	}
+
+	if err := database.CheckRediSearchModule(ctx); err != nil {
+		checks["redisearch"] = gin.H{"status": "fail", "error": err.Error()}
+		ready = false
+	} else {
+		checks["redisearch"] = gin.H{"status": "ok"}
+	}
+
+	if err := database.CheckIndexReady(ctx, database.IShopIndex); err != nil {
+		checks[database.IShopIndex] = gin.H{"status": "fail", "error": err.Error()}
+		ready = false
+	} else {
+		checks[database.IShopIndex] = gin.H{"status": "ok"}
+	}
+
+	status := http.StatusOK
+	overall := "ready"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		overall = "not_ready"
+	}
+
+	c.JSON(status, gin.H{"status": overall, "checks": checks})
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"i-manage/internal/models"
@@ -67,7 +69,7 @@ func GetICom(c *gin.Context) {
 	}
 
 	// Get actions
-	actions, _ := service.GetActions(c.Request.Context(), id)
+	actions, _ := service.GetVisibleActions(c.Request.Context(), id)
 	if actions == nil {
 		actions = []models.ActionButton{}
 	}
@@ -167,9 +169,23 @@ func ListIComs(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// statsErrorStatus maps statistics errors to HTTP status codes
+func statsErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrIComNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrStatsInterval),
+		errors.Is(err, services.ErrStatsMetric),
+		errors.Is(err, services.ErrStatsRange):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // GetIComStats godoc
 // @Summary      Get iCom Statistics
-// @Description  Get statistics for an iCom
+// @Description  Count the members of an iCom by status, rank, industry, sub-industry, province and district
 // @Tags         icom
 // @Accept       json
 // @Produce      json
@@ -182,22 +198,57 @@ func ListIComs(c *gin.Context) {
 func GetIComStats(c *gin.Context) {
 	id := c.Param("id")
 
-	service := services.NewIComService()
-	profile, err := service.GetICom(c.Request.Context(), id)
+	service := services.NewStatsService()
+	stats, err := service.Breakdown(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(statsErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	stats := models.IComStatsResponse{
-		TotalMembers:      profile.TotalMembers,
-		ActiveMembers:     profile.ActiveMembers,
-		PendingMembers:    0,
-		IndustryBreakdown: make(map[string]int),
-		DistrictBreakdown: make(map[string]int),
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetIComStatsTimeSeries godoc
+// @Summary      Get iCom growth time series
+// @Description  Joins, leaves, likes and interactions per day, ISO week or month over a date range.
+// @Description  Defaults to the last 30 days, 12 weeks or 12 months; at most 400 periods per request.
+// @Tags         icom
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        interval query string false "day (default), week or month"
+// @Param        from query string false "First day (YYYY-MM-DD)"
+// @Param        to query string false "Last day (YYYY-MM-DD), defaults to today"
+// @Param        metrics query string false "Comma-separated: joins, leaves, likes, interactions"
+// @Success      200  {object}  models.StatsTimeSeriesResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/stats/timeseries [get]
+// @Security     CookieAuth
+func GetIComStatsTimeSeries(c *gin.Context) {
+	id := c.Param("id")
+
+	req := models.StatsTimeSeriesRequest{
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+		Interval: c.Query("interval"),
+	}
+	if metrics := c.Query("metrics"); metrics != "" {
+		for _, m := range strings.Split(metrics, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				req.Metrics = append(req.Metrics, m)
+			}
+		}
+	}
+
+	service := services.NewStatsService()
+	response, err := service.TimeSeries(c.Request.Context(), id, req)
+	if err != nil {
+		c.JSON(statsErrorStatus(err), gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, stats)
+	c.JSON(http.StatusOK, response)
 }
 
 // GetIComMetadata godoc
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/services"
+)
+
+// memberToken returns the member access token a request carries, from the
+// X-Member-Token header or, for links and feed subscriptions, the token
+// query parameter
+func memberToken(c *gin.Context) string {
+	if token := c.GetHeader("X-Member-Token"); token != "" {
+		return token
+	}
+	return c.Query("token")
+}
+
+// accessErrorStatus maps member access errors to HTTP status codes
+func accessErrorStatus(err error) int {
+	if err.Error() == "membership not found" {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// IssueMemberAccessToken godoc
+// @Summary      Issue a member access token
+// @Description  Give a member shop a new access token, revoking the one it had. Members pass it as the token query
+// @Description  parameter or X-Member-Token header to see members-only events and announcements, subscribe to the
+// @Description  feeds and RSVP as their shop. This is the only response that includes the token.
+// @Tags         icom-members
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        shop_id path string true "Shop ID"
+// @Success      200  {object}  models.MemberAccess
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/members/{shop_id}/access-token [post]
+// @Security     CookieAuth
+func IssueMemberAccessToken(c *gin.Context) {
+	service := services.NewMemberService()
+	access, err := service.IssueAccessToken(c.Request.Context(), c.Param("id"), c.Param("shop_id"))
+	if err != nil {
+		c.JSON(accessErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, access)
+}
+
+// RevokeMemberAccessToken godoc
+// @Summary      Revoke a member access token
+// @Description  Take back the access token of a member shop
+// @Tags         icom-members
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        shop_id path string true "Shop ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/members/{shop_id}/access-token [delete]
+// @Security     CookieAuth
+func RevokeMemberAccessToken(c *gin.Context) {
+	service := services.NewMemberService()
+	if err := service.RevokeAccessToken(c.Request.Context(), c.Param("id"), c.Param("shop_id")); err != nil {
+		c.JSON(accessErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access token revoked"})
+}
@@ -1,16 +1,34 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"i-manage/internal/middleware"
 	"i-manage/internal/models"
 	"i-manage/internal/services"
 )
 
+// actionErrorStatus maps action service errors to HTTP status codes
+func actionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrActionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrActionType),
+		errors.Is(err, services.ErrActionTarget),
+		errors.Is(err, services.ErrActionSchedule),
+		errors.Is(err, services.ErrActionOrderMismatch):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // AddAction godoc
 // @Summary      Add Action Button
-// @Description  Add a functional action button
+// @Description  Add a functional action button. Type is one of phone, zalo, messenger, map, url, email or download;
+// @Description  url is validated and normalized for the type, e.g. a phone number becomes a tel: link.
 // @Tags         icom-actions
 // @Accept       json
 // @Produce      json
@@ -33,7 +51,7 @@ func AddAction(c *gin.Context) {
 	service := services.NewIComService()
 	actionID, err := service.AddAction(c.Request.Context(), icomID, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(actionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -45,7 +63,7 @@ func AddAction(c *gin.Context) {
 
 // UpdateAction godoc
 // @Summary      Update Action Button
-// @Description  Update action button information
+// @Description  Update action button information. A new type or url is validated against the other.
 // @Tags         icom-actions
 // @Accept       json
 // @Produce      json
@@ -54,6 +72,7 @@ func AddAction(c *gin.Context) {
 // @Param        request body models.UpdateActionRequest true "Update details"
 // @Success      200  {object}  map[string]string
 // @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /icom/{id}/actions/{action_id} [put]
 // @Security     CookieAuth
@@ -69,7 +88,7 @@ func UpdateAction(c *gin.Context) {
 
 	service := services.NewIComService()
 	if err := service.UpdateAction(c.Request.Context(), icomID, actionID, req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(actionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -101,13 +120,46 @@ func RemoveAction(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Action removed successfully"})
 }
 
+// ReorderActions godoc
+// @Summary      Reorder Action Buttons
+// @Description  Set the order of all action buttons. action_ids must list every action once.
+// @Tags         icom-actions
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.ReorderActionsRequest true "Action IDs in display order"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/actions/order [put]
+// @Security     CookieAuth
+func ReorderActions(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.ReorderActionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewIComService()
+	if err := service.ReorderActions(c.Request.Context(), icomID, req.ActionIDs); err != nil {
+		c.JSON(actionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Actions reordered successfully"})
+}
+
 // ListActions godoc
 // @Summary      List Action Buttons
-// @Description  Get all action buttons
+// @Description  Get the active action buttons within their visibility window, in order. Signed-in
+// @Description  managers can pass all=true to include inactive and scheduled actions.
 // @Tags         icom-actions
 // @Accept       json
 // @Produce      json
 // @Param        id path string true "iCom ID"
+// @Param        all query bool false "Include inactive and scheduled actions"
 // @Success      200  {object}  []models.ActionButton
 // @Failure      500  {object}  map[string]string
 // @Router       /icom/{id}/actions [get]
@@ -115,8 +167,24 @@ func RemoveAction(c *gin.Context) {
 func ListActions(c *gin.Context) {
 	icomID := c.Param("id")
 
+	all := false
+	if c.Query("all") == "true" {
+		authenticated, err := middleware.IsAuthenticated(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		all = authenticated
+	}
+
 	service := services.NewIComService()
-	actions, err := service.GetActions(c.Request.Context(), icomID)
+	var actions []models.ActionButton
+	var err error
+	if all {
+		actions, err = service.GetActions(c.Request.Context(), icomID)
+	} else {
+		actions, err = service.GetVisibleActions(c.Request.Context(), icomID)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -128,3 +196,91 @@ func ListActions(c *gin.Context) {
 
 	c.JSON(http.StatusOK, actions)
 }
+
+// actionVisitor identifies the visitor of a click by the client IP. A visitor
+// ID sent by the client would let it pose as any number of visitors; ClientIP
+// only believes forwarded headers from the proxies configured in
+// TRUSTED_PROXIES or TRUSTED_PLATFORM.
+func actionVisitor(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// FollowAction godoc
+// @Summary      Follow Action Button
+// @Description  Record a click on an action button and redirect to its URL
+// @Tags         icom-actions
+// @Param        id path string true "iCom ID"
+// @Param        action_id path string true "Action ID"
+// @Success      302
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/actions/{action_id}/go [get]
+func FollowAction(c *gin.Context) {
+	icomID := c.Param("id")
+	actionID := c.Param("action_id")
+
+	service := services.NewIComService()
+	url, err := service.RecordActionClick(c.Request.Context(), icomID, actionID, actionVisitor(c))
+	if err != nil {
+		c.JSON(actionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+}
+
+// RecordActionClick godoc
+// @Summary      Track Action Click
+// @Description  Record a click on an action button opened by the client itself, e.g. a tel: link
+// @Tags         icom-actions
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        action_id path string true "Action ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/actions/{action_id}/click [post]
+func RecordActionClick(c *gin.Context) {
+	icomID := c.Param("id")
+	actionID := c.Param("action_id")
+
+	service := services.NewIComService()
+	url, err := service.RecordActionClick(c.Request.Context(), icomID, actionID, actionVisitor(c))
+	if err != nil {
+		c.JSON(actionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+// GetActionAnalytics godoc
+// @Summary      Action Button Analytics
+// @Description  List every action button with its clicks and unique visitors per day. Visitors are told apart by
+// @Description  client address and their counts are estimates.
+// @Tags         icom-actions
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        from query string false "First day (YYYY-MM-DD), defaults to 29 days before to"
+// @Param        to query string false "Last day (YYYY-MM-DD), defaults to today"
+// @Success      200  {object}  models.ActionAnalyticsResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/actions/analytics [get]
+// @Security     CookieAuth
+func GetActionAnalytics(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewIComService()
+	analytics, err := service.GetActionAnalytics(c.Request.Context(), icomID, c.Query("from"), c.Query("to"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrStatsRange) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, analytics)
+}
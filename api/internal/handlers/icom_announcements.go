@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/middleware"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+)
+
+// announcementErrorStatus maps announcement service errors to HTTP status codes
+func announcementErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrIComNotFound), errors.Is(err, services.ErrAnnouncementNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrAnnouncementSchedule),
+		errors.Is(err, services.ErrAnnouncementBody),
+		errors.Is(err, services.ErrNotificationChannel):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// announcementViewer reports whether the caller may see members-only
+// announcements, and whether a signed-in manager asked for all of them
+func announcementViewer(c *gin.Context, service *services.AnnouncementService, icomID string) (membersOnly, all bool, err error) {
+	authenticated, err := middleware.IsAuthenticated(c)
+	if err != nil {
+		return false, false, err
+	}
+	membersOnly, err = service.CanSeeMembersOnly(c.Request.Context(), icomID, authenticated, memberToken(c))
+	return membersOnly, authenticated && c.Query("all") == "true", err
+}
+
+// ListAnnouncements godoc
+// @Summary      List announcements
+// @Description  List the published announcements of an iCom, pinned first, then newest first. Members-only
+// @Description  announcements are listed to signed-in managers and to active members sending their access token.
+// @Description  Signed-in managers can pass all=true to include scheduled and expired announcements.
+// @Tags         icom-announcements
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page (max 100)" default(20)
+// @Param        token query string false "Access token of the viewing member"
+// @Param        all query bool false "Include scheduled and expired announcements"
+// @Success      200  {object}  models.AnnouncementListResponse
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/announcements [get]
+func ListAnnouncements(c *gin.Context) {
+	icomID := c.Param("id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewAnnouncementService()
+	membersOnly, all, err := announcementViewer(c, service, icomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := service.ListAnnouncements(c.Request.Context(), icomID, page, limit, membersOnly, all)
+	if err != nil {
+		c.JSON(announcementErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetAnnouncement godoc
+// @Summary      Get an announcement
+// @Description  Get a published announcement. Signed-in managers also get scheduled and expired ones.
+// @Tags         icom-announcements
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        announcement_id path string true "Announcement ID"
+// @Param        token query string false "Access token of the viewing member"
+// @Success      200  {object}  models.Announcement
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/announcements/{announcement_id} [get]
+func GetAnnouncement(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewAnnouncementService()
+	authenticated, err := middleware.IsAuthenticated(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	membersOnly, err := service.CanSeeMembersOnly(c.Request.Context(), icomID, authenticated, memberToken(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	announcement, err := service.GetAnnouncement(c.Request.Context(), icomID, c.Param("announcement_id"), membersOnly, authenticated)
+	if err != nil {
+		c.JSON(announcementErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, announcement)
+}
+
+// GetAnnouncementsRSS godoc
+// @Summary      Announcements RSS feed
+// @Description  Get the latest announcements of an iCom as an RSS 2.0 feed. Members subscribe with their access
+// @Description  token to include members-only announcements.
+// @Tags         icom-announcements
+// @Produce      application/rss+xml
+// @Param        id path string true "iCom ID"
+// @Param        token query string false "Access token of the subscribing member"
+// @Success      200  {string}  string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/announcements.rss [get]
+func GetAnnouncementsRSS(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewAnnouncementService()
+	membersOnly, _, err := announcementViewer(c, service, icomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := service.WriteRSS(c.Request.Context(), &buf, icomID, membersOnly); err != nil {
+		c.JSON(announcementErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/rss+xml; charset=utf-8", buf.Bytes())
+}
+
+// GetAnnouncementsAtom godoc
+// @Summary      Announcements Atom feed
+// @Description  Get the latest announcements of an iCom as an Atom feed. Members subscribe with their access token
+// @Description  to include members-only announcements.
+// @Tags         icom-announcements
+// @Produce      application/atom+xml
+// @Param        id path string true "iCom ID"
+// @Param        token query string false "Access token of the subscribing member"
+// @Success      200  {string}  string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/announcements.atom [get]
+func GetAnnouncementsAtom(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewAnnouncementService()
+	membersOnly, _, err := announcementViewer(c, service, icomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := service.WriteAtom(c.Request.Context(), &buf, icomID, membersOnly); err != nil {
+		c.JSON(announcementErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/atom+xml; charset=utf-8", buf.Bytes())
+}
+
+// CreateAnnouncement godoc
+// @Summary      Publish an announcement
+// @Description  Publish an announcement now, or at publish_at. The body is HTML; tags and attributes outside a
+// @Description  basic formatting set are removed. With channels set (e.g. ["inbox"]) the active members are
+// @Description  notified through each channel once the announcement is published.
+// @Tags         icom-announcements
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.CreateAnnouncementRequest true "Announcement"
+// @Success      201  {object}  models.Announcement
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/announcements [post]
+// @Security     CookieAuth
+func CreateAnnouncement(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.CreateAnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewAnnouncementService()
+	announcement, err := service.CreateAnnouncement(c.Request.Context(), icomID, req)
+	if err != nil {
+		c.JSON(announcementErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, announcement)
+}
+
+// UpdateAnnouncement godoc
+// @Summary      Update an announcement
+// @Description  Update an announcement; only the fields sent are changed. Send an empty expires_at or cover_image
+// @Description  to remove it.
+// @Tags         icom-announcements
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        announcement_id path string true "Announcement ID"
+// @Param        request body models.UpdateAnnouncementRequest true "Changes"
+// @Success      200  {object}  models.Announcement
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/announcements/{announcement_id} [put]
+// @Security     CookieAuth
+func UpdateAnnouncement(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.UpdateAnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewAnnouncementService()
+	announcement, err := service.UpdateAnnouncement(c.Request.Context(), icomID, c.Param("announcement_id"), req)
+	if err != nil {
+		c.JSON(announcementErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, announcement)
+}
+
+// DeleteAnnouncement godoc
+// @Summary      Delete an announcement
+// @Description  Delete an announcement. Notifications already sent stay in the members' inboxes.
+// @Tags         icom-announcements
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        announcement_id path string true "Announcement ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/announcements/{announcement_id} [delete]
+// @Security     CookieAuth
+func DeleteAnnouncement(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewAnnouncementService()
+	if err := service.DeleteAnnouncement(c.Request.Context(), icomID, c.Param("announcement_id")); err != nil {
+		c.JSON(announcementErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Announcement deleted successfully"})
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+)
+
+// applicationErrorStatus maps membership application errors to HTTP status codes
+func applicationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrIComNotFound),
+		errors.Is(err, services.ErrShopNotFound),
+		errors.Is(err, services.ErrApplicationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrAlreadyMember),
+		errors.Is(err, services.ErrApplicationDecided),
+		errors.Is(err, services.ErrAlreadyWaitlisted),
+		errors.Is(err, services.ErrApplicationWaitlist):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrRejectReasonRequired),
+		errors.Is(err, services.ErrTierUndefined):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ApplyMembership godoc
+// @Summary      Apply to join iCom
+// @Description  Submit a shop's application. Depending on the iCom's require_approval and auto_activate
+// @Description  settings the shop is activated immediately or waits in the review queue as PENDING.
+// @Description  When the iCom is full and has a waitlist the application is WAITLISTED instead.
+// @Tags         icom-applications
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.ApplyMembershipRequest true "Application"
+// @Success      201  {object}  models.MembershipApplication
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/applications [post]
+// @Security     CookieAuth
+func ApplyMembership(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.ApplyMembershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewMemberService()
+	application, err := service.Apply(c.Request.Context(), icomID, req)
+	if err != nil {
+		if !respondRuleViolation(c, err) {
+			c.JSON(applicationErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, application)
+}
+
+// ListApplications godoc
+// @Summary      Review queue
+// @Description  List pending membership applications, oldest first
+// @Tags         icom-applications
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200  {object}  models.ApplicationListResponse
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/applications [get]
+// @Security     CookieAuth
+func ListApplications(c *gin.Context) {
+	icomID := c.Param("id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewMemberService()
+	response, err := service.ListApplications(c.Request.Context(), icomID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListWaitlist godoc
+// @Summary      Waitlist
+// @Description  List waitlisted applications in the order they will be admitted when seats free up
+// @Tags         icom-applications
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200  {object}  models.ApplicationListResponse
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/waitlist [get]
+// @Security     CookieAuth
+func ListWaitlist(c *gin.Context) {
+	icomID := c.Param("id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewMemberService()
+	response, err := service.ListWaitlist(c.Request.Context(), icomID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ApproveApplication godoc
+// @Summary      Approve application
+// @Description  Approve a pending application and activate the membership
+// @Tags         icom-applications
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        shop_id path string true "Shop ID"
+// @Param        request body models.ReviewApplicationRequest false "Optional note for the applicant"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/applications/{shop_id}/approve [post]
+// @Security     CookieAuth
+func ApproveApplication(c *gin.Context) {
+	icomID := c.Param("id")
+	shopID := c.Param("shop_id")
+
+	var req models.ReviewApplicationRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	service := services.NewMemberService()
+	if err := service.ApproveApplication(c.Request.Context(), icomID, shopID, req.Reason); err != nil {
+		if !respondRuleViolation(c, err) {
+			c.JSON(applicationErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Application approved successfully"})
+}
+
+// RejectApplication godoc
+// @Summary      Reject application
+// @Description  Reject a pending application with a reason; the pending membership is removed
+// @Tags         icom-applications
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        shop_id path string true "Shop ID"
+// @Param        request body models.ReviewApplicationRequest true "Rejection reason"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/applications/{shop_id}/reject [post]
+// @Security     CookieAuth
+func RejectApplication(c *gin.Context) {
+	icomID := c.Param("id")
+	shopID := c.Param("shop_id")
+
+	var req models.ReviewApplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewMemberService()
+	if err := service.RejectApplication(c.Request.Context(), icomID, shopID, req.Reason); err != nil {
+		if !respondRuleViolation(c, err) {
+			c.JSON(applicationErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Application rejected successfully"})
+}
+
+// BulkReviewApplications godoc
+// @Summary      Bulk review applications
+// @Description  Approve or reject many pending applications at once; results are reported per shop
+// @Tags         icom-applications
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.BulkReviewRequest true "Decision and shop IDs"
+// @Success      200  {object}  []models.BulkReviewResult
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/applications/bulk [post]
+// @Security     CookieAuth
+func BulkReviewApplications(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.BulkReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewMemberService()
+	results, err := service.BulkReview(c.Request.Context(), icomID, req)
+	if err != nil {
+		if !respondRuleViolation(c, err) {
+			c.JSON(applicationErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
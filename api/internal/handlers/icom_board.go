@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -8,9 +9,24 @@ import (
 	"i-manage/internal/services"
 )
 
+// boardErrorStatus maps board service errors to HTTP status codes
+func boardErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrBoardMemberNotFound),
+		errors.Is(err, services.ErrBoardTermNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrBoardTermRange),
+		errors.Is(err, services.ErrBoardOrderMismatch):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // AddBoardMember godoc
 // @Summary      Add Board Member
-// @Description  Add a member to the board of directors
+// @Description  Add a member to the end of the board of directors. Role is one of chair, vice_chair, secretary,
+// @Description  treasurer, member or advisor. Term defaults to the years of the term dates, or the current year.
 // @Tags         icom-board
 // @Accept       json
 // @Produce      json
@@ -33,7 +49,7 @@ func AddBoardMember(c *gin.Context) {
 	service := services.NewIComService()
 	memberID, err := service.AddBoardMember(c.Request.Context(), icomID, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(boardErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -45,7 +61,7 @@ func AddBoardMember(c *gin.Context) {
 
 // UpdateBoardMember godoc
 // @Summary      Update Board Member
-// @Description  Update board member information
+// @Description  Update board member information, including archived members of past terms
 // @Tags         icom-board
 // @Accept       json
 // @Produce      json
@@ -54,6 +70,7 @@ func AddBoardMember(c *gin.Context) {
 // @Param        request body models.UpdateBoardMemberRequest true "Update details"
 // @Success      200  {object}  map[string]string
 // @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /icom/{id}/board/{member_id} [put]
 // @Security     CookieAuth
@@ -69,7 +86,7 @@ func UpdateBoardMember(c *gin.Context) {
 
 	service := services.NewIComService()
 	if err := service.UpdateBoardMember(c.Request.Context(), icomID, memberID, req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(boardErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -78,13 +95,14 @@ func UpdateBoardMember(c *gin.Context) {
 
 // RemoveBoardMember godoc
 // @Summary      Remove Board Member
-// @Description  Remove a member from the board
+// @Description  Remove a member from the current board and archive them in their term's history
 // @Tags         icom-board
 // @Accept       json
 // @Produce      json
 // @Param        id path string true "iCom ID"
 // @Param        member_id path string true "Member ID"
 // @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /icom/{id}/board/{member_id} [delete]
 // @Security     CookieAuth
@@ -94,21 +112,54 @@ func RemoveBoardMember(c *gin.Context) {
 
 	service := services.NewIComService()
 	if err := service.RemoveBoardMember(c.Request.Context(), icomID, memberID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(boardErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Board member removed successfully"})
 }
 
+// ReorderBoard godoc
+// @Summary      Reorder Board
+// @Description  Set the display order of the current board. member_ids must list every current board member once.
+// @Tags         icom-board
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.ReorderBoardRequest true "Board member IDs in display order"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/board/order [put]
+// @Security     CookieAuth
+func ReorderBoard(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.ReorderBoardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewIComService()
+	if err := service.ReorderBoard(c.Request.Context(), icomID, req.MemberIDs); err != nil {
+		c.JSON(boardErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Board reordered successfully"})
+}
+
 // ListBoardMembers godoc
 // @Summary      List Board Members
-// @Description  Get all board members
+// @Description  Get the current board in display order, or everyone who served in a past or current term
 // @Tags         icom-board
 // @Accept       json
 // @Produce      json
 // @Param        id path string true "iCom ID"
+// @Param        term query string false "Term, e.g. 2024-2027"
 // @Success      200  {object}  []models.BoardMember
+// @Failure      404  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /icom/{id}/board [get]
 // @Security     CookieAuth
@@ -116,9 +167,15 @@ func ListBoardMembers(c *gin.Context) {
 	icomID := c.Param("id")
 
 	service := services.NewIComService()
-	members, err := service.GetBoardMembers(c.Request.Context(), icomID)
+	var members []models.BoardMember
+	var err error
+	if term := c.Query("term"); term != "" {
+		members, err = service.GetBoardTerm(c.Request.Context(), icomID, term)
+	} else {
+		members, err = service.GetBoardMembers(c.Request.Context(), icomID)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(boardErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -128,3 +185,25 @@ func ListBoardMembers(c *gin.Context) {
 
 	c.JSON(http.StatusOK, members)
 }
+
+// ListBoardTerms godoc
+// @Summary      List Board Terms
+// @Description  List the board terms with recorded members, newest first
+// @Tags         icom-board
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Success      200  {object}  []models.BoardTerm
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/board/terms [get]
+func ListBoardTerms(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewIComService()
+	terms, err := service.ListBoardTerms(c.Request.Context(), icomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, terms)
+}
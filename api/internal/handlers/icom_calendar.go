@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/middleware"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+)
+
+// calendarErrorStatus maps calendar service errors to HTTP status codes
+func calendarErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrIComNotFound),
+		errors.Is(err, services.ErrCalendarEventNotFound),
+		errors.Is(err, services.ErrAttendeeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCalendarEventSchedule),
+		errors.Is(err, services.ErrCalendarRange),
+		errors.Is(err, services.ErrRSVPIdentity):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrEventMembersOnly),
+		errors.Is(err, services.ErrRSVPNotMember),
+		errors.Is(err, services.ErrRSVPCancelToken):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrEventEnded), errors.Is(err, services.ErrAttendeeWaitlisted):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// calendarViewer reports whether the caller may see members-only events:
+// signed-in managers and active members holding their access token may
+func calendarViewer(c *gin.Context, service *services.CalendarService, icomID string) (bool, error) {
+	authenticated, err := middleware.IsAuthenticated(c)
+	if err != nil {
+		return false, err
+	}
+	return service.CanSeeMembersOnly(c.Request.Context(), icomID, authenticated, memberToken(c))
+}
+
+// ListCalendarEvents godoc
+// @Summary      List events
+// @Description  List the events of an iCom, soonest first. Without from only events that have not ended are listed.
+// @Description  Members-only events are listed to signed-in managers and to active members sending their access
+// @Description  token.
+// @Tags         icom-events
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        from query string false "First day (YYYY-MM-DD)"
+// @Param        to query string false "Last day (YYYY-MM-DD)"
+// @Param        token query string false "Access token of the viewing member"
+// @Success      200  {object}  []models.CalendarEvent
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events [get]
+func ListCalendarEvents(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewCalendarService()
+	membersOnly, err := calendarViewer(c, service, icomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := service.ListEvents(c.Request.Context(), icomID, c.Query("from"), c.Query("to"), membersOnly)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// GetCalendarFeed godoc
+// @Summary      iCalendar feed
+// @Description  Get the events of an iCom as an iCalendar (.ics) feed to subscribe to from calendar apps. The feed
+// @Description  holds upcoming events and those that ended in the last 90 days. Members subscribe with their access
+// @Description  token to include members-only events.
+// @Tags         icom-events
+// @Produce      text/calendar
+// @Param        id path string true "iCom ID"
+// @Param        token query string false "Access token of the subscribing member"
+// @Success      200  {string}  string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events.ics [get]
+func GetCalendarFeed(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewCalendarService()
+	membersOnly, err := calendarViewer(c, service, icomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := service.WriteICalendar(c.Request.Context(), &buf, icomID, membersOnly); err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="icom-%s.ics"`, icomID))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+// GetCalendarEvent godoc
+// @Summary      Get an event
+// @Description  Get an event with how many are going and waitlisted
+// @Tags         icom-events
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        event_id path string true "Event ID"
+// @Param        token query string false "Access token of the viewing member"
+// @Success      200  {object}  models.CalendarEvent
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events/{event_id} [get]
+func GetCalendarEvent(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewCalendarService()
+	membersOnly, err := calendarViewer(c, service, icomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, err := service.GetEvent(c.Request.Context(), icomID, c.Param("event_id"), membersOnly)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// RSVPCalendarEvent godoc
+// @Summary      RSVP to an event
+// @Description  Sign up for an event. Members sign up with their access token, visitors with name and email;
+// @Description  members-only events are open to active members only. When the event is full the attendee is
+// @Description  waitlisted and gets a seat as others cancel. The response carries the cancel token that withdraws
+// @Description  the RSVP. Signing up again returns the existing RSVP, with its cancel token for members only.
+// @Tags         icom-events
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        event_id path string true "Event ID"
+// @Param        request body models.RSVPRequest true "Attendee"
+// @Success      200  {object}  models.Attendee
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events/{event_id}/rsvp [post]
+func RSVPCalendarEvent(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.RSVPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Token == "" {
+		req.Token = memberToken(c)
+	}
+
+	service := services.NewCalendarService()
+	attendee, err := service.RSVP(c.Request.Context(), icomID, c.Param("event_id"), req)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, attendee)
+}
+
+// WithdrawCalendarRSVP godoc
+// @Summary      Cancel an RSVP
+// @Description  Cancel an RSVP with the attendee ID and cancel token its sign-up returned. A freed seat goes to the
+// @Description  first on the waitlist.
+// @Tags         icom-events
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        event_id path string true "Event ID"
+// @Param        request body models.WithdrawRSVPRequest true "RSVP"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events/{event_id}/rsvp [delete]
+func WithdrawCalendarRSVP(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.WithdrawRSVPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewCalendarService()
+	if err := service.WithdrawRSVP(c.Request.Context(), icomID, c.Param("event_id"), req); err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "RSVP cancelled"})
+}
+
+// CreateCalendarEvent godoc
+// @Summary      Create an event
+// @Description  Add an event to the calendar of an iCom. A capacity of 0 means unlimited seats.
+// @Tags         icom-events
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.CreateCalendarEventRequest true "Event"
+// @Success      201  {object}  models.CalendarEvent
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events [post]
+// @Security     CookieAuth
+func CreateCalendarEvent(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.CreateCalendarEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewCalendarService()
+	event, err := service.CreateEvent(c.Request.Context(), icomID, req)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, event)
+}
+
+// UpdateCalendarEvent godoc
+// @Summary      Update an event
+// @Description  Update an event; only the fields sent are changed. Raising the capacity gives freed seats to the
+// @Description  waitlist.
+// @Tags         icom-events
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        event_id path string true "Event ID"
+// @Param        request body models.UpdateCalendarEventRequest true "Changes"
+// @Success      200  {object}  models.CalendarEvent
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events/{event_id} [put]
+// @Security     CookieAuth
+func UpdateCalendarEvent(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.UpdateCalendarEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewCalendarService()
+	event, err := service.UpdateEvent(c.Request.Context(), icomID, c.Param("event_id"), req)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// DeleteCalendarEvent godoc
+// @Summary      Delete an event
+// @Description  Delete an event with its RSVPs
+// @Tags         icom-events
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        event_id path string true "Event ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events/{event_id} [delete]
+// @Security     CookieAuth
+func DeleteCalendarEvent(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewCalendarService()
+	if err := service.DeleteEvent(c.Request.Context(), icomID, c.Param("event_id")); err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event deleted successfully"})
+}
+
+// ListEventAttendees godoc
+// @Summary      List attendees
+// @Description  List who RSVP'd to an event: those going first, then the waitlist, each in RSVP order
+// @Tags         icom-events
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        event_id path string true "Event ID"
+// @Param        status query string false "going or waitlisted"
+// @Success      200  {object}  models.AttendeeList
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events/{event_id}/attendees [get]
+// @Security     CookieAuth
+func ListEventAttendees(c *gin.Context) {
+	icomID := c.Param("id")
+
+	status := c.Query("status")
+	if status != "" && status != models.RSVPStatusGoing && status != models.RSVPStatusWaitlisted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be going or waitlisted"})
+		return
+	}
+
+	service := services.NewCalendarService()
+	list, err := service.ListAttendees(c.Request.Context(), icomID, c.Param("event_id"), status)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// CancelEventAttendee godoc
+// @Summary      Remove an attendee
+// @Description  Take an attendee off an event. A freed seat goes to the first on the waitlist.
+// @Tags         icom-events
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        event_id path string true "Event ID"
+// @Param        attendee_id path string true "Attendee ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events/{event_id}/attendees/{attendee_id} [delete]
+// @Security     CookieAuth
+func CancelEventAttendee(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewCalendarService()
+	if err := service.CancelRSVP(c.Request.Context(), icomID, c.Param("event_id"), c.Param("attendee_id")); err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attendee removed"})
+}
+
+// CheckInAttendee godoc
+// @Summary      Check in an attendee
+// @Description  Record that an attendee arrived at the event. Waitlisted attendees cannot check in.
+// @Tags         icom-events
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        event_id path string true "Event ID"
+// @Param        attendee_id path string true "Attendee ID"
+// @Success      200  {object}  models.Attendee
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events/{event_id}/attendees/{attendee_id}/checkin [post]
+// @Security     CookieAuth
+func CheckInAttendee(c *gin.Context) {
+	checkInAttendee(c, false)
+}
+
+// UndoCheckInAttendee godoc
+// @Summary      Undo a check-in
+// @Description  Take back the check-in of an attendee
+// @Tags         icom-events
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        event_id path string true "Event ID"
+// @Param        attendee_id path string true "Attendee ID"
+// @Success      200  {object}  models.Attendee
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/events/{event_id}/attendees/{attendee_id}/checkin [delete]
+// @Security     CookieAuth
+func UndoCheckInAttendee(c *gin.Context) {
+	checkInAttendee(c, true)
+}
+
+func checkInAttendee(c *gin.Context, undo bool) {
+	icomID := c.Param("id")
+
+	service := services.NewCalendarService()
+	attendee, err := service.CheckIn(c.Request.Context(), icomID, c.Param("event_id"), c.Param("attendee_id"), undo)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, attendee)
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+)
+
+// duesErrorStatus maps dues and payment service errors to HTTP status codes
+func duesErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrIComNotFound),
+		errors.Is(err, services.ErrInvoiceNotFound),
+		errors.Is(err, services.ErrCheckoutNotFound),
+		errors.Is(err, services.ErrGatewayNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrDuesSettings),
+		errors.Is(err, services.ErrTierUndefined),
+		errors.Is(err, services.ErrInvoiceStatus),
+		errors.Is(err, services.ErrPaymentAmount),
+		errors.Is(err, services.ErrGatewayCallback):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInvoiceSettled):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetDuesSettings godoc
+// @Summary      Get dues settings
+// @Description  Get the fee schedule of an iCom: currency, period length, due days, whether overdue members are
+// @Description  suspended, and the fee of each tier
+// @Tags         icom-dues
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Success      200  {object}  models.DuesSettings
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/dues [get]
+// @Security     CookieAuth
+func GetDuesSettings(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewDuesService()
+	settings, err := service.GetDuesSettings(c.Request.Context(), icomID)
+	if err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// SetDuesSettings godoc
+// @Summary      Set dues settings
+// @Description  Replace the fee schedule of an iCom. Each fee names a tier; tiers without a fee pay nothing.
+// @Description  Invoices are issued per membership period, counted from the day the member joined.
+// @Description  Invoices already issued keep their amounts.
+// @Tags         icom-dues
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.DuesSettings true "Fee schedule"
+// @Success      200  {object}  models.DuesSettings
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/dues [put]
+// @Security     CookieAuth
+func SetDuesSettings(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.DuesSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewDuesService()
+	settings, err := service.SetDuesSettings(c.Request.Context(), icomID, req)
+	if err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// RunDues godoc
+// @Summary      Run dues now
+// @Description  Issue the invoices of the current membership periods, mark invoices past their due date overdue
+// @Description  and suspend members who owe them when the iCom asks for it, instead of waiting for the hourly run
+// @Tags         icom-dues
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Success      200  {object}  models.InvoiceRun
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/dues/run [post]
+// @Security     CookieAuth
+func RunDues(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewDuesService()
+	run, err := service.ProcessDues(c.Request.Context(), icomID)
+	if err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// GetDuesDashboard godoc
+// @Summary      Dues dashboard
+// @Description  Invoice counts and amounts per status, amounts billed, collected and outstanding, members
+// @Description  suspended for overdue dues and the oldest overdue invoices
+// @Tags         icom-dues
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Success      200  {object}  models.DuesDashboard
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/dues/dashboard [get]
+// @Security     CookieAuth
+func GetDuesDashboard(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewDuesService()
+	dashboard, err := service.GetDuesDashboard(c.Request.Context(), icomID)
+	if err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dashboard)
+}
+
+// ListInvoices godoc
+// @Summary      List invoices
+// @Description  List the invoices of an iCom, newest period first
+// @Tags         icom-dues
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        status query string false "Invoice status" Enums(issued, paid, overdue, waived)
+// @Param        shop_id query string false "Only the invoices of this member"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200  {object}  models.InvoiceList
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/dues/invoices [get]
+// @Security     CookieAuth
+func ListInvoices(c *gin.Context) {
+	icomID := c.Param("id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewDuesService()
+	list, err := service.ListInvoices(c.Request.Context(), icomID, c.Query("status"), c.Query("shop_id"), page, limit)
+	if err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// GetInvoice godoc
+// @Summary      Get invoice
+// @Description  Get an invoice with its payments
+// @Tags         icom-dues
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        invoice_id path string true "Invoice ID"
+// @Success      200  {object}  models.Invoice
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/dues/invoices/{invoice_id} [get]
+// @Security     CookieAuth
+func GetInvoice(c *gin.Context) {
+	icomID := c.Param("id")
+	invoiceID := c.Param("invoice_id")
+
+	service := services.NewDuesService()
+	invoice, err := service.GetInvoice(c.Request.Context(), icomID, invoiceID)
+	if err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice)
+}
+
+// RecordPayment godoc
+// @Summary      Record payment
+// @Description  Record a payment received outside i-Manage (cash, bank transfer). Partial payments are allowed;
+// @Description  the invoice is paid once they cover its amount, which also reactivates a member suspended for dues.
+// @Tags         icom-dues
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        invoice_id path string true "Invoice ID"
+// @Param        request body models.RecordPaymentRequest true "Payment"
+// @Success      200  {object}  models.Invoice
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/dues/invoices/{invoice_id}/payments [post]
+// @Security     CookieAuth
+func RecordPayment(c *gin.Context) {
+	icomID := c.Param("id")
+	invoiceID := c.Param("invoice_id")
+
+	var req models.RecordPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewDuesService()
+	invoice, err := service.RecordPayment(c.Request.Context(), icomID, invoiceID, req)
+	if err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice)
+}
+
+// WaiveInvoice godoc
+// @Summary      Waive invoice
+// @Description  Cancel what is left to pay on an invoice
+// @Tags         icom-dues
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        invoice_id path string true "Invoice ID"
+// @Param        request body models.WaiveInvoiceRequest true "Reason"
+// @Success      200  {object}  models.Invoice
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/dues/invoices/{invoice_id}/waive [post]
+// @Security     CookieAuth
+func WaiveInvoice(c *gin.Context) {
+	icomID := c.Param("id")
+	invoiceID := c.Param("invoice_id")
+
+	var req models.WaiveInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewDuesService()
+	invoice, err := service.WaiveInvoice(c.Request.Context(), icomID, invoiceID, req.Reason)
+	if err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice)
+}
+
+// CreateCheckout godoc
+// @Summary      Pay invoice online
+// @Description  Start paying what is left on an invoice through a payment provider. The payer completes the
+// @Description  payment at pay_url; the provider reports the outcome to the payment callback.
+// @Tags         icom-dues
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        invoice_id path string true "Invoice ID"
+// @Param        request body models.CreateCheckoutRequest true "Payment provider"
+// @Success      201  {object}  models.Checkout
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/dues/invoices/{invoice_id}/checkout [post]
+// @Security     CookieAuth
+func CreateCheckout(c *gin.Context) {
+	icomID := c.Param("id")
+	invoiceID := c.Param("invoice_id")
+
+	var req models.CreateCheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewDuesService()
+	checkout, err := service.CreateCheckout(c.Request.Context(), icomID, invoiceID, req.Provider)
+	if err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, checkout)
+}
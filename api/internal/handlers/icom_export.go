@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/middleware"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+)
+
+// exportContentTypes maps export formats to their media types
+var exportContentTypes = map[string]string{
+	models.ExportFormatCSV:   "text/csv; charset=utf-8",
+	models.ExportFormatXLSX:  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	models.ExportFormatVCard: "text/vcard; charset=utf-8",
+}
+
+// ExportMembers godoc
+// @Summary      Export member directory
+// @Description  Stream the members matching the filters as CSV, XLSX or vCard 4.0. q matches like the global
+// @Description  search. Anonymous requests get a public export: active members only, without the fields each
+// @Description  shop marked as private. Signed-in admins get every member and field.
+// @Tags         icom-members
+// @Produce      text/csv
+// @Produce      application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce      text/vcard
+// @Param        id path string true "iCom ID"
+// @Param        format query string false "csv (default), xlsx or vcf"
+// @Param        columns query string false "Comma-separated columns (ignored for vcf)"
+// @Param        q query string false "Search query"
+// @Param        industry query string false "Industry"
+// @Param        sub_industry query string false "Sub-industry"
+// @Param        province query string false "Province"
+// @Param        district query string false "District"
+// @Param        ward query string false "Ward"
+// @Param        status query string false "Membership status"
+// @Param        rank query string false "Rank"
+// @Success      200  {string}  string
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/members/export [get]
+func ExportMembers(c *gin.Context) {
+	icomID := c.Param("id")
+
+	authenticated, err := middleware.IsAuthenticated(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	req := models.MemberExportRequest{
+		Filter: models.FilterMembersRequest{
+			Query:       c.Query("q"),
+			Industry:    c.Query("industry"),
+			SubIndustry: c.Query("sub_industry"),
+			Province:    c.Query("province"),
+			District:    c.Query("district"),
+			Ward:        c.Query("ward"),
+			Status:      c.Query("status"),
+			Rank:        c.Query("rank"),
+		},
+		Format: strings.ToLower(c.Query("format")),
+		Public: !authenticated,
+	}
+	if columns := c.Query("columns"); columns != "" {
+		for _, col := range strings.Split(columns, ",") {
+			if col = strings.TrimSpace(col); col != "" {
+				req.Columns = append(req.Columns, col)
+			}
+		}
+	}
+
+	service := services.NewMemberService()
+	if err := service.PrepareExport(c.Request.Context(), icomID, &req); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrIComNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrExportFormat), errors.Is(err, services.ErrExportColumn):
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", exportContentTypes[req.Format])
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="icom-%s-members.%s"`, icomID, req.Format))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent, so a failure part way can only cut the download short
+	if _, err := service.ExportMembers(c.Request.Context(), icomID, req, c.Writer); err != nil {
+		c.Error(err)
+	}
+}
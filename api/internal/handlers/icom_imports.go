@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+	"i-manage/internal/spreadsheet"
+)
+
+// importMaxFileSize bounds uploaded member files
+const importMaxFileSize = 10 << 20
+
+// importErrorStatus maps member import errors to HTTP status codes
+func importErrorStatus(err error) int {
+	var mappingErr *services.ImportMappingError
+	switch {
+	case errors.Is(err, services.ErrImportNotFound),
+		errors.Is(err, services.ErrIComNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &mappingErr),
+		errors.Is(err, services.ErrImportEmpty),
+		errors.Is(err, services.ErrImportOnDuplicate),
+		errors.Is(err, spreadsheet.ErrUnsupportedFormat):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrImportTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ImportMembers godoc
+// @Summary      Bulk import members
+// @Description  Upload a CSV or XLSX member list. Columns are mapped onto AddMemberRequest fields by header
+// @Description  name, or explicitly with mapping ({"name": "Shop name", "lat": "Latitude"}). With dry_run=true
+// @Description  every row is validated and a preview with per-row errors is returned. Otherwise the import runs
+// @Description  in the background (202); uploading the same file again returns the existing job (200).
+// @Tags         icom-imports
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        file formData file true "CSV or XLSX file"
+// @Param        mapping formData string false "JSON object: field -> column header"
+// @Param        on_duplicate formData string false "skip (default), link or create"
+// @Param        dry_run formData bool false "Validate only"
+// @Success      200  {object}  models.ImportPreview
+// @Success      202  {object}  models.ImportJob
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      413  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/imports [post]
+// @Security     CookieAuth
+func ImportMembers(c *gin.Context) {
+	icomID := c.Param("id")
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, importMaxFileSize+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if fileHeader.Size > importMaxFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is larger than 10 MB"})
+		return
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := models.ImportOptions{OnDuplicate: c.PostForm("on_duplicate")}
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &opts.Mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of field to column header"})
+			return
+		}
+	}
+
+	service := services.NewImportService()
+	if dryRun, _ := strconv.ParseBool(c.PostForm("dry_run")); dryRun {
+		preview, err := service.Preview(c.Request.Context(), icomID, fileHeader.Filename, data, opts)
+		if err != nil {
+			c.JSON(importErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, preview)
+		return
+	}
+
+	job, existing, err := service.StartImport(c.Request.Context(), icomID, fileHeader.Filename, data, opts)
+	if err != nil {
+		c.JSON(importErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if existing {
+		c.JSON(http.StatusOK, job)
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListImports godoc
+// @Summary      List member imports
+// @Description  List an iCom's import jobs, newest first
+// @Tags         icom-imports
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200  {object}  models.ImportJobList
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/imports [get]
+// @Security     CookieAuth
+func ListImports(c *gin.Context) {
+	icomID := c.Param("id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewImportService()
+	response, err := service.ListImports(c.Request.Context(), icomID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetImport godoc
+// @Summary      Member import progress
+// @Description  Get the status and progress counters of an import job
+// @Tags         icom-imports
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        import_id path string true "Import job ID"
+// @Success      200  {object}  models.ImportJob
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/imports/{import_id} [get]
+// @Security     CookieAuth
+func GetImport(c *gin.Context) {
+	icomID := c.Param("id")
+	jobID := c.Param("import_id")
+
+	service := services.NewImportService()
+	job, err := service.GetImport(c.Request.Context(), icomID, jobID)
+	if err != nil {
+		c.JSON(importErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// DownloadImportErrors godoc
+// @Summary      Import error report
+// @Description  Download the rows that were not imported as CSV: the original columns followed by the
+// @Description  failing field and message, so the file can be fixed and uploaded again
+// @Tags         icom-imports
+// @Produce      text/csv
+// @Param        id path string true "iCom ID"
+// @Param        import_id path string true "Import job ID"
+// @Success      200  {string}  string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/imports/{import_id}/errors [get]
+// @Security     CookieAuth
+func DownloadImportErrors(c *gin.Context) {
+	icomID := c.Param("id")
+	jobID := c.Param("import_id")
+
+	service := services.NewImportService()
+	headers, rowErrs, err := service.ImportErrors(c.Request.Context(), icomID, jobID)
+	if err != nil {
+		c.JSON(importErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-errors.csv"`, jobID))
+	c.Status(http.StatusOK)
+
+	// BOM so Excel opens the UTF-8 report correctly
+	c.Writer.WriteString("\xef\xbb\xbf")
+	w := csv.NewWriter(c.Writer)
+	w.Write(append(append([]string{"row"}, headers...), "error_field", "error_message"))
+	for _, e := range rowErrs {
+		values := make([]string, len(headers))
+		copy(values, e.Values)
+		w.Write(append(append([]string{strconv.Itoa(e.Row)}, values...), e.Field, e.Message))
+	}
+	w.Flush()
+}
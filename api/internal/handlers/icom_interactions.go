@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/middleware"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+)
+
+// GetInteractionAnomalies godoc
+// @Summary      Interaction anomaly report
+// @Description  List shops whose counted interactions on a day reached min_score and factor times their
+// @Description  average over the previous 7 days, or whose blocked (duplicate or rate-limited) attempts
+// @Description  reached min_score. Includes the score held back from flagged sources.
+// @Tags         icom-interactions
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        date query string false "Day (YYYY-MM-DD), defaults to today"
+// @Param        factor query number false "Spike factor over the baseline" default(3)
+// @Param        min_score query number false "Minimum score or blocked attempts" default(20)
+// @Success      200  {object}  models.InteractionAnomalyReport
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/interactions/anomalies [get]
+// @Security     CookieAuth
+func GetInteractionAnomalies(c *gin.Context) {
+	icomID := c.Param("id")
+
+	date := time.Now()
+	if d := c.Query("date"); d != "" {
+		parsed, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+			return
+		}
+		// Noon keeps the day the same in any statistics time zone
+		date = parsed.Add(12 * time.Hour)
+	}
+	factor, _ := strconv.ParseFloat(c.Query("factor"), 64)
+	minScore, _ := strconv.ParseFloat(c.Query("min_score"), 64)
+
+	service := services.NewInteractionService()
+	report, err := service.AnomalyReport(c.Request.Context(), icomID, date, factor, minScore)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// AdjustInteractionScore godoc
+// @Summary      Reset or adjust interaction score
+// @Description  reset sets the shop's interaction score to 0 and drops its held score, adjust adds delta
+// @Description  and release moves the held score into the rankings. Every change is written to the audit trail.
+// @Tags         icom-interactions
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        shop_id path string true "Shop ID"
+// @Param        request body models.AdjustScoreRequest true "Adjustment"
+// @Success      200  {object}  models.ScoreAuditEntry
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/interactions/{shop_id}/adjust [post]
+// @Security     CookieAuth
+func AdjustInteractionScore(c *gin.Context) {
+	icomID := c.Param("id")
+	shopID := c.Param("shop_id")
+
+	var req models.AdjustScoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewInteractionService()
+	entry, err := service.AdjustScore(c.Request.Context(), icomID, shopID, req, middleware.UserEmail(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrShopNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrAdjustDeltaZero):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrNothingToRelease):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// ListScoreAudit godoc
+// @Summary      Score audit trail
+// @Description  List interaction score adjustments, newest first
+// @Tags         icom-interactions
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200  {object}  models.ScoreAuditList
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/interactions/audit [get]
+// @Security     CookieAuth
+func ListScoreAudit(c *gin.Context) {
+	icomID := c.Param("id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewInteractionService()
+	response, err := service.ScoreAudit(c.Request.Context(), icomID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ReconcileLikes godoc
+// @Summary      Reconcile like scores
+// @Description  Compare the like leaderboards (total and per source) with the like ledger. GET only reports
+// @Description  shops that drifted; POST also rewrites their all-time scores to the ledger counts. Scores
+// @Description  earned before the ledger existed have no records and are reset by POST.
+// @Tags         icom-interactions
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Success      200  {object}  models.LikeReconcileReport
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/likes/reconcile [get]
+// @Router       /icom/{id}/likes/reconcile [post]
+// @Security     CookieAuth
+func ReconcileLikes(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewIComService()
+	report, err := service.ReconcileLikes(c.Request.Context(), icomID, c.Request.Method == http.MethodPost)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrIComNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
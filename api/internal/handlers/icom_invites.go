@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+)
+
+// inviteErrorStatus maps invite errors to HTTP status codes
+func inviteErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInviteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInviteExpired),
+		errors.Is(err, services.ErrInviteRevoked),
+		errors.Is(err, services.ErrInviteExhausted):
+		return http.StatusGone
+	case errors.Is(err, services.ErrInviteShopRequired):
+		return http.StatusBadRequest
+	default:
+		return applicationErrorStatus(err)
+	}
+}
+
+// CreateInvite godoc
+// @Summary      Create invite
+// @Description  Create an invitation link and join code with an expiry, usage limit and default rank/role
+// @Tags         icom-invites
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.CreateInviteRequest true "Invite settings"
+// @Success      201  {object}  models.Invite
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/invites [post]
+// @Security     CookieAuth
+func CreateInvite(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewInviteService()
+	invite, err := service.CreateInvite(c.Request.Context(), icomID, req)
+	if err != nil {
+		c.JSON(inviteErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+// ListInvites godoc
+// @Summary      List invites
+// @Description  List an iCom's invites, newest first, including expired and revoked ones
+// @Tags         icom-invites
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200  {object}  models.InviteListResponse
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/invites [get]
+// @Security     CookieAuth
+func ListInvites(c *gin.Context) {
+	icomID := c.Param("id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewInviteService()
+	response, err := service.ListInvites(c.Request.Context(), icomID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetInvite godoc
+// @Summary      Get invite
+// @Description  Get an invite with the shops that joined through it
+// @Tags         icom-invites
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        code path string true "Invite code"
+// @Success      200  {object}  models.Invite
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/invites/{code} [get]
+// @Security     CookieAuth
+func GetInvite(c *gin.Context) {
+	icomID := c.Param("id")
+	code := c.Param("code")
+
+	service := services.NewInviteService()
+	invite, err := service.GetInvite(c.Request.Context(), icomID, code)
+	if err != nil {
+		c.JSON(inviteErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invite)
+}
+
+// RevokeInvite godoc
+// @Summary      Revoke invite
+// @Description  Stop an invite from being used; shops that already joined keep their membership
+// @Tags         icom-invites
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        code path string true "Invite code"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/invites/{code} [delete]
+// @Security     CookieAuth
+func RevokeInvite(c *gin.Context) {
+	icomID := c.Param("id")
+	code := c.Param("code")
+
+	service := services.NewInviteService()
+	if err := service.RevokeInvite(c.Request.Context(), icomID, code); err != nil {
+		c.JSON(inviteErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked successfully"})
+}
+
+// GetInviteInfo godoc
+// @Summary      Open invite
+// @Description  Public details of an invitation link or join code, used to pre-fill the join form
+// @Tags         invites
+// @Accept       json
+// @Produce      json
+// @Param        code path string true "Invite code"
+// @Success      200  {object}  models.InviteInfo
+// @Failure      404  {object}  map[string]string
+// @Failure      410  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /invite/{code} [get]
+func GetInviteInfo(c *gin.Context) {
+	code := c.Param("code")
+
+	service := services.NewInviteService()
+	info, err := service.GetInviteInfo(c.Request.Context(), code)
+	if err != nil {
+		c.JSON(inviteErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// JoinByInvite godoc
+// @Summary      Join through invite
+// @Description  Join the invite's iCom with an existing shop (shop_id) or a new one (shop). The membership gets
+// @Description  the invite's rank and role and follows the iCom's approval, capacity and waitlist rules.
+// @Tags         invites
+// @Accept       json
+// @Produce      json
+// @Param        code path string true "Invite code"
+// @Param        request body models.JoinByInviteRequest true "Shop to join with"
+// @Success      201  {object}  models.MembershipApplication
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]interface{}
+// @Failure      410  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]string
+// @Router       /invite/{code}/join [post]
+// @Security     CookieAuth
+func JoinByInvite(c *gin.Context) {
+	code := c.Param("code")
+
+	var req models.JoinByInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewInviteService()
+	application, err := service.Join(c.Request.Context(), code, req)
+	if err != nil {
+		if respondRuleViolation(c, err) || respondDuplicateShops(c, err) {
+			return
+		}
+		c.JSON(inviteErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, application)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/live"
+)
+
+const (
+	liveHeartbeat    = 15 * time.Second
+	liveReplayLimit  = 500
+	liveRetryMillis  = 3000
+	liveWriteTimeout = 10 * time.Second
+)
+
+// writeLiveMessage writes one SSE event
+func writeLiveMessage(c *gin.Context, msg live.Message) error {
+	_, err := fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, msg.Data)
+	return err
+}
+
+// StreamLive godoc
+// @Summary      Live iCom updates
+// @Description  Server-Sent Events stream of leaderboard deltas, new members and like counts.
+// @Description  Events are named leaderboard, member.joined and likes. Reconnect with the
+// @Description  Last-Event-ID header (or last_event_id query) to resume after a disconnect.
+// @Tags         icom
+// @Produce      text/event-stream
+// @Param        id path string true "iCom ID"
+// @Param        Last-Event-ID header string false "Resume after this event ID"
+// @Param        last_event_id query string false "Resume after this event ID (for clients that cannot set headers)"
+// @Success      200  {string}  string
+// @Failure      503  {object}  map[string]string
+// @Router       /icom/{id}/live [get]
+func StreamLive(c *gin.Context) {
+	icomID := c.Param("id")
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+
+	// Subscribe before replaying so nothing published in between is lost
+	sub, err := live.DefaultHub.Subscribe(icomID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	defer live.DefaultHub.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	rc := http.NewResponseController(c.Writer)
+	flush := func() error {
+		if err := rc.Flush(); err != nil {
+			return err
+		}
+		return rc.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+	}
+
+	rc.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", liveRetryMillis)
+
+	if lastID != "" {
+		missed, err := live.History(c.Request.Context(), icomID, lastID, liveReplayLimit)
+		if err == nil {
+			for _, msg := range missed {
+				if writeLiveMessage(c, msg) != nil {
+					return
+				}
+				lastID = msg.ID
+			}
+		}
+	}
+	if flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-sub.Done():
+			// Too slow or shutting down; the client resumes with Last-Event-ID
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil || flush() != nil {
+				return
+			}
+		case msg := <-sub.C:
+			if lastID != "" && !live.After(msg.ID, lastID) {
+				// Already sent during replay
+				continue
+			}
+			if writeLiveMessage(c, msg) != nil || flush() != nil {
+				return
+			}
+			lastID = msg.ID
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
 
@@ -9,9 +11,39 @@ import (
 	"i-manage/internal/services"
 )
 
+// respondRuleViolation writes a 422 listing the broken membership rules and
+// reports whether err was a rule violation
+func respondRuleViolation(c *gin.Context, err error) bool {
+	var ruleErr *services.MembershipRuleError
+	if !errors.As(err, &ruleErr) {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":      err.Error(),
+		"violations": ruleErr.Violations,
+	})
+	return true
+}
+
+// respondDuplicateShops writes a 409 listing the existing shops that may be
+// the one being created and reports whether err was a duplicate error
+func respondDuplicateShops(c *gin.Context, err error) bool {
+	var dupErr *services.DuplicateShopError
+	if !errors.As(err, &dupErr) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error":      err.Error(),
+		"candidates": dupErr.Candidates,
+	})
+	return true
+}
+
 // AddMember godoc
 // @Summary      Add Member to iCom
-// @Description  Add a shop to iCom (creates new iShop in this iCom with location details)
+// @Description  Add a shop to iCom. Pass shop_id to link an existing iShop with its own rank, role and status;
+// @Description  otherwise a new iShop is created from the profile fields. Creating a shop whose phone, email
+// @Description  or nearby name matches existing shops fails with 409 and the candidates, unless ignore_duplicates is set.
 // @Tags         icom-members
 // @Accept       json
 // @Produce      json
@@ -19,6 +51,9 @@ import (
 // @Param        request body models.AddMemberRequest true "Shop/Member details"
 // @Success      201  {object}  map[string]string
 // @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]interface{}
+// @Failure      422  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]string
 // @Router       /icom/{id}/members [post]
 // @Security     CookieAuth
@@ -34,7 +69,13 @@ func AddMember(c *gin.Context) {
 	service := services.NewMemberService()
 	shopID, err := service.AddMember(c.Request.Context(), icomID, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if respondRuleViolation(c, err) {
+			return
+		}
+		if respondDuplicateShops(c, err) {
+			return
+		}
+		c.JSON(applicationErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -203,6 +244,7 @@ func GetMemberDetail(c *gin.Context) {
 // @Success      200  {object}  map[string]string
 // @Failure      400  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]string
 // @Router       /icom/{id}/members/{shop_id}/status [put]
 // @Security     CookieAuth
@@ -218,8 +260,13 @@ func UpdateMemberStatus(c *gin.Context) {
 
 	service := services.NewMemberService()
 	if err := service.UpdateMemberStatus(c.Request.Context(), icomID, shopID, req); err != nil {
+		if respondRuleViolation(c, err) {
+			return
+		}
 		if err.Error() == "membership not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, services.ErrTierUndefined) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
@@ -269,32 +316,56 @@ func UpdateMemberOrder(c *gin.Context) {
 
 // IncrementInteractions godoc
 // @Summary      Increment Interactions
-// @Description  Increment interaction score for ranking
+// @Description  Record an interaction for ranking. A visitor and client IP are counted once per shop within the
+// @Description  de-duplication window; a repeat from either is not counted. Sources over the rate limit get 429 and are
+// @Description  flagged for a while; interactions from flagged sources are held or discounted.
 // @Tags         icom-members
 // @Accept       json
 // @Produce      json
 // @Param        id path string true "iCom ID"
 // @Param        shop_id path string true "Shop ID"
-// @Success      200  {object}  map[string]string
+// @Param        request body models.InteractionRequest false "Visitor"
+// @Success      200  {object}  models.InteractionResult
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /icom/{id}/interactions/{shop_id} [post]
-// @Security     CookieAuth
 func IncrementInteractions(c *gin.Context) {
 	icomID := c.Param("id")
 	shopID := c.Param("shop_id")
 
-	service := services.NewIComService()
-	if err := service.IncrementInteractions(c.Request.Context(), icomID, shopID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	var req models.InteractionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	service := services.NewInteractionService()
+	result, err := service.RecordInteraction(c.Request.Context(), icomID, shopID, req.VisitorID, c.ClientIP())
+	if err != nil {
+		var rateErr *services.RateLimitError
+		switch {
+		case errors.As(err, &rateErr):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateErr.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrShopNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Interaction incremented"})
+	c.JSON(http.StatusOK, result)
 }
 
 // IncrementLikes (ToggleLike) godoc
 // @Summary      Toggle Like (Like/Unlike)
-// @Description  Toggle like status for a shop by a visitor (guest support)
+// @Description  Toggle like status for a shop by a visitor (guest support). Likes are recorded per iCom
+// @Description  in a durable ledger, so a second toggle by the same visitor always takes the like back.
 // @Tags         icom-members
 // @Accept       json
 // @Produce      json
@@ -330,7 +401,7 @@ func IncrementLikes(c *gin.Context) {
 
 // CheckLikeStatus godoc
 // @Summary      Check Like Status
-// @Description  Check if a visitor has liked a shop
+// @Description  Check if a visitor has liked a shop in the iCom
 // @Tags         icom-members
 // @Accept       json
 // @Produce      json
@@ -342,6 +413,7 @@ func IncrementLikes(c *gin.Context) {
 // @Failure      500  {object}  map[string]string
 // @Router       /icom/{id}/likes/{shop_id}/status [get]
 func CheckLikeStatus(c *gin.Context) {
+	icomID := c.Param("id")
 	shopID := c.Param("shop_id")
 	visitorID := c.Query("visitor_id")
 
@@ -351,7 +423,7 @@ func CheckLikeStatus(c *gin.Context) {
 	}
 
 	service := services.NewIComService()
-	liked, err := service.CheckLikeStatus(c.Request.Context(), shopID, visitorID)
+	liked, err := service.CheckLikeStatus(c.Request.Context(), icomID, shopID, visitorID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -396,14 +468,19 @@ func GeoSearch(c *gin.Context) {
 
 // GetLeaderboard godoc
 // @Summary      Get Leaderboard
-// @Description  Get top shops by ranking type
+// @Description  Get top shops by ranking type, all-time or over a period: today, this week (since Monday),
+// @Description  this month or the last 30 days. With scoring=decay older days within the period count less,
+// @Description  halving every half_life days.
 // @Tags         icom-members
 // @Accept       json
 // @Produce      json
 // @Param        id path string true "iCom ID"
 // @Param        type query string true "Ranking type (interactions or likes)"
 // @Param        source query string false "Source filter for likes (icom or ishop)"
-// @Param        limit query int false "Number of results" default(10)
+// @Param        period query string false "all (default), today, week, month or 30d"
+// @Param        scoring query string false "total (default) or decay"
+// @Param        half_life query int false "Decay half-life in whole days, 1 to 30" default(7)
+// @Param        limit query int false "Number of results (1 to 100)" default(10)
 // @Success      200  {object}  models.LeaderboardResponse
 // @Failure      400  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
@@ -411,26 +488,104 @@ func GeoSearch(c *gin.Context) {
 // @Security     CookieAuth
 func GetLeaderboard(c *gin.Context) {
 	icomID := c.Param("id")
-	rankType := c.Query("type")
-	source := c.Query("source")
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	halfLife, _ := strconv.ParseFloat(c.Query("half_life"), 64)
+
+	req := models.LeaderboardRequest{
+		Type:         c.Query("type"),
+		Source:       c.Query("source"),
+		Period:       c.DefaultQuery("period", models.LeaderboardPeriodAll),
+		Scoring:      c.DefaultQuery("scoring", models.LeaderboardScoringTotal),
+		HalfLifeDays: halfLife,
+		Limit:        limit,
+	}
 
-	if rankType != "interactions" && rankType != "likes" {
+	if req.Type != "interactions" && req.Type != "likes" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ranking type. Use 'interactions' or 'likes'"})
 		return
 	}
 
 	service := services.NewIComService()
-	entries, err := service.GetLeaderboard(c.Request.Context(), icomID, rankType, source, limit)
+	entries, err := service.GetPeriodLeaderboard(c.Request.Context(), icomID, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrLeaderboardPeriod) || errors.Is(err, services.ErrLeaderboardScoring) ||
+			errors.Is(err, services.ErrLeaderboardSource) || errors.Is(err, services.ErrLeaderboardHalfLife) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
 	response := models.LeaderboardResponse{
-		Type:    rankType,
+		Type:    req.Type,
+		Period:  req.Period,
+		Scoring: req.Scoring,
 		Entries: entries,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
+
+// GetMemberViolations godoc
+// @Summary      Membership rule violations
+// @Description  List members that break the iCom's current industry, area or capacity rules,
+// @Description  e.g. after the rules were tightened. Over-capacity is attributed to the latest joiners.
+// @Tags         icom-members
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Success      200  {object}  models.ViolationReport
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/members/violations [get]
+// @Security     CookieAuth
+func GetMemberViolations(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewMemberService()
+	report, err := service.ViolationReport(c.Request.Context(), icomID)
+	if err != nil {
+		if errors.Is(err, services.ErrIComNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// CheckDuplicateShops godoc
+// @Summary      Find possible duplicate shops
+// @Description  Suggest existing shops with the same phone or email, or a similar name within 200 m,
+// @Description  before creating a new member. Candidates already in this iCom are flagged.
+// @Tags         icom-members
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.DuplicateCheckRequest true "Shop to be created"
+// @Success      200  {object}  []models.DuplicateCandidate
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/members/duplicates [post]
+// @Security     CookieAuth
+func CheckDuplicateShops(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.DuplicateCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewIShopService()
+	candidates, err := service.FindDuplicates(c.Request.Context(), icomID, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, candidates)
+}
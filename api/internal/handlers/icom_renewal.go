@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+)
+
+// renewalErrorStatus maps renewal service errors to HTTP status codes
+func renewalErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrIComNotFound):
+		return http.StatusNotFound
+	case err.Error() == "membership not found":
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrRenewalDisabled), errors.Is(err, services.ErrRenewalNotAllowed):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetRenewalPolicy godoc
+// @Summary      Get the renewal policy
+// @Description  Get how long memberships of an iCom last, whether they renew automatically and when members are
+// @Description  reminded. A term of 0 months means memberships never expire.
+// @Tags         icom-renewal
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Success      200  {object}  models.RenewalPolicy
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/renewal [get]
+// @Security     CookieAuth
+func GetRenewalPolicy(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewMemberService()
+	policy, err := service.GetRenewalPolicy(c.Request.Context(), icomID)
+	if err != nil {
+		c.JSON(renewalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// SetRenewalPolicy godoc
+// @Summary      Set the renewal policy
+// @Description  Replace the renewal policy of an iCom. When memberships start to expire, current members get the
+// @Description  end of their running term, counted from the day they joined. Setting the term to 0 clears every
+// @Description  expiry date.
+// @Tags         icom-renewal
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.RenewalPolicy true "Renewal policy"
+// @Success      200  {object}  models.RenewalPolicy
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/renewal [put]
+// @Security     CookieAuth
+func SetRenewalPolicy(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.RenewalPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewMemberService()
+	policy, err := service.SetRenewalPolicy(c.Request.Context(), icomID, req)
+	if err != nil {
+		c.JSON(renewalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// RunMembershipExpiry godoc
+// @Summary      Run the expiry scheduler
+// @Description  Send due expiry reminders and lapse or renew ended memberships now instead of waiting for the
+// @Description  hourly run
+// @Tags         icom-renewal
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Success      200  {object}  models.ExpiryRun
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/renewal/run [post]
+// @Security     CookieAuth
+func RunMembershipExpiry(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewMemberService()
+	run, err := service.ProcessExpiry(c.Request.Context(), icomID)
+	if err != nil {
+		c.JSON(renewalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// RenewMembership godoc
+// @Summary      Renew a membership
+// @Description  Extend a membership by the given months, or by the policy term. A running membership is extended
+// @Description  from its expiry date; an expired one from today and becomes ACTIVE again if the iCom's membership
+// @Description  rules allow it.
+// @Tags         icom-renewal
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        shop_id path string true "Shop ID"
+// @Param        request body models.RenewMembershipRequest false "Renewal"
+// @Success      200  {object}  models.MembershipRenewal
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/members/{shop_id}/renew [post]
+// @Security     CookieAuth
+func RenewMembership(c *gin.Context) {
+	icomID := c.Param("id")
+	shopID := c.Param("shop_id")
+
+	var req models.RenewMembershipRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	service := services.NewMemberService()
+	renewal, err := service.RenewMembership(c.Request.Context(), icomID, shopID, req.Months)
+	if err != nil {
+		if respondRuleViolation(c, err) {
+			return
+		}
+		c.JSON(renewalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, renewal)
+}
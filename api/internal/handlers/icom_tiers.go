@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+)
+
+// tierErrorStatus maps tier service errors to HTTP status codes
+func tierErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrIComNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrTierInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTierInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ListTiers godoc
+// @Summary      List membership tiers
+// @Description  List the membership tiers of an iCom, lowest first, with their benefits and promotion rules.
+// @Description  An iCom that has not defined tiers has a single MEMBER tier.
+// @Tags         icom-tiers
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Success      200  {array}   models.MembershipTier
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/tiers [get]
+func ListTiers(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewMemberService()
+	tiers, err := service.GetTiers(c.Request.Context(), icomID)
+	if err != nil {
+		c.JSON(tierErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tiers)
+}
+
+// SetTiers godoc
+// @Summary      Set membership tiers
+// @Description  Replace the membership tiers of an iCom, lowest first. The first tier is the base tier new members
+// @Description  get. Tiers with a promotion rule are assigned automatically by the tier evaluator; the others are
+// @Description  assigned by hand. A tier still held by members cannot be dropped.
+// @Tags         icom-tiers
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.SetTiersRequest true "Tiers, lowest first"
+// @Success      200  {array}   models.MembershipTier
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/tiers [put]
+// @Security     CookieAuth
+func SetTiers(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.SetTiersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewMemberService()
+	tiers, err := service.SetTiers(c.Request.Context(), icomID, req.Tiers)
+	if err != nil {
+		c.JSON(tierErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tiers)
+}
+
+// EvaluateTiers godoc
+// @Summary      Evaluate membership tiers
+// @Description  Move active members between the automatic tiers now instead of waiting for the hourly evaluation.
+// @Description  With dry_run the changes are only reported.
+// @Tags         icom-tiers
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        dry_run query bool false "Report changes without applying them"
+// @Success      200  {object}  models.TierEvaluation
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/tiers/evaluate [post]
+// @Security     CookieAuth
+func EvaluateTiers(c *gin.Context) {
+	icomID := c.Param("id")
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+	service := services.NewMemberService()
+	result, err := service.EvaluateTiers(c.Request.Context(), icomID, dryRun)
+	if err != nil {
+		c.JSON(tierErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ListTierAudit godoc
+// @Summary      Tier audit trail
+// @Description  List the rank changes made by the tier evaluator, newest first
+// @Tags         icom-tiers
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200  {object}  models.TierChangeList
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/tiers/audit [get]
+// @Security     CookieAuth
+func ListTierAudit(c *gin.Context) {
+	icomID := c.Param("id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewMemberService()
+	response, err := service.TierAudit(c.Request.Context(), icomID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/models"
+	"i-manage/internal/services"
+)
+
+// webhookErrorStatus maps webhook service errors to HTTP status codes
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound), errors.Is(err, services.ErrDeliveryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidWebhookEvent), errors.Is(err, services.ErrWebhookURL):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// CreateWebhook godoc
+// @Summary      Create Webhook
+// @Description  Register a webhook that receives member and like events. The secret is only returned here.
+// @Description  The URL must be https on a public host; loopback, private and link-local addresses are refused.
+// @Tags         icom-webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        request body models.CreateWebhookRequest true "Webhook details"
+// @Success      201  {object}  models.Webhook
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/webhooks [post]
+// @Security     CookieAuth
+func CreateWebhook(c *gin.Context) {
+	icomID := c.Param("id")
+
+	var req models.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewWebhookService()
+	hook, err := service.CreateWebhook(c.Request.Context(), icomID, req)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, hook)
+}
+
+// ListWebhooks godoc
+// @Summary      List Webhooks
+// @Description  Get all webhooks of an iCom
+// @Tags         icom-webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Success      200  {object}  []models.Webhook
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/webhooks [get]
+// @Security     CookieAuth
+func ListWebhooks(c *gin.Context) {
+	icomID := c.Param("id")
+
+	service := services.NewWebhookService()
+	hooks, err := service.ListWebhooks(c.Request.Context(), icomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if hooks == nil {
+		hooks = []models.Webhook{}
+	}
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+// GetWebhook godoc
+// @Summary      Get Webhook
+// @Description  Get a webhook of an iCom
+// @Tags         icom-webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        webhook_id path string true "Webhook ID"
+// @Success      200  {object}  models.Webhook
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/webhooks/{webhook_id} [get]
+// @Security     CookieAuth
+func GetWebhook(c *gin.Context) {
+	icomID := c.Param("id")
+	webhookID := c.Param("webhook_id")
+
+	service := services.NewWebhookService()
+	hook, err := service.GetWebhook(c.Request.Context(), icomID, webhookID)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+// UpdateWebhook godoc
+// @Summary      Update Webhook
+// @Description  Update a webhook's URL, event filter, secret, thresholds or active flag
+// @Tags         icom-webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        webhook_id path string true "Webhook ID"
+// @Param        request body models.UpdateWebhookRequest true "Update details"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/webhooks/{webhook_id} [put]
+// @Security     CookieAuth
+func UpdateWebhook(c *gin.Context) {
+	icomID := c.Param("id")
+	webhookID := c.Param("webhook_id")
+
+	var req models.UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewWebhookService()
+	if err := service.UpdateWebhook(c.Request.Context(), icomID, webhookID, req); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook updated successfully"})
+}
+
+// DeleteWebhook godoc
+// @Summary      Delete Webhook
+// @Description  Delete a webhook and its delivery log
+// @Tags         icom-webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        webhook_id path string true "Webhook ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/webhooks/{webhook_id} [delete]
+// @Security     CookieAuth
+func DeleteWebhook(c *gin.Context) {
+	icomID := c.Param("id")
+	webhookID := c.Param("webhook_id")
+
+	service := services.NewWebhookService()
+	if err := service.DeleteWebhook(c.Request.Context(), icomID, webhookID); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// PingWebhook godoc
+// @Summary      Ping Webhook
+// @Description  Send a signed ping event to the webhook immediately and return the delivery result
+// @Tags         icom-webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        webhook_id path string true "Webhook ID"
+// @Success      200  {object}  models.WebhookDelivery
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/webhooks/{webhook_id}/ping [post]
+// @Security     CookieAuth
+func PingWebhook(c *gin.Context) {
+	icomID := c.Param("id")
+	webhookID := c.Param("webhook_id")
+
+	service := services.NewWebhookService()
+	delivery, err := service.Ping(c.Request.Context(), icomID, webhookID)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// ListWebhookDeliveries godoc
+// @Summary      List Webhook Deliveries
+// @Description  Get the delivery log of a webhook, newest first
+// @Tags         icom-webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        webhook_id path string true "Webhook ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200  {object}  models.WebhookDeliveryList
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/webhooks/{webhook_id}/deliveries [get]
+// @Security     CookieAuth
+func ListWebhookDeliveries(c *gin.Context) {
+	icomID := c.Param("id")
+	webhookID := c.Param("webhook_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewWebhookService()
+	list, err := service.ListDeliveries(c.Request.Context(), icomID, webhookID, page, limit)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// ReplayWebhookDelivery godoc
+// @Summary      Replay Webhook Delivery
+// @Description  Queue a logged delivery to be sent again with the same payload
+// @Tags         icom-webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iCom ID"
+// @Param        webhook_id path string true "Webhook ID"
+// @Param        delivery_id path string true "Delivery ID"
+// @Success      202  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /icom/{id}/webhooks/{webhook_id}/deliveries/{delivery_id}/replay [post]
+// @Security     CookieAuth
+func ReplayWebhookDelivery(c *gin.Context) {
+	icomID := c.Param("id")
+	webhookID := c.Param("webhook_id")
+	deliveryID := c.Param("delivery_id")
+
+	service := services.NewWebhookService()
+	if err := service.ReplayDelivery(c.Request.Context(), icomID, webhookID, deliveryID); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued for replay"})
+}
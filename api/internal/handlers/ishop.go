@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"i-manage/internal/models"
@@ -73,6 +74,7 @@ func GetIShop(c *gin.Context) {
 // @Success      200  {object}  map[string]string
 // @Failure      400  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]string
 // @Router       /ishop/{id} [put]
 // @Security     CookieAuth
@@ -87,6 +89,9 @@ func UpdateIShop(c *gin.Context) {
 
 	service := services.NewIShopService()
 	if err := service.UpdateIShop(c.Request.Context(), id, req); err != nil {
+		if respondRuleViolation(c, err) {
+			return
+		}
 		if err.Error() == "iShop not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		} else {
@@ -148,3 +153,63 @@ func ListIShopMemberships(c *gin.Context) {
 
 	c.JSON(http.StatusOK, memberships)
 }
+
+// GetIShopLikes godoc
+// @Summary      iShop likes
+// @Description  Like counts per iCom and source, and the most recent likers across all iComs
+// @Tags         ishop
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iShop ID"
+// @Param        limit query int false "Recent likers to return" default(20)
+// @Success      200  {object}  models.IShopLikesResponse
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /ishop/{id}/likes [get]
+// @Security     CookieAuth
+func GetIShopLikes(c *gin.Context) {
+	id := c.Param("id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewIShopService()
+	likes, err := service.GetLikes(c.Request.Context(), id, limit)
+	if err != nil {
+		if err.Error() == "iShop not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, likes)
+}
+
+// ListIShopNotifications godoc
+// @Summary      List iShop notifications
+// @Description  Get the shop's notification inbox (e.g. application decisions), newest first
+// @Tags         ishop
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "iShop ID"
+// @Param        page query int false "Page number" default(1)
+// @Param        limit query int false "Items per page" default(20)
+// @Success      200  {object}  models.NotificationListResponse
+// @Failure      500  {object}  map[string]string
+// @Router       /ishop/{id}/notifications [get]
+// @Security     CookieAuth
+func ListIShopNotifications(c *gin.Context) {
+	id := c.Param("id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	service := services.NewNotificationService()
+	response, err := service.ListNotifications(c.Request.Context(), id, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
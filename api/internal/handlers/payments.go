@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"i-manage/internal/services"
+)
+
+// PaymentCallback godoc
+// @Summary      Payment provider callback
+// @Description  Called by a payment provider with the outcome of a checkout. The request is authenticated by the
+// @Description  provider's signature; repeated callbacks for a completed checkout are ignored.
+// @Tags         payments
+// @Accept       json
+// @Produce      json
+// @Param        provider path string true "Payment provider"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /payments/callback/{provider} [post]
+func PaymentCallback(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewDuesService()
+	if err := service.HandlePaymentCallback(c.Request.Context(), c.Param("provider"), c.Request.Header, body); err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Callback processed"})
+}
+
+// GetFakeCheckout godoc
+// @Summary      Fake gateway checkout
+// @Description  Show a checkout of the local fake payment gateway. Only available when PAYMENT_FAKE_GATEWAY is enabled.
+// @Tags         payments
+// @Produce      json
+// @Param        checkout_id path string true "Checkout ID"
+// @Success      200  {object}  models.Checkout
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /payments/fake/{checkout_id} [get]
+func GetFakeCheckout(c *gin.Context) {
+	service := services.NewDuesService()
+	checkout, err := service.GetCheckout(c.Request.Context(), c.Param("checkout_id"))
+	if err == nil && checkout.Provider != services.FakeGatewayName {
+		err = services.ErrCheckoutNotFound
+	}
+	if err != nil {
+		c.JSON(duesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, checkout)
+}
+
+// CompleteFakeCheckout godoc
+// @Summary      Complete fake gateway checkout
+// @Description  Pay a checkout of the local fake payment gateway, or fail it with status=failed. The gateway posts
+// @Description  a signed callback to the payment callback like a real provider would.
+// @Tags         payments
+// @Produce      json
+// @Param        checkout_id path string true "Checkout ID"
+// @Param        status query string false "Outcome" Enums(succeeded, failed) default(succeeded)
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      502  {object}  map[string]string
+// @Router       /payments/fake/{checkout_id} [post]
+func CompleteFakeCheckout(c *gin.Context) {
+	succeed := c.DefaultQuery("status", "succeeded") != "failed"
+	if err := services.CompleteFakeCheckout(c.Request.Context(), c.Param("checkout_id"), succeed); err != nil {
+		status := duesErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			// The callback itself failed
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Checkout completed"})
+}
@@ -0,0 +1,295 @@
+// Package hashcodec maps Go structs to and from Redis hashes using the
+// `redis:"field"` struct tags already carried by the models.
+//
+// Supported field types are strings, bools, signed/unsigned integers,
+// floats, time.Time (RFC3339) and pointers to any of these. Slices, maps
+// and nested structs are stored as JSON strings. Untagged fields and fields
+// tagged `redis:"-"` are ignored; untagged embedded structs are flattened.
+package hashcodec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// field describes one hash field of a struct
+type field struct {
+	name  string
+	index []int
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// fieldsOf returns the hash fields of a struct type, flattening embedded structs
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, hasTag := sf.Tag.Lookup("redis")
+		name := strings.Split(tag, ",")[0]
+
+		if sf.Anonymous && !hasTag {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for _, inner := range fieldsOf(ft) {
+					inner.index = append([]int{i}, inner.index...)
+					fields = append(fields, inner)
+				}
+			}
+			continue
+		}
+
+		if !sf.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, field{name: name, index: []int{i}})
+	}
+
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// structValue dereferences v and checks that it is a struct
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}, fmt.Errorf("hashcodec: nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("hashcodec: expected struct, got %s", rv.Type())
+	}
+	return rv, nil
+}
+
+// fieldByIndex walks an index path, returning false if it crosses a nil embedded pointer
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// Marshal encodes every tagged field of v into a map suitable for HSET
+func Marshal(v interface{}) (map[string]interface{}, error) {
+	return marshal(v, false)
+}
+
+// MarshalPartial encodes only the fields of v that are set: nil pointers,
+// slices and maps, empty strings, zero numbers and zero times are skipped.
+// Use it to build partial-update maps from request structs.
+func MarshalPartial(v interface{}) (map[string]interface{}, error) {
+	return marshal(v, true)
+}
+
+func marshal(v interface{}, partial bool) (map[string]interface{}, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]interface{})
+	for _, f := range fieldsOf(rv.Type()) {
+		fv, ok := fieldByIndex(rv, f.index)
+		if !ok {
+			continue
+		}
+		if partial && isEmpty(fv) {
+			continue
+		}
+		s, err := encode(fv)
+		if err != nil {
+			return nil, fmt.Errorf("hashcodec: field %s: %w", f.name, err)
+		}
+		out[f.name] = s
+	}
+	return out, nil
+}
+
+// isEmpty reports whether a value should be skipped by MarshalPartial
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map:
+		// A non-nil empty slice is an explicit "clear the list"
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+		return v.IsZero()
+	default:
+		return v.IsZero()
+	}
+}
+
+func encode(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	case reflect.Struct:
+		if v.Type() == timeType {
+			t := v.Interface().(time.Time)
+			if t.IsZero() {
+				return "", nil
+			}
+			return t.Format(time.RFC3339), nil
+		}
+	}
+
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Unmarshal decodes a hash (as returned by HGETALL) into the struct pointed to by v.
+// Fields missing from the hash keep their current value; empty strings decode
+// to the zero value of non-string fields. A field that fails to decode is left
+// unchanged, the remaining fields are still decoded and the first error is returned.
+func Unmarshal(data map[string]string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("hashcodec: Unmarshal requires a non-nil pointer")
+	}
+	rv, err := structValue(v)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, f := range fieldsOf(rv.Type()) {
+		raw, ok := data[f.name]
+		if !ok {
+			continue
+		}
+		fv := allocByIndex(rv, f.index)
+		if err := decode(raw, fv); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("hashcodec: field %s: %w", f.name, err)
+		}
+	}
+	return firstErr
+}
+
+// allocByIndex walks an index path, allocating nil embedded pointers on the way
+func allocByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func decode(raw string, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if raw == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.String && raw == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			// Counters written via HINCRBYFLOAT or float scores may carry a fraction
+			f, ferr := strconv.ParseFloat(raw, 64)
+			if ferr != nil {
+				return err
+			}
+			n = int64(f)
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Struct:
+		if v.Type() == timeType {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+	}
+
+	return json.Unmarshal([]byte(raw), v.Addr().Interface())
+}
@@ -0,0 +1,138 @@
+package hashcodec
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"i-manage/internal/models"
+)
+
+type address struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type base struct {
+	ID string `redis:"id"`
+}
+
+type sample struct {
+	base
+	Name     string            `redis:"name"`
+	Active   bool              `redis:"active"`
+	Count    int               `redis:"count"`
+	Score    float64           `redis:"score"`
+	Joined   time.Time         `redis:"joined"`
+	Tags     []string          `redis:"tags"`
+	Address  address           `redis:"address"`
+	Extra    map[string]string `redis:"extra"`
+	Optional *bool             `redis:"optional"`
+	Ignored  string            `redis:"-"`
+	Untagged string
+}
+
+func TestRoundTrip(t *testing.T) {
+	yes := true
+	in := sample{
+		base:     base{ID: "42"},
+		Name:     "Cafe",
+		Active:   true,
+		Count:    7,
+		Score:    10.75,
+		Joined:   time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:     []string{"fnb", "cafe"},
+		Address:  address{City: "HCM", Zip: "700000"},
+		Extra:    map[string]string{"k": "v"},
+		Optional: &yes,
+		Ignored:  "skip",
+		Untagged: "skip",
+	}
+
+	fields, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"id":       "42",
+		"name":     "Cafe",
+		"active":   "true",
+		"count":    "7",
+		"score":    "10.75",
+		"joined":   "2026-01-02T03:04:05Z",
+		"tags":     `["fnb","cafe"]`,
+		"address":  `{"city":"HCM","zip":"700000"}`,
+		"extra":    `{"k":"v"}`,
+		"optional": "true",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("Marshal mismatch\n got: %v\nwant: %v", fields, want)
+	}
+
+	raw := make(map[string]string, len(fields))
+	for k, v := range fields {
+		raw[k] = v.(string)
+	}
+
+	var out sample
+	if err := Unmarshal(raw, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	in.Ignored, in.Untagged = "", ""
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip mismatch\n got: %+v\nwant: %+v", out, in)
+	}
+}
+
+func TestMarshalPartialSkipsZeroValues(t *testing.T) {
+	no := false
+	req := struct {
+		Name     string   `redis:"name"`
+		Tags     []string `redis:"tags"`
+		Max      int      `redis:"max"`
+		Approval *bool    `redis:"approval"`
+		Email    string   `redis:"email"`
+		Areas    []string `redis:"areas"`
+	}{
+		Name:     "New name",
+		Approval: &no,
+		Areas:    []string{},
+	}
+
+	fields, err := MarshalPartial(req)
+	if err != nil {
+		t.Fatalf("MarshalPartial: %v", err)
+	}
+
+	want := map[string]interface{}{"name": "New name", "approval": "false", "areas": "[]"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got %v, want %v", fields, want)
+	}
+}
+
+func TestUnmarshalLenientValues(t *testing.T) {
+	var p models.IComProfile
+	err := Unmarshal(map[string]string{
+		"id":            "2000100101",
+		"maxMembers":    "50",
+		"totalMembers":  "",
+		"activeMembers": "3",
+	}, &p)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if p.ID != "2000100101" || p.MaxMembers != 50 || p.TotalMembers != 0 || p.ActiveMembers != 3 {
+		t.Errorf("unexpected profile: %+v", p)
+	}
+}
+
+func TestUnmarshalReportsBadField(t *testing.T) {
+	var p models.IComProfile
+	if err := Unmarshal(map[string]string{"maxMembers": "lots", "name": "Hội"}, &p); err == nil {
+		t.Errorf("expected error for non-numeric maxMembers")
+	}
+	if p.Name != "Hội" {
+		t.Errorf("expected remaining fields to decode, got name %q", p.Name)
+	}
+}
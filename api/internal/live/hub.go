@@ -0,0 +1,149 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"i-manage/internal/database"
+)
+
+const (
+	// bufferSize is how many undelivered messages a connection may hold
+	// before it is considered too slow and dropped
+	bufferSize = 64
+
+	// MaxConnsPerICom caps concurrent live connections per iCom on one instance
+	MaxConnsPerICom = 1000
+)
+
+// ErrTooManyConnections is returned when an iCom has reached MaxConnsPerICom
+var ErrTooManyConnections = errors.New("too many live connections")
+
+// Subscription is one client's view of an iCom's updates
+type Subscription struct {
+	C      <-chan Message
+	c      chan Message
+	done   chan struct{}
+	once   sync.Once
+	icomID string
+}
+
+// Done is closed when the subscription was dropped because the client fell
+// behind or the hub stopped. The client should reconnect with Last-Event-ID.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) drop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// Hub relays Pub/Sub messages to the subscriptions on this instance.
+// It implements workers.Worker.
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[string]map[*Subscription]struct{}
+}
+
+// DefaultHub is the hub used by the API server
+var DefaultHub = NewHub()
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{subs: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscribe registers a subscription for an iCom
+func (h *Hub) Subscribe(icomID string) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subs[icomID]) >= MaxConnsPerICom {
+		return nil, ErrTooManyConnections
+	}
+
+	c := make(chan Message, bufferSize)
+	sub := &Subscription{C: c, c: c, done: make(chan struct{}), icomID: icomID}
+	if h.subs[icomID] == nil {
+		h.subs[icomID] = make(map[*Subscription]struct{})
+	}
+	h.subs[icomID][sub] = struct{}{}
+	return sub, nil
+}
+
+// Unsubscribe removes a subscription
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs[sub.icomID], sub)
+	if len(h.subs[sub.icomID]) == 0 {
+		delete(h.subs, sub.icomID)
+	}
+	sub.drop()
+}
+
+// Dispatch hands a message to every subscription of its iCom without
+// blocking. Subscriptions whose buffer is full are dropped.
+func (h *Hub) Dispatch(msg Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs[msg.IComID] {
+		select {
+		case sub.c <- msg:
+		default:
+			sub.drop()
+		}
+	}
+}
+
+// dropAll ends every subscription, e.g. on shutdown
+func (h *Hub) dropAll() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, subs := range h.subs {
+		for sub := range subs {
+			sub.drop()
+		}
+	}
+}
+
+// Name returns the worker name
+func (h *Hub) Name() string {
+	return "live:hub"
+}
+
+// Run relays Pub/Sub messages until ctx is cancelled, then drops all
+// subscriptions so that open streams end
+func (h *Hub) Run(ctx context.Context) error {
+	ps := database.Rdb.PSubscribe(ctx, channelPrefix+"*")
+	defer ps.Close()
+
+	ch := ps.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			h.dropAll()
+			return ctx.Err()
+		case m, ok := <-ch:
+			if !ok {
+				return errors.New("live: pubsub channel closed")
+			}
+			var msg Message
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				log.Printf("live: bad message on %s: %v", m.Channel, err)
+				continue
+			}
+			if msg.IComID == "" {
+				msg.IComID = strings.TrimPrefix(m.Channel, channelPrefix)
+			}
+			h.Dispatch(msg)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package live fans real-time iCom updates out to Server-Sent Events clients.
+//
+// Every update is appended to a short per-iCom Redis Stream, which gives it a
+// resumable ID, and then published on a Pub/Sub channel so that every API
+// instance can push it to its own connected clients.
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/database"
+)
+
+// Message types pushed to clients
+const (
+	TypeLeaderboard  = "leaderboard"
+	TypeMemberJoined = "member.joined"
+	TypeLikes        = "likes"
+)
+
+const (
+	channelPrefix = "live:icom:"
+	historyLen    = 1000
+	historyTTL    = 24 * time.Hour
+)
+
+// Message is one update delivered to live clients
+type Message struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	IComID string          `json:"icom_id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func historyKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:live", icomID)
+}
+
+// Channel returns the Pub/Sub channel of an iCom
+func Channel(icomID string) string {
+	return channelPrefix + icomID
+}
+
+// Publish records an update in the iCom's history and broadcasts it to all
+// instances
+func Publish(ctx context.Context, icomID, typ string, data interface{}) (*Message, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key := historyKey(icomID)
+	id, err := database.Rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: historyLen,
+		Approx: true,
+		Values: map[string]interface{}{"type": typ, "data": string(raw)},
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{ID: id, Type: typ, IComID: icomID, Data: raw}
+	payload, _ := json.Marshal(msg)
+
+	pipe := database.Rdb.Pipeline()
+	pipe.Expire(ctx, key, historyTTL)
+	pipe.Publish(ctx, Channel(icomID), payload)
+	_, err = pipe.Exec(ctx)
+	return msg, err
+}
+
+// History returns up to count updates of an iCom published after lastID
+func History(ctx context.Context, icomID, lastID string, count int64) ([]Message, error) {
+	entries, err := database.Rdb.XRangeN(ctx, historyKey(icomID), "("+lastID, "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]Message, 0, len(entries))
+	for _, e := range entries {
+		typ, _ := e.Values["type"].(string)
+		data, _ := e.Values["data"].(string)
+		msgs = append(msgs, Message{ID: e.ID, Type: typ, IComID: icomID, Data: json.RawMessage(data)})
+	}
+	return msgs, nil
+}
+
+// After reports whether stream ID a is strictly greater than b. Malformed IDs
+// compare as zero.
+func After(a, b string) bool {
+	ams, aseq := parseID(a)
+	bms, bseq := parseID(b)
+	if ams != bms {
+		return ams > bms
+	}
+	return aseq > bseq
+}
+
+func parseID(id string) (uint64, uint64) {
+	msPart, seqPart, _ := strings.Cut(id, "-")
+	ms, _ := strconv.ParseUint(msPart, 10, 64)
+	seq, _ := strconv.ParseUint(seqPart, 10, 64)
+	return ms, seq
+}
@@ -0,0 +1,81 @@
+package live
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/database"
+)
+
+func TestAfter(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"2-0", "1-5", true},
+		{"1-5", "1-4", true},
+		{"1-4", "1-4", false},
+		{"10-0", "9-99", true},
+		{"1-0", "2-0", false},
+	}
+	for _, tc := range cases {
+		if got := After(tc.a, tc.b); got != tc.want {
+			t.Errorf("After(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub()
+	slow, _ := hub.Subscribe("1")
+	other, _ := hub.Subscribe("2")
+
+	for i := 0; i <= bufferSize; i++ {
+		hub.Dispatch(Message{IComID: "1", Type: TypeLikes})
+	}
+
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("expected the slow subscription to be dropped")
+	}
+	select {
+	case <-other.Done():
+		t.Fatal("subscription of another iCom should be unaffected")
+	default:
+	}
+
+	hub.Unsubscribe(slow)
+	hub.Unsubscribe(other)
+	if len(hub.subs) != 0 {
+		t.Errorf("expected no subscriptions left, got %d", len(hub.subs))
+	}
+}
+
+func TestPublishHistoryResume(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	prev := database.Rdb
+	database.Rdb = rdb
+	defer func() { database.Rdb = prev }()
+
+	ctx := context.Background()
+	first, err := Publish(ctx, "1", TypeLikes, map[string]int{"likes": 1})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if _, err := Publish(ctx, "1", TypeLikes, map[string]int{"likes": 2}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	missed, err := History(ctx, "1", first.ID, 10)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(missed) != 1 || string(missed[0].Data) != `{"likes":2}` {
+		t.Errorf("unexpected history after %s: %+v", first.ID, missed)
+	}
+}
@@ -5,9 +5,32 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"i-manage/internal/database"
 )
 
+// IsAuthenticated reports whether the request carries a valid session token.
+// Public endpoints use it to show more to signed-in admins.
+func IsAuthenticated(c *gin.Context) (bool, error) {
+	token, err := c.Cookie("token")
+	if err != nil || token == "" {
+		return false, nil
+	}
+	exists, err := database.Rdb.Exists(c, fmt.Sprintf("token:%s", token)).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists > 0, nil
+}
+
+// userEmailKey is the context key AuthMiddleware stores the signed-in email under
+const userEmailKey = "user_email"
+
+// UserEmail returns the email of the admin signed in on an authenticated route
+func UserEmail(c *gin.Context) string {
+	return c.GetString(userEmailKey)
+}
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. Retrieve Token from Cookie
@@ -18,23 +41,19 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// 2. Validate Token in Redis
-		// Check if key "token:<token>" exists
+		// Key "token:<token>" holds the signed-in email
 		tokenKey := fmt.Sprintf("token:%s", token)
-		exists, err := database.Rdb.Exists(c, tokenKey).Result()
-		
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		email, err := database.Rdb.Get(c, tokenKey).Result()
+		if err == redis.Nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Invalid or expired token"})
 			return
 		}
-
-		if exists == 0 {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Invalid or expired token"})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
 			return
 		}
 
-		// Optional: We could get the email and set it in context if needed
-		// email, _ := database.Rdb.Get(c, tokenKey).Result()
-		// c.Set("user_email", email)
+		c.Set(userEmailKey, email)
 
 		c.Next()
 	}
@@ -0,0 +1,65 @@
+package models
+
+// Announcement audiences
+const (
+	AnnouncementAudiencePublic  = "public"  // shown to everyone and in the RSS/Atom feeds
+	AnnouncementAudienceMembers = "members" // shown to active members only
+)
+
+// Announcement statuses, derived from the publish and expiry times
+const (
+	AnnouncementStatusScheduled = "scheduled"
+	AnnouncementStatusPublished = "published"
+	AnnouncementStatusExpired   = "expired"
+)
+
+// Announcement is a news post an iCom publishes to its members and visitors
+type Announcement struct {
+	ID         string   `json:"id" redis:"id"`
+	IComID     string   `json:"icom_id" redis:"icomId"`
+	Title      string   `json:"title" redis:"title"`
+	Body       string   `json:"body" redis:"body"` // sanitized HTML
+	CoverImage string   `json:"cover_image,omitempty" redis:"coverImage"`
+	Pinned     bool     `json:"pinned" redis:"pinned"`
+	Audience   string   `json:"audience" redis:"audience"`
+	PublishAt  string   `json:"publish_at" redis:"publishAt"`
+	ExpiresAt  string   `json:"expires_at,omitempty" redis:"expiresAt"`
+	Channels   []string `json:"channels,omitempty" redis:"channels"` // notification channels members are pushed through
+	Created    string   `json:"created" redis:"created"`
+	Modified   string   `json:"modified" redis:"modified"`
+
+	Status string `json:"status" redis:"-"`
+}
+
+// CreateAnnouncementRequest represents request to publish an announcement
+type CreateAnnouncementRequest struct {
+	Title      string   `json:"title" binding:"required,max=200"`
+	Body       string   `json:"body" binding:"required,max=50000"`
+	CoverImage string   `json:"cover_image" binding:"omitempty,url,max=2000"`
+	Pinned     bool     `json:"pinned"`
+	Audience   string   `json:"audience" binding:"omitempty,oneof=public members"`                 // defaults to public
+	PublishAt  string   `json:"publish_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"` // defaults to now
+	ExpiresAt  string   `json:"expires_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Channels   []string `json:"channels" binding:"omitempty,dive,required"` // e.g. ["inbox"]; none sends no notification
+}
+
+// UpdateAnnouncementRequest represents request to update an announcement
+// Only the fields sent are changed
+type UpdateAnnouncementRequest struct {
+	Title      string  `json:"title" binding:"max=200"`
+	Body       string  `json:"body" binding:"max=50000"`
+	CoverImage *string `json:"cover_image" binding:"omitempty,url,max=2000"` // empty string removes the cover
+	Pinned     *bool   `json:"pinned"`
+	Audience   string  `json:"audience" binding:"omitempty,oneof=public members"`
+	PublishAt  string  `json:"publish_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	ExpiresAt  *string `json:"expires_at"` // empty string removes the expiry
+}
+
+// AnnouncementListResponse represents a page of an iCom's announcements,
+// pinned first, then newest first
+type AnnouncementListResponse struct {
+	Announcements []Announcement `json:"announcements"`
+	Total         int            `json:"total"`
+	Page          int            `json:"page"`
+	Limit         int            `json:"limit"`
+}
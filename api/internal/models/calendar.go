@@ -0,0 +1,97 @@
+package models
+
+// Calendar event visibilities
+const (
+	EventVisibilityPublic  = "public"  // listed to everyone, anyone may RSVP
+	EventVisibilityMembers = "members" // listed to and open for active members only
+)
+
+// RSVP statuses
+const (
+	RSVPStatusGoing      = "going"
+	RSVPStatusWaitlisted = "waitlisted" // the event was full; promoted in RSVP order as seats free up
+)
+
+// CalendarEvent is a meetup, trade fair, training or other event an iCom
+// runs for its members
+type CalendarEvent struct {
+	ID          string   `json:"id" redis:"id"`
+	IComID      string   `json:"icom_id" redis:"icomId"`
+	Title       string   `json:"title" redis:"title"`
+	Description string   `json:"description,omitempty" redis:"description"`
+	Address     string   `json:"address,omitempty" redis:"address"`
+	Lat         *float64 `json:"lat,omitempty" redis:"lat"`
+	Lng         *float64 `json:"lng,omitempty" redis:"lng"`
+	StartsAt    string   `json:"starts_at" redis:"startsAt"`
+	EndsAt      string   `json:"ends_at" redis:"endsAt"`
+	Capacity    int      `json:"capacity" redis:"capacity"` // 0 means unlimited
+	Visibility  string   `json:"visibility" redis:"visibility"`
+	Created     string   `json:"created" redis:"created"`
+	Modified    string   `json:"modified" redis:"modified"`
+
+	Going      int `json:"going" redis:"-"`
+	Waitlisted int `json:"waitlisted" redis:"-"`
+}
+
+// CreateCalendarEventRequest represents request to create an event
+type CreateCalendarEventRequest struct {
+	Title       string   `json:"title" binding:"required,max=200"`
+	Description string   `json:"description" binding:"max=5000"`
+	Address     string   `json:"address" binding:"max=500"`
+	Lat         *float64 `json:"lat" binding:"omitempty,latitude"`
+	Lng         *float64 `json:"lng" binding:"omitempty,longitude"`
+	StartsAt    string   `json:"starts_at" binding:"required,datetime=2006-01-02T15:04:05Z07:00"`
+	EndsAt      string   `json:"ends_at" binding:"required,datetime=2006-01-02T15:04:05Z07:00"`
+	Capacity    int      `json:"capacity" binding:"min=0"`
+	Visibility  string   `json:"visibility" binding:"omitempty,oneof=public members"` // defaults to public
+}
+
+// UpdateCalendarEventRequest represents request to update an event
+// Only non-empty fields are written (see hashcodec.MarshalPartial)
+type UpdateCalendarEventRequest struct {
+	Title       string   `json:"title" binding:"max=200" redis:"title"`
+	Description *string  `json:"description" binding:"omitempty,max=5000" redis:"description"`
+	Address     *string  `json:"address" binding:"omitempty,max=500" redis:"address"`
+	Lat         *float64 `json:"lat" binding:"omitempty,latitude" redis:"lat"`
+	Lng         *float64 `json:"lng" binding:"omitempty,longitude" redis:"lng"`
+	StartsAt    string   `json:"starts_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00" redis:"startsAt"`
+	EndsAt      string   `json:"ends_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00" redis:"endsAt"`
+	Capacity    *int     `json:"capacity" binding:"omitempty,min=0" redis:"capacity"`
+	Visibility  string   `json:"visibility" binding:"omitempty,oneof=public members" redis:"visibility"`
+}
+
+// RSVPRequest signs up for an event. Members sign up with their access
+// token; visitors with their name and email.
+type RSVPRequest struct {
+	Token string `json:"token"`
+	Name  string `json:"name" binding:"max=200"`
+	Email string `json:"email" binding:"omitempty,email"`
+}
+
+// WithdrawRSVPRequest cancels an RSVP with the cancel token it was given
+type WithdrawRSVPRequest struct {
+	AttendeeID  string `json:"attendee_id" binding:"required"`
+	CancelToken string `json:"cancel_token" binding:"required"`
+}
+
+// Attendee is a member or visitor who RSVP'd to an event
+type Attendee struct {
+	ID          string `json:"id" redis:"id"`
+	EventID     string `json:"event_id" redis:"eventId"`
+	ShopID      string `json:"shop_id,omitempty" redis:"shopId"`
+	Name        string `json:"name" redis:"name"`
+	Email       string `json:"email,omitempty" redis:"email"`
+	Status      string `json:"status" redis:"status"`
+	RSVPAt      string `json:"rsvp_at" redis:"rsvpAt"`
+	CheckedInAt string `json:"checked_in_at,omitempty" redis:"checkedInAt"`
+	CancelToken string `json:"cancel_token,omitempty" redis:"-"` // only in the RSVP response
+}
+
+// AttendeeList lists the attendees of an event in RSVP order
+type AttendeeList struct {
+	EventID    string     `json:"event_id"`
+	Attendees  []Attendee `json:"attendees"`
+	Going      int        `json:"going"`
+	Waitlisted int        `json:"waitlisted"`
+	CheckedIn  int        `json:"checked_in"`
+}
@@ -0,0 +1,156 @@
+package models
+
+// Invoice statuses
+const (
+	InvoiceStatusIssued  = "issued"
+	InvoiceStatusPaid    = "paid"
+	InvoiceStatusOverdue = "overdue"
+	InvoiceStatusWaived  = "waived"
+)
+
+// InvoiceStatuses lists every invoice status
+var InvoiceStatuses = []string{InvoiceStatusIssued, InvoiceStatusPaid, InvoiceStatusOverdue, InvoiceStatusWaived}
+
+// Payment methods. Manual payments use cash, bank_transfer or other;
+// payments made through a payment provider use gateway.
+const (
+	PaymentMethodCash         = "cash"
+	PaymentMethodBankTransfer = "bank_transfer"
+	PaymentMethodOther        = "other"
+	PaymentMethodGateway      = "gateway"
+)
+
+// Checkout statuses
+const (
+	CheckoutStatusPending   = "pending"
+	CheckoutStatusSucceeded = "succeeded"
+	CheckoutStatusFailed    = "failed"
+)
+
+// TierFee is what members of one tier owe per membership period.
+// Amounts are in the smallest unit of the currency (VND has none).
+type TierFee struct {
+	Rank   string `json:"rank" binding:"required"`
+	Amount int64  `json:"amount" binding:"min=0"`
+}
+
+// DuesSettings is the fee schedule of an iCom
+type DuesSettings struct {
+	Currency       string    `json:"currency" binding:"omitempty,len=3"`             // ISO 4217, defaults to VND
+	PeriodMonths   int       `json:"period_months" binding:"omitempty,min=1,max=60"` // length of a membership period, defaults to 12
+	DueDays        int       `json:"due_days" binding:"omitempty,min=1,max=365"`     // days after the period starts, defaults to 30
+	SuspendOverdue bool      `json:"suspend_overdue"`                                // move ACTIVE members with overdue dues to SUSPENDED
+	Fees           []TierFee `json:"fees" binding:"dive"`                            // tiers without a fee pay nothing
+}
+
+// Invoice is the dues of one member for one membership period
+type Invoice struct {
+	ID          string `json:"id" redis:"id"`
+	IComID      string `json:"icom_id" redis:"icomId"`
+	ShopID      string `json:"shop_id" redis:"shopId"`
+	Rank        string `json:"rank" redis:"rank"`
+	Amount      int64  `json:"amount" redis:"amount"`
+	PaidAmount  int64  `json:"paid_amount" redis:"paidAmount"`
+	Currency    string `json:"currency" redis:"currency"`
+	PeriodStart string `json:"period_start" redis:"periodStart"` // YYYY-MM-DD
+	PeriodEnd   string `json:"period_end" redis:"periodEnd"`     // YYYY-MM-DD, exclusive
+	DueDate     string `json:"due_date" redis:"dueDate"`         // YYYY-MM-DD, overdue the day after
+	Status      string `json:"status" redis:"status"`
+	IssuedAt    string `json:"issued_at" redis:"issuedAt"`
+	PaidAt      string `json:"paid_at,omitempty" redis:"paidAt"`
+	WaivedAt    string `json:"waived_at,omitempty" redis:"waivedAt"`
+	WaiveReason string `json:"waive_reason,omitempty" redis:"waiveReason"`
+	Modified    string `json:"modified" redis:"modified"`
+
+	Payments []Payment `json:"payments,omitempty" redis:"-"`
+}
+
+// Payment is money received against an invoice
+type Payment struct {
+	ID         string `json:"id"`
+	InvoiceID  string `json:"invoice_id"`
+	Amount     int64  `json:"amount"`
+	Method     string `json:"method"`
+	Provider   string `json:"provider,omitempty"`  // payment provider of gateway payments
+	Reference  string `json:"reference,omitempty"` // receipt number or provider transaction ID
+	Note       string `json:"note,omitempty"`
+	PaidAt     string `json:"paid_at"`
+	RecordedAt string `json:"recorded_at"`
+}
+
+// RecordPaymentRequest records a payment received outside i-Manage
+type RecordPaymentRequest struct {
+	Amount    int64  `json:"amount" binding:"required,min=1"`
+	Method    string `json:"method" binding:"required,oneof=cash bank_transfer other"`
+	Reference string `json:"reference"`
+	Note      string `json:"note"`
+	PaidAt    string `json:"paid_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"` // defaults to now
+}
+
+// WaiveInvoiceRequest cancels what is left to pay on an invoice
+type WaiveInvoiceRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// InvoiceList is a page of invoices, newest period first
+type InvoiceList struct {
+	Invoices []Invoice `json:"invoices"`
+	Total    int       `json:"total"`
+	Page     int       `json:"page"`
+	Limit    int       `json:"limit"`
+}
+
+// InvoiceRun is the outcome of a dues run over an iCom
+type InvoiceRun struct {
+	IComID    string `json:"icom_id"`
+	Issued    int    `json:"issued"`    // invoices created for the current periods
+	Overdue   int    `json:"overdue"`   // invoices that passed their due date
+	Suspended int    `json:"suspended"` // members suspended for overdue dues
+}
+
+// DuesStatusTotal counts the invoices in one status
+type DuesStatusTotal struct {
+	Count  int   `json:"count"`
+	Amount int64 `json:"amount"`
+}
+
+// DuesDashboard summarises the dues of an iCom
+type DuesDashboard struct {
+	IComID         string                     `json:"icom_id"`
+	Currency       string                     `json:"currency"`
+	Statuses       map[string]DuesStatusTotal `json:"statuses"`        // by invoice status
+	Billed         int64                      `json:"billed"`          // invoiced, waived invoices excluded
+	Collected      int64                      `json:"collected"`       // received, partial payments included
+	Outstanding    int64                      `json:"outstanding"`     // left to pay on issued and overdue invoices
+	CollectionRate float64                    `json:"collection_rate"` // collected / billed
+	Suspended      int                        `json:"suspended"`       // members suspended for overdue dues
+	Overdue        []Invoice                  `json:"overdue"`         // oldest due date first
+}
+
+// CreateCheckoutRequest starts paying an invoice through a payment provider
+type CreateCheckoutRequest struct {
+	Provider string `json:"provider" binding:"required"`
+}
+
+// Checkout is a payment started with a payment provider
+type Checkout struct {
+	ID        string `json:"id" redis:"id"`
+	IComID    string `json:"icom_id" redis:"icomId"`
+	InvoiceID string `json:"invoice_id" redis:"invoiceId"`
+	Provider  string `json:"provider" redis:"provider"`
+	Amount    int64  `json:"amount" redis:"amount"`
+	Currency  string `json:"currency" redis:"currency"`
+	PayURL    string `json:"pay_url" redis:"payUrl"` // where the payer completes the payment
+	Status    string `json:"status" redis:"status"`
+	Reference string `json:"reference,omitempty" redis:"reference"` // provider transaction ID
+	Created   string `json:"created" redis:"created"`
+	Modified  string `json:"modified" redis:"modified"`
+}
+
+// GatewayCallback is the outcome of a checkout reported by a payment provider
+type GatewayCallback struct {
+	CheckoutID string `json:"checkout_id"`
+	Reference  string `json:"reference"`
+	Amount     int64  `json:"amount"`
+	Status     string `json:"status"` // succeeded or failed
+}
@@ -30,6 +30,7 @@ type IComProfile struct {
 	RequireApproval   string `json:"require_approval" redis:"requireApproval"` // "true" or "false"
 	AutoActivate      string `json:"auto_activate" redis:"autoActivate"`       // "true" or "false"
 	MaxMembers        int    `json:"max_members" redis:"maxMembers"`
+	WaitlistEnabled   string `json:"waitlist_enabled" redis:"waitlistEnabled"` // "true" or "false"
 
 	// Statistics
 	TotalMembers  int `json:"total_members" redis:"totalMembers"`
@@ -58,26 +59,29 @@ type CreateIComRequest struct {
 	RequireApproval   bool     `json:"require_approval"`
 	AutoActivate      bool     `json:"auto_activate"`
 	MaxMembers        int      `json:"max_members"`
+	WaitlistEnabled   bool     `json:"waitlist_enabled"`
 }
 
 // UpdateIComRequest represents request to update iCom
+// Only non-empty fields are written (see hashcodec.MarshalPartial)
 type UpdateIComRequest struct {
-	Name              string   `json:"name"`
-	FullName          string   `json:"full_name"`
-	Slogan            string   `json:"slogan"`
-	Description       string   `json:"description"`
-	Logo              string   `json:"logo"`
-	Banner            string   `json:"banner"`
-	ThemeColor        string   `json:"theme_color"`
-	Address           string   `json:"address"`
-	Phone             string   `json:"phone"`
-	Email             string   `json:"email" binding:"omitempty,email"`
-	Website           string   `json:"website"`
-	AllowedIndustries []string `json:"allowed_industries"`
-	OperatingAreas    []string `json:"operating_areas"`
-	RequireApproval   *bool    `json:"require_approval"`
-	AutoActivate      *bool    `json:"auto_activate"`
-	MaxMembers        int      `json:"max_members"`
+	Name              string   `json:"name" redis:"name"`
+	FullName          string   `json:"full_name" redis:"fullName"`
+	Slogan            string   `json:"slogan" redis:"slogan"`
+	Description       string   `json:"description" redis:"description"`
+	Logo              string   `json:"logo" redis:"logo"`
+	Banner            string   `json:"banner" redis:"banner"`
+	ThemeColor        string   `json:"theme_color" redis:"themeColor"`
+	Address           string   `json:"address" redis:"address"`
+	Phone             string   `json:"phone" redis:"phone"`
+	Email             string   `json:"email" binding:"omitempty,email" redis:"email"`
+	Website           string   `json:"website" redis:"website"`
+	AllowedIndustries []string `json:"allowed_industries" redis:"allowedIndustries"`
+	OperatingAreas    []string `json:"operating_areas" redis:"operatingAreas"`
+	RequireApproval   *bool    `json:"require_approval" redis:"requireApproval"`
+	AutoActivate      *bool    `json:"auto_activate" redis:"autoActivate"`
+	MaxMembers        int      `json:"max_members" binding:"min=0" redis:"maxMembers"`
+	WaitlistEnabled   *bool    `json:"waitlist_enabled" redis:"waitlistEnabled"`
 }
 
 // IComResponse represents the response with full iCom details
@@ -87,37 +91,98 @@ type IComResponse struct {
 	Actions []ActionButton `json:"actions"`
 }
 
-// BoardMember represents a member of the board
+// Board roles, in the order boards are usually presented
+const (
+	BoardRoleChair     = "chair"
+	BoardRoleViceChair = "vice_chair"
+	BoardRoleSecretary = "secretary"
+	BoardRoleTreasurer = "treasurer"
+	BoardRoleMember    = "member"
+	BoardRoleAdvisor   = "advisor"
+)
+
+// BoardMember represents a member of the board. Members removed from the
+// board keep their record with RemovedAt set, as part of their term's history.
 type BoardMember struct {
-	MemberID string `json:"member_id" redis:"memberId"`
-	UserID   string `json:"user_id" redis:"userId"`
-	Name     string `json:"name" redis:"name"`
-	Role     string `json:"role" redis:"role"`
-	Contact  string `json:"contact" redis:"contact"`
-	Avatar   string `json:"avatar" redis:"avatar"`
-	Bio      string `json:"bio" redis:"bio"`
+	MemberID  string `json:"member_id" redis:"memberId"`
+	UserID    string `json:"user_id" redis:"userId"`
+	Name      string `json:"name" redis:"name"`
+	Role      string `json:"role" redis:"role"`
+	Contact   string `json:"contact" redis:"contact"`
+	Avatar    string `json:"avatar" redis:"avatar"`
+	Bio       string `json:"bio" redis:"bio"`
+	Position  int    `json:"position" redis:"position"`
+	Term      string `json:"term,omitempty" redis:"term"`
+	TermStart string `json:"term_start,omitempty" redis:"termStart"` // YYYY-MM-DD
+	TermEnd   string `json:"term_end,omitempty" redis:"termEnd"`     // YYYY-MM-DD
+	RemovedAt string `json:"removed_at,omitempty" redis:"removedAt"`
 }
 
-// AddBoardMemberRequest represents request to add board member
+// AddBoardMemberRequest represents request to add board member. Term defaults
+// to the years of the term dates, e.g. "2024-2027".
 type AddBoardMemberRequest struct {
-	UserID  string `json:"user_id" binding:"required"`
-	Name    string `json:"name" binding:"required"`
-	Role    string `json:"role" binding:"required"`
-	Contact string `json:"contact"`
-	Avatar  string `json:"avatar"`
-	Bio     string `json:"bio"`
+	UserID    string `json:"user_id" binding:"required"`
+	Name      string `json:"name" binding:"required"`
+	Role      string `json:"role" binding:"required,oneof=chair vice_chair secretary treasurer member advisor"`
+	Contact   string `json:"contact"`
+	Avatar    string `json:"avatar"`
+	Bio       string `json:"bio"`
+	Term      string `json:"term"`
+	TermStart string `json:"term_start" binding:"omitempty,datetime=2006-01-02"`
+	TermEnd   string `json:"term_end" binding:"omitempty,datetime=2006-01-02"`
 }
 
 // UpdateBoardMemberRequest represents request to update board member
 type UpdateBoardMemberRequest struct {
-	Name    string `json:"name"`
-	Role    string `json:"role"`
-	Contact string `json:"contact"`
-	Avatar  string `json:"avatar"`
-	Bio     string `json:"bio"`
+	Name      string `json:"name" redis:"name"`
+	Role      string `json:"role" binding:"omitempty,oneof=chair vice_chair secretary treasurer member advisor" redis:"role"`
+	Contact   string `json:"contact" redis:"contact"`
+	Avatar    string `json:"avatar" redis:"avatar"`
+	Bio       string `json:"bio" redis:"bio"`
+	Term      string `json:"term" redis:"term"`
+	TermStart string `json:"term_start" binding:"omitempty,datetime=2006-01-02" redis:"termStart"`
+	TermEnd   string `json:"term_end" binding:"omitempty,datetime=2006-01-02" redis:"termEnd"`
+}
+
+// ReorderBoardRequest sets the display order of the current board
+type ReorderBoardRequest struct {
+	MemberIDs []string `json:"member_ids" binding:"required,min=1"`
+}
+
+// BoardTerm is a board term with at least one recorded member
+type BoardTerm struct {
+	Term      string `json:"term"`
+	TermStart string `json:"term_start,omitempty"`
+	TermEnd   string `json:"term_end,omitempty"`
+	Current   bool   `json:"current"`
 }
 
-// ActionButton represents a functional button/action
+// Action button types. The target of each type is validated and normalized
+// into a link the button opens.
+const (
+	ActionTypePhone     = "phone"     // tel: link from a phone number
+	ActionTypeZalo      = "zalo"      // https://zalo.me/ link from a phone number or zalo.me link
+	ActionTypeMessenger = "messenger" // https://m.me/ link from a page name or Facebook link
+	ActionTypeMap       = "map"       // directions from "lat,lng" or a map link
+	ActionTypeURL       = "url"
+	ActionTypeEmail     = "email" // mailto: link from an address
+	ActionTypeDownload  = "download"
+)
+
+// ActionTypes lists the supported action button types
+var ActionTypes = []string{
+	ActionTypePhone,
+	ActionTypeZalo,
+	ActionTypeMessenger,
+	ActionTypeMap,
+	ActionTypeURL,
+	ActionTypeEmail,
+	ActionTypeDownload,
+}
+
+// ActionButton represents a functional button/action. Actions are shown in
+// Order, while Active is not false and the current time is within
+// [StartsAt, EndsAt).
 type ActionButton struct {
 	ActionID string `json:"action_id" redis:"actionId"`
 	Type     string `json:"type" redis:"type"`
@@ -125,24 +190,67 @@ type ActionButton struct {
 	URL      string `json:"url" redis:"url"`
 	Icon     string `json:"icon" redis:"icon"`
 	Order    int    `json:"order" redis:"order"`
+	Active   *bool  `json:"active" redis:"active"`
+	StartsAt string `json:"starts_at,omitempty" redis:"startsAt"` // RFC3339
+	EndsAt   string `json:"ends_at,omitempty" redis:"endsAt"`     // RFC3339
 }
 
-// AddActionRequest represents request to add action button
+// AddActionRequest represents request to add action button. URL is the
+// target of the action type, e.g. a phone number for phone and zalo.
 type AddActionRequest struct {
-	Type  string `json:"type" binding:"required"`
-	Title string `json:"title" binding:"required"`
-	URL   string `json:"url" binding:"required"`
-	Icon  string `json:"icon"`
-	Order int    `json:"order"`
+	Type     string `json:"type" binding:"required,oneof=phone zalo messenger map url email download"`
+	Title    string `json:"title" binding:"required"`
+	URL      string `json:"url" binding:"required"`
+	Icon     string `json:"icon"`
+	Order    int    `json:"order"`
+	Active   *bool  `json:"active"`
+	StartsAt string `json:"starts_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	EndsAt   string `json:"ends_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
 }
 
-// UpdateActionRequest represents request to update action button
+// UpdateActionRequest represents request to update action button.
+// ClearSchedule removes the visibility window before applying StartsAt and EndsAt.
 type UpdateActionRequest struct {
-	Type  string `json:"type"`
-	Title string `json:"title"`
-	URL   string `json:"url"`
-	Icon  string `json:"icon"`
-	Order int    `json:"order"`
+	Type          string `json:"type" binding:"omitempty,oneof=phone zalo messenger map url email download" redis:"type"`
+	Title         string `json:"title" redis:"title"`
+	URL           string `json:"url" redis:"url"`
+	Icon          string `json:"icon" redis:"icon"`
+	Order         int    `json:"order" binding:"min=0" redis:"order"`
+	Active        *bool  `json:"active" redis:"active"`
+	StartsAt      string `json:"starts_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00" redis:"startsAt"`
+	EndsAt        string `json:"ends_at" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00" redis:"endsAt"`
+	ClearSchedule bool   `json:"clear_schedule" redis:"-"`
+}
+
+// ReorderActionsRequest sets the display order of all action buttons
+type ReorderActionsRequest struct {
+	ActionIDs []string `json:"action_ids" binding:"required,min=1"`
+}
+
+// ActionClickDay is the clicks on an action during one day
+type ActionClickDay struct {
+	Date     string `json:"date"` // YYYY-MM-DD in the statistics time zone
+	Clicks   int64  `json:"clicks"`
+	Visitors int64  `json:"visitors"` // unique visitor estimate
+}
+
+// ActionAnalytics is the click summary of one action button. Visitor
+// counts are HyperLogLog estimates.
+type ActionAnalytics struct {
+	Action        ActionButton     `json:"action"`
+	TotalClicks   int64            `json:"total_clicks"`
+	TotalVisitors int64            `json:"total_visitors"`
+	Clicks        int64            `json:"clicks"`   // within the range
+	Visitors      int64            `json:"visitors"` // within the range
+	Days          []ActionClickDay `json:"days"`
+}
+
+// ActionAnalyticsResponse lists every action with its clicks over a range of days
+type ActionAnalyticsResponse struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Timezone string            `json:"timezone"`
+	Actions  []ActionAnalytics `json:"actions"`
 }
 
 // MembershipDetail represents shop's membership details in an iCom
@@ -155,13 +263,21 @@ type MembershipDetail struct {
 	JoinedDate string `json:"joined_date" redis:"joinedDate"`
 	Role       string `json:"role" redis:"role"`
 	Benefits   string `json:"benefits" redis:"benefits"`
+	InviteCode string `json:"invite_code,omitempty" redis:"inviteCode"` // invite the shop joined through
+	ExpiresAt  string `json:"expires_at,omitempty" redis:"expiresAt"`   // end of the current term, when the iCom's memberships expire
 }
 
-// AddMemberRequest represents request to add a shop to iCom
-// This also creates the iShop if needed
+// AddMemberRequest represents request to add a shop to iCom.
+// With ShopID an existing iShop is linked; otherwise a new iShop is created
+// from the profile fields, unless it looks like a duplicate of an existing one.
 type AddMemberRequest struct {
+	// Existing shop to link instead of creating a new one
+	ShopID string `json:"shop_id"`
+	// Create a new shop even when duplicates were found
+	IgnoreDuplicates bool `json:"ignore_duplicates"`
+
 	// Shop Profile
-	Name        string   `json:"name" binding:"required"`
+	Name        string   `json:"name" binding:"required_without=ShopID"`
 	Description string   `json:"description"`
 	Logo        string   `json:"logo"`
 	Banner      string   `json:"banner"`
@@ -172,8 +288,8 @@ type AddMemberRequest struct {
 	District string  `json:"district"`
 	Ward     string  `json:"ward"`
 	Street   string  `json:"street"`
-	Lat      float64 `json:"lat" binding:"required"` // Required for geo-search and map display
-	Lng      float64 `json:"lng" binding:"required"` // Required for geo-search and map display
+	Lat      float64 `json:"lat" binding:"required_without=ShopID"` // Required for geo-search and map display
+	Lng      float64 `json:"lng" binding:"required_without=ShopID"` // Required for geo-search and map display
 
 	// Contact
 	Phone   string `json:"phone"`
@@ -181,7 +297,7 @@ type AddMemberRequest struct {
 	Website string `json:"website"`
 
 	// Industry
-	Industry    string `json:"industry" binding:"required"`
+	Industry    string `json:"industry" binding:"required_without=ShopID"`
 	SubIndustry string `json:"sub_industry"`
 
 	// Membership details
@@ -197,6 +313,82 @@ type UpdateMemberStatusRequest struct {
 	Role   string `json:"role"`
 }
 
+// MembershipApplication is a shop's request to join an iCom
+type MembershipApplication struct {
+	ShopID      string `json:"shop_id" redis:"shopId"`
+	IComID      string `json:"icom_id" redis:"icomId"`
+	ShopName    string `json:"shop_name" redis:"-"`
+	ShopLogo    string `json:"shop_logo" redis:"-"`
+	Status      string `json:"status" redis:"status"` // PENDING, WAITLISTED, APPROVED or REJECTED
+	Message     string `json:"message" redis:"message"`
+	Rank        string `json:"rank" redis:"rank"` // rank and role granted on admission
+	Role        string `json:"role" redis:"role"`
+	InviteCode  string `json:"invite_code,omitempty" redis:"inviteCode"`
+	Reason      string `json:"reason" redis:"reason"` // given with the decision
+	AppliedDate string `json:"applied_date" redis:"appliedDate"`
+	DecidedDate string `json:"decided_date" redis:"decidedDate"`
+}
+
+// RuleViolation describes one membership rule a shop does not satisfy
+type RuleViolation struct {
+	Rule    string `json:"rule"` // capacity, industry or area
+	Message string `json:"message"`
+}
+
+// MemberViolation lists the rules an existing member breaks
+type MemberViolation struct {
+	ShopID     string          `json:"shop_id"`
+	Name       string          `json:"name"`
+	Status     string          `json:"status"`
+	Industry   string          `json:"industry"`
+	Province   string          `json:"province"`
+	District   string          `json:"district"`
+	Violations []RuleViolation `json:"violations"`
+}
+
+// ViolationReport lists members that break the iCom's current rules
+type ViolationReport struct {
+	MaxMembers        int               `json:"max_members"`
+	OccupiedSeats     int               `json:"occupied_seats"` // ACTIVE + PENDING members
+	OverCapacity      int               `json:"over_capacity"`
+	AllowedIndustries []string          `json:"allowed_industries"`
+	OperatingAreas    []string          `json:"operating_areas"`
+	Members           []MemberViolation `json:"members"`
+}
+
+// ApplyMembershipRequest represents a shop applying to join an iCom
+type ApplyMembershipRequest struct {
+	ShopID  string `json:"shop_id" binding:"required"`
+	Message string `json:"message" binding:"max=1000"`
+}
+
+// ReviewApplicationRequest represents an approve or reject decision
+type ReviewApplicationRequest struct {
+	Reason string `json:"reason" binding:"max=1000"`
+}
+
+// BulkReviewRequest represents the same decision applied to many applications
+type BulkReviewRequest struct {
+	Decision string   `json:"decision" binding:"required,oneof=approve reject"`
+	ShopIDs  []string `json:"shop_ids" binding:"required,min=1,max=100"`
+	Reason   string   `json:"reason" binding:"max=1000"`
+}
+
+// BulkReviewResult is the outcome of one application in a bulk decision
+type BulkReviewResult struct {
+	ShopID string `json:"shop_id"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ApplicationListResponse represents a page of the review queue
+type ApplicationListResponse struct {
+	Applications []MembershipApplication `json:"applications"`
+	Total        int                     `json:"total"`
+	Page         int                     `json:"page"`
+	Limit        int                     `json:"limit"`
+}
+
 // UpdateMemberOrderRequest represents request to update member display order
 type UpdateMemberOrderRequest struct {
 	DisplayOrder int `json:"display_order" binding:"required,min=1"`
@@ -267,16 +459,47 @@ type LeaderboardEntry struct {
 // LeaderboardResponse represents leaderboard data
 type LeaderboardResponse struct {
 	Type    string             `json:"type"` // interactions or likes
+	Period  string             `json:"period"`
+	Scoring string             `json:"scoring"`
 	Entries []LeaderboardEntry `json:"entries"`
 }
 
+// Leaderboard periods. Calendar periods follow the statistics time zone.
+const (
+	LeaderboardPeriodAll        = "all"   // all-time totals
+	LeaderboardPeriodToday      = "today"
+	LeaderboardPeriodWeek       = "week"  // since Monday
+	LeaderboardPeriodMonth      = "month" // since the 1st
+	LeaderboardPeriodLast30Days = "30d"   // rolling, including today
+)
+
+// Leaderboard scoring modes
+const (
+	LeaderboardScoringTotal = "total" // every day in the period counts the same
+	LeaderboardScoringDecay = "decay" // older days count less, halving every HalfLifeDays
+)
+
+// LeaderboardRequest selects a leaderboard
+type LeaderboardRequest struct {
+	Type         string // interactions or likes
+	Source       string // likes only: icom or ishop
+	Period       string
+	Scoring      string
+	HalfLifeDays float64 // decay scoring, default 7
+	Limit        int
+}
+
 // IComStatsResponse represents iCom statistics
 type IComStatsResponse struct {
-	TotalMembers      int            `json:"total_members"`
-	ActiveMembers     int            `json:"active_members"`
-	PendingMembers    int            `json:"pending_members"`
-	IndustryBreakdown map[string]int `json:"industry_breakdown"`
-	DistrictBreakdown map[string]int `json:"district_breakdown"`
+	TotalMembers         int            `json:"total_members"`
+	ActiveMembers        int            `json:"active_members"`
+	PendingMembers       int            `json:"pending_members"`
+	StatusBreakdown      map[string]int `json:"status_breakdown"`
+	RankBreakdown        map[string]int `json:"rank_breakdown"`
+	IndustryBreakdown    map[string]int `json:"industry_breakdown"`
+	SubIndustryBreakdown map[string]int `json:"sub_industry_breakdown"`
+	ProvinceBreakdown    map[string]int `json:"province_breakdown"`
+	DistrictBreakdown    map[string]int `json:"district_breakdown"`
 }
 
 // IComListResponse represents paginated list of iComs
@@ -297,3 +520,80 @@ type IComMetadataResponse struct {
 	SubIndustries []MetadataItem `json:"sub_industries"`
 	Areas         []MetadataItem `json:"areas"`
 }
+
+// Member export formats
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatXLSX  = "xlsx"
+	ExportFormatVCard = "vcf"
+)
+
+// MemberExportColumns lists the columns a member export can contain
+var MemberExportColumns = []string{
+	"shop_id", "name", "description", "logo", "industry", "sub_industry",
+	"phone", "email", "website", "street", "ward", "district", "province", "lat", "lng",
+	"rank", "role", "status", "joined_date",
+}
+
+// DefaultMemberExportColumns are exported when no columns are requested
+var DefaultMemberExportColumns = []string{
+	"name", "industry", "phone", "email", "website", "street", "ward", "district", "province",
+	"rank", "status", "joined_date",
+}
+
+// MemberExportRequest selects the members and columns of an export
+type MemberExportRequest struct {
+	Filter  FilterMembersRequest // Page and Limit are ignored
+	Format  string
+	Columns []string
+	// Public exports contain only active members and leave out the fields
+	// each shop marked as private
+	Public bool
+}
+
+// Like sources
+const (
+	LikeSourceICom  = "icom"
+	LikeSourceIShop = "ishop"
+)
+
+// LikeSources lists where a like can be given
+var LikeSources = []string{LikeSourceICom, LikeSourceIShop}
+
+// LikeRecord is one visitor's like of a shop in an iCom
+type LikeRecord struct {
+	VisitorID string `json:"visitor_id"`
+	IComID    string `json:"icom_id"`
+	Source    string `json:"source"`
+	LikedAt   string `json:"liked_at"`
+}
+
+// IComLikeCount is how often a shop was liked in one iCom
+type IComLikeCount struct {
+	IComID   string           `json:"icom_id"`
+	IComName string           `json:"icom_name"`
+	Count    int64            `json:"count"`
+	BySource map[string]int64 `json:"by_source"`
+}
+
+// IShopLikesResponse is the shop owner's view of their likes
+type IShopLikesResponse struct {
+	ShopID string          `json:"shop_id"`
+	Total  int64           `json:"total"`
+	ByICom []IComLikeCount `json:"by_icom"`
+	Recent []LikeRecord    `json:"recent"`
+}
+
+// LikeMismatch is a shop whose like scores disagree with the ledger
+type LikeMismatch struct {
+	ShopID string             `json:"shop_id"`
+	Ledger map[string]int64   `json:"ledger"` // "total" and per source
+	Scores map[string]float64 `json:"scores"` // leaderboard scores, same keys
+}
+
+// LikeReconcileReport lists the like scores of an iCom that drifted from the ledger
+type LikeReconcileReport struct {
+	Checked    int            `json:"checked"`
+	Mismatches []LikeMismatch `json:"mismatches"`
+	Fixed      bool           `json:"fixed"`
+}
@@ -0,0 +1,75 @@
+package models
+
+// Member import job statuses
+const (
+	ImportStatusQueued    = "queued"
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+// What an import does with rows that look like an existing shop
+const (
+	ImportOnDuplicateSkip   = "skip"   // report the row and leave it out
+	ImportOnDuplicateLink   = "link"   // add the existing shop as member
+	ImportOnDuplicateCreate = "create" // create a new shop anyway
+)
+
+// ImportOptions configures how a file maps onto AddMemberRequest fields
+type ImportOptions struct {
+	// AddMemberRequest field (JSON name, e.g. "lat") -> column header.
+	// Columns whose header matches a field name are mapped automatically.
+	Mapping     map[string]string `json:"mapping"`
+	OnDuplicate string            `json:"on_duplicate"` // skip (default), link or create
+}
+
+// ImportRowError describes why a row could not be imported
+type ImportRowError struct {
+	Row     int      `json:"row"` // 1-based line in the file, header included
+	Field   string   `json:"field,omitempty"`
+	Message string   `json:"message"`
+	Values  []string `json:"values,omitempty"` // the original row
+}
+
+// ImportPreview is the dry-run result of an import
+type ImportPreview struct {
+	FileName        string             `json:"file_name"`
+	Format          string             `json:"format"`
+	Columns         []string           `json:"columns"`
+	Mapping         map[string]string  `json:"mapping"` // resolved field -> column
+	TotalRows       int                `json:"total_rows"`
+	ValidRows       int                `json:"valid_rows"`
+	InvalidRows     int                `json:"invalid_rows"`
+	AlreadyImported int                `json:"already_imported"`
+	Errors          []ImportRowError   `json:"errors"`
+	Sample          []AddMemberRequest `json:"sample"` // first valid rows as they would be imported
+}
+
+// ImportJob is a background member import
+type ImportJob struct {
+	ID          string            `json:"id" redis:"id"`
+	IComID      string            `json:"icom_id" redis:"icomId"`
+	FileName    string            `json:"file_name" redis:"fileName"`
+	FileHash    string            `json:"file_hash" redis:"fileHash"`
+	Mapping     map[string]string `json:"mapping" redis:"mapping"`
+	OnDuplicate string            `json:"on_duplicate" redis:"onDuplicate"`
+	Status      string            `json:"status" redis:"status"`
+	TotalRows   int               `json:"total_rows" redis:"totalRows"`
+	Processed   int               `json:"processed" redis:"processed"`
+	Added       int               `json:"added" redis:"added"`
+	Linked      int               `json:"linked" redis:"linked"`
+	Skipped     int               `json:"skipped" redis:"skipped"` // already imported or duplicates
+	Failed      int               `json:"failed" redis:"failed"`
+	Error       string            `json:"error,omitempty" redis:"error"`
+	Created     string            `json:"created" redis:"created"`
+	Started     string            `json:"started,omitempty" redis:"started"`
+	Finished    string            `json:"finished,omitempty" redis:"finished"`
+}
+
+// ImportJobList represents a page of an iCom's import jobs
+type ImportJobList struct {
+	Jobs  []ImportJob `json:"jobs"`
+	Total int         `json:"total"`
+	Page  int         `json:"page"`
+	Limit int         `json:"limit"`
+}
@@ -0,0 +1,74 @@
+package models
+
+// InteractionRequest identifies who is interacting. Without a visitor ID the
+// client IP stands in for the visitor.
+type InteractionRequest struct {
+	VisitorID string `json:"visitor_id"`
+}
+
+// Reasons an interaction was not counted in full
+const (
+	InteractionReasonDuplicate = "duplicate" // same visitor and shop within the de-duplication window
+	InteractionReasonFlagged   = "flagged"   // source recently hit the rate limit; score held or discounted
+)
+
+// InteractionResult reports how an interaction was counted
+type InteractionResult struct {
+	Counted bool    `json:"counted"`
+	Weight  float64 `json:"weight"` // score added to the rankings
+	Reason  string  `json:"reason,omitempty"`
+}
+
+// InteractionAnomaly is a shop whose interactions spiked against its baseline
+type InteractionAnomaly struct {
+	ShopID   string  `json:"shop_id"`
+	Name     string  `json:"name"`
+	Score    float64 `json:"score"`    // counted interactions on the day
+	Baseline float64 `json:"baseline"` // daily average over the previous 7 days
+	Ratio    float64 `json:"ratio"`    // score / baseline (baseline of at least 1)
+	Blocked  int64   `json:"blocked"`  // duplicate and rate-limited attempts on the day
+	Held     float64 `json:"held"`     // score withheld from flagged sources, not yet released
+}
+
+// InteractionAnomalyReport lists the suspicious shops of one day
+type InteractionAnomalyReport struct {
+	Date      string               `json:"date"`
+	Factor    float64              `json:"factor"`
+	MinScore  float64              `json:"min_score"`
+	Anomalies []InteractionAnomaly `json:"anomalies"`
+}
+
+// Score adjustment actions
+const (
+	ScoreActionReset   = "reset"   // interactions score back to 0, held score dropped
+	ScoreActionAdjust  = "adjust"  // add delta (may be negative)
+	ScoreActionRelease = "release" // move the held score into the rankings
+)
+
+// AdjustScoreRequest is an admin correction of a shop's interaction score
+type AdjustScoreRequest struct {
+	Action string  `json:"action" binding:"required,oneof=reset adjust release"`
+	Delta  float64 `json:"delta"`
+	Reason string  `json:"reason" binding:"required"`
+}
+
+// ScoreAuditEntry records one score adjustment
+type ScoreAuditEntry struct {
+	ID       string  `json:"id"`
+	ShopID   string  `json:"shop_id"`
+	Action   string  `json:"action"`
+	Delta    float64 `json:"delta"`
+	OldScore float64 `json:"old_score"`
+	NewScore float64 `json:"new_score"`
+	Reason   string  `json:"reason"`
+	Actor    string  `json:"actor"` // email of the admin
+	Created  string  `json:"created"`
+}
+
+// ScoreAuditList is a page of the score audit trail, newest first
+type ScoreAuditList struct {
+	Entries []ScoreAuditEntry `json:"entries"`
+	Total   int               `json:"total"`
+	Page    int               `json:"page"`
+	Limit   int               `json:"limit"`
+}
@@ -0,0 +1,60 @@
+package models
+
+// Invite is an invitation link or join code for an iCom. Shops that join
+// through it get the invite's default rank and role.
+type Invite struct {
+	Code        string `json:"code" redis:"code"`
+	IComID      string `json:"icom_id" redis:"icomId"`
+	Link        string `json:"link" redis:"-"`
+	Rank        string `json:"rank" redis:"rank"`
+	Role        string `json:"role" redis:"role"`
+	Note        string `json:"note" redis:"note"`
+	MaxUses     int    `json:"max_uses" redis:"maxUses"` // 0 means unlimited
+	Uses        int    `json:"uses" redis:"uses"`
+	ExpiresAt   string `json:"expires_at" redis:"expiresAt"`
+	Revoked     bool   `json:"revoked" redis:"revoked"`
+	RevokedDate string `json:"revoked_date,omitempty" redis:"revokedDate"`
+	Created     string `json:"created" redis:"created"`
+
+	// Shops that joined through this invite (only on GetInvite)
+	Members []string `json:"members,omitempty" redis:"-"`
+}
+
+// CreateInviteRequest represents request to create an invite
+type CreateInviteRequest struct {
+	Rank           string `json:"rank"` // defaults to MEMBER
+	Role           string `json:"role"`
+	Note           string `json:"note" binding:"max=200"`
+	MaxUses        int    `json:"max_uses" binding:"min=0"`                            // 0 means unlimited
+	ExpiresInHours int    `json:"expires_in_hours" binding:"omitempty,min=1,max=8760"` // defaults to 7 days
+}
+
+// InviteListResponse represents paginated list of an iCom's invites
+type InviteListResponse struct {
+	Invites []Invite `json:"invites"`
+	Total   int      `json:"total"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+}
+
+// InviteInfo is the public view of an invite used to pre-fill the join form
+type InviteInfo struct {
+	Code            string `json:"code"`
+	IComID          string `json:"icom_id"`
+	IComName        string `json:"icom_name"`
+	IComLogo        string `json:"icom_logo"`
+	Rank            string `json:"rank"`
+	Role            string `json:"role"`
+	ExpiresAt       string `json:"expires_at"`
+	RemainingUses   int    `json:"remaining_uses"` // -1 means unlimited
+	RequireApproval bool   `json:"require_approval"`
+}
+
+// JoinByInviteRequest represents a shop owner joining through an invite,
+// either with an existing iShop or by creating a new one
+type JoinByInviteRequest struct {
+	ShopID           string              `json:"shop_id"`
+	Shop             *CreateIShopRequest `json:"shop"`
+	IgnoreDuplicates bool                `json:"ignore_duplicates"`
+	Message          string              `json:"message" binding:"max=1000"`
+}
@@ -34,6 +34,8 @@ type IShopProfile struct {
 
 	// Configuration
 	Status string `json:"status" redis:"status"`
+	// Contact fields left out of public exports (see ShopPrivateFields)
+	PrivateFields []string `json:"private_fields" redis:"privateFields"`
 
 	// Audit fields
 	Created  string `json:"created" redis:"created"`
@@ -67,32 +69,39 @@ type CreateIShopRequest struct {
 	// Industry
 	Industry    string `json:"industry"`
 	SubIndustry string `json:"sub_industry"`
+
+	// Contact fields left out of public exports
+	PrivateFields []string `json:"private_fields" binding:"omitempty,dive,oneof=phone email website street location"`
 }
 
 // UpdateIShopRequest represents request to update iShop
+// Only non-empty fields are written (see hashcodec.MarshalPartial)
 type UpdateIShopRequest struct {
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Logo        string   `json:"logo"`
-	Banner      string   `json:"banner"`
-	ImageURLs   []string `json:"image_urls"`
+	Name        string   `json:"name" redis:"name"`
+	Description string   `json:"description" redis:"description"`
+	Logo        string   `json:"logo" redis:"logo"`
+	Banner      string   `json:"banner" redis:"banner"`
+	ImageURLs   []string `json:"image_urls" redis:"imageUrls"`
 
 	// Address
-	Province string  `json:"province"`
-	District string  `json:"district"`
-	Ward     string  `json:"ward"`
-	Street   string  `json:"street"`
-	Lat      float64 `json:"lat"`
-	Lng      float64 `json:"lng"`
+	Province string  `json:"province" redis:"province"`
+	District string  `json:"district" redis:"district"`
+	Ward     string  `json:"ward" redis:"ward"`
+	Street   string  `json:"street" redis:"street"`
+	Lat      float64 `json:"lat" redis:"lat"`
+	Lng      float64 `json:"lng" redis:"lng"`
 
 	// Contact
-	Phone   string `json:"phone"`
-	Email   string `json:"email" binding:"omitempty,email"`
-	Website string `json:"website"`
+	Phone   string `json:"phone" redis:"phone"`
+	Email   string `json:"email" binding:"omitempty,email" redis:"email"`
+	Website string `json:"website" redis:"website"`
 
 	// Industry
-	Industry    string `json:"industry"`
-	SubIndustry string `json:"sub_industry"`
+	Industry    string `json:"industry" redis:"industry"`
+	SubIndustry string `json:"sub_industry" redis:"subIndustry"`
+
+	// Privacy; an empty list makes every field public again
+	PrivateFields []string `json:"private_fields" binding:"omitempty,dive,oneof=phone email website street location" redis:"privateFields"`
 }
 
 // IShopResponse represents full iShop details with memberships
@@ -112,3 +121,39 @@ type IShopMembershipInfo struct {
 	Role       string  `json:"role"`
 	Score      float64 `json:"score"` // Membership score/timestamp
 }
+
+// Shop fields an owner can keep out of public exports; "location" covers the
+// coordinates
+var ShopPrivateFields = []string{"phone", "email", "website", "street", "location"}
+
+// Reasons a shop is suggested as a possible duplicate
+const (
+	DuplicateReasonPhone      = "phone"
+	DuplicateReasonEmail      = "email"
+	DuplicateReasonNameNearby = "name_nearby"
+)
+
+// DuplicateCheckRequest describes a shop about to be created
+type DuplicateCheckRequest struct {
+	Name  string  `json:"name"`
+	Phone string  `json:"phone"`
+	Email string  `json:"email"`
+	Lat   float64 `json:"lat"`
+	Lng   float64 `json:"lng"`
+}
+
+// DuplicateCandidate is an existing shop that may be the same business
+type DuplicateCandidate struct {
+	ShopID   string   `json:"shop_id"`
+	Name     string   `json:"name"`
+	Logo     string   `json:"logo"`
+	Phone    string   `json:"phone"`
+	Email    string   `json:"email"`
+	Province string   `json:"province"`
+	District string   `json:"district"`
+	Street   string   `json:"street"`
+	Distance float64  `json:"distance_m,omitempty"` // Meters, for name matches
+	Reasons  []string `json:"reasons"`
+	// Whether the shop already belongs to the iCom being checked
+	AlreadyMember bool `json:"already_member"`
+}
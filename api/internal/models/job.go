@@ -0,0 +1,53 @@
+package models
+
+// Job statuses
+const (
+	JobStatusScheduled = "scheduled" // waiting for its next run
+	JobStatusRunning   = "running"
+	JobStatusRetrying  = "retrying" // the last attempt failed, another is scheduled
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed" // every attempt failed
+)
+
+// JobStatuses lists every job status
+var JobStatuses = []string{JobStatusScheduled, JobStatusRunning, JobStatusRetrying, JobStatusSucceeded, JobStatusFailed}
+
+// Job is a recurring or one-off background job run by the scheduler
+type Job struct {
+	ID             string `json:"id" redis:"id"`
+	Kind           string `json:"kind" redis:"kind"`                   // handler that runs the job
+	Schedule       string `json:"schedule,omitempty" redis:"schedule"` // cron expression of recurring jobs
+	Payload        string `json:"payload,omitempty" redis:"payload"`   // input of one-off jobs
+	Status         string `json:"status" redis:"status"`
+	Attempt        int    `json:"attempt" redis:"attempt"` // failed attempts of the current run
+	MaxAttempts    int    `json:"max_attempts" redis:"maxAttempts"`
+	NextRunAt      string `json:"next_run_at,omitempty" redis:"nextRunAt"`
+	LastRunAt      string `json:"last_run_at,omitempty" redis:"lastRunAt"`
+	LastDurationMs int64  `json:"last_duration_ms" redis:"lastDurationMs"`
+	LastError      string `json:"last_error,omitempty" redis:"lastError"`
+	LastInstance   string `json:"last_instance,omitempty" redis:"lastInstance"` // API instance of the last run
+	Runs           int    `json:"runs" redis:"runs"`
+	Failures       int    `json:"failures" redis:"failures"`
+	Created        string `json:"created" redis:"created"`
+	Modified       string `json:"modified" redis:"modified"`
+
+	History []JobRun `json:"history,omitempty" redis:"-"`
+}
+
+// JobRun is one attempt at running a job
+type JobRun struct {
+	JobID      string `json:"job_id"`
+	Attempt    int    `json:"attempt"`
+	Status     string `json:"status"` // succeeded or failed
+	Error      string `json:"error,omitempty"`
+	Instance   string `json:"instance"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// JobList lists the scheduler's jobs, soonest next run first
+type JobList struct {
+	Jobs  []Job `json:"jobs"`
+	Total int   `json:"total"`
+}
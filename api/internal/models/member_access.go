@@ -0,0 +1,9 @@
+package models
+
+// MemberAccess is the access token of a member shop. Members pass it as the
+// token query parameter or X-Member-Token header to see members-only events
+// and announcements, subscribe to feeds and RSVP as their shop.
+type MemberAccess struct {
+	ShopID string `json:"shop_id"`
+	Token  string `json:"token"`
+}
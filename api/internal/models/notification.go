@@ -0,0 +1,30 @@
+package models
+
+// Notification types
+const (
+	NotificationApplicationApproved = "application.approved"
+	NotificationApplicationRejected = "application.rejected"
+	NotificationMembershipExpiring  = "membership.expiring"
+	NotificationMembershipExpired   = "membership.expired"
+	NotificationMembershipRenewed   = "membership.renewed"
+	NotificationEventSeatConfirmed  = "event.seat_confirmed"
+	NotificationAnnouncement        = "announcement.published"
+)
+
+// Notification is a message in a shop's inbox
+type Notification struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	IComID  string `json:"icom_id,omitempty"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Created string `json:"created"`
+}
+
+// NotificationListResponse represents a page of a shop's inbox, newest first
+type NotificationListResponse struct {
+	Notifications []Notification `json:"notifications"`
+	Total         int            `json:"total"`
+	Page          int            `json:"page"`
+	Limit         int            `json:"limit"`
+}
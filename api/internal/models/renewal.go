@@ -0,0 +1,37 @@
+package models
+
+// Renewal modes
+const (
+	RenewalModeManual = "manual" // memberships lapse to EXPIRED unless renewed
+	RenewalModeAuto   = "auto"   // memberships renew themselves at expiry
+)
+
+// RenewalPolicy decides when the memberships of an iCom expire
+type RenewalPolicy struct {
+	TermMonths   int    `json:"term_months" binding:"min=0,max=120"`        // 0 means memberships never expire
+	Mode         string `json:"mode" binding:"omitempty,oneof=manual auto"` // defaults to manual
+	ReminderDays []int  `json:"reminder_days" binding:"dive,min=1,max=365"` // days before expiry, defaults to 30, 7 and 1
+	GraceDays    int    `json:"grace_days" binding:"min=0,max=365"`         // days after the expiry date before the membership lapses
+}
+
+// RenewMembershipRequest extends a membership
+type RenewMembershipRequest struct {
+	Months int `json:"months" binding:"min=0,max=120"` // defaults to the policy term
+}
+
+// MembershipRenewal is the outcome of renewing a membership
+type MembershipRenewal struct {
+	ShopID       string `json:"shop_id"`
+	Status       string `json:"status"`
+	OldExpiresAt string `json:"old_expires_at,omitempty"`
+	ExpiresAt    string `json:"expires_at"`
+}
+
+// ExpiryRun is the outcome of a pass of the expiry scheduler over an iCom
+type ExpiryRun struct {
+	IComID   string `json:"icom_id"`
+	Assigned int    `json:"assigned"` // active members given their first expiry date
+	Reminded int    `json:"reminded"`
+	Renewed  int    `json:"renewed"` // renewed automatically
+	Expired  int    `json:"expired"`
+}
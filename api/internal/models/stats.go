@@ -0,0 +1,50 @@
+package models
+
+// Time series intervals
+const (
+	StatsIntervalDay   = "day"
+	StatsIntervalWeek  = "week"
+	StatsIntervalMonth = "month"
+)
+
+// Time series metrics
+const (
+	StatsMetricJoins        = "joins"        // memberships that became active
+	StatsMetricLeaves       = "leaves"       // non-pending memberships removed
+	StatsMetricLikes        = "likes"        // likes minus unlikes
+	StatsMetricInteractions = "interactions" // recorded interactions
+)
+
+// StatsMetrics lists every time series metric
+var StatsMetrics = []string{StatsMetricJoins, StatsMetricLeaves, StatsMetricLikes, StatsMetricInteractions}
+
+// StatsTimeSeriesRequest selects the series returned by GetIComStatsTimeSeries
+type StatsTimeSeriesRequest struct {
+	From     string   // YYYY-MM-DD, inclusive
+	To       string   // YYYY-MM-DD, inclusive
+	Interval string   // day, week or month
+	Metrics  []string // defaults to StatsMetrics
+}
+
+// StatsPoint is the value of a metric over one period
+type StatsPoint struct {
+	Period string `json:"period"` // 2026-10-19, 2026-W42 or 2026-10
+	Start  string `json:"start"`  // first day of the period
+	Value  int64  `json:"value"`
+}
+
+// StatsSeries is one metric over the requested range
+type StatsSeries struct {
+	Metric string       `json:"metric"`
+	Total  int64        `json:"total"`
+	Points []StatsPoint `json:"points"`
+}
+
+// StatsTimeSeriesResponse holds the requested series, one point per period
+type StatsTimeSeriesResponse struct {
+	Interval string        `json:"interval"`
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Timezone string        `json:"timezone"`
+	Series   []StatsSeries `json:"series"`
+}
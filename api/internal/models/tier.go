@@ -0,0 +1,63 @@
+package models
+
+// DefaultTierCode is the rank of every member of an iCom that has not
+// defined its own tiers
+const DefaultTierCode = "MEMBER"
+
+// MembershipTier is a rank an iCom defines for its members. Tiers are listed
+// from lowest to highest; the first one is the base tier new members get.
+type MembershipTier struct {
+	Code      string         `json:"code" binding:"required"` // stored as the membership rank, e.g. GOLD
+	Name      string         `json:"name" binding:"required"`
+	Color     string         `json:"color" binding:"omitempty,hexcolor"`
+	Benefits  string         `json:"benefits"`
+	Level     int            `json:"level"` // position in the list, 0 for the base tier
+	Promotion *PromotionRule `json:"promotion,omitempty"`
+}
+
+// PromotionRule makes a tier automatic: members of an automatic tier (or of
+// the base tier) are moved to the highest automatic tier whose rule they
+// meet. Tiers above the base without a rule are assigned by hand only.
+type PromotionRule struct {
+	MinScore      float64 `json:"min_score,omitempty"`
+	ScoreType     string  `json:"score_type,omitempty" binding:"omitempty,oneof=interactions likes"` // leaderboard, defaults to interactions
+	MinMemberDays int     `json:"min_member_days,omitempty" binding:"min=0"`                         // days since joining
+}
+
+// SetTiersRequest replaces the tiers of an iCom, lowest first
+type SetTiersRequest struct {
+	Tiers []MembershipTier `json:"tiers" binding:"required,min=1,dive"`
+}
+
+// Tier change reasons
+const (
+	TierChangePromotion = "promotion"
+	TierChangeDemotion  = "demotion"
+)
+
+// TierChange records one rank change made by the tier evaluator
+type TierChange struct {
+	ShopID     string  `json:"shop_id"`
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Reason     string  `json:"reason"` // promotion or demotion
+	Score      float64 `json:"score"`
+	MemberDays int     `json:"member_days"`
+	Created    string  `json:"created"`
+}
+
+// TierChangeList is a page of the tier audit trail, newest first
+type TierChangeList struct {
+	Entries []TierChange `json:"entries"`
+	Total   int          `json:"total"`
+	Page    int          `json:"page"`
+	Limit   int          `json:"limit"`
+}
+
+// TierEvaluation is the outcome of evaluating the tiers of an iCom
+type TierEvaluation struct {
+	IComID    string       `json:"icom_id"`
+	Evaluated int          `json:"evaluated"` // active members on an automatic or base tier
+	DryRun    bool         `json:"dry_run"`
+	Changes   []TierChange `json:"changes"`
+}
@@ -0,0 +1,85 @@
+package models
+
+// Webhook event names delivered to subscribers
+const (
+	WebhookEventMemberJoined        = "member.joined"
+	WebhookEventMemberStatusChanged = "member.status_changed"
+	WebhookEventMemberRemoved       = "member.removed"
+	WebhookEventMemberApplied       = "member.applied"
+	WebhookEventMemberRejected      = "member.rejected"
+	WebhookEventLikesThreshold      = "likes.threshold"
+	WebhookEventPing                = "ping"
+)
+
+// WebhookEvents lists the event names a subscription may filter on
+var WebhookEvents = []string{
+	WebhookEventMemberJoined,
+	WebhookEventMemberStatusChanged,
+	WebhookEventMemberRemoved,
+	WebhookEventMemberApplied,
+	WebhookEventMemberRejected,
+	WebhookEventLikesThreshold,
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// Webhook is an outbound HTTP subscription owned by an iCom
+type Webhook struct {
+	ID             string   `json:"id" redis:"id"`
+	IComID         string   `json:"icom_id" redis:"icomId"`
+	URL            string   `json:"url" redis:"url"`
+	Events         []string `json:"events" redis:"events"` // empty means every event
+	Secret         string   `json:"secret,omitempty" redis:"secret"`
+	Active         bool     `json:"active" redis:"active"`
+	LikeThresholds []int    `json:"like_thresholds" redis:"likeThresholds"` // like counts that fire likes.threshold
+	Created        string   `json:"created" redis:"created"`
+	Modified       string   `json:"modified" redis:"modified"`
+}
+
+// CreateWebhookRequest represents request to register a webhook
+type CreateWebhookRequest struct {
+	URL            string   `json:"url" binding:"required,url"`
+	Events         []string `json:"events"`
+	Secret         string   `json:"secret"` // generated when empty
+	Active         *bool    `json:"active"` // defaults to true
+	LikeThresholds []int    `json:"like_thresholds" binding:"dive,min=1"`
+}
+
+// UpdateWebhookRequest represents request to update a webhook
+// Only non-empty fields are written (see hashcodec.MarshalPartial)
+type UpdateWebhookRequest struct {
+	URL            string   `json:"url" binding:"omitempty,url" redis:"url"`
+	Events         []string `json:"events" redis:"events"`
+	Secret         string   `json:"secret" redis:"secret"`
+	Active         *bool    `json:"active" redis:"active"`
+	LikeThresholds []int    `json:"like_thresholds" binding:"omitempty,dive,min=1" redis:"likeThresholds"`
+}
+
+// WebhookDelivery is one attempt record for sending an event to a webhook
+type WebhookDelivery struct {
+	ID            string `json:"id" redis:"id"`
+	WebhookID     string `json:"webhook_id" redis:"webhookId"`
+	Event         string `json:"event" redis:"event"`
+	SourceEventID string `json:"source_event_id" redis:"sourceEventId"`
+	Payload       string `json:"payload" redis:"payload"`
+	Status        string `json:"status" redis:"status"`
+	Attempts      int    `json:"attempts" redis:"attempts"`
+	ResponseCode  int    `json:"response_code" redis:"responseCode"`
+	Error         string `json:"error" redis:"error"`
+	NextAttemptAt string `json:"next_attempt_at" redis:"nextAttemptAt"`
+	Created       string `json:"created" redis:"created"`
+	Modified      string `json:"modified" redis:"modified"`
+}
+
+// WebhookDeliveryList represents a page of a webhook's delivery log
+type WebhookDeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Total      int               `json:"total"`
+	Page       int               `json:"page"`
+	Limit      int               `json:"limit"`
+}
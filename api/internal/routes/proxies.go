@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trustedPlatforms maps TRUSTED_PLATFORM names to the header their edge sets
+// to the client address
+var trustedPlatforms = map[string]string{
+	"cloudflare": gin.PlatformCloudflare,
+	"appengine":  gin.PlatformGoogleAppEngine,
+	"flyio":      gin.PlatformFlyIO,
+}
+
+// configureProxies decides where c.ClientIP() takes the client address
+// from. Rate limits and anonymous visitor IDs rely on it, so by default no
+// proxy is trusted and the peer address of the connection is used; a client
+// cannot pick its address through X-Forwarded-For.
+//
+// Behind a reverse proxy or load balancer set TRUSTED_PROXIES to its
+// addresses or CIDRs, comma separated, and its X-Forwarded-For is believed.
+// Behind a platform edge set TRUSTED_PLATFORM to cloudflare, appengine, flyio
+// or the name of the header the edge sets.
+func configureProxies(r *gin.Engine) {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	if platform := strings.TrimSpace(os.Getenv("TRUSTED_PLATFORM")); platform != "" {
+		if header, ok := trustedPlatforms[strings.ToLower(platform)]; ok {
+			platform = header
+		}
+		r.TrustedPlatform = platform
+	}
+}
@@ -18,6 +18,9 @@ import (
 func SetupRouter() *gin.Engine {
 	r := gin.Default()
 
+	// Chỉ tin địa chỉ client từ proxy/nền tảng được cấu hình (TRUSTED_PROXIES, TRUSTED_PLATFORM)
+	configureProxies(r)
+
 	// CORS Configuration
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:3001"},
@@ -28,6 +31,10 @@ func SetupRouter() *gin.Engine {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Health probes for the load balancer
+	r.GET("/healthz", handlers.Healthz)
+	r.GET("/readyz", handlers.Readyz)
+
 	// Swagger setup (uncomment after running swag init)
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	
@@ -54,19 +61,41 @@ func SetupRouter() *gin.Engine {
 			// Xem danh sách thành viên
 			icomPublic.GET("/:id/members", handlers.ListMembers)
 			icomPublic.POST("/:id/members/filter", handlers.FilterMembers)
+			icomPublic.GET("/:id/members/export", handlers.ExportMembers)
 			icomPublic.GET("/:id/search", handlers.GlobalSearch)
 			icomPublic.GET("/:id/members/:shop_id", handlers.GetMemberDetail)
 			
 			// Xem bảng xếp hạng & tìm kiếm
 			icomPublic.GET("/:id/leaderboard", handlers.GetLeaderboard)
+			icomPublic.GET("/:id/live", handlers.StreamLive)
 			icomPublic.POST("/:id/geo-search", handlers.GeoSearch)
 			
 			// Xem Ban Chấp Hành
 			icomPublic.GET("/:id/board", handlers.ListBoardMembers)
+			icomPublic.GET("/:id/board/terms", handlers.ListBoardTerms)
+			
+			// Xem hạng thành viên & quyền lợi
+			icomPublic.GET("/:id/tiers", handlers.ListTiers)
 			
 			// Xem các nút chức năng
 			icomPublic.GET("/:id/actions", handlers.ListActions)
+			// Ghi nhận lượt bấm nút chức năng
+			icomPublic.GET("/:id/actions/:action_id/go", handlers.FollowAction)
+			icomPublic.POST("/:id/actions/:action_id/click", handlers.RecordActionClick)
 			icomPublic.GET("/:id/metadata", handlers.GetIComMetadata)
+
+			// Sự kiện & đăng ký tham dự (events calendar)
+			icomPublic.GET("/:id/events", handlers.ListCalendarEvents)
+			icomPublic.GET("/:id/events.ics", handlers.GetCalendarFeed)
+			icomPublic.GET("/:id/events/:event_id", handlers.GetCalendarEvent)
+			icomPublic.POST("/:id/events/:event_id/rsvp", handlers.RSVPCalendarEvent)
+			icomPublic.DELETE("/:id/events/:event_id/rsvp", handlers.WithdrawCalendarRSVP)
+
+			// Tin tức & thông báo (announcements), RSS/Atom feed
+			icomPublic.GET("/:id/announcements", handlers.ListAnnouncements)
+			icomPublic.GET("/:id/announcements.rss", handlers.GetAnnouncementsRSS)
+			icomPublic.GET("/:id/announcements.atom", handlers.GetAnnouncementsAtom)
+			icomPublic.GET("/:id/announcements/:announcement_id", handlers.GetAnnouncement)
 			
 			// Tương tác (có thể public hoặc yêu cầu auth tùy logic nghiệp vụ)
 			icomPublic.POST("/:id/interactions/:shop_id", handlers.IncrementInteractions)
@@ -86,23 +115,118 @@ func SetupRouter() *gin.Engine {
 			icomAdmin.PUT("/:id", handlers.UpdateICom)
 			icomAdmin.DELETE("/:id", handlers.DeleteICom)
 			icomAdmin.GET("/:id/stats", handlers.GetIComStats)
+			icomAdmin.GET("/:id/stats/timeseries", handlers.GetIComStatsTimeSeries)
 
 			// Quản lý Members
 			icomAdmin.POST("/:id/members", handlers.AddMember)
+			icomAdmin.GET("/:id/members/violations", handlers.GetMemberViolations)
+			icomAdmin.POST("/:id/members/duplicates", handlers.CheckDuplicateShops)
 			icomAdmin.PUT("/:id/members/:shop_id/status", handlers.UpdateMemberStatus)
 			icomAdmin.PUT("/:id/members/:shop_id/order", handlers.UpdateMemberOrder)
 			icomAdmin.DELETE("/:id/members/:shop_id", handlers.RemoveMember)
+			icomAdmin.POST("/:id/members/:shop_id/renew", handlers.RenewMembership)
+			icomAdmin.POST("/:id/members/:shop_id/access-token", handlers.IssueMemberAccessToken)
+			icomAdmin.DELETE("/:id/members/:shop_id/access-token", handlers.RevokeMemberAccessToken)
+
+			// Thời hạn thành viên & gia hạn (renewal)
+			icomAdmin.GET("/:id/renewal", handlers.GetRenewalPolicy)
+			icomAdmin.PUT("/:id/renewal", handlers.SetRenewalPolicy)
+			icomAdmin.POST("/:id/renewal/run", handlers.RunMembershipExpiry)
+
+			// Hạng thành viên (tiers) & xét lên/xuống hạng tự động
+			icomAdmin.PUT("/:id/tiers", handlers.SetTiers)
+			icomAdmin.POST("/:id/tiers/evaluate", handlers.EvaluateTiers)
+			icomAdmin.GET("/:id/tiers/audit", handlers.ListTierAudit)
+
+			// Hội phí, hóa đơn & thanh toán (dues)
+			icomAdmin.GET("/:id/dues", handlers.GetDuesSettings)
+			icomAdmin.PUT("/:id/dues", handlers.SetDuesSettings)
+			icomAdmin.POST("/:id/dues/run", handlers.RunDues)
+			icomAdmin.GET("/:id/dues/dashboard", handlers.GetDuesDashboard)
+			icomAdmin.GET("/:id/dues/invoices", handlers.ListInvoices)
+			icomAdmin.GET("/:id/dues/invoices/:invoice_id", handlers.GetInvoice)
+			icomAdmin.POST("/:id/dues/invoices/:invoice_id/payments", handlers.RecordPayment)
+			icomAdmin.POST("/:id/dues/invoices/:invoice_id/waive", handlers.WaiveInvoice)
+			icomAdmin.POST("/:id/dues/invoices/:invoice_id/checkout", handlers.CreateCheckout)
+
+			// Đơn xin gia nhập (membership applications)
+			icomAdmin.POST("/:id/applications", handlers.ApplyMembership)
+			icomAdmin.GET("/:id/applications", handlers.ListApplications)
+			icomAdmin.POST("/:id/applications/bulk", handlers.BulkReviewApplications)
+			icomAdmin.POST("/:id/applications/:shop_id/approve", handlers.ApproveApplication)
+			icomAdmin.POST("/:id/applications/:shop_id/reject", handlers.RejectApplication)
+			icomAdmin.GET("/:id/waitlist", handlers.ListWaitlist)
+
+			// Nhập thành viên hàng loạt (bulk import)
+			icomAdmin.POST("/:id/imports", handlers.ImportMembers)
+			icomAdmin.GET("/:id/imports", handlers.ListImports)
+			icomAdmin.GET("/:id/imports/:import_id", handlers.GetImport)
+			icomAdmin.GET("/:id/imports/:import_id/errors", handlers.DownloadImportErrors)
+
+			// Chống gian lận tương tác (interaction anomalies & score adjustments)
+			icomAdmin.GET("/:id/interactions/anomalies", handlers.GetInteractionAnomalies)
+			icomAdmin.GET("/:id/interactions/audit", handlers.ListScoreAudit)
+			icomAdmin.POST("/:id/interactions/:shop_id/adjust", handlers.AdjustInteractionScore)
+			icomAdmin.GET("/:id/likes/reconcile", handlers.ReconcileLikes)
+			icomAdmin.POST("/:id/likes/reconcile", handlers.ReconcileLikes)
+
+			// Link mời & mã tham gia (invites)
+			icomAdmin.POST("/:id/invites", handlers.CreateInvite)
+			icomAdmin.GET("/:id/invites", handlers.ListInvites)
+			icomAdmin.GET("/:id/invites/:code", handlers.GetInvite)
+			icomAdmin.DELETE("/:id/invites/:code", handlers.RevokeInvite)
 
 			// Quản lý Ban Chấp Hành
 			icomAdmin.POST("/:id/board", handlers.AddBoardMember)
+			icomAdmin.PUT("/:id/board/order", handlers.ReorderBoard)
 			icomAdmin.PUT("/:id/board/:member_id", handlers.UpdateBoardMember)
 			icomAdmin.DELETE("/:id/board/:member_id", handlers.RemoveBoardMember)
 
 			icomAdmin.POST("/:id/actions", handlers.AddAction)
+			icomAdmin.PUT("/:id/actions/order", handlers.ReorderActions)
+			icomAdmin.GET("/:id/actions/analytics", handlers.GetActionAnalytics)
 			icomAdmin.PUT("/:id/actions/:action_id", handlers.UpdateAction)
 			icomAdmin.DELETE("/:id/actions/:action_id", handlers.RemoveAction)
+
+			// Quản lý sự kiện, danh sách tham dự & check-in
+			icomAdmin.POST("/:id/events", handlers.CreateCalendarEvent)
+			icomAdmin.PUT("/:id/events/:event_id", handlers.UpdateCalendarEvent)
+			icomAdmin.DELETE("/:id/events/:event_id", handlers.DeleteCalendarEvent)
+			icomAdmin.GET("/:id/events/:event_id/attendees", handlers.ListEventAttendees)
+			icomAdmin.DELETE("/:id/events/:event_id/attendees/:attendee_id", handlers.CancelEventAttendee)
+			icomAdmin.POST("/:id/events/:event_id/attendees/:attendee_id/checkin", handlers.CheckInAttendee)
+			icomAdmin.DELETE("/:id/events/:event_id/attendees/:attendee_id/checkin", handlers.UndoCheckInAttendee)
+
+			// Đăng & quản lý tin tức (announcements)
+			icomAdmin.POST("/:id/announcements", handlers.CreateAnnouncement)
+			icomAdmin.PUT("/:id/announcements/:announcement_id", handlers.UpdateAnnouncement)
+			icomAdmin.DELETE("/:id/announcements/:announcement_id", handlers.DeleteAnnouncement)
+
+			// Webhooks
+			icomAdmin.GET("/:id/webhooks", handlers.ListWebhooks)
+			icomAdmin.POST("/:id/webhooks", handlers.CreateWebhook)
+			icomAdmin.GET("/:id/webhooks/:webhook_id", handlers.GetWebhook)
+			icomAdmin.PUT("/:id/webhooks/:webhook_id", handlers.UpdateWebhook)
+			icomAdmin.DELETE("/:id/webhooks/:webhook_id", handlers.DeleteWebhook)
+			icomAdmin.POST("/:id/webhooks/:webhook_id/ping", handlers.PingWebhook)
+			icomAdmin.GET("/:id/webhooks/:webhook_id/deliveries", handlers.ListWebhookDeliveries)
+			icomAdmin.POST("/:id/webhooks/:webhook_id/deliveries/:delivery_id/replay", handlers.ReplayWebhookDelivery)
 		}
 
+		// ============================================
+		// Invite Routes (xem công khai, tham gia cần đăng nhập)
+		// ============================================
+		api.GET("/invite/:code", handlers.GetInviteInfo)
+		api.POST("/invite/:code/join", middleware.AuthMiddleware(), handlers.JoinByInvite)
+
+		// ============================================
+		// Payment Routes (cổng thanh toán gọi lại, xác thực bằng chữ ký)
+		// ============================================
+		api.POST("/payments/callback/:provider", handlers.PaymentCallback)
+		// Cổng thanh toán giả lập (chỉ khi bật PAYMENT_FAKE_GATEWAY)
+		api.GET("/payments/fake/:checkout_id", handlers.GetFakeCheckout)
+		api.POST("/payments/fake/:checkout_id", handlers.CompleteFakeCheckout)
+
 		// ============================================
 		// iShop PUBLIC Routes (Không cần authentication)
 		// ============================================
@@ -122,6 +246,20 @@ func SetupRouter() *gin.Engine {
 			ishopAdmin.POST("", handlers.CreateIShop)
 			ishopAdmin.PUT("/:id", handlers.UpdateIShop)
 			ishopAdmin.DELETE("/:id", handlers.DeleteIShop)
+			ishopAdmin.GET("/:id/notifications", handlers.ListIShopNotifications)
+			ishopAdmin.GET("/:id/likes", handlers.GetIShopLikes)
+		}
+
+		// ============================================
+		// System ADMIN Routes (Yêu cầu authentication)
+		// ============================================
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware())
+		{
+			// Tác vụ nền (scheduler): trạng thái & lịch sử chạy
+			admin.GET("/jobs", handlers.ListJobs)
+			admin.GET("/jobs/:id", handlers.GetJob)
+			admin.POST("/jobs/:id/run", handlers.RunJob)
 		}
 		
 
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Clicks on an action button are counted per day in the statistics time zone:
+//
+//	icom:<id>:action:<action>:clicks            hash of YYYY-MM-DD -> clicks, plus "total"
+//	icom:<id>:action:<action>:visitors          HyperLogLog of every visitor
+//	icom:<id>:action:<action>:visitors:<day>    HyperLogLog of the day's visitors
+
+// actionVisitorsTTL keeps daily visitor estimates as long as a time series can reach
+const actionVisitorsTTL = statsMaxPoints * 24 * time.Hour
+
+func actionClicksKey(icomID, actionID string) string {
+	return fmt.Sprintf("icom:%s:action:%s:clicks", icomID, actionID)
+}
+
+// actionVisitorsKey is the all-time visitor estimate, or a day's when day is set
+func actionVisitorsKey(icomID, actionID, day string) string {
+	if day == "" {
+		return fmt.Sprintf("icom:%s:action:%s:visitors", icomID, actionID)
+	}
+	return fmt.Sprintf("icom:%s:action:%s:visitors:%s", icomID, actionID, day)
+}
+
+// RecordActionClick counts a click on a visible action and returns the URL
+// the button opens. visitorID identifies the visitor in the unique visitor
+// estimates; handlers pass the client IP.
+func (s *IComService) RecordActionClick(ctx context.Context, icomID, actionID, visitorID string) (string, error) {
+	data, err := s.rdb.HGetAll(ctx, actionKey(icomID, actionID)).Result()
+	if err != nil {
+		return "", err
+	}
+	var action models.ActionButton
+	if len(data) == 0 || hashcodec.Unmarshal(data, &action) != nil {
+		return "", ErrActionNotFound
+	}
+	now := time.Now()
+	if !actionVisible(action, now) {
+		return "", ErrActionNotFound
+	}
+
+	day := rankDay(now)
+	clicksKey := actionClicksKey(icomID, actionID)
+	dayVisitors := actionVisitorsKey(icomID, actionID, day)
+
+	pipe := s.rdb.Pipeline()
+	pipe.HIncrBy(ctx, clicksKey, day, 1)
+	pipe.HIncrBy(ctx, clicksKey, "total", 1)
+	pipe.PFAdd(ctx, actionVisitorsKey(icomID, actionID, ""), visitorID)
+	pipe.PFAdd(ctx, dayVisitors, visitorID)
+	pipe.Expire(ctx, dayVisitors, actionVisitorsTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return action.URL, nil
+}
+
+// clearActionClicks queues the removal of an action's click counters. Daily
+// visitor estimates are left to expire.
+func clearActionClicks(ctx context.Context, pipe redis.Pipeliner, icomID, actionID string) {
+	pipe.Del(ctx, actionClicksKey(icomID, actionID), actionVisitorsKey(icomID, actionID, ""))
+}
+
+// GetActionAnalytics returns every action of an iCom, in order, with its
+// clicks per day between from and to (YYYY-MM-DD, inclusive). The range
+// defaults to the last 30 days.
+func (s *IComService) GetActionAnalytics(ctx context.Context, icomID, from, to string) (*models.ActionAnalyticsResponse, error) {
+	days, err := analyticsDays(from, to, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	actions, err := s.GetActions(ctx, icomID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, len(days)+1)
+	for i, d := range days {
+		fields[i] = d
+	}
+	fields[len(days)] = "total"
+
+	pipe := s.rdb.Pipeline()
+	clickCmds := make([]*redis.SliceCmd, len(actions))
+	totalVisitorCmds := make([]*redis.IntCmd, len(actions))
+	rangeVisitorCmds := make([]*redis.IntCmd, len(actions))
+	dayVisitorCmds := make([][]*redis.IntCmd, len(actions))
+	for i, action := range actions {
+		clickCmds[i] = pipe.HMGet(ctx, actionClicksKey(icomID, action.ActionID), fields...)
+		totalVisitorCmds[i] = pipe.PFCount(ctx, actionVisitorsKey(icomID, action.ActionID, ""))
+		dayKeys := make([]string, len(days))
+		dayVisitorCmds[i] = make([]*redis.IntCmd, len(days))
+		for j, d := range days {
+			dayKeys[j] = actionVisitorsKey(icomID, action.ActionID, d)
+			dayVisitorCmds[i][j] = pipe.PFCount(ctx, dayKeys[j])
+		}
+		// PFCOUNT over several keys estimates their union
+		rangeVisitorCmds[i] = pipe.PFCount(ctx, dayKeys...)
+	}
+	if len(actions) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+
+	response := &models.ActionAnalyticsResponse{
+		From:     days[0],
+		To:       days[len(days)-1],
+		Timezone: statsLocation().String(),
+		Actions:  make([]models.ActionAnalytics, 0, len(actions)),
+	}
+	for i, action := range actions {
+		counts := make([]int64, len(fields))
+		for j, raw := range stringValues(clickCmds[i].Val(), len(fields)) {
+			fmt.Sscan(raw, &counts[j])
+		}
+		a := models.ActionAnalytics{
+			Action:        action,
+			TotalClicks:   counts[len(days)],
+			TotalVisitors: totalVisitorCmds[i].Val(),
+			Visitors:      rangeVisitorCmds[i].Val(),
+			Days:          make([]models.ActionClickDay, len(days)),
+		}
+		for j, d := range days {
+			a.Days[j] = models.ActionClickDay{
+				Date:     d,
+				Clicks:   counts[j],
+				Visitors: dayVisitorCmds[i][j].Val(),
+			}
+			a.Clicks += a.Days[j].Clicks
+		}
+		response.Actions = append(response.Actions, a)
+	}
+	return response, nil
+}
+
+// analyticsDays lists the days from..to in the statistics time zone, oldest
+// first, defaulting to the 30 days ending today
+func analyticsDays(from, to string, now time.Time) ([]string, error) {
+	loc := statsLocation()
+	end := periodStart(models.StatsIntervalDay, now.In(loc))
+	if to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: to must be YYYY-MM-DD", ErrStatsRange)
+		}
+		end = t
+	}
+	start := end.AddDate(0, 0, -29)
+	if from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: from must be YYYY-MM-DD", ErrStatsRange)
+		}
+		start = t
+	}
+	if start.After(end) {
+		return nil, fmt.Errorf("%w: from is after to", ErrStatsRange)
+	}
+
+	var days []string
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if len(days) == statsMaxPoints {
+			return nil, fmt.Errorf("%w: more than %d days", ErrStatsRange, statsMaxPoints)
+		}
+		days = append(days, d.Format("2006-01-02"))
+	}
+	return days, nil
+}
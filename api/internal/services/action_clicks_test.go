@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"i-manage/internal/models"
+)
+
+func TestActionClicks(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+	service := NewIComService()
+
+	id, err := service.AddAction(ctx, "1", models.AddActionRequest{Type: "url", Title: "Join", URL: "example.com/join"})
+	if err != nil {
+		t.Fatalf("AddAction: %v", err)
+	}
+	inactive := false
+	hidden, _ := service.AddAction(ctx, "1", models.AddActionRequest{Type: "url", Title: "Old", URL: "example.com", Active: &inactive})
+
+	for _, visitor := range []string{"a", "b", "a"} {
+		url, err := service.RecordActionClick(ctx, "1", id, visitor)
+		if err != nil || url != "https://example.com/join" {
+			t.Fatalf("RecordActionClick = %q, %v", url, err)
+		}
+	}
+	if _, err := service.RecordActionClick(ctx, "1", hidden, "a"); !errors.Is(err, ErrActionNotFound) {
+		t.Errorf("click on inactive action err = %v", err)
+	}
+
+	today := rankDay(time.Now())
+	report, err := service.GetActionAnalytics(ctx, "1", "", "")
+	if err != nil {
+		t.Fatalf("GetActionAnalytics: %v", err)
+	}
+	if len(report.Actions) != 2 || report.To != today || len(report.Actions[0].Days) != 30 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	join := report.Actions[0]
+	last := join.Days[len(join.Days)-1]
+	if join.TotalClicks != 3 || join.Clicks != 3 || join.TotalVisitors != 2 || join.Visitors != 2 || last.Clicks != 3 || last.Visitors != 2 {
+		t.Errorf("unexpected analytics %+v", join)
+	}
+
+	if _, err := service.GetActionAnalytics(ctx, "1", today, "2020-01-01"); !errors.Is(err, ErrStatsRange) {
+		t.Errorf("reversed range err = %v", err)
+	}
+}
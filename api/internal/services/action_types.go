@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"i-manage/internal/models"
+)
+
+// Action validation errors surfaced to handlers
+var (
+	ErrActionType   = errors.New("unknown action type")
+	ErrActionTarget = errors.New("invalid action target")
+)
+
+// actionType validates the target of an action button and normalizes it into
+// the link the button opens
+type actionType struct {
+	normalize func(target string) (string, error)
+}
+
+// actionTypes is the registry of supported action button types
+var actionTypes = map[string]actionType{
+	models.ActionTypePhone:     {normalize: normalizePhoneAction},
+	models.ActionTypeZalo:      {normalize: normalizeZaloAction},
+	models.ActionTypeMessenger: {normalize: normalizeMessengerAction},
+	models.ActionTypeMap:       {normalize: normalizeMapAction},
+	models.ActionTypeURL:       {normalize: normalizeWebURL},
+	models.ActionTypeEmail:     {normalize: normalizeEmailAction},
+	models.ActionTypeDownload:  {normalize: normalizeDownloadAction},
+}
+
+// normalizeActionTarget validates target against the registry entry of typ
+func normalizeActionTarget(typ, target string) (string, error) {
+	t, ok := actionTypes[typ]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrActionType, typ)
+	}
+	return t.normalize(strings.TrimSpace(target))
+}
+
+func invalidTarget(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrActionTarget, fmt.Sprintf(format, args...))
+}
+
+// actionPhone validates a phone number target and returns its digits, with
+// Vietnamese numbers in national form (0...)
+func actionPhone(raw string) (string, error) {
+	trimmed := strings.TrimPrefix(raw, "tel:")
+	if strings.Trim(trimmed, "0123456789+ .-()") != "" {
+		return "", invalidTarget("%q is not a phone number", raw)
+	}
+	digits := normalizePhone(trimmed)
+	if digits == "" || len(digits) > 15 {
+		return "", invalidTarget("%q is not a phone number", raw)
+	}
+	return digits, nil
+}
+
+func normalizePhoneAction(target string) (string, error) {
+	digits, err := actionPhone(target)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(digits, "0") {
+		return "tel:+84" + digits[1:], nil
+	}
+	return "tel:+" + digits, nil
+}
+
+// normalizeZaloAction accepts a phone number or a zalo.me link. Zalo links
+// use the national form of Vietnamese numbers.
+func normalizeZaloAction(target string) (string, error) {
+	if u, err := url.Parse(withScheme(target)); err == nil && strings.Contains(target, "/") &&
+		(u.Host == "zalo.me" || u.Host == "www.zalo.me") {
+		id := strings.Trim(u.Path, "/")
+		if id == "" {
+			return "", invalidTarget("zalo link has no account")
+		}
+		return "https://zalo.me/" + id, nil
+	}
+	digits, err := actionPhone(target)
+	if err != nil {
+		return "", err
+	}
+	return "https://zalo.me/" + digits, nil
+}
+
+var messengerName = regexp.MustCompile(`^[A-Za-z0-9.]{1,80}$`)
+
+// normalizeMessengerAction accepts a page name or an m.me, messenger.com or
+// facebook.com link
+func normalizeMessengerAction(target string) (string, error) {
+	name := target
+	if strings.Contains(target, "/") {
+		u, err := url.Parse(withScheme(target))
+		if err != nil {
+			return "", invalidTarget("%q is not a link", target)
+		}
+		host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+		path := strings.Trim(u.Path, "/")
+		switch host {
+		case "m.me", "facebook.com", "fb.com", "m.facebook.com":
+			name = path
+		case "messenger.com":
+			name = strings.TrimPrefix(path, "t/")
+		default:
+			return "", invalidTarget("%q is not a Messenger or Facebook link", target)
+		}
+	}
+	if !messengerName.MatchString(name) {
+		return "", invalidTarget("%q is not a Messenger page name", name)
+	}
+	return "https://m.me/" + name, nil
+}
+
+// normalizeMapAction turns "lat,lng" into a directions link; map links are
+// kept as web URLs
+func normalizeMapAction(target string) (string, error) {
+	if parts := strings.Split(target, ","); len(parts) == 2 {
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		lng, lngErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if latErr == nil && lngErr == nil {
+			if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+				return "", invalidTarget("coordinates out of range")
+			}
+			return fmt.Sprintf("https://www.google.com/maps/dir/?api=1&destination=%s,%s",
+				strconv.FormatFloat(lat, 'f', -1, 64), strconv.FormatFloat(lng, 'f', -1, 64)), nil
+		}
+	}
+	return normalizeWebURL(target)
+}
+
+func normalizeEmailAction(target string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimPrefix(target, "mailto:"))
+	if err != nil {
+		return "", invalidTarget("%q is not an email address", target)
+	}
+	return "mailto:" + addr.Address, nil
+}
+
+// normalizeDownloadAction requires a web URL that points at a file
+func normalizeDownloadAction(target string) (string, error) {
+	u, err := normalizeWebURL(target)
+	if err != nil {
+		return "", err
+	}
+	parsed, _ := url.Parse(u)
+	if strings.Trim(parsed.Path, "/") == "" {
+		return "", invalidTarget("download link must point at a file")
+	}
+	return u, nil
+}
+
+// withScheme prefixes https:// to a link written without a scheme
+func withScheme(target string) string {
+	if !strings.Contains(target, "://") {
+		return "https://" + target
+	}
+	return target
+}
+
+// normalizeWebURL requires an http(s) URL with a host, lowercasing the scheme
+// and host
+func normalizeWebURL(target string) (string, error) {
+	u, err := url.Parse(withScheme(target))
+	if err != nil {
+		return "", invalidTarget("%q is not a link", target)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", invalidTarget("link must use http or https")
+	}
+	if !strings.Contains(u.Hostname(), ".") {
+		return "", invalidTarget("%q has no host", target)
+	}
+	return u.String(), nil
+}
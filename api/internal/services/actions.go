@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/events"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Action errors surfaced to handlers
+var (
+	ErrActionNotFound      = errors.New("action not found")
+	ErrActionSchedule      = errors.New("ends_at must be after starts_at")
+	ErrActionOrderMismatch = errors.New("action_ids must list every action exactly once")
+)
+
+func actionListKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:actions", icomID)
+}
+
+func actionKey(icomID, actionID string) string {
+	return fmt.Sprintf("icom:%s:action:%s", icomID, actionID)
+}
+
+// checkActionSchedule rejects a visibility window that ends before it starts
+func checkActionSchedule(startsAt, endsAt string) error {
+	if startsAt == "" || endsAt == "" {
+		return nil
+	}
+	start, err := time.Parse(time.RFC3339, startsAt)
+	if err != nil {
+		return err
+	}
+	end, err := time.Parse(time.RFC3339, endsAt)
+	if err != nil {
+		return err
+	}
+	if !end.After(start) {
+		return ErrActionSchedule
+	}
+	return nil
+}
+
+// actionVisible reports whether an action is shown to the public at now
+func actionVisible(action models.ActionButton, now time.Time) bool {
+	if action.Active != nil && !*action.Active {
+		return false
+	}
+	if start, err := time.Parse(time.RFC3339, action.StartsAt); err == nil && now.Before(start) {
+		return false
+	}
+	if end, err := time.Parse(time.RFC3339, action.EndsAt); err == nil && !now.Before(end) {
+		return false
+	}
+	return true
+}
+
+// GetActions retrieves all action buttons, including inactive and scheduled
+// ones, sorted by order. Actions with the same order keep insertion order.
+func (s *IComService) GetActions(ctx context.Context, icomID string) ([]models.ActionButton, error) {
+	actionIDs, err := s.rdb.LRange(ctx, actionListKey(icomID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(actionIDs) == 0 {
+		return []models.ActionButton{}, nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(actionIDs))
+	for i, actionID := range actionIDs {
+		cmds[i] = pipe.HGetAll(ctx, actionKey(icomID, actionID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	actions := make([]models.ActionButton, 0, len(actionIDs))
+	for _, cmd := range cmds {
+		data := cmd.Val()
+		if len(data) == 0 {
+			continue
+		}
+
+		var action models.ActionButton
+		if err := hashcodec.Unmarshal(data, &action); err != nil {
+			continue
+		}
+		// Actions saved before the active flag existed are active
+		if action.Active == nil {
+			active := true
+			action.Active = &active
+		}
+		actions = append(actions, action)
+	}
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].Order < actions[j].Order })
+
+	return actions, nil
+}
+
+// GetVisibleActions retrieves the action buttons shown to the public: active
+// and within their visibility window
+func (s *IComService) GetVisibleActions(ctx context.Context, icomID string) ([]models.ActionButton, error) {
+	actions, err := s.GetActions(ctx, icomID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	visible := actions[:0]
+	for _, action := range actions {
+		if actionVisible(action, now) {
+			visible = append(visible, action)
+		}
+	}
+	return visible, nil
+}
+
+// AddAction adds an action button. The URL is validated and normalized for
+// the action type.
+func (s *IComService) AddAction(ctx context.Context, icomID string, req models.AddActionRequest) (string, error) {
+	target, err := normalizeActionTarget(req.Type, req.URL)
+	if err != nil {
+		return "", err
+	}
+	if err := checkActionSchedule(req.StartsAt, req.EndsAt); err != nil {
+		return "", err
+	}
+
+	actionID := fmt.Sprintf("action_%d", time.Now().UnixNano())
+	active := req.Active == nil || *req.Active
+	fields, err := hashcodec.Marshal(models.ActionButton{
+		ActionID: actionID,
+		Type:     req.Type,
+		Title:    req.Title,
+		URL:      target,
+		Icon:     req.Icon,
+		Order:    req.Order,
+		Active:   &active,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.RPush(ctx, actionListKey(icomID), actionID)
+	pipe.HSet(ctx, actionKey(icomID, actionID), fields)
+	events.Append(ctx, pipe, events.New(events.ActionAdded, icomID, "", events.ActionData{
+		ActionID: actionID,
+		Type:     req.Type,
+		Title:    req.Title,
+	}))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	return actionID, nil
+}
+
+// UpdateAction updates an action button. Changing the type or URL validates
+// the resulting pair again.
+func (s *IComService) UpdateAction(ctx context.Context, icomID, actionID string, req models.UpdateActionRequest) error {
+	detailKey := actionKey(icomID, actionID)
+
+	updates, err := hashcodec.MarshalPartial(req)
+	if err != nil {
+		return err
+	}
+	if req.ClearSchedule {
+		for _, field := range []string{"startsAt", "endsAt"} {
+			if _, ok := updates[field]; !ok {
+				updates[field] = ""
+			}
+		}
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	return s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.HGetAll(ctx, detailKey).Result()
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return ErrActionNotFound
+		}
+		var next models.ActionButton
+		if err := hashcodec.Unmarshal(data, &next); err != nil {
+			return err
+		}
+		changed := make(map[string]string, len(updates))
+		for field, value := range updates {
+			changed[field] = fmt.Sprint(value)
+		}
+		if err := hashcodec.Unmarshal(changed, &next); err != nil {
+			return err
+		}
+
+		if req.Type != "" || req.URL != "" {
+			target, err := normalizeActionTarget(next.Type, next.URL)
+			if err != nil {
+				return err
+			}
+			updates["url"] = target
+		}
+		if err := checkActionSchedule(next.StartsAt, next.EndsAt); err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, detailKey, updates)
+			events.Append(ctx, pipe, events.New(events.ActionUpdated, icomID, "", events.ActionData{
+				ActionID: actionID,
+				Type:     req.Type,
+				Title:    req.Title,
+			}))
+			return nil
+		})
+		return err
+	}, detailKey)
+}
+
+// RemoveAction removes an action button
+func (s *IComService) RemoveAction(ctx context.Context, icomID, actionID string) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.LRem(ctx, actionListKey(icomID), 0, actionID)
+	pipe.Del(ctx, actionKey(icomID, actionID))
+	clearActionClicks(ctx, pipe, icomID, actionID)
+	events.Append(ctx, pipe, events.New(events.ActionRemoved, icomID, "", events.ActionData{ActionID: actionID}))
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ReorderActions sets the order of every action button at once. actionIDs
+// must be a permutation of the iCom's actions.
+func (s *IComService) ReorderActions(ctx context.Context, icomID string, actionIDs []string) error {
+	listKey := actionListKey(icomID)
+
+	return s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.LRange(ctx, listKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		if len(current) != len(actionIDs) {
+			return ErrActionOrderMismatch
+		}
+		known := make(map[string]bool, len(current))
+		for _, id := range current {
+			known[id] = true
+		}
+		for _, id := range actionIDs {
+			if !known[id] {
+				return ErrActionOrderMismatch
+			}
+			delete(known, id)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, listKey)
+			args := make([]interface{}, len(actionIDs))
+			for i, id := range actionIDs {
+				args[i] = id
+				pipe.HSet(ctx, actionKey(icomID, id), "order", i)
+			}
+			pipe.RPush(ctx, listKey, args...)
+			events.Append(ctx, pipe, events.New(events.ActionsReordered, icomID, "", events.ActionsReorderedData{
+				ActionIDs: actionIDs,
+			}))
+			return nil
+		})
+		return err
+	}, listKey)
+}
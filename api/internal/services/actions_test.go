@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"i-manage/internal/models"
+)
+
+func TestNormalizeActionTarget(t *testing.T) {
+	tests := []struct {
+		typ, target, want string
+	}{
+		{models.ActionTypePhone, "0901 234 567", "tel:+84901234567"},
+		{models.ActionTypePhone, "+84 90-123-4567", "tel:+84901234567"},
+		{models.ActionTypeZalo, "+84901234567", "https://zalo.me/0901234567"},
+		{models.ActionTypeZalo, "zalo.me/0901234567/", "https://zalo.me/0901234567"},
+		{models.ActionTypeMessenger, "imanage.vn", "https://m.me/imanage.vn"},
+		{models.ActionTypeMessenger, "https://www.facebook.com/imanage/", "https://m.me/imanage"},
+		{models.ActionTypeMap, "10.7769, 106.7009", "https://www.google.com/maps/dir/?api=1&destination=10.7769,106.7009"},
+		{models.ActionTypeURL, "Example.COM/Path", "https://example.com/Path"},
+		{models.ActionTypeEmail, "Hội <info@example.com>", "mailto:info@example.com"},
+		{models.ActionTypeDownload, "http://example.com/files/brochure.pdf", "http://example.com/files/brochure.pdf"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeActionTarget(tt.typ, tt.target)
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeActionTarget(%s, %q) = %q, %v; want %q", tt.typ, tt.target, got, err, tt.want)
+		}
+	}
+
+	invalid := []struct{ typ, target string }{
+		{models.ActionTypePhone, "call me"},
+		{models.ActionTypeMessenger, "https://example.com/page"},
+		{models.ActionTypeMap, "91,10"},
+		{models.ActionTypeURL, "javascript:alert(1)"},
+		{models.ActionTypeEmail, "not-an-email"},
+		{models.ActionTypeDownload, "https://example.com/"},
+	}
+	for _, tt := range invalid {
+		if _, err := normalizeActionTarget(tt.typ, tt.target); !errors.Is(err, ErrActionTarget) {
+			t.Errorf("normalizeActionTarget(%s, %q) err = %v, want ErrActionTarget", tt.typ, tt.target, err)
+		}
+	}
+	if _, err := normalizeActionTarget("fax", "123"); !errors.Is(err, ErrActionType) {
+		t.Errorf("unknown type err = %v", err)
+	}
+}
+
+func TestActionsOrderAndVisibility(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	service := NewIComService()
+
+	add := func(req models.AddActionRequest) string {
+		t.Helper()
+		id, err := service.AddAction(ctx, "1", req)
+		if err != nil {
+			t.Fatalf("AddAction(%s): %v", req.Title, err)
+		}
+		return id
+	}
+	inactive := false
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	call := add(models.AddActionRequest{Type: "phone", Title: "Call", URL: "0901234567", Order: 2})
+	site := add(models.AddActionRequest{Type: "url", Title: "Site", URL: "example.com", Order: 1})
+	add(models.AddActionRequest{Type: "url", Title: "Hidden", URL: "example.com", Active: &inactive})
+	add(models.AddActionRequest{Type: "url", Title: "Expired", URL: "example.com", EndsAt: past})
+	// Saved before the active flag existed
+	rdb.RPush(ctx, actionListKey("1"), "legacy")
+	rdb.HSet(ctx, actionKey("1", "legacy"), "actionId", "legacy", "type", "Website", "title", "Legacy", "order", "3")
+
+	all, _ := service.GetActions(ctx, "1")
+	if len(all) != 5 || all[0].Order != 0 {
+		t.Fatalf("GetActions = %+v", all)
+	}
+	visible, _ := service.GetVisibleActions(ctx, "1")
+	var titles []string
+	for _, a := range visible {
+		titles = append(titles, a.Title)
+	}
+	if len(titles) != 3 || titles[0] != "Site" || titles[1] != "Call" || titles[2] != "Legacy" {
+		t.Errorf("visible actions = %v", titles)
+	}
+
+	ids := make([]string, len(all))
+	for i, a := range all {
+		ids[len(all)-1-i] = a.ActionID
+	}
+	if err := service.ReorderActions(ctx, "1", ids); err != nil {
+		t.Fatalf("ReorderActions: %v", err)
+	}
+	if err := service.ReorderActions(ctx, "1", ids[:2]); !errors.Is(err, ErrActionOrderMismatch) {
+		t.Errorf("partial reorder err = %v", err)
+	}
+	if all, _ = service.GetActions(ctx, "1"); all[0].Title != "Legacy" {
+		t.Errorf("first action after reorder = %s", all[0].Title)
+	}
+
+	// Changing the type re-validates the stored URL
+	if err := service.UpdateAction(ctx, "1", call, models.UpdateActionRequest{Type: "zalo"}); err != nil {
+		t.Fatalf("UpdateAction: %v", err)
+	}
+	if url, _ := rdb.HGet(ctx, actionKey("1", call), "url").Result(); url != "https://zalo.me/0901234567" {
+		t.Errorf("url after type change = %q", url)
+	}
+	if err := service.UpdateAction(ctx, "1", site, models.UpdateActionRequest{Type: "email"}); !errors.Is(err, ErrActionTarget) {
+		t.Errorf("incompatible type err = %v", err)
+	}
+	if err := service.UpdateAction(ctx, "1", "missing", models.UpdateActionRequest{Title: "x"}); !errors.Is(err, ErrActionNotFound) {
+		t.Errorf("missing action err = %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"i-manage/internal/models"
+)
+
+// announcementFeedSize is how many announcements the RSS and Atom feeds carry
+const announcementFeedSize = 50
+
+// announcementLink builds the link of an iCom's news page, or of one of its
+// announcements. ANNOUNCEMENT_BASE_URL points at the news pages of the web
+// app, e.g. https://example.com/news
+func announcementLink(icomID, announcementID string) string {
+	base := os.Getenv("ANNOUNCEMENT_BASE_URL")
+	if base == "" {
+		base = "/news"
+	}
+	link := strings.TrimRight(base, "/") + "/" + icomID
+	if announcementID != "" {
+		link += "/" + announcementID
+	}
+	return link
+}
+
+// announcementURN is the stable identifier of an announcement in feeds
+func announcementURN(icomID, announcementID string) string {
+	return fmt.Sprintf("urn:i-manage:icom:%s:announcement:%s", icomID, announcementID)
+}
+
+// announcementFeedHTML is the body of an announcement in feeds, under its
+// cover image
+func announcementFeedHTML(a models.Announcement) string {
+	if a.CoverImage == "" || !richTextURL(a.CoverImage, false) {
+		return a.Body
+	}
+	return `<p><img src="` + html.EscapeString(a.CoverImage) + `" alt=""></p>` + a.Body
+}
+
+// announcementFeed returns an iCom with the announcements its feeds carry:
+// published ones, newest first, members-only ones included for members
+func (s *AnnouncementService) announcementFeed(ctx context.Context, icomID string, membersOnly bool) (map[string]string, []models.Announcement, error) {
+	icom, err := s.rdb.HGetAll(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(icom) == 0 {
+		return nil, nil, ErrIComNotFound
+	}
+	list, err := s.listAnnouncements(ctx, icomID, membersOnly, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(list) > announcementFeedSize {
+		list = list[:announcementFeedSize]
+	}
+	if icom["name"] == "" {
+		icom["name"] = icomID
+	}
+	return icom, list, nil
+}
+
+// feedTime formats an RFC3339 time in the given layout, in UTC
+func feedTime(value, layout string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(layout)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// WriteRSS writes the announcements of an iCom as an RSS 2.0 feed
+func (s *AnnouncementService) WriteRSS(ctx context.Context, w io.Writer, icomID string, membersOnly bool) error {
+	icom, list, err := s.announcementFeed(ctx, icomID, membersOnly)
+	if err != nil {
+		return err
+	}
+
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         icom["name"],
+			Link:          announcementLink(icomID, ""),
+			Description:   icom["description"],
+			Language:      "vi",
+			LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+			Items:         make([]rssItem, 0, len(list)),
+		},
+	}
+	if feed.Channel.Description == "" {
+		feed.Channel.Description = "Announcements of " + icom["name"]
+	}
+	for _, a := range list {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       a.Title,
+			Link:        announcementLink(icomID, a.ID),
+			GUID:        rssGUID{Value: announcementURN(icomID, a.ID)},
+			PubDate:     feedTime(a.PublishAt, time.RFC1123Z),
+			Description: announcementFeedHTML(a),
+		})
+	}
+	return writeXML(w, feed)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteAtom writes the announcements of an iCom as an Atom feed (RFC 4287)
+func (s *AnnouncementService) WriteAtom(ctx context.Context, w io.Writer, icomID string, membersOnly bool) error {
+	icom, list, err := s.announcementFeed(ctx, icomID, membersOnly)
+	if err != nil {
+		return err
+	}
+
+	feed := atomFeed{
+		Title:   icom["name"],
+		ID:      fmt.Sprintf("urn:i-manage:icom:%s:announcements", icomID),
+		Link:    atomLink{Href: announcementLink(icomID, ""), Rel: "alternate"},
+		Author:  atomAuthor{Name: icom["name"]},
+		Entries: make([]atomEntry, 0, len(list)),
+	}
+	// The feed changed when its latest entry did
+	for _, a := range list {
+		updated := feedTime(a.Modified, time.RFC3339)
+		if published := feedTime(a.PublishAt, time.RFC3339); updated < published {
+			updated = published
+		}
+		if updated > feed.Updated {
+			feed.Updated = updated
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:     a.Title,
+			ID:        announcementURN(icomID, a.ID),
+			Link:      atomLink{Href: announcementLink(icomID, a.ID), Rel: "alternate"},
+			Published: feedTime(a.PublishAt, time.RFC3339),
+			Updated:   updated,
+			Content:   atomContent{Type: "html", Value: announcementFeedHTML(a)},
+		})
+	}
+	if feed.Updated == "" {
+		feed.Updated = feedTime(icom["modified"], time.RFC3339)
+	}
+	if feed.Updated == "" {
+		feed.Updated = time.Now().UTC().Format(time.RFC3339)
+	}
+	return writeXML(w, feed)
+}
+
+// writeXML writes v as an indented XML document
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,454 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+	"i-manage/internal/workers"
+)
+
+// Announcement errors surfaced to handlers
+var (
+	ErrAnnouncementNotFound = errors.New("announcement not found")
+	ErrAnnouncementSchedule = errors.New("publish_at and expires_at must be RFC3339 times, expires_at after publish_at")
+	ErrAnnouncementBody     = errors.New("body has no content")
+)
+
+const (
+	// AnnouncementPushJob is the scheduler job kind that pushes an
+	// announcement to the members once it is published
+	AnnouncementPushJob = "announcement-push"
+	// announcementExcerptLength is how much of the body notifications carry
+	announcementExcerptLength = 280
+)
+
+// Announcements are stored per iCom:
+//
+//	icom:<id>:announcements                   zset of announcement IDs by publish time (unix)
+//	icom:<id>:announcement:<aid>              hash of the announcement
+//	icom:<id>:announcement:<aid>:notified     set of "<channel>:<shop ID>" already pushed to
+
+func announcementsKey(icomID string) string { return fmt.Sprintf("icom:%s:announcements", icomID) }
+func announcementKey(icomID, announcementID string) string {
+	return fmt.Sprintf("icom:%s:announcement:%s", icomID, announcementID)
+}
+func announcementNotifiedKey(icomID, announcementID string) string {
+	return announcementKey(icomID, announcementID) + ":notified"
+}
+
+// announcementPush is the payload of an AnnouncementPushJob
+type announcementPush struct {
+	IComID         string `json:"icom_id"`
+	AnnouncementID string `json:"announcement_id"`
+}
+
+// AnnouncementService manages the announcements iComs publish
+type AnnouncementService struct {
+	rdb *redis.Client
+}
+
+// NewAnnouncementService creates a new announcement service
+func NewAnnouncementService() *AnnouncementService {
+	return &AnnouncementService{rdb: database.Rdb}
+}
+
+// announcementStatus derives the status of an announcement at now
+func announcementStatus(a models.Announcement, now time.Time) string {
+	if publishAt, err := time.Parse(time.RFC3339, a.PublishAt); err == nil && now.Before(publishAt) {
+		return models.AnnouncementStatusScheduled
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, a.ExpiresAt); err == nil && !now.Before(expiresAt) {
+		return models.AnnouncementStatusExpired
+	}
+	return models.AnnouncementStatusPublished
+}
+
+// checkAnnouncementSchedule parses the publish time of an announcement and
+// rejects one that expires before it is published
+func checkAnnouncementSchedule(publishAt, expiresAt string) (time.Time, error) {
+	publish, err := time.Parse(time.RFC3339, publishAt)
+	if err != nil {
+		return publish, ErrAnnouncementSchedule
+	}
+	if expiresAt == "" {
+		return publish, nil
+	}
+	if expires, err := time.Parse(time.RFC3339, expiresAt); err != nil || !expires.After(publish) {
+		return publish, ErrAnnouncementSchedule
+	}
+	return publish, nil
+}
+
+// CanSeeMembersOnly reports whether a viewer may see members-only
+// announcements: signed-in managers and active members holding their access
+// token may
+func (s *AnnouncementService) CanSeeMembersOnly(ctx context.Context, icomID string, manager bool, token string) (bool, error) {
+	if manager {
+		return true, nil
+	}
+	shopID, err := accessMember(ctx, s.rdb, icomID, token)
+	return shopID != "", err
+}
+
+// CreateAnnouncement publishes an announcement, now or at req.PublishAt.
+// With channels set the active members are pushed a notification through
+// each of them once it is published.
+func (s *AnnouncementService) CreateAnnouncement(ctx context.Context, icomID string, req models.CreateAnnouncementRequest) (*models.Announcement, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrIComNotFound
+	}
+	for _, name := range req.Channels {
+		if _, err := notificationChannel(name); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	announcement := models.Announcement{
+		ID:         fmt.Sprintf("ann_%d", now.UnixNano()),
+		IComID:     icomID,
+		Title:      req.Title,
+		Body:       sanitizeRichText(req.Body),
+		CoverImage: req.CoverImage,
+		Pinned:     req.Pinned,
+		Audience:   req.Audience,
+		PublishAt:  req.PublishAt,
+		ExpiresAt:  req.ExpiresAt,
+		Channels:   req.Channels,
+		Created:    now.Format(time.RFC3339),
+		Modified:   now.Format(time.RFC3339),
+	}
+	if announcement.Audience == "" {
+		announcement.Audience = models.AnnouncementAudiencePublic
+	}
+	if announcement.PublishAt == "" {
+		announcement.PublishAt = announcement.Created
+	}
+	if richTextEmpty(announcement.Body) {
+		return nil, ErrAnnouncementBody
+	}
+	publish, err := checkAnnouncementSchedule(announcement.PublishAt, announcement.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := hashcodec.MarshalPartial(announcement)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, announcementKey(icomID, announcement.ID), fields)
+	pipe.ZAdd(ctx, announcementsKey(icomID), redis.Z{Score: float64(publish.Unix()), Member: announcement.ID})
+	events.Append(ctx, pipe, events.New(events.AnnouncementCreated, icomID, "", events.AnnouncementData{
+		AnnouncementID: announcement.ID,
+		Title:          announcement.Title,
+		Audience:       announcement.Audience,
+		PublishAt:      announcement.PublishAt,
+	}))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	if len(announcement.Channels) > 0 {
+		if err := s.enqueuePush(ctx, icomID, announcement.ID, publish); err != nil {
+			return nil, err
+		}
+	}
+	announcement.Status = announcementStatus(announcement, now)
+	return &announcement, nil
+}
+
+// enqueuePush schedules pushing an announcement to the members at its
+// publish time
+func (s *AnnouncementService) enqueuePush(ctx context.Context, icomID, announcementID string, publish time.Time) error {
+	payload, err := json.Marshal(announcementPush{IComID: icomID, AnnouncementID: announcementID})
+	if err != nil {
+		return err
+	}
+	_, err = workers.EnqueueJob(ctx, s.rdb, AnnouncementPushJob, string(payload), publish)
+	return err
+}
+
+// UpdateAnnouncement updates the fields set in req. Moving the publish time
+// of an announcement that is pushed to members moves the push with it.
+func (s *AnnouncementService) UpdateAnnouncement(ctx context.Context, icomID, announcementID string, req models.UpdateAnnouncementRequest) (*models.Announcement, error) {
+	announcement, err := s.loadAnnouncement(ctx, icomID, announcementID)
+	if err != nil {
+		return nil, err
+	}
+	previousPublishAt := announcement.PublishAt
+
+	if req.Title != "" {
+		announcement.Title = req.Title
+	}
+	if req.Body != "" {
+		announcement.Body = sanitizeRichText(req.Body)
+		if richTextEmpty(announcement.Body) {
+			return nil, ErrAnnouncementBody
+		}
+	}
+	if req.CoverImage != nil {
+		announcement.CoverImage = *req.CoverImage
+	}
+	if req.Pinned != nil {
+		announcement.Pinned = *req.Pinned
+	}
+	if req.Audience != "" {
+		announcement.Audience = req.Audience
+	}
+	if req.PublishAt != "" {
+		announcement.PublishAt = req.PublishAt
+	}
+	if req.ExpiresAt != nil {
+		announcement.ExpiresAt = *req.ExpiresAt
+	}
+	publish, err := checkAnnouncementSchedule(announcement.PublishAt, announcement.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	announcement.Modified = now.Format(time.RFC3339)
+	fields, err := hashcodec.Marshal(announcement)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, announcementKey(icomID, announcementID), fields)
+	pipe.ZAdd(ctx, announcementsKey(icomID), redis.Z{Score: float64(publish.Unix()), Member: announcementID})
+	events.Append(ctx, pipe, events.New(events.AnnouncementUpdated, icomID, "", events.AnnouncementData{
+		AnnouncementID: announcementID,
+		Title:          announcement.Title,
+		Audience:       announcement.Audience,
+		PublishAt:      announcement.PublishAt,
+	}))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	// A push queued for the previous time finds the announcement not yet
+	// published and leaves it to this one; members already notified are
+	// skipped either way
+	if len(announcement.Channels) > 0 && announcement.PublishAt != previousPublishAt {
+		if err := s.enqueuePush(ctx, icomID, announcementID, publish); err != nil {
+			return nil, err
+		}
+	}
+	announcement.Status = announcementStatus(*announcement, now)
+	return announcement, nil
+}
+
+// DeleteAnnouncement removes an announcement. A push that is still queued
+// finds nothing to send.
+func (s *AnnouncementService) DeleteAnnouncement(ctx context.Context, icomID, announcementID string) error {
+	announcement, err := s.loadAnnouncement(ctx, icomID, announcementID)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, announcementKey(icomID, announcementID), announcementNotifiedKey(icomID, announcementID))
+	pipe.ZRem(ctx, announcementsKey(icomID), announcementID)
+	events.Append(ctx, pipe, events.New(events.AnnouncementDeleted, icomID, "", events.AnnouncementData{
+		AnnouncementID: announcementID,
+		Title:          announcement.Title,
+		Audience:       announcement.Audience,
+		PublishAt:      announcement.PublishAt,
+	}))
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// loadAnnouncement reads an announcement
+func (s *AnnouncementService) loadAnnouncement(ctx context.Context, icomID, announcementID string) (*models.Announcement, error) {
+	data, err := s.rdb.HGetAll(ctx, announcementKey(icomID, announcementID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrAnnouncementNotFound
+	}
+	var announcement models.Announcement
+	if err := hashcodec.Unmarshal(data, &announcement); err != nil {
+		return nil, err
+	}
+	return &announcement, nil
+}
+
+// announcementVisible reports whether an announcement is shown to a viewer.
+// Managers listing all see scheduled and expired announcements too.
+func announcementVisible(a models.Announcement, membersOnly, all bool) bool {
+	if all {
+		return true
+	}
+	if a.Audience == models.AnnouncementAudienceMembers && !membersOnly {
+		return false
+	}
+	return a.Status == models.AnnouncementStatusPublished
+}
+
+// GetAnnouncement returns an announcement. One the viewer may not see is
+// not found.
+func (s *AnnouncementService) GetAnnouncement(ctx context.Context, icomID, announcementID string, membersOnly, all bool) (*models.Announcement, error) {
+	announcement, err := s.loadAnnouncement(ctx, icomID, announcementID)
+	if err != nil {
+		return nil, err
+	}
+	announcement.Status = announcementStatus(*announcement, time.Now())
+	if !announcementVisible(*announcement, membersOnly, all) {
+		return nil, ErrAnnouncementNotFound
+	}
+	return announcement, nil
+}
+
+// listAnnouncements returns the announcements of an iCom the viewer may
+// see, newest publish time first
+func (s *AnnouncementService) listAnnouncements(ctx context.Context, icomID string, membersOnly, all bool) ([]models.Announcement, error) {
+	upTo := "+inf"
+	if !all {
+		upTo = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	ids, err := s.rdb.ZRevRangeByScore(ctx, announcementsKey(icomID), &redis.ZRangeBy{Min: "-inf", Max: upTo}).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]models.Announcement, 0, len(ids))
+	now := time.Now()
+	for start := 0; start < len(ids); start += exportBatchSize {
+		end := min(start+exportBatchSize, len(ids))
+		pipe := s.rdb.Pipeline()
+		cmds := make([]*redis.MapStringStringCmd, end-start)
+		for i, id := range ids[start:end] {
+			cmds[i] = pipe.HGetAll(ctx, announcementKey(icomID, id))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for _, cmd := range cmds {
+			var announcement models.Announcement
+			if data := cmd.Val(); len(data) == 0 || hashcodec.Unmarshal(data, &announcement) != nil {
+				continue
+			}
+			announcement.Status = announcementStatus(announcement, now)
+			if announcementVisible(announcement, membersOnly, all) {
+				list = append(list, announcement)
+			}
+		}
+	}
+	return list, nil
+}
+
+// ListAnnouncements returns a page of the announcements of an iCom, pinned
+// first, then newest first. Members-only announcements are included when
+// membersOnly is set; scheduled and expired ones when all is set.
+func (s *AnnouncementService) ListAnnouncements(ctx context.Context, icomID string, page, limit int, membersOnly, all bool) (*models.AnnouncementListResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	list, err := s.listAnnouncements(ctx, icomID, membersOnly, all)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Pinned && !list[j].Pinned })
+
+	resp := &models.AnnouncementListResponse{
+		Announcements: []models.Announcement{},
+		Total:         len(list),
+		Page:          page,
+		Limit:         limit,
+	}
+	if start := (page - 1) * limit; start < len(list) {
+		resp.Announcements = list[start:min(start+limit, len(list))]
+	}
+	return resp, nil
+}
+
+// PushAnnouncement notifies the active members of an iCom about an
+// announcement through its channels. It is the handler of the
+// AnnouncementPushJob; members already notified on a channel are skipped,
+// so a retried job only sends what failed.
+func (s *AnnouncementService) PushAnnouncement(ctx context.Context, payload string) error {
+	var push announcementPush
+	if err := json.Unmarshal([]byte(payload), &push); err != nil {
+		return err
+	}
+	announcement, err := s.loadAnnouncement(ctx, push.IComID, push.AnnouncementID)
+	if err == ErrAnnouncementNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Moved to a later time or already over
+	if announcementStatus(*announcement, time.Now()) != models.AnnouncementStatusPublished {
+		return nil
+	}
+
+	channels := make([]NotificationChannel, 0, len(announcement.Channels))
+	for _, name := range announcement.Channels {
+		ch, err := notificationChannel(name)
+		if err != nil {
+			return err
+		}
+		channels = append(channels, ch)
+	}
+	shopIDs, err := s.rdb.SMembers(ctx, fmt.Sprintf("icom:%s:status:%s", push.IComID, constants.MEMBER_STATUS_ACTIVE)).Result()
+	if err != nil {
+		return err
+	}
+	sort.Strings(shopIDs)
+
+	icomName, _ := s.rdb.HGet(ctx, fmt.Sprintf("icom:%s", push.IComID), "name").Result()
+	n := models.Notification{
+		ID:     "ntf_" + announcement.ID,
+		Type:   models.NotificationAnnouncement,
+		IComID: push.IComID,
+		Title:  announcement.Title,
+		Body:   richTextExcerpt(announcement.Body, announcementExcerptLength),
+	}
+	if icomName != "" {
+		n.Title = icomName + ": " + announcement.Title
+	}
+
+	// A failing shop or channel does not stop the others
+	notifiedKey := announcementNotifiedKey(push.IComID, push.AnnouncementID)
+	var firstErr error
+	for _, shopID := range shopIDs {
+		for _, ch := range channels {
+			member := ch.Name() + ":" + shopID
+			added, err := s.rdb.SAdd(ctx, notifiedKey, member).Result()
+			if err != nil {
+				return err
+			}
+			if added == 0 {
+				continue
+			}
+			if err := ch.Notify(ctx, shopID, n); err != nil {
+				s.rdb.SRem(ctx, notifiedKey, member)
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s to %s: %w", ch.Name(), shopID, err)
+				}
+			}
+		}
+	}
+	return firstErr
+}
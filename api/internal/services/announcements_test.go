@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"i-manage/internal/constants"
+	"i-manage/internal/models"
+	"i-manage/internal/workers"
+)
+
+func TestSanitizeRichText(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{`<p>Hello <b>world</b></p>`, `<p>Hello <b>world</b></p>`},
+		{`<p onclick="x()">a<script>alert(1)</script>b</p>`, `<p>ab</p>`},
+		{`<div><span>plain</span></div>`, `plain`},
+		{`<a href="javascript:alert(1)" title="t">x</a>`, `<a title="t" rel="nofollow noopener noreferrer">x</a>`},
+		{`<a href="https://example.com/?a=1&b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener noreferrer">x</a>`},
+		{`<img src="data:image/png;base64,AA" alt="a"><img src="https://example.com/a.png">`, `<img alt="a"><img src="https://example.com/a.png">`},
+		{`<ul><li>one<li>two</ul>`, `<ul><li>one</li><li>two</li></ul>`},
+		{`<p><em>open`, `<p><em>open</em></p>`},
+		{`</p>stray &lt;tag&gt;`, `stray &lt;tag&gt;`},
+	}
+	for _, tc := range cases {
+		if got := sanitizeRichText(tc.in); got != tc.want {
+			t.Errorf("sanitizeRichText(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	if got := richTextExcerpt(`<p>Hội <b>viên</b></p><p>mới</p>`, 20); got != "Hội viên mới" {
+		t.Errorf("excerpt = %q", got)
+	}
+	if got := richTextExcerpt(`<p>abcdefghij</p>`, 5); got != "abcd…" {
+		t.Errorf("cut excerpt = %q", got)
+	}
+}
+
+// recordingChannel is a notification channel that records deliveries and
+// fails for the shops in fail
+type recordingChannel struct {
+	mu   sync.Mutex
+	sent []string
+	fail map[string]bool
+}
+
+func (c *recordingChannel) Name() string { return "test" }
+
+func (c *recordingChannel) Notify(ctx context.Context, shopID string, n models.Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail[shopID] {
+		return errors.New("unreachable")
+	}
+	c.sent = append(c.sent, shopID+":"+n.ID)
+	return nil
+}
+
+func setupAnnouncements(t *testing.T) *AnnouncementService {
+	t.Helper()
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1", "id", "1", "name", "Hội Doanh nghiệp", "description", "Tin tức & sự kiện")
+	for _, shopID := range []string{"shop1", "shop2"} {
+		rdb.HSet(ctx, "icom:1:member:"+shopID, "shopId", shopID, "status", constants.MEMBER_STATUS_ACTIVE)
+		rdb.SAdd(ctx, "icom:1:status:"+constants.MEMBER_STATUS_ACTIVE, shopID)
+	}
+	return NewAnnouncementService()
+}
+
+func TestAnnouncementVisibilityAndFeeds(t *testing.T) {
+	service := setupAnnouncements(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	create := func(req models.CreateAnnouncementRequest) *models.Announcement {
+		t.Helper()
+		a, err := service.CreateAnnouncement(ctx, "1", req)
+		if err != nil {
+			t.Fatalf("CreateAnnouncement(%s): %v", req.Title, err)
+		}
+		return a
+	}
+	older := create(models.CreateAnnouncementRequest{Title: "Older", Body: "<p>first</p>", Pinned: true,
+		PublishAt: now.Add(-2 * time.Hour).Format(time.RFC3339)})
+	newer := create(models.CreateAnnouncementRequest{Title: "Newer & better", Body: "<p>second</p>",
+		CoverImage: "https://example.com/cover.png", PublishAt: now.Add(-time.Hour).Format(time.RFC3339)})
+	members := create(models.CreateAnnouncementRequest{Title: "Members", Body: "<p>inside</p>",
+		Audience: models.AnnouncementAudienceMembers})
+	scheduled := create(models.CreateAnnouncementRequest{Title: "Later", Body: "<p>soon</p>",
+		PublishAt: now.Add(time.Hour).Format(time.RFC3339)})
+	create(models.CreateAnnouncementRequest{Title: "Over", Body: "<p>gone</p>",
+		PublishAt: now.Add(-3 * time.Hour).Format(time.RFC3339), ExpiresAt: now.Add(-time.Minute).Format(time.RFC3339)})
+	if scheduled.Status != models.AnnouncementStatusScheduled {
+		t.Fatalf("scheduled status = %s", scheduled.Status)
+	}
+
+	ids := func(list *models.AnnouncementListResponse) []string {
+		out := make([]string, len(list.Announcements))
+		for i, a := range list.Announcements {
+			out[i] = a.Title
+		}
+		return out
+	}
+	cases := []struct {
+		membersOnly, all bool
+		want             string
+	}{
+		{false, false, "Older,Newer & better"},
+		{true, false, "Older,Members,Newer & better"},
+		{true, true, "Older,Later,Members,Newer & better,Over"},
+	}
+	for _, tc := range cases {
+		list, err := service.ListAnnouncements(ctx, "1", 1, 20, tc.membersOnly, tc.all)
+		if err != nil {
+			t.Fatalf("ListAnnouncements: %v", err)
+		}
+		if got := strings.Join(ids(list), ","); got != tc.want {
+			t.Errorf("membersOnly=%v all=%v: got %s, want %s", tc.membersOnly, tc.all, got, tc.want)
+		}
+	}
+	if page, _ := service.ListAnnouncements(ctx, "1", 2, 1, true, false); page.Total != 3 || ids(page)[0] != "Members" {
+		t.Fatalf("page 2 = %+v", page)
+	}
+	if _, err := service.GetAnnouncement(ctx, "1", members.ID, false, false); !errors.Is(err, ErrAnnouncementNotFound) {
+		t.Fatalf("visitor GetAnnouncement err = %v", err)
+	}
+
+	// Members are recognised by their access token, not their shop ID
+	token := issueAccessToken(t)
+	if membersOnly, err := service.CanSeeMembersOnly(ctx, "1", false, token); err != nil || !membersOnly {
+		t.Fatalf("CanSeeMembersOnly = %v, %v", membersOnly, err)
+	}
+	if membersOnly, _ := service.CanSeeMembersOnly(ctx, "1", false, "shop1"); membersOnly {
+		t.Fatal("CanSeeMembersOnly accepted a shop ID")
+	}
+
+	// Unpinning and expiring change what is listed
+	empty := ""
+	pinned := false
+	if _, err := service.UpdateAnnouncement(ctx, "1", older.ID, models.UpdateAnnouncementRequest{Pinned: &pinned}); err != nil {
+		t.Fatalf("UpdateAnnouncement: %v", err)
+	}
+	expires := now.Add(-2 * time.Hour).Format(time.RFC3339)
+	if _, err := service.UpdateAnnouncement(ctx, "1", newer.ID, models.UpdateAnnouncementRequest{ExpiresAt: &expires}); !errors.Is(err, ErrAnnouncementSchedule) {
+		t.Fatalf("expiry before publish err = %v", err)
+	}
+	if _, err := service.UpdateAnnouncement(ctx, "1", newer.ID, models.UpdateAnnouncementRequest{ExpiresAt: &empty}); err != nil {
+		t.Fatalf("UpdateAnnouncement: %v", err)
+	}
+	if list, _ := service.ListAnnouncements(ctx, "1", 1, 20, false, false); strings.Join(ids(list), ",") != "Newer & better,Older" {
+		t.Fatalf("after unpinning = %v", ids(list))
+	}
+
+	var buf bytes.Buffer
+	if err := service.WriteRSS(ctx, &buf, "1", false); err != nil {
+		t.Fatalf("WriteRSS: %v", err)
+	}
+	var rss rssFeed
+	if err := xml.Unmarshal(buf.Bytes(), &rss); err != nil {
+		t.Fatalf("RSS is not XML: %v\n%s", err, buf.String())
+	}
+	if rss.Channel.Title != "Hội Doanh nghiệp" || len(rss.Channel.Items) != 2 || rss.Channel.Items[0].Title != "Newer & better" ||
+		!strings.HasPrefix(rss.Channel.Items[0].Description, `<p><img src="https://example.com/cover.png"`) {
+		t.Fatalf("RSS = %+v", rss.Channel)
+	}
+
+	buf.Reset()
+	if err := service.WriteAtom(ctx, &buf, "1", false); err != nil {
+		t.Fatalf("WriteAtom: %v", err)
+	}
+	var atom atomFeed
+	if err := xml.Unmarshal(buf.Bytes(), &atom); err != nil {
+		t.Fatalf("Atom is not XML: %v\n%s", err, buf.String())
+	}
+	if len(atom.Entries) != 2 || atom.Entries[1].ID != announcementURN("1", older.ID) || atom.Updated == "" {
+		t.Fatalf("Atom = %+v", atom)
+	}
+
+	// Members subscribing with their token also get members-only announcements
+	buf.Reset()
+	if err := service.WriteAtom(ctx, &buf, "1", true); err != nil {
+		t.Fatalf("WriteAtom for members: %v", err)
+	}
+	var membersAtom atomFeed
+	if err := xml.Unmarshal(buf.Bytes(), &membersAtom); err != nil || len(membersAtom.Entries) != 3 {
+		t.Fatalf("members Atom = %+v, %v", membersAtom, err)
+	}
+
+	if err := service.WriteRSS(ctx, &buf, "missing", false); !errors.Is(err, ErrIComNotFound) {
+		t.Fatalf("missing iCom err = %v", err)
+	}
+}
+
+func TestAnnouncementPush(t *testing.T) {
+	service := setupAnnouncements(t)
+	ctx := context.Background()
+	channel := &recordingChannel{fail: map[string]bool{"shop2": true}}
+	RegisterNotificationChannel(channel)
+
+	if _, err := service.CreateAnnouncement(ctx, "1", models.CreateAnnouncementRequest{
+		Title: "x", Body: "<p>x</p>", Channels: []string{"carrier-pigeon"},
+	}); !errors.Is(err, ErrNotificationChannel) {
+		t.Fatalf("unknown channel err = %v", err)
+	}
+	a, err := service.CreateAnnouncement(ctx, "1", models.CreateAnnouncementRequest{
+		Title: "Họp thường niên", Body: "<p>Mời <b>toàn thể</b> hội viên</p>", Channels: []string{InboxChannelName, "test"},
+	})
+	if err != nil {
+		t.Fatalf("CreateAnnouncement: %v", err)
+	}
+
+	jobs, err := workers.ListJobs(ctx, service.rdb, "")
+	if err != nil || len(jobs.Jobs) != 1 || jobs.Jobs[0].Kind != AnnouncementPushJob {
+		t.Fatalf("queued jobs = %+v, %v", jobs, err)
+	}
+	payload := jobs.Jobs[0].Payload
+	var push announcementPush
+	if err := json.Unmarshal([]byte(payload), &push); err != nil || push.AnnouncementID != a.ID {
+		t.Fatalf("job payload = %s", payload)
+	}
+
+	// shop2 cannot be reached on the test channel; the retry only sends that
+	if err := service.PushAnnouncement(ctx, payload); err == nil {
+		t.Fatal("PushAnnouncement succeeded with a failing channel")
+	}
+	delete(channel.fail, "shop2")
+	if err := service.PushAnnouncement(ctx, payload); err != nil {
+		t.Fatalf("PushAnnouncement retry: %v", err)
+	}
+	if err := service.PushAnnouncement(ctx, payload); err != nil {
+		t.Fatalf("PushAnnouncement rerun: %v", err)
+	}
+	want := "shop1:ntf_" + a.ID + ",shop2:ntf_" + a.ID
+	if got := strings.Join(channel.sent, ","); got != want {
+		t.Fatalf("test channel sent %s, want %s", got, want)
+	}
+
+	inbox, err := NewNotificationService().ListNotifications(ctx, "shop2", 1, 10)
+	if err != nil || inbox.Total != 1 {
+		t.Fatalf("shop2 inbox = %+v, %v", inbox, err)
+	}
+	n := inbox.Notifications[0]
+	if n.Type != models.NotificationAnnouncement || n.Title != "Hội Doanh nghiệp: Họp thường niên" || n.Body != "Mời toàn thể hội viên" {
+		t.Fatalf("notification = %+v", n)
+	}
+
+	// A deleted announcement has nothing to push
+	if err := service.DeleteAnnouncement(ctx, "1", a.ID); err != nil {
+		t.Fatalf("DeleteAnnouncement: %v", err)
+	}
+	if err := service.PushAnnouncement(ctx, payload); err != nil {
+		t.Fatalf("PushAnnouncement after delete: %v", err)
+	}
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/events"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Board errors surfaced to handlers
+var (
+	ErrBoardMemberNotFound = errors.New("board member not found")
+	ErrBoardTermNotFound   = errors.New("board term not found")
+	ErrBoardTermRange      = errors.New("term_end must not be before term_start")
+	ErrBoardOrderMismatch  = errors.New("member_ids must list every current board member exactly once")
+)
+
+// The current board is the icom:<id>:board list, in display order. Every
+// member, current or archived, keeps its icom:<id>:board:<member> hash and is
+// indexed by term:
+//
+//	icom:<id>:board:terms         zset of term -> earliest start (unix)
+//	icom:<id>:board:term:<term>   set of member IDs that served in the term
+
+func boardListKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:board", icomID)
+}
+
+func boardMemberKey(icomID, memberID string) string {
+	return fmt.Sprintf("icom:%s:board:%s", icomID, memberID)
+}
+
+func boardTermsKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:board:terms", icomID)
+}
+
+func boardTermKey(icomID, term string) string {
+	return fmt.Sprintf("icom:%s:board:term:%s", icomID, term)
+}
+
+// termYear matches the leading year of a term label such as "2024-2027"
+var termYear = regexp.MustCompile(`^(\d{4})`)
+
+// termLabel names a term after the years of its dates: "2024-2027", or
+// "2024" when it has no end or ends the year it starts
+func termLabel(start, end string) string {
+	if len(start) < 4 {
+		return ""
+	}
+	if len(end) < 4 || end[:4] == start[:4] {
+		return start[:4]
+	}
+	return start[:4] + "-" + end[:4]
+}
+
+// checkTermRange rejects a term that ends before it starts. Both dates are
+// YYYY-MM-DD, so they compare as strings.
+func checkTermRange(start, end string) error {
+	if start != "" && end != "" && end < start {
+		return ErrBoardTermRange
+	}
+	return nil
+}
+
+// termSortKey orders terms by their start date, falling back to the year in
+// the label
+func termSortKey(member models.BoardMember) float64 {
+	if t, err := time.ParseInLocation("2006-01-02", member.TermStart, statsLocation()); err == nil {
+		return float64(t.Unix())
+	}
+	if m := termYear.FindStringSubmatch(member.Term); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		return float64(time.Date(year, time.January, 1, 0, 0, 0, 0, statsLocation()).Unix())
+	}
+	return 0
+}
+
+// indexBoardTerm queues the recording of a member under their term
+func indexBoardTerm(ctx context.Context, pipe redis.Pipeliner, icomID string, member models.BoardMember) {
+	if member.Term == "" {
+		return
+	}
+	pipe.SAdd(ctx, boardTermKey(icomID, member.Term), member.MemberID)
+	// LT keeps the earliest start seen for the term
+	pipe.ZAddLT(ctx, boardTermsKey(icomID), redis.Z{Score: termSortKey(member), Member: member.Term})
+}
+
+// AddBoardMember adds a member to the end of the current board. Without an
+// explicit term the member is filed under the years of their term dates, or
+// the current year.
+func (s *IComService) AddBoardMember(ctx context.Context, icomID string, req models.AddBoardMemberRequest) (string, error) {
+	if err := checkTermRange(req.TermStart, req.TermEnd); err != nil {
+		return "", err
+	}
+
+	// Generate member ID
+	memberID := fmt.Sprintf("board_%d", time.Now().UnixNano())
+	member := models.BoardMember{
+		MemberID:  memberID,
+		UserID:    req.UserID,
+		Name:      req.Name,
+		Role:      req.Role,
+		Contact:   req.Contact,
+		Avatar:    req.Avatar,
+		Bio:       req.Bio,
+		Term:      req.Term,
+		TermStart: req.TermStart,
+		TermEnd:   req.TermEnd,
+	}
+	if member.Term == "" {
+		member.Term = termLabel(req.TermStart, req.TermEnd)
+	}
+	if member.Term == "" {
+		member.Term = strconv.Itoa(time.Now().In(statsLocation()).Year())
+	}
+
+	listKey := boardListKey(icomID)
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		// Positions only grow, so archived members keep a distinct place
+		last, err := tx.LIndex(ctx, listKey, -1).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if last != "" {
+			pos, err := tx.HGet(ctx, boardMemberKey(icomID, last), "position").Int()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			member.Position = pos + 1
+		}
+
+		fields, err := hashcodec.Marshal(member)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.RPush(ctx, listKey, memberID)
+			pipe.HSet(ctx, boardMemberKey(icomID, memberID), fields)
+			indexBoardTerm(ctx, pipe, icomID, member)
+			events.Append(ctx, pipe, events.New(events.BoardMemberAdded, icomID, "", events.BoardMemberData{
+				MemberID: memberID,
+				Name:     req.Name,
+				Role:     req.Role,
+				Term:     member.Term,
+			}))
+			return nil
+		})
+		return err
+	}, listKey)
+	if err != nil {
+		return "", err
+	}
+
+	return memberID, nil
+}
+
+// UpdateBoardMember updates board member details. Archived members can be
+// corrected too. Changing the term dates renames a term that was derived
+// from them, unless a term is given explicitly.
+func (s *IComService) UpdateBoardMember(ctx context.Context, icomID, memberID string, req models.UpdateBoardMemberRequest) error {
+	detailKey := boardMemberKey(icomID, memberID)
+
+	updates, err := hashcodec.MarshalPartial(req)
+	if err != nil {
+		return err
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	return s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.HGetAll(ctx, detailKey).Result()
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return ErrBoardMemberNotFound
+		}
+		var current models.BoardMember
+		if err := hashcodec.Unmarshal(data, &current); err != nil {
+			return err
+		}
+
+		next := current
+		if req.TermStart != "" {
+			next.TermStart = req.TermStart
+		}
+		if req.TermEnd != "" {
+			next.TermEnd = req.TermEnd
+		}
+		if err := checkTermRange(next.TermStart, next.TermEnd); err != nil {
+			return err
+		}
+		switch {
+		case req.Term != "":
+			next.Term = req.Term
+		case current.Term == "" || current.Term == termLabel(current.TermStart, current.TermEnd):
+			if label := termLabel(next.TermStart, next.TermEnd); label != "" {
+				next.Term = label
+				updates["term"] = label
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, detailKey, updates)
+			if next.Term != current.Term && current.Term != "" {
+				pipe.SRem(ctx, boardTermKey(icomID, current.Term), memberID)
+			}
+			indexBoardTerm(ctx, pipe, icomID, next)
+			events.Append(ctx, pipe, events.New(events.BoardMemberUpdated, icomID, "", events.BoardMemberData{
+				MemberID: memberID,
+				Name:     req.Name,
+				Role:     req.Role,
+				Term:     next.Term,
+			}))
+			return nil
+		})
+		return err
+	}, detailKey)
+}
+
+// RemoveBoardMember takes a member off the current board and archives them
+// in their term's history. Members recorded before terms existed are filed
+// under the year they leave.
+func (s *IComService) RemoveBoardMember(ctx context.Context, icomID, memberID string) error {
+	listKey := boardListKey(icomID)
+	detailKey := boardMemberKey(icomID, memberID)
+
+	return s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.HGetAll(ctx, detailKey).Result()
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 || data["removedAt"] != "" {
+			return ErrBoardMemberNotFound
+		}
+		var member models.BoardMember
+		if err := hashcodec.Unmarshal(data, &member); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if member.Term == "" {
+			member.Term = strconv.Itoa(now.In(statsLocation()).Year())
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.LRem(ctx, listKey, 0, memberID)
+			pipe.HSet(ctx, detailKey, "removedAt", now.UTC().Format(time.RFC3339), "term", member.Term)
+			indexBoardTerm(ctx, pipe, icomID, member)
+			events.Append(ctx, pipe, events.New(events.BoardMemberRemoved, icomID, "", events.BoardMemberData{
+				MemberID: memberID,
+				Name:     member.Name,
+				Role:     member.Role,
+				Term:     member.Term,
+			}))
+			return nil
+		})
+		return err
+	}, listKey, detailKey)
+}
+
+// ReorderBoard sets the display order of the current board. memberIDs must
+// be a permutation of the current board.
+func (s *IComService) ReorderBoard(ctx context.Context, icomID string, memberIDs []string) error {
+	listKey := boardListKey(icomID)
+
+	return s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.LRange(ctx, listKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		if len(current) != len(memberIDs) {
+			return ErrBoardOrderMismatch
+		}
+		onBoard := make(map[string]bool, len(current))
+		for _, id := range current {
+			onBoard[id] = true
+		}
+		for _, id := range memberIDs {
+			if !onBoard[id] {
+				return ErrBoardOrderMismatch
+			}
+			delete(onBoard, id)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, listKey)
+			args := make([]interface{}, len(memberIDs))
+			for i, id := range memberIDs {
+				args[i] = id
+				pipe.HSet(ctx, boardMemberKey(icomID, id), "position", i)
+			}
+			pipe.RPush(ctx, listKey, args...)
+			events.Append(ctx, pipe, events.New(events.BoardReordered, icomID, "", events.BoardReorderedData{
+				MemberIDs: memberIDs,
+			}))
+			return nil
+		})
+		return err
+	}, listKey)
+}
+
+// GetBoardTerm returns everyone who served in a term, current and archived,
+// in display order
+func (s *IComService) GetBoardTerm(ctx context.Context, icomID, term string) ([]models.BoardMember, error) {
+	memberIDs, err := s.rdb.SMembers(ctx, boardTermKey(icomID, term)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(memberIDs) == 0 {
+		return nil, ErrBoardTermNotFound
+	}
+
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(memberIDs))
+	for i, memberID := range memberIDs {
+		cmds[i] = pipe.HGetAll(ctx, boardMemberKey(icomID, memberID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	members := make([]models.BoardMember, 0, len(memberIDs))
+	for _, cmd := range cmds {
+		var member models.BoardMember
+		if data := cmd.Val(); len(data) == 0 || hashcodec.Unmarshal(data, &member) != nil {
+			continue
+		}
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Position != members[j].Position {
+			return members[i].Position < members[j].Position
+		}
+		return members[i].MemberID < members[j].MemberID
+	})
+	return members, nil
+}
+
+// ListBoardTerms lists the terms with recorded members, newest first. A
+// term's dates span those of its members.
+func (s *IComService) ListBoardTerms(ctx context.Context, icomID string) ([]models.BoardTerm, error) {
+	terms, err := s.rdb.ZRevRange(ctx, boardTermsKey(icomID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		return []models.BoardTerm{}, nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	idCmds := make([]*redis.StringSliceCmd, len(terms))
+	for i, term := range terms {
+		idCmds[i] = pipe.SMembers(ctx, boardTermKey(icomID, term))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	pipe = s.rdb.Pipeline()
+	fieldCmds := make([][]*redis.SliceCmd, len(terms))
+	for i, cmd := range idCmds {
+		for _, memberID := range cmd.Val() {
+			fieldCmds[i] = append(fieldCmds[i], pipe.HMGet(ctx, boardMemberKey(icomID, memberID), "termStart", "termEnd", "removedAt"))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	result := make([]models.BoardTerm, 0, len(terms))
+	for i, term := range terms {
+		// Terms everyone was moved out of are left behind in the index
+		if len(fieldCmds[i]) == 0 {
+			continue
+		}
+		bt := models.BoardTerm{Term: term}
+		for _, cmd := range fieldCmds[i] {
+			vals := stringValues(cmd.Val(), 3)
+			if vals[0] != "" && (bt.TermStart == "" || vals[0] < bt.TermStart) {
+				bt.TermStart = vals[0]
+			}
+			if vals[1] > bt.TermEnd {
+				bt.TermEnd = vals[1]
+			}
+			bt.Current = bt.Current || vals[2] == ""
+		}
+		result = append(result, bt)
+	}
+	return result, nil
+}
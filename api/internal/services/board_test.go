@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"i-manage/internal/models"
+)
+
+func TestBoardTermsAndOrder(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+	service := NewIComService()
+
+	add := func(name, role, start, end string) string {
+		t.Helper()
+		id, err := service.AddBoardMember(ctx, "1", models.AddBoardMemberRequest{
+			UserID: name, Name: name, Role: role, TermStart: start, TermEnd: end,
+		})
+		if err != nil {
+			t.Fatalf("AddBoardMember(%s): %v", name, err)
+		}
+		return id
+	}
+	names := func(members []models.BoardMember) []string {
+		out := make([]string, len(members))
+		for i, m := range members {
+			out[i] = m.Name
+		}
+		return out
+	}
+
+	an := add("An", models.BoardRoleChair, "2021-01-01", "2023-12-31")
+	binh := add("Binh", models.BoardRoleSecretary, "2021-01-01", "2023-12-31")
+	if err := service.RemoveBoardMember(ctx, "1", an); err != nil {
+		t.Fatalf("RemoveBoardMember: %v", err)
+	}
+	if err := service.RemoveBoardMember(ctx, "1", an); !errors.Is(err, ErrBoardMemberNotFound) {
+		t.Errorf("second removal err = %v", err)
+	}
+	chi := add("Chi", models.BoardRoleChair, "2024-01-01", "2026-12-31")
+	dung := add("Dung", models.BoardRoleTreasurer, "2024-01-01", "2026-12-31")
+
+	// Binh moves to the new term; positions keep growing past the archived chair
+	if err := service.UpdateBoardMember(ctx, "1", binh, models.UpdateBoardMemberRequest{TermStart: "2024-01-01", TermEnd: "2026-12-31"}); err != nil {
+		t.Fatalf("UpdateBoardMember: %v", err)
+	}
+	if err := service.ReorderBoard(ctx, "1", []string{chi, dung, binh}); err != nil {
+		t.Fatalf("ReorderBoard: %v", err)
+	}
+	if err := service.ReorderBoard(ctx, "1", []string{chi, chi, binh}); !errors.Is(err, ErrBoardOrderMismatch) {
+		t.Errorf("duplicate reorder err = %v", err)
+	}
+
+	current, _ := service.GetBoardMembers(ctx, "1")
+	if got := names(current); len(got) != 3 || got[0] != "Chi" || got[2] != "Binh" {
+		t.Errorf("current board = %v", got)
+	}
+	past, err := service.GetBoardTerm(ctx, "1", "2021-2023")
+	if err != nil {
+		t.Fatalf("GetBoardTerm: %v", err)
+	}
+	if got := names(past); len(got) != 1 || got[0] != "An" || past[0].RemovedAt == "" {
+		t.Errorf("2021-2023 board = %+v", past)
+	}
+	if got, _ := service.GetBoardTerm(ctx, "1", "2024-2026"); len(got) != 3 || got[2].Name != "Binh" {
+		t.Errorf("2024-2026 board = %v", names(got))
+	}
+	if _, err := service.GetBoardTerm(ctx, "1", "1999"); !errors.Is(err, ErrBoardTermNotFound) {
+		t.Errorf("unknown term err = %v", err)
+	}
+
+	terms, err := service.ListBoardTerms(ctx, "1")
+	if err != nil {
+		t.Fatalf("ListBoardTerms: %v", err)
+	}
+	if len(terms) != 2 || terms[0].Term != "2024-2026" || !terms[0].Current || terms[1].Current || terms[1].TermStart != "2021-01-01" {
+		t.Errorf("terms = %+v", terms)
+	}
+
+	if _, err := service.AddBoardMember(ctx, "1", models.AddBoardMemberRequest{
+		UserID: "x", Name: "X", Role: models.BoardRoleMember, TermStart: "2024-01-01", TermEnd: "2023-01-01",
+	}); !errors.Is(err, ErrBoardTermRange) {
+		t.Errorf("reversed term err = %v", err)
+	}
+}
@@ -0,0 +1,652 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Calendar errors surfaced to handlers
+var (
+	ErrCalendarEventNotFound = errors.New("event not found")
+	ErrCalendarEventSchedule = errors.New("ends_at must be after starts_at")
+	ErrCalendarRange         = errors.New("from and to must be dates (YYYY-MM-DD), from not after to")
+	ErrEventMembersOnly      = errors.New("event is open to active members only")
+	ErrEventEnded            = errors.New("event has ended")
+	ErrRSVPIdentity          = errors.New("either a member token or name and email are required")
+	ErrRSVPNotMember         = errors.New("token does not belong to an active member of this iCom")
+	ErrRSVPCancelToken       = errors.New("cancel token does not match the RSVP")
+	ErrAttendeeNotFound      = errors.New("attendee not found")
+	ErrAttendeeWaitlisted    = errors.New("waitlisted attendees cannot check in")
+)
+
+// Events are stored per iCom:
+//
+//	icom:<id>:events                       zset of event IDs by end time (unix)
+//	icom:<id>:event:<eid>                  hash of the event
+//	icom:<id>:event:<eid>:going            zset of attendee IDs by RSVP time (unix ms)
+//	icom:<id>:event:<eid>:waitlist         zset of attendee IDs by RSVP time (unix ms)
+//	icom:<id>:event:<eid>:attendee:<aid>   hash of the attendee and its cancelToken
+
+func calendarKey(icomID string) string { return fmt.Sprintf("icom:%s:events", icomID) }
+func calendarEventKey(icomID, eventID string) string {
+	return fmt.Sprintf("icom:%s:event:%s", icomID, eventID)
+}
+func eventGoingKey(icomID, eventID string) string {
+	return calendarEventKey(icomID, eventID) + ":going"
+}
+func eventWaitlistKey(icomID, eventID string) string {
+	return calendarEventKey(icomID, eventID) + ":waitlist"
+}
+func attendeeKey(icomID, eventID, attendeeID string) string {
+	return calendarEventKey(icomID, eventID) + ":attendee:" + attendeeID
+}
+
+// CalendarService manages the events calendar of iComs
+type CalendarService struct {
+	rdb *redis.Client
+}
+
+// NewCalendarService creates a new calendar service
+func NewCalendarService() *CalendarService {
+	return &CalendarService{rdb: database.Rdb}
+}
+
+// checkEventSchedule parses the dates of an event and rejects an event that
+// ends before it starts
+func checkEventSchedule(startsAt, endsAt string) (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, startsAt)
+	if err != nil {
+		return start, start, err
+	}
+	end, err := time.Parse(time.RFC3339, endsAt)
+	if err != nil {
+		return start, end, err
+	}
+	if !end.After(start) {
+		return start, end, ErrCalendarEventSchedule
+	}
+	return start, end, nil
+}
+
+// isActiveMember reports whether a shop is an active member of an iCom
+func isActiveMember(ctx context.Context, rdb *redis.Client, icomID, shopID string) (bool, error) {
+	if shopID == "" {
+		return false, nil
+	}
+	status, err := rdb.HGet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), "status").Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return status == constants.MEMBER_STATUS_ACTIVE, err
+}
+
+// CanSeeMembersOnly reports whether a viewer may see members-only events:
+// signed-in managers and active members holding their access token may
+func (s *CalendarService) CanSeeMembersOnly(ctx context.Context, icomID string, manager bool, token string) (bool, error) {
+	if manager {
+		return true, nil
+	}
+	shopID, err := accessMember(ctx, s.rdb, icomID, token)
+	return shopID != "", err
+}
+
+// CreateEvent adds an event to an iCom's calendar
+func (s *CalendarService) CreateEvent(ctx context.Context, icomID string, req models.CreateCalendarEventRequest) (*models.CalendarEvent, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrIComNotFound
+	}
+	_, end, err := checkEventSchedule(req.StartsAt, req.EndsAt)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	event := models.CalendarEvent{
+		ID:          fmt.Sprintf("evt_%d", time.Now().UnixNano()),
+		IComID:      icomID,
+		Title:       req.Title,
+		Description: req.Description,
+		Address:     req.Address,
+		Lat:         req.Lat,
+		Lng:         req.Lng,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+		Capacity:    req.Capacity,
+		Visibility:  req.Visibility,
+		Created:     now,
+		Modified:    now,
+	}
+	if event.Visibility == "" {
+		event.Visibility = models.EventVisibilityPublic
+	}
+	fields, err := hashcodec.MarshalPartial(event)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, calendarEventKey(icomID, event.ID), fields)
+	pipe.ZAdd(ctx, calendarKey(icomID), redis.Z{Score: float64(end.Unix()), Member: event.ID})
+	events.Append(ctx, pipe, events.New(events.CalendarEventCreated, icomID, "", events.CalendarEventData{
+		EventID:  event.ID,
+		Title:    event.Title,
+		StartsAt: event.StartsAt,
+	}))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// UpdateEvent updates the fields set in req. Raising the capacity gives the
+// freed seats to the waitlist; lowering it keeps the attendees already going.
+func (s *CalendarService) UpdateEvent(ctx context.Context, icomID, eventID string, req models.UpdateCalendarEventRequest) (*models.CalendarEvent, error) {
+	event, err := s.loadEvent(ctx, icomID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	startsAt, endsAt := event.StartsAt, event.EndsAt
+	if req.StartsAt != "" {
+		startsAt = req.StartsAt
+	}
+	if req.EndsAt != "" {
+		endsAt = req.EndsAt
+	}
+	_, end, err := checkEventSchedule(startsAt, endsAt)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := hashcodec.MarshalPartial(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return event, nil
+	}
+	changed := make([]string, 0, len(fields))
+	for field := range fields {
+		changed = append(changed, field)
+	}
+	sort.Strings(changed)
+	fields["modified"] = time.Now().Format(time.RFC3339)
+
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, calendarEventKey(icomID, eventID), fields)
+	pipe.ZAdd(ctx, calendarKey(icomID), redis.Z{Score: float64(end.Unix()), Member: eventID})
+	events.Append(ctx, pipe, events.New(events.CalendarEventUpdated, icomID, "", events.CalendarEventData{
+		EventID:  eventID,
+		Title:    event.Title,
+		StartsAt: startsAt,
+		Changed:  changed,
+	}))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	if req.Capacity != nil {
+		if err := s.promoteWaitlist(ctx, icomID, eventID); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetEvent(ctx, icomID, eventID, true)
+}
+
+// DeleteEvent removes an event with its RSVPs
+func (s *CalendarService) DeleteEvent(ctx context.Context, icomID, eventID string) error {
+	event, err := s.loadEvent(ctx, icomID, eventID)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.rdb.Pipeline()
+	goingCmd := pipe.ZRange(ctx, eventGoingKey(icomID, eventID), 0, -1)
+	waitlistCmd := pipe.ZRange(ctx, eventWaitlistKey(icomID, eventID), 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return err
+	}
+
+	tx := s.rdb.TxPipeline()
+	for _, attendeeID := range append(goingCmd.Val(), waitlistCmd.Val()...) {
+		tx.Del(ctx, attendeeKey(icomID, eventID, attendeeID))
+	}
+	tx.Del(ctx, calendarEventKey(icomID, eventID), eventGoingKey(icomID, eventID), eventWaitlistKey(icomID, eventID))
+	tx.ZRem(ctx, calendarKey(icomID), eventID)
+	events.Append(ctx, tx, events.New(events.CalendarEventDeleted, icomID, "", events.CalendarEventData{
+		EventID:  eventID,
+		Title:    event.Title,
+		StartsAt: event.StartsAt,
+	}))
+	_, err = tx.Exec(ctx)
+	return err
+}
+
+// loadEvent reads an event without its RSVP counts
+func (s *CalendarService) loadEvent(ctx context.Context, icomID, eventID string) (*models.CalendarEvent, error) {
+	data, err := s.rdb.HGetAll(ctx, calendarEventKey(icomID, eventID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrCalendarEventNotFound
+	}
+	var event models.CalendarEvent
+	if err := hashcodec.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// GetEvent returns an event with its RSVP counts. A members-only event is
+// not found unless membersOnly is set.
+func (s *CalendarService) GetEvent(ctx context.Context, icomID, eventID string, membersOnly bool) (*models.CalendarEvent, error) {
+	event, err := s.loadEvent(ctx, icomID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if event.Visibility == models.EventVisibilityMembers && !membersOnly {
+		return nil, ErrCalendarEventNotFound
+	}
+	pipe := s.rdb.Pipeline()
+	goingCmd := pipe.ZCard(ctx, eventGoingKey(icomID, eventID))
+	waitlistCmd := pipe.ZCard(ctx, eventWaitlistKey(icomID, eventID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	event.Going, event.Waitlisted = int(goingCmd.Val()), int(waitlistCmd.Val())
+	return event, nil
+}
+
+// ListEvents returns the events of an iCom between two dates (YYYY-MM-DD,
+// both inclusive), soonest first. Without from the events that have not
+// ended yet are listed; without to there is no end. Members-only events are
+// included when membersOnly is set.
+func (s *CalendarService) ListEvents(ctx context.Context, icomID, from, to string, membersOnly bool) ([]models.CalendarEvent, error) {
+	var fromTime, toTime time.Time
+	loc := statsLocation()
+	fromTime = time.Now()
+	if from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, loc)
+		if err != nil {
+			return nil, ErrCalendarRange
+		}
+		fromTime = t
+	}
+	if to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, loc)
+		if err != nil || t.Before(fromTime.Truncate(24*time.Hour).AddDate(0, 0, -1)) {
+			return nil, ErrCalendarRange
+		}
+		toTime = t.AddDate(0, 0, 1)
+	}
+	return s.listEvents(ctx, icomID, fromTime, toTime, membersOnly)
+}
+
+// listEvents returns the events of an iCom that end after from and start
+// before to (when set), soonest first
+func (s *CalendarService) listEvents(ctx context.Context, icomID string, from, to time.Time, membersOnly bool) ([]models.CalendarEvent, error) {
+	eventIDs, err := s.rdb.ZRangeByScore(ctx, calendarKey(icomID), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(from.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.rdb.Pipeline()
+	eventCmds := make([]*redis.MapStringStringCmd, len(eventIDs))
+	goingCmds := make([]*redis.IntCmd, len(eventIDs))
+	waitlistCmds := make([]*redis.IntCmd, len(eventIDs))
+	for i, eventID := range eventIDs {
+		eventCmds[i] = pipe.HGetAll(ctx, calendarEventKey(icomID, eventID))
+		goingCmds[i] = pipe.ZCard(ctx, eventGoingKey(icomID, eventID))
+		waitlistCmds[i] = pipe.ZCard(ctx, eventWaitlistKey(icomID, eventID))
+	}
+	if len(eventIDs) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+
+	list := make([]models.CalendarEvent, 0, len(eventIDs))
+	for i := range eventIDs {
+		var event models.CalendarEvent
+		if data := eventCmds[i].Val(); len(data) == 0 || hashcodec.Unmarshal(data, &event) != nil {
+			continue
+		}
+		if event.Visibility == models.EventVisibilityMembers && !membersOnly {
+			continue
+		}
+		if start, err := time.Parse(time.RFC3339, event.StartsAt); !to.IsZero() && err == nil && !start.Before(to) {
+			continue
+		}
+		event.Going, event.Waitlisted = int(goingCmds[i].Val()), int(waitlistCmds[i].Val())
+		list = append(list, event)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, _ := time.Parse(time.RFC3339, list[i].StartsAt)
+		b, _ := time.Parse(time.RFC3339, list[j].StartsAt)
+		return a.Before(b)
+	})
+	return list, nil
+}
+
+// attendeeID identifies an attendee: members by their shop, visitors by
+// their email, so signing up twice returns the first RSVP
+func attendeeID(shopID, email string) string {
+	if shopID != "" {
+		return "shop_" + shopID
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "guest_" + hex.EncodeToString(sum[:8])
+}
+
+func generateCancelToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "rsvp_" + hex.EncodeToString(b)
+}
+
+// RSVP signs a member or visitor up for an event. When the event is full
+// the attendee joins the waitlist. A new RSVP carries the cancel token that
+// withdraws it; signing up again returns it to members only, as anyone can
+// give a visitor's email.
+func (s *CalendarService) RSVP(ctx context.Context, icomID, eventID string, req models.RSVPRequest) (*models.Attendee, error) {
+	if req.Token == "" && (req.Name == "" || req.Email == "") {
+		return nil, ErrRSVPIdentity
+	}
+	event, err := s.loadEvent(ctx, icomID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if end, err := time.Parse(time.RFC3339, event.EndsAt); err == nil && !time.Now().Before(end) {
+		return nil, ErrEventEnded
+	}
+
+	var shopID string
+	if req.Token != "" {
+		if shopID, err = accessMember(ctx, s.rdb, icomID, req.Token); err != nil {
+			return nil, err
+		}
+		if shopID == "" {
+			return nil, ErrRSVPNotMember
+		}
+	}
+	attendee := models.Attendee{
+		ID:      attendeeID(shopID, req.Email),
+		EventID: eventID,
+		ShopID:  shopID,
+		Name:    req.Name,
+		Email:   req.Email,
+	}
+	if shopID != "" {
+		if attendee.Name == "" {
+			attendee.Name, _ = s.rdb.HGet(ctx, fmt.Sprintf("ishop:%s", shopID), "name").Result()
+		}
+	} else if event.Visibility == models.EventVisibilityMembers {
+		return nil, ErrEventMembersOnly
+	}
+
+	key := attendeeKey(icomID, eventID, attendee.ID)
+	goingKey := eventGoingKey(icomID, eventID)
+	err = s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		existing, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			if shopID != "" {
+				attendee.CancelToken = existing["cancelToken"]
+			}
+			return hashcodec.Unmarshal(existing, &attendee)
+		}
+
+		going, err := tx.ZCard(ctx, goingKey).Result()
+		if err != nil {
+			return err
+		}
+		capacity, _ := tx.HGet(ctx, calendarEventKey(icomID, eventID), "capacity").Int()
+
+		now := time.Now()
+		attendee.RSVPAt = now.Format(time.RFC3339)
+		attendee.Status = models.RSVPStatusGoing
+		listKey := goingKey
+		if capacity > 0 && int(going) >= capacity {
+			attendee.Status = models.RSVPStatusWaitlisted
+			listKey = eventWaitlistKey(icomID, eventID)
+		}
+		fields, err := hashcodec.MarshalPartial(attendee)
+		if err != nil {
+			return err
+		}
+		attendee.CancelToken = generateCancelToken()
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, fields)
+			pipe.HSet(ctx, key, "cancelToken", attendee.CancelToken)
+			pipe.ZAdd(ctx, listKey, redis.Z{Score: float64(now.UnixMilli()), Member: attendee.ID})
+			events.Append(ctx, pipe, events.New(events.RSVPAdded, icomID, attendee.ShopID, events.RSVPData{
+				EventID:    eventID,
+				AttendeeID: attendee.ID,
+				Status:     attendee.Status,
+			}))
+			return nil
+		})
+		return err
+	}, key, goingKey)
+	if err != nil {
+		return nil, err
+	}
+	return &attendee, nil
+}
+
+// WithdrawRSVP cancels an RSVP with the cancel token it was given
+func (s *CalendarService) WithdrawRSVP(ctx context.Context, icomID, eventID string, req models.WithdrawRSVPRequest) error {
+	return s.cancelRSVP(ctx, icomID, eventID, req.AttendeeID, func(data map[string]string) error {
+		if req.CancelToken == "" || subtle.ConstantTimeCompare([]byte(data["cancelToken"]), []byte(req.CancelToken)) != 1 {
+			return ErrRSVPCancelToken
+		}
+		return nil
+	})
+}
+
+// CancelRSVP takes an attendee off an event. A freed seat goes to the
+// first attendee on the waitlist.
+func (s *CalendarService) CancelRSVP(ctx context.Context, icomID, eventID, attendeeID string) error {
+	return s.cancelRSVP(ctx, icomID, eventID, attendeeID, nil)
+}
+
+// cancelRSVP takes an attendee off an event once authorize, when set,
+// accepts the stored attendee
+func (s *CalendarService) cancelRSVP(ctx context.Context, icomID, eventID, attendeeID string, authorize func(data map[string]string) error) error {
+	if _, err := s.loadEvent(ctx, icomID, eventID); err != nil {
+		return err
+	}
+	key := attendeeKey(icomID, eventID, attendeeID)
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return ErrAttendeeNotFound
+		}
+		if authorize != nil {
+			if err := authorize(data); err != nil {
+				return err
+			}
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.ZRem(ctx, eventGoingKey(icomID, eventID), attendeeID)
+			pipe.ZRem(ctx, eventWaitlistKey(icomID, eventID), attendeeID)
+			events.Append(ctx, pipe, events.New(events.RSVPCancelled, icomID, data["shopId"], events.RSVPData{
+				EventID:    eventID,
+				AttendeeID: attendeeID,
+				Status:     data["status"],
+			}))
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return err
+	}
+	return s.promoteWaitlist(ctx, icomID, eventID)
+}
+
+// promoteWaitlist moves waitlisted attendees to going, in RSVP order, while
+// the event has free seats
+func (s *CalendarService) promoteWaitlist(ctx context.Context, icomID, eventID string) error {
+	goingKey := eventGoingKey(icomID, eventID)
+	waitlistKey := eventWaitlistKey(icomID, eventID)
+	for {
+		promoted := false
+		err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+			capacity, _ := tx.HGet(ctx, calendarEventKey(icomID, eventID), "capacity").Int()
+			going, err := tx.ZCard(ctx, goingKey).Result()
+			if err != nil {
+				return err
+			}
+			if capacity > 0 && int(going) >= capacity {
+				return nil
+			}
+			next, err := tx.ZRangeWithScores(ctx, waitlistKey, 0, 0).Result()
+			if err != nil || len(next) == 0 {
+				return err
+			}
+			attendeeID := next[0].Member.(string)
+			shopID, _ := tx.HGet(ctx, attendeeKey(icomID, eventID, attendeeID), "shopId").Result()
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.ZRem(ctx, waitlistKey, attendeeID)
+				// The original RSVP time keeps the attendee's place
+				pipe.ZAdd(ctx, goingKey, redis.Z{Score: next[0].Score, Member: attendeeID})
+				pipe.HSet(ctx, attendeeKey(icomID, eventID, attendeeID), "status", models.RSVPStatusGoing)
+				events.Append(ctx, pipe, events.New(events.RSVPPromoted, icomID, shopID, events.RSVPData{
+					EventID:    eventID,
+					AttendeeID: attendeeID,
+					Status:     models.RSVPStatusGoing,
+				}))
+				return nil
+			})
+			promoted = err == nil
+			return err
+		}, goingKey, waitlistKey)
+		if err != nil || !promoted {
+			return err
+		}
+	}
+}
+
+// ListAttendees returns the attendees of an event in RSVP order: those
+// going first, then the waitlist. status filters on going or waitlisted.
+func (s *CalendarService) ListAttendees(ctx context.Context, icomID, eventID, status string) (*models.AttendeeList, error) {
+	if _, err := s.loadEvent(ctx, icomID, eventID); err != nil {
+		return nil, err
+	}
+
+	pipe := s.rdb.Pipeline()
+	goingCmd := pipe.ZRange(ctx, eventGoingKey(icomID, eventID), 0, -1)
+	waitlistCmd := pipe.ZRange(ctx, eventWaitlistKey(icomID, eventID), 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	list := &models.AttendeeList{
+		EventID:    eventID,
+		Attendees:  []models.Attendee{},
+		Going:      len(goingCmd.Val()),
+		Waitlisted: len(waitlistCmd.Val()),
+	}
+	attendeeIDs := append(goingCmd.Val(), waitlistCmd.Val()...)
+	if len(attendeeIDs) == 0 {
+		return list, nil
+	}
+
+	pipe = s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(attendeeIDs))
+	for i, attendeeID := range attendeeIDs {
+		cmds[i] = pipe.HGetAll(ctx, attendeeKey(icomID, eventID, attendeeID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		var attendee models.Attendee
+		if data := cmd.Val(); len(data) == 0 || hashcodec.Unmarshal(data, &attendee) != nil {
+			continue
+		}
+		if attendee.CheckedInAt != "" {
+			list.CheckedIn++
+		}
+		if status == "" || attendee.Status == status {
+			list.Attendees = append(list.Attendees, attendee)
+		}
+	}
+	return list, nil
+}
+
+// CheckIn records an attendee's arrival, or takes it back with undo
+func (s *CalendarService) CheckIn(ctx context.Context, icomID, eventID, attendeeID string, undo bool) (*models.Attendee, error) {
+	if _, err := s.loadEvent(ctx, icomID, eventID); err != nil {
+		return nil, err
+	}
+	key := attendeeKey(icomID, eventID, attendeeID)
+	var attendee models.Attendee
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return ErrAttendeeNotFound
+		}
+		if err := hashcodec.Unmarshal(data, &attendee); err != nil {
+			return err
+		}
+		if attendee.Status != models.RSVPStatusGoing {
+			return ErrAttendeeWaitlisted
+		}
+		if undo == (attendee.CheckedInAt == "") {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if undo {
+				attendee.CheckedInAt = ""
+				pipe.HDel(ctx, key, "checkedInAt")
+				return nil
+			}
+			attendee.CheckedInAt = time.Now().Format(time.RFC3339)
+			pipe.HSet(ctx, key, "checkedInAt", attendee.CheckedInAt)
+			events.Append(ctx, pipe, events.New(events.AttendeeCheckedIn, icomID, attendee.ShopID, events.RSVPData{
+				EventID:    eventID,
+				AttendeeID: attendeeID,
+				Status:     attendee.Status,
+			}))
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return &attendee, nil
+}
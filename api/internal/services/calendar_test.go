@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"i-manage/internal/constants"
+	"i-manage/internal/models"
+)
+
+// setupCalendar creates iCom 1 with active member shop1 and an event
+// starting tomorrow
+func setupCalendar(t *testing.T, capacity int, visibility string) (*CalendarService, *models.CalendarEvent) {
+	t.Helper()
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+
+	rdb.HSet(ctx, "icom:1", "id", "1", "name", "Hội Doanh nghiệp, Quận 1")
+	rdb.HSet(ctx, "icom:1:member:shop1", "shopId", "shop1", "status", constants.MEMBER_STATUS_ACTIVE)
+	rdb.HSet(ctx, "ishop:shop1", "id", "shop1", "name", "Shop One")
+
+	service := NewCalendarService()
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	event, err := service.CreateEvent(ctx, "1", models.CreateCalendarEventRequest{
+		Title:      "Gặp mặt; cuối năm",
+		Address:    "1 Lê Lợi",
+		StartsAt:   start.Format(time.RFC3339),
+		EndsAt:     start.Add(2 * time.Hour).Format(time.RFC3339),
+		Capacity:   capacity,
+		Visibility: visibility,
+	})
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	return service, event
+}
+
+// issueAccessToken gives shop1 of iCom 1 an access token
+func issueAccessToken(t *testing.T) string {
+	t.Helper()
+	access, err := NewMemberService().IssueAccessToken(context.Background(), "1", "shop1")
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+	return access.Token
+}
+
+func TestCalendarRSVPWaitlist(t *testing.T) {
+	service, event := setupCalendar(t, 1, "")
+	ctx := context.Background()
+	token := issueAccessToken(t)
+
+	member, err := service.RSVP(ctx, "1", event.ID, models.RSVPRequest{Token: token})
+	if err != nil || member.Status != models.RSVPStatusGoing || member.Name != "Shop One" || member.CancelToken == "" {
+		t.Fatalf("member RSVP = %+v, %v", member, err)
+	}
+	guest, err := service.RSVP(ctx, "1", event.ID, models.RSVPRequest{Name: "An", Email: "an@example.com"})
+	if err != nil || guest.Status != models.RSVPStatusWaitlisted {
+		t.Fatalf("guest RSVP = %+v, %v", guest, err)
+	}
+	// Signing up again keeps the existing RSVP; only members get its cancel
+	// token back, anyone can give a visitor's email
+	again, err := service.RSVP(ctx, "1", event.ID, models.RSVPRequest{Name: "An", Email: "AN@example.com"})
+	if err != nil || again.ID != guest.ID || again.Status != models.RSVPStatusWaitlisted || again.CancelToken != "" {
+		t.Fatalf("repeated RSVP = %+v, %v", again, err)
+	}
+	if again, err = service.RSVP(ctx, "1", event.ID, models.RSVPRequest{Token: token}); err != nil || again.CancelToken != member.CancelToken {
+		t.Fatalf("repeated member RSVP = %+v, %v", again, err)
+	}
+	if _, err := service.RSVP(ctx, "1", event.ID, models.RSVPRequest{Token: "mbr_unknown"}); !errors.Is(err, ErrRSVPNotMember) {
+		t.Fatalf("unknown token RSVP err = %v", err)
+	}
+	if _, err := service.CheckIn(ctx, "1", event.ID, guest.ID, false); !errors.Is(err, ErrAttendeeWaitlisted) {
+		t.Fatalf("waitlisted check-in err = %v", err)
+	}
+
+	// Withdrawing takes the cancel token of the RSVP
+	if err := service.WithdrawRSVP(ctx, "1", event.ID, models.WithdrawRSVPRequest{
+		AttendeeID: member.ID, CancelToken: guest.CancelToken,
+	}); !errors.Is(err, ErrRSVPCancelToken) {
+		t.Fatalf("WithdrawRSVP with another token err = %v", err)
+	}
+
+	// The freed seat goes to the waitlist
+	if err := service.WithdrawRSVP(ctx, "1", event.ID, models.WithdrawRSVPRequest{
+		AttendeeID: member.ID, CancelToken: member.CancelToken,
+	}); err != nil {
+		t.Fatalf("WithdrawRSVP: %v", err)
+	}
+	list, err := service.ListAttendees(ctx, "1", event.ID, "")
+	if err != nil {
+		t.Fatalf("ListAttendees: %v", err)
+	}
+	if list.Going != 1 || list.Waitlisted != 0 || len(list.Attendees) != 1 || list.Attendees[0].ID != guest.ID ||
+		list.Attendees[0].Status != models.RSVPStatusGoing {
+		t.Fatalf("attendees after withdraw = %+v", list)
+	}
+
+	checked, err := service.CheckIn(ctx, "1", event.ID, guest.ID, false)
+	if err != nil || checked.CheckedInAt == "" {
+		t.Fatalf("CheckIn = %+v, %v", checked, err)
+	}
+	if list, _ = service.ListAttendees(ctx, "1", event.ID, ""); list.CheckedIn != 1 {
+		t.Fatalf("checked in = %d, want 1", list.CheckedIn)
+	}
+	if checked, err = service.CheckIn(ctx, "1", event.ID, guest.ID, true); err != nil || checked.CheckedInAt != "" {
+		t.Fatalf("undo CheckIn = %+v, %v", checked, err)
+	}
+}
+
+func TestCalendarMembersOnly(t *testing.T) {
+	service, event := setupCalendar(t, 0, models.EventVisibilityMembers)
+	ctx := context.Background()
+
+	if _, err := service.GetEvent(ctx, "1", event.ID, false); !errors.Is(err, ErrCalendarEventNotFound) {
+		t.Fatalf("visitor GetEvent err = %v", err)
+	}
+	if list, err := service.ListEvents(ctx, "1", "", "", false); err != nil || len(list) != 0 {
+		t.Fatalf("visitor ListEvents = %v, %v", list, err)
+	}
+	token := issueAccessToken(t)
+	membersOnly, err := service.CanSeeMembersOnly(ctx, "1", false, token)
+	if err != nil || !membersOnly {
+		t.Fatalf("CanSeeMembersOnly = %v, %v", membersOnly, err)
+	}
+	// A shop ID is not a token
+	if membersOnly, _ := service.CanSeeMembersOnly(ctx, "1", false, "shop1"); membersOnly {
+		t.Fatal("CanSeeMembersOnly accepted a shop ID")
+	}
+	if list, err := service.ListEvents(ctx, "1", "", "", true); err != nil || len(list) != 1 {
+		t.Fatalf("member ListEvents = %v, %v", list, err)
+	}
+	if _, err := service.ListEvents(ctx, "1", "2025-02-01", "2025-01-01", true); !errors.Is(err, ErrCalendarRange) {
+		t.Fatalf("reversed range err = %v", err)
+	}
+
+	if _, err := service.RSVP(ctx, "1", event.ID, models.RSVPRequest{Name: "An", Email: "an@example.com"}); !errors.Is(err, ErrEventMembersOnly) {
+		t.Fatalf("visitor RSVP err = %v", err)
+	}
+	if _, err := service.RSVP(ctx, "1", event.ID, models.RSVPRequest{Token: token}); err != nil {
+		t.Fatalf("member RSVP: %v", err)
+	}
+
+	// A new token revokes the old one
+	if _, err := NewMemberService().IssueAccessToken(ctx, "1", "shop1"); err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+	if membersOnly, _ := service.CanSeeMembersOnly(ctx, "1", false, token); membersOnly {
+		t.Fatal("CanSeeMembersOnly accepted a replaced token")
+	}
+
+	var buf bytes.Buffer
+	if err := service.WriteICalendar(ctx, &buf, "1", false); err != nil {
+		t.Fatalf("WriteICalendar: %v", err)
+	}
+	if strings.Contains(buf.String(), "BEGIN:VEVENT") {
+		t.Fatalf("visitor feed lists a members-only event:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := service.WriteICalendar(ctx, &buf, "1", true); err != nil {
+		t.Fatalf("WriteICalendar: %v", err)
+	}
+	feed := buf.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Hội Doanh nghiệp\\, Quận 1\r\n",
+		"UID:1-" + event.ID + "@i-manage\r\n",
+		"SUMMARY:Gặp mặt\\; cuối năm\r\n",
+		"CLASS:PRIVATE\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Fatalf("feed missing %q:\n%s", want, feed)
+		}
+	}
+}
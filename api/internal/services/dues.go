@@ -0,0 +1,858 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Dues errors surfaced to handlers
+var (
+	ErrDuesSettings    = errors.New("invalid dues settings")
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	ErrInvoiceStatus   = errors.New("invalid invoice status")
+	ErrInvoiceSettled  = errors.New("invoice is already paid or waived")
+	ErrPaymentAmount   = errors.New("payment exceeds the amount due")
+)
+
+// errDuesStatusChanged skips a member whose status changed since it was read
+// for suspending or restoring
+var errDuesStatusChanged = errors.New("membership status changed")
+
+const (
+	defaultDuesCurrency     = "VND"
+	defaultDuesPeriodMonths = 12
+	defaultDuesDays         = 30
+
+	// duesDashboardOverdue caps the overdue invoices listed on the dashboard
+	duesDashboardOverdue = 20
+)
+
+// Dues are stored per iCom:
+//
+//	icom:<id>:dues                          JSON fee schedule
+//	icom:<id>:invoice:<invoice>             hash of the invoice
+//	icom:<id>:invoice:<invoice>:payments    list of payments (JSON), oldest first
+//	icom:<id>:invoices                      zset of invoice IDs by period start
+//	icom:<id>:invoices:status:<status>      set of invoice IDs
+//	icom:<id>:member:<shop>:invoices        zset of the member's invoice IDs by period start
+//
+// Members suspended for overdue dues carry duesSuspended=true on their
+// membership hash so paying restores them.
+
+func duesKey(icomID string) string { return fmt.Sprintf("icom:%s:dues", icomID) }
+func invoiceKey(icomID, invoiceID string) string {
+	return fmt.Sprintf("icom:%s:invoice:%s", icomID, invoiceID)
+}
+func invoicePaymentsKey(icomID, invoiceID string) string {
+	return fmt.Sprintf("icom:%s:invoice:%s:payments", icomID, invoiceID)
+}
+func invoiceListKey(icomID string) string { return fmt.Sprintf("icom:%s:invoices", icomID) }
+func invoiceStatusKey(icomID, status string) string {
+	return fmt.Sprintf("icom:%s:invoices:status:%s", icomID, status)
+}
+func memberInvoicesKey(icomID, shopID string) string {
+	return fmt.Sprintf("icom:%s:member:%s:invoices", icomID, shopID)
+}
+
+// invoiceID names the invoice of a member for the period starting on start,
+// so issuing the same period twice finds the existing invoice
+func invoiceID(shopID string, start time.Time) string {
+	return fmt.Sprintf("inv_%s_%s", shopID, start.Format("20060102"))
+}
+
+// DuesService manages membership fees, invoices and payments
+type DuesService struct {
+	rdb           *redis.Client
+	memberService *MemberService
+}
+
+// NewDuesService creates a new dues service
+func NewDuesService() *DuesService {
+	return &DuesService{
+		rdb:           database.Rdb,
+		memberService: NewMemberService(),
+	}
+}
+
+// withDuesDefaults fills the unset fields of a fee schedule
+func withDuesDefaults(settings *models.DuesSettings) {
+	settings.Currency = strings.ToUpper(strings.TrimSpace(settings.Currency))
+	if settings.Currency == "" {
+		settings.Currency = defaultDuesCurrency
+	}
+	if settings.PeriodMonths <= 0 {
+		settings.PeriodMonths = defaultDuesPeriodMonths
+	}
+	if settings.DueDays <= 0 {
+		settings.DueDays = defaultDuesDays
+	}
+	if settings.Fees == nil {
+		settings.Fees = []models.TierFee{}
+	}
+}
+
+// loadDuesSettings returns the fee schedule of an iCom and whether one was set
+func loadDuesSettings(ctx context.Context, rdb *redis.Client, icomID string) (models.DuesSettings, bool, error) {
+	var settings models.DuesSettings
+	raw, err := rdb.Get(ctx, duesKey(icomID)).Result()
+	if err != nil && err != redis.Nil {
+		return settings, false, err
+	}
+	found := err == nil && json.Unmarshal([]byte(raw), &settings) == nil
+	withDuesDefaults(&settings)
+	return settings, found, nil
+}
+
+// feeFor returns the dues of a rank, 0 when the rank pays nothing
+func feeFor(settings models.DuesSettings, rank string) int64 {
+	for _, fee := range settings.Fees {
+		if fee.Rank == rank {
+			return fee.Amount
+		}
+	}
+	return 0
+}
+
+// GetDuesSettings returns the fee schedule of an iCom
+func (s *DuesService) GetDuesSettings(ctx context.Context, icomID string) (*models.DuesSettings, error) {
+	if err := s.checkICom(ctx, icomID); err != nil {
+		return nil, err
+	}
+	settings, _, err := loadDuesSettings(ctx, s.rdb, icomID)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// SetDuesSettings replaces the fee schedule of an iCom. Fees must name the
+// iCom's tiers. Invoices already issued keep their amounts.
+func (s *DuesService) SetDuesSettings(ctx context.Context, icomID string, settings models.DuesSettings) (*models.DuesSettings, error) {
+	if err := s.checkICom(ctx, icomID); err != nil {
+		return nil, err
+	}
+	withDuesDefaults(&settings)
+
+	seen := make(map[string]bool, len(settings.Fees))
+	for i := range settings.Fees {
+		fee := &settings.Fees[i]
+		fee.Rank = strings.ToUpper(strings.TrimSpace(fee.Rank))
+		if seen[fee.Rank] {
+			return nil, fmt.Errorf("%w: duplicate fee for %s", ErrDuesSettings, fee.Rank)
+		}
+		seen[fee.Rank] = true
+		if err := checkRank(ctx, s.rdb, icomID, fee.Rank); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	tx := s.rdb.TxPipeline()
+	tx.Set(ctx, duesKey(icomID), data, 0)
+	events.Append(ctx, tx, events.New(events.IComUpdated, icomID, "", events.IComChangedData{Changed: []string{"dues"}}))
+	if _, err := tx.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (s *DuesService) checkICom(ctx context.Context, icomID string) error {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrIComNotFound
+	}
+	return nil
+}
+
+// duesDay truncates t to the start of its day in the statistics time zone
+func duesDay(t time.Time) time.Time {
+	return periodStart(models.StatsIntervalDay, t.In(statsLocation()))
+}
+
+// duesPeriod returns the membership period containing now. Periods are
+// months long and anchored on the day the member joined.
+func duesPeriod(joined time.Time, months int, now time.Time) (time.Time, time.Time) {
+	start := duesDay(joined)
+	today := duesDay(now)
+	for n := 1; ; n++ {
+		end := start.AddDate(0, months, 0)
+		if end.After(today) {
+			return start, end
+		}
+		// Step from the anchor so month-end joining dates do not drift
+		start = duesDay(joined).AddDate(0, n*months, 0)
+	}
+}
+
+// ProcessDues issues the invoices of the current membership periods, marks
+// the invoices past their due date overdue and, when the iCom asks for it,
+// suspends the members who owe them
+func (s *DuesService) ProcessDues(ctx context.Context, icomID string) (*models.InvoiceRun, error) {
+	if err := s.checkICom(ctx, icomID); err != nil {
+		return nil, err
+	}
+	return s.processDues(ctx, icomID, time.Now())
+}
+
+func (s *DuesService) processDues(ctx context.Context, icomID string, now time.Time) (*models.InvoiceRun, error) {
+	settings, _, err := loadDuesSettings(ctx, s.rdb, icomID)
+	if err != nil {
+		return nil, err
+	}
+	run := &models.InvoiceRun{IComID: icomID}
+	if run.Issued, err = s.issueInvoices(ctx, icomID, settings, now); err != nil {
+		return nil, err
+	}
+	if run.Overdue, err = s.markOverdue(ctx, icomID, now); err != nil {
+		return nil, err
+	}
+	if settings.SuspendOverdue {
+		if run.Suspended, err = s.suspendOverdue(ctx, icomID); err != nil {
+			return nil, err
+		}
+	}
+	return run, nil
+}
+
+// issueInvoices creates the missing invoices of the current periods of
+// active and suspended members whose tier pays dues
+func (s *DuesService) issueInvoices(ctx context.Context, icomID string, settings models.DuesSettings, now time.Time) (int, error) {
+	billable := false
+	for _, fee := range settings.Fees {
+		billable = billable || fee.Amount > 0
+	}
+	if !billable {
+		return 0, nil
+	}
+
+	shopIDs, err := s.rdb.SUnion(ctx,
+		fmt.Sprintf("icom:%s:status:%s", icomID, constants.MEMBER_STATUS_ACTIVE),
+		fmt.Sprintf("icom:%s:status:%s", icomID, constants.MEMBER_STATUS_SUSPENDED),
+	).Result()
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(shopIDs)
+
+	issued := 0
+	for start := 0; start < len(shopIDs); start += exportBatchSize {
+		batch := shopIDs[start:min(start+exportBatchSize, len(shopIDs))]
+
+		pipe := s.rdb.Pipeline()
+		cmds := make([]*redis.SliceCmd, len(batch))
+		for i, shopID := range batch {
+			cmds[i] = pipe.HMGet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), "rank", "joinedDate")
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return issued, err
+		}
+
+		for i, shopID := range batch {
+			membership := stringValues(cmds[i].Val(), 2)
+			amount := feeFor(settings, membership[0])
+			joined, err := time.Parse(time.RFC3339, membership[1])
+			if amount <= 0 || err != nil {
+				continue
+			}
+			periodStart, periodEnd := duesPeriod(joined, settings.PeriodMonths, now)
+			invoice := models.Invoice{
+				ID:          invoiceID(shopID, periodStart),
+				IComID:      icomID,
+				ShopID:      shopID,
+				Rank:        membership[0],
+				Amount:      amount,
+				Currency:    settings.Currency,
+				PeriodStart: periodStart.Format("2006-01-02"),
+				PeriodEnd:   periodEnd.Format("2006-01-02"),
+				DueDate:     periodStart.AddDate(0, 0, settings.DueDays).Format("2006-01-02"),
+				Status:      models.InvoiceStatusIssued,
+				IssuedAt:    now.UTC().Format(time.RFC3339),
+				Modified:    now.UTC().Format(time.RFC3339),
+			}
+			created, err := s.createInvoice(ctx, invoice, periodStart)
+			if err != nil {
+				return issued, err
+			}
+			if created {
+				issued++
+			}
+		}
+	}
+	return issued, nil
+}
+
+// createInvoice stores an invoice unless it was issued before
+func (s *DuesService) createInvoice(ctx context.Context, invoice models.Invoice, periodStart time.Time) (bool, error) {
+	key := invoiceKey(invoice.IComID, invoice.ID)
+	fields, err := hashcodec.Marshal(invoice)
+	if err != nil {
+		return false, err
+	}
+
+	created := false
+	err = s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil || exists > 0 {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			score := float64(periodStart.Unix())
+			pipe.HSet(ctx, key, fields)
+			pipe.ZAdd(ctx, invoiceListKey(invoice.IComID), redis.Z{Score: score, Member: invoice.ID})
+			pipe.ZAdd(ctx, memberInvoicesKey(invoice.IComID, invoice.ShopID), redis.Z{Score: score, Member: invoice.ID})
+			pipe.SAdd(ctx, invoiceStatusKey(invoice.IComID, invoice.Status), invoice.ID)
+			events.Append(ctx, pipe, events.New(events.InvoiceIssued, invoice.IComID, invoice.ShopID, invoiceData(invoice)))
+			return nil
+		})
+		created = err == nil
+		return err
+	}, key)
+	return created, err
+}
+
+func invoiceData(invoice models.Invoice) events.InvoiceData {
+	return events.InvoiceData{
+		InvoiceID:   invoice.ID,
+		Rank:        invoice.Rank,
+		Amount:      invoice.Amount,
+		Currency:    invoice.Currency,
+		PeriodStart: invoice.PeriodStart,
+		Status:      invoice.Status,
+	}
+}
+
+// markOverdue moves the issued invoices whose due date has passed to overdue
+func (s *DuesService) markOverdue(ctx context.Context, icomID string, now time.Time) (int, error) {
+	ids, err := s.rdb.SMembers(ctx, invoiceStatusKey(icomID, models.InvoiceStatusIssued)).Result()
+	if err != nil {
+		return 0, err
+	}
+	today := duesDay(now).Format("2006-01-02")
+
+	overdue := 0
+	for start := 0; start < len(ids); start += exportBatchSize {
+		batch := ids[start:min(start+exportBatchSize, len(ids))]
+
+		pipe := s.rdb.Pipeline()
+		cmds := make([]*redis.StringCmd, len(batch))
+		for i, id := range batch {
+			cmds[i] = pipe.HGet(ctx, invoiceKey(icomID, id), "dueDate")
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return overdue, err
+		}
+
+		for i, id := range batch {
+			// Dates compare as strings in YYYY-MM-DD
+			if due := cmds[i].Val(); due == "" || due >= today {
+				continue
+			}
+			changed, err := s.updateInvoice(ctx, icomID, id, func(invoice *models.Invoice) ([]events.Event, error) {
+				if invoice.Status != models.InvoiceStatusIssued {
+					return nil, nil
+				}
+				invoice.Status = models.InvoiceStatusOverdue
+				invoice.Modified = now.UTC().Format(time.RFC3339)
+				return []events.Event{events.New(events.InvoiceOverdue, icomID, invoice.ShopID, invoiceData(*invoice))}, nil
+			}, nil)
+			if err != nil {
+				return overdue, err
+			}
+			if changed != nil {
+				overdue++
+			}
+		}
+	}
+	return overdue, nil
+}
+
+// suspendOverdue suspends the active members with an overdue invoice
+func (s *DuesService) suspendOverdue(ctx context.Context, icomID string) (int, error) {
+	ids, err := s.rdb.SMembers(ctx, invoiceStatusKey(icomID, models.InvoiceStatusOverdue)).Result()
+	if err != nil {
+		return 0, err
+	}
+	shops := make(map[string]bool)
+	for _, id := range ids {
+		shopID, err := s.rdb.HGet(ctx, invoiceKey(icomID, id), "shopId").Result()
+		if err != nil && err != redis.Nil {
+			return 0, err
+		}
+		if shopID != "" {
+			shops[shopID] = true
+		}
+	}
+
+	suspended := 0
+	for shopID := range shops {
+		memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
+		status, err := s.rdb.HGet(ctx, memberKey, "status").Result()
+		if err != nil && err != redis.Nil {
+			return suspended, err
+		}
+		if status != constants.MEMBER_STATUS_ACTIVE {
+			continue
+		}
+		// The flag is set with the status, so a suspended member is always
+		// restored once it pays
+		err = s.memberService.updateMemberStatusGuarded(ctx, icomID, shopID, models.UpdateMemberStatusRequest{
+			Status: constants.MEMBER_STATUS_SUSPENDED,
+		}, func(member map[string]string) error {
+			if member["status"] != constants.MEMBER_STATUS_ACTIVE {
+				return errDuesStatusChanged
+			}
+			return nil
+		}, func(pipe redis.Pipeliner) {
+			pipe.HSet(ctx, memberKey, "duesSuspended", "true")
+		})
+		if errors.Is(err, errDuesStatusChanged) {
+			continue
+		}
+		if err != nil {
+			return suspended, err
+		}
+		suspended++
+	}
+	return suspended, nil
+}
+
+// restoreMember reactivates a member suspended for dues once nothing is
+// overdue any more. A member whose status was changed by hand since is only
+// released from the dues suspension.
+func (s *DuesService) restoreMember(ctx context.Context, icomID, shopID string) error {
+	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
+	membership, err := s.rdb.HMGet(ctx, memberKey, "status", "duesSuspended").Result()
+	if err != nil {
+		return err
+	}
+	values := stringValues(membership, 2)
+	if values[1] != "true" {
+		return nil
+	}
+
+	invoiceIDs, err := s.rdb.ZRange(ctx, memberInvoicesKey(icomID, shopID), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.BoolCmd, len(invoiceIDs))
+	for i, id := range invoiceIDs {
+		cmds[i] = pipe.SIsMember(ctx, invoiceStatusKey(icomID, models.InvoiceStatusOverdue), id)
+	}
+	if len(invoiceIDs) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	for _, cmd := range cmds {
+		if cmd.Val() {
+			return nil
+		}
+	}
+
+	if values[0] == constants.MEMBER_STATUS_SUSPENDED {
+		err := s.memberService.updateMemberStatusGuarded(ctx, icomID, shopID, models.UpdateMemberStatusRequest{
+			Status: constants.MEMBER_STATUS_ACTIVE,
+		}, func(member map[string]string) error {
+			if member["status"] != constants.MEMBER_STATUS_SUSPENDED || member["duesSuspended"] != "true" {
+				return errDuesStatusChanged
+			}
+			return nil
+		}, func(pipe redis.Pipeliner) {
+			pipe.HDel(ctx, memberKey, "duesSuspended")
+		})
+		if !errors.Is(err, errDuesStatusChanged) {
+			return err
+		}
+	}
+	return s.rdb.HDel(ctx, memberKey, "duesSuspended").Err()
+}
+
+// updateInvoice applies change to an invoice under WATCH. change returns the
+// events to emit, or none to leave the invoice untouched; extra queues more
+// commands in the same transaction. The updated invoice is returned when it
+// changed.
+func (s *DuesService) updateInvoice(ctx context.Context, icomID, invoiceID string, change func(*models.Invoice) ([]events.Event, error), extra func(redis.Pipeliner, *models.Invoice)) (*models.Invoice, error) {
+	return s.updateInvoiceGuarded(ctx, icomID, invoiceID, nil, change, extra)
+}
+
+// invoiceGuard ties an invoice update to another key, such as the checkout a
+// payment settles. The key is watched with the invoice; check runs first in
+// the transaction and reads the key through tx.
+type invoiceGuard struct {
+	key   string
+	check func(tx *redis.Tx) error
+}
+
+// updateInvoiceGuarded is updateInvoice with a guard; nil means none
+func (s *DuesService) updateInvoiceGuarded(ctx context.Context, icomID, invoiceID string, guard *invoiceGuard, change func(*models.Invoice) ([]events.Event, error), extra func(redis.Pipeliner, *models.Invoice)) (*models.Invoice, error) {
+	key := invoiceKey(icomID, invoiceID)
+	keys := []string{key}
+	if guard != nil {
+		keys = append(keys, guard.key)
+	}
+	var updated *models.Invoice
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		if guard != nil {
+			if err := guard.check(tx); err != nil {
+				return err
+			}
+		}
+		data, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var invoice models.Invoice
+		if len(data) == 0 || hashcodec.Unmarshal(data, &invoice) != nil {
+			return ErrInvoiceNotFound
+		}
+		oldStatus := invoice.Status
+		evts, err := change(&invoice)
+		if err != nil || len(evts) == 0 {
+			return err
+		}
+		fields, err := hashcodec.Marshal(invoice)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, fields)
+			if invoice.Status != oldStatus {
+				pipe.SMove(ctx, invoiceStatusKey(icomID, oldStatus), invoiceStatusKey(icomID, invoice.Status), invoiceID)
+			}
+			if extra != nil {
+				extra(pipe, &invoice)
+			}
+			for _, evt := range evts {
+				events.Append(ctx, pipe, evt)
+			}
+			return nil
+		})
+		if err == nil {
+			updated = &invoice
+		}
+		return err
+	}, keys...)
+	return updated, err
+}
+
+// settled reports whether an invoice no longer takes payments
+func settled(invoice *models.Invoice) bool {
+	return invoice.Status == models.InvoiceStatusPaid || invoice.Status == models.InvoiceStatusWaived
+}
+
+// RecordPayment records a payment received outside i-Manage. The invoice is
+// paid once the payments cover its amount.
+func (s *DuesService) RecordPayment(ctx context.Context, icomID, invoiceID string, req models.RecordPaymentRequest) (*models.Invoice, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	payment := models.Payment{
+		ID:         fmt.Sprintf("pay_%d", time.Now().UnixNano()),
+		InvoiceID:  invoiceID,
+		Amount:     req.Amount,
+		Method:     req.Method,
+		Reference:  req.Reference,
+		Note:       req.Note,
+		PaidAt:     req.PaidAt,
+		RecordedAt: now,
+	}
+	if payment.PaidAt == "" {
+		payment.PaidAt = now
+	}
+	return s.applyPayment(ctx, icomID, payment)
+}
+
+// applyPayment adds a payment to its invoice
+func (s *DuesService) applyPayment(ctx context.Context, icomID string, payment models.Payment) (*models.Invoice, error) {
+	return s.applyPaymentGuarded(ctx, icomID, payment, nil, nil)
+}
+
+// applyPaymentGuarded adds a payment to its invoice in one transaction with
+// the guard's check and the writes queued by extra
+func (s *DuesService) applyPaymentGuarded(ctx context.Context, icomID string, payment models.Payment, guard *invoiceGuard, extra func(redis.Pipeliner)) (*models.Invoice, error) {
+	entry, err := json.Marshal(payment)
+	if err != nil {
+		return nil, err
+	}
+	invoice, err := s.updateInvoiceGuarded(ctx, icomID, payment.InvoiceID, guard, func(invoice *models.Invoice) ([]events.Event, error) {
+		if settled(invoice) {
+			return nil, ErrInvoiceSettled
+		}
+		if payment.Amount > invoice.Amount-invoice.PaidAmount {
+			return nil, fmt.Errorf("%w: %d %s left to pay", ErrPaymentAmount, invoice.Amount-invoice.PaidAmount, invoice.Currency)
+		}
+		invoice.PaidAmount += payment.Amount
+		invoice.Modified = payment.RecordedAt
+		if invoice.PaidAmount == invoice.Amount {
+			invoice.Status = models.InvoiceStatusPaid
+			invoice.PaidAt = payment.PaidAt
+		}
+		evts := []events.Event{events.New(events.PaymentRecorded, icomID, invoice.ShopID, events.InvoiceData{
+			InvoiceID: invoice.ID,
+			Amount:    payment.Amount,
+			Currency:  invoice.Currency,
+			Status:    invoice.Status,
+			Method:    payment.Method,
+		})}
+		if invoice.Status == models.InvoiceStatusPaid {
+			evts = append(evts, events.New(events.InvoicePaid, icomID, invoice.ShopID, invoiceData(*invoice)))
+		}
+		return evts, nil
+	}, func(pipe redis.Pipeliner, invoice *models.Invoice) {
+		pipe.RPush(ctx, invoicePaymentsKey(icomID, payment.InvoiceID), entry)
+		if extra != nil {
+			extra(pipe)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if invoice.Status == models.InvoiceStatusPaid {
+		if err := s.restoreMember(ctx, icomID, invoice.ShopID); err != nil {
+			log.Printf("dues: restoring member %s of iCom %s failed: %v", invoice.ShopID, icomID, err)
+		}
+	}
+	return invoice, nil
+}
+
+// WaiveInvoice cancels what is left to pay on an invoice
+func (s *DuesService) WaiveInvoice(ctx context.Context, icomID, invoiceID, reason string) (*models.Invoice, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	invoice, err := s.updateInvoice(ctx, icomID, invoiceID, func(invoice *models.Invoice) ([]events.Event, error) {
+		if settled(invoice) {
+			return nil, ErrInvoiceSettled
+		}
+		invoice.Status = models.InvoiceStatusWaived
+		invoice.WaivedAt = now
+		invoice.WaiveReason = reason
+		invoice.Modified = now
+		data := invoiceData(*invoice)
+		data.Reason = reason
+		return []events.Event{events.New(events.InvoiceWaived, icomID, invoice.ShopID, data)}, nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.restoreMember(ctx, icomID, invoice.ShopID); err != nil {
+		log.Printf("dues: restoring member %s of iCom %s failed: %v", invoice.ShopID, icomID, err)
+	}
+	return invoice, nil
+}
+
+// GetInvoice returns an invoice with its payments
+func (s *DuesService) GetInvoice(ctx context.Context, icomID, invoiceID string) (*models.Invoice, error) {
+	pipe := s.rdb.Pipeline()
+	dataCmd := pipe.HGetAll(ctx, invoiceKey(icomID, invoiceID))
+	paymentsCmd := pipe.LRange(ctx, invoicePaymentsKey(icomID, invoiceID), 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var invoice models.Invoice
+	if len(dataCmd.Val()) == 0 || hashcodec.Unmarshal(dataCmd.Val(), &invoice) != nil {
+		return nil, ErrInvoiceNotFound
+	}
+	invoice.Payments = make([]models.Payment, 0, len(paymentsCmd.Val()))
+	for _, raw := range paymentsCmd.Val() {
+		var payment models.Payment
+		if json.Unmarshal([]byte(raw), &payment) == nil {
+			invoice.Payments = append(invoice.Payments, payment)
+		}
+	}
+	return &invoice, nil
+}
+
+// ListInvoices returns a page of the invoices of an iCom, newest period
+// first, optionally only those of one status or one member
+func (s *DuesService) ListInvoices(ctx context.Context, icomID, status, shopID string, page, limit int) (*models.InvoiceList, error) {
+	if status != "" && !containsString(models.InvoiceStatuses, status) {
+		return nil, fmt.Errorf("%w: %s", ErrInvoiceStatus, status)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	source := invoiceListKey(icomID)
+	if shopID != "" {
+		source = memberInvoicesKey(icomID, shopID)
+	}
+	ids, err := s.rdb.ZRevRange(ctx, source, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if status != "" && len(ids) > 0 {
+		members, err := s.rdb.SMembers(ctx, invoiceStatusKey(icomID, status)).Result()
+		if err != nil {
+			return nil, err
+		}
+		inStatus := make(map[string]bool, len(members))
+		for _, id := range members {
+			inStatus[id] = true
+		}
+		filtered := ids[:0]
+		for _, id := range ids {
+			if inStatus[id] {
+				filtered = append(filtered, id)
+			}
+		}
+		ids = filtered
+	}
+
+	list := &models.InvoiceList{Invoices: []models.Invoice{}, Total: len(ids), Page: page, Limit: limit}
+	start := (page - 1) * limit
+	if start >= len(ids) {
+		return list, nil
+	}
+	invoices, err := s.loadInvoices(ctx, icomID, ids[start:min(start+limit, len(ids))])
+	if err != nil {
+		return nil, err
+	}
+	list.Invoices = invoices
+	return list, nil
+}
+
+// loadInvoices reads invoices in the given order, skipping missing ones
+func (s *DuesService) loadInvoices(ctx context.Context, icomID string, ids []string) ([]models.Invoice, error) {
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, invoiceKey(icomID, id))
+	}
+	if len(ids) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+	invoices := make([]models.Invoice, 0, len(ids))
+	for _, cmd := range cmds {
+		var invoice models.Invoice
+		if len(cmd.Val()) == 0 || hashcodec.Unmarshal(cmd.Val(), &invoice) != nil {
+			continue
+		}
+		invoices = append(invoices, invoice)
+	}
+	return invoices, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDuesDashboard summarises the invoices and payments of an iCom
+func (s *DuesService) GetDuesDashboard(ctx context.Context, icomID string) (*models.DuesDashboard, error) {
+	settings, err := s.GetDuesSettings(ctx, icomID)
+	if err != nil {
+		return nil, err
+	}
+	dashboard := &models.DuesDashboard{
+		IComID:   icomID,
+		Currency: settings.Currency,
+		Statuses: make(map[string]models.DuesStatusTotal, len(models.InvoiceStatuses)),
+		Overdue:  []models.Invoice{},
+	}
+	for _, status := range models.InvoiceStatuses {
+		dashboard.Statuses[status] = models.DuesStatusTotal{}
+	}
+
+	ids, err := s.rdb.ZRange(ctx, invoiceListKey(icomID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(ids); start += exportBatchSize {
+		invoices, err := s.loadInvoices(ctx, icomID, ids[start:min(start+exportBatchSize, len(ids))])
+		if err != nil {
+			return nil, err
+		}
+		for _, invoice := range invoices {
+			total := dashboard.Statuses[invoice.Status]
+			total.Count++
+			total.Amount += invoice.Amount
+			dashboard.Statuses[invoice.Status] = total
+
+			dashboard.Collected += invoice.PaidAmount
+			if invoice.Status != models.InvoiceStatusWaived {
+				dashboard.Billed += invoice.Amount
+			}
+			if !settled(&invoice) {
+				dashboard.Outstanding += invoice.Amount - invoice.PaidAmount
+			}
+			if invoice.Status == models.InvoiceStatusOverdue {
+				dashboard.Overdue = append(dashboard.Overdue, invoice)
+			}
+		}
+	}
+	if dashboard.Billed > 0 {
+		dashboard.CollectionRate = float64(dashboard.Collected) / float64(dashboard.Billed)
+	}
+	sort.SliceStable(dashboard.Overdue, func(i, j int) bool {
+		return dashboard.Overdue[i].DueDate < dashboard.Overdue[j].DueDate
+	})
+	if len(dashboard.Overdue) > duesDashboardOverdue {
+		dashboard.Overdue = dashboard.Overdue[:duesDashboardOverdue]
+	}
+
+	suspended, err := s.rdb.SMembers(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, constants.MEMBER_STATUS_SUSPENDED)).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(suspended))
+	for i, shopID := range suspended {
+		cmds[i] = pipe.HGet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), "duesSuspended")
+	}
+	if len(suspended) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+	for _, cmd := range cmds {
+		if cmd.Val() == "true" {
+			dashboard.Suspended++
+		}
+	}
+	return dashboard, nil
+}
+
+// ProcessAllDues processes the dues of every iCom with a fee schedule. It
+// runs as the "dues" scheduler job.
+func (s *DuesService) ProcessAllDues(ctx context.Context) error {
+	return forEachICom(ctx, s.rdb, func(icomID string) error {
+		if _, found, err := loadDuesSettings(ctx, s.rdb, icomID); err != nil || !found {
+			return err
+		}
+		run, err := s.processDues(ctx, icomID, time.Now())
+		if err != nil {
+			return err
+		}
+		if run.Issued+run.Overdue+run.Suspended > 0 {
+			log.Printf("dues: iCom %s: %d issued, %d overdue, %d suspended", icomID, run.Issued, run.Overdue, run.Suspended)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"i-manage/internal/constants"
+	"i-manage/internal/models"
+)
+
+func TestDuesPeriod(t *testing.T) {
+	loc := statsLocation()
+	joined := time.Date(2024, 3, 15, 9, 0, 0, 0, loc)
+	tests := []struct {
+		now        time.Time
+		start, end string
+	}{
+		{time.Date(2024, 3, 15, 0, 0, 0, 0, loc), "2024-03-15", "2025-03-15"},
+		{time.Date(2025, 3, 14, 23, 0, 0, 0, loc), "2024-03-15", "2025-03-15"},
+		{time.Date(2025, 3, 15, 0, 0, 0, 0, loc), "2025-03-15", "2026-03-15"},
+		{time.Date(2027, 1, 1, 0, 0, 0, 0, loc), "2026-03-15", "2027-03-15"},
+	}
+	for _, tt := range tests {
+		start, end := duesPeriod(joined, 12, tt.now)
+		if start.Format("2006-01-02") != tt.start || end.Format("2006-01-02") != tt.end {
+			t.Errorf("duesPeriod(%s) = %s..%s, want %s..%s", tt.now.Format("2006-01-02"), start.Format("2006-01-02"), end.Format("2006-01-02"), tt.start, tt.end)
+		}
+	}
+}
+
+// setupDues creates iCom 1 with a GOLD tier that pays 500000 a year and
+// members joined 40 days ago: shop1 and shop2 on GOLD, shop3 on MEMBER
+func setupDues(t *testing.T, suspend bool) (*DuesService, time.Time) {
+	t.Helper()
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	rdb.HSet(ctx, "icom:1", "id", "1")
+	if _, err := NewMemberService().SetTiers(ctx, "1", []models.MembershipTier{
+		{Code: "MEMBER", Name: "Member"},
+		{Code: "GOLD", Name: "Gold"},
+	}); err != nil {
+		t.Fatalf("SetTiers: %v", err)
+	}
+	joined := now.AddDate(0, 0, -40).Format(time.RFC3339)
+	for shopID, rank := range map[string]string{"shop1": "GOLD", "shop2": "GOLD", "shop3": "MEMBER"} {
+		rdb.HSet(ctx, fmt.Sprintf("icom:1:member:%s", shopID), "shopId", shopID, "rank", rank,
+			"status", constants.MEMBER_STATUS_ACTIVE, "joinedDate", joined)
+		rdb.SAdd(ctx, "icom:1:status:ACTIVE", shopID)
+		rdb.HSet(ctx, fmt.Sprintf("ishop:%s", shopID), "id", shopID, "name", shopID)
+	}
+
+	service := NewDuesService()
+	if _, err := service.SetDuesSettings(ctx, "1", models.DuesSettings{
+		Fees:           []models.TierFee{{Rank: "MEMBER", Amount: 0}, {Rank: "gold", Amount: 500000}},
+		SuspendOverdue: suspend,
+	}); err != nil {
+		t.Fatalf("SetDuesSettings: %v", err)
+	}
+	return service, now
+}
+
+func TestDuesSettingsValidation(t *testing.T) {
+	service, _ := setupDues(t, false)
+	ctx := context.Background()
+
+	if _, err := service.SetDuesSettings(ctx, "1", models.DuesSettings{
+		Fees: []models.TierFee{{Rank: "PLATINUM", Amount: 1}},
+	}); !errors.Is(err, ErrTierUndefined) {
+		t.Errorf("unknown tier err = %v", err)
+	}
+	if _, err := service.SetDuesSettings(ctx, "1", models.DuesSettings{
+		Fees: []models.TierFee{{Rank: "GOLD", Amount: 1}, {Rank: "gold", Amount: 2}},
+	}); !errors.Is(err, ErrDuesSettings) {
+		t.Errorf("duplicate fee err = %v", err)
+	}
+	settings, _ := service.GetDuesSettings(ctx, "1")
+	if settings.Currency != "VND" || settings.PeriodMonths != 12 || settings.DueDays != 30 || feeFor(*settings, "GOLD") != 500000 {
+		t.Errorf("settings = %+v", settings)
+	}
+}
+
+func TestDuesOverdueSuspendAndPay(t *testing.T) {
+	service, now := setupDues(t, true)
+	ctx := context.Background()
+	rdb := service.rdb
+
+	// Joined 40 days ago with 30 due days: already overdue
+	run, err := service.processDues(ctx, "1", now)
+	if err != nil {
+		t.Fatalf("processDues: %v", err)
+	}
+	if run.Issued != 2 || run.Overdue != 2 || run.Suspended != 2 {
+		t.Fatalf("run = %+v", run)
+	}
+	if again, _ := service.processDues(ctx, "1", now); again.Issued+again.Overdue+again.Suspended != 0 {
+		t.Errorf("second run = %+v", again)
+	}
+	if status, _ := rdb.HGet(ctx, "icom:1:member:shop1", "status").Result(); status != constants.MEMBER_STATUS_SUSPENDED {
+		t.Errorf("shop1 status = %s", status)
+	}
+	if flag, _ := rdb.HGet(ctx, "icom:1:member:shop1", "duesSuspended").Result(); flag != "true" {
+		t.Errorf("shop1 duesSuspended = %q", flag)
+	}
+
+	list, err := service.ListInvoices(ctx, "1", models.InvoiceStatusOverdue, "shop1", 1, 20)
+	if err != nil || list.Total != 1 {
+		t.Fatalf("ListInvoices = %+v, %v", list, err)
+	}
+	id := list.Invoices[0].ID
+
+	// A partial payment leaves the member suspended
+	invoice, err := service.RecordPayment(ctx, "1", id, models.RecordPaymentRequest{Amount: 200000, Method: models.PaymentMethodCash})
+	if err != nil || invoice.Status != models.InvoiceStatusOverdue || invoice.PaidAmount != 200000 {
+		t.Fatalf("partial payment = %+v, %v", invoice, err)
+	}
+	if _, err := service.RecordPayment(ctx, "1", id, models.RecordPaymentRequest{Amount: 400000, Method: models.PaymentMethodCash}); !errors.Is(err, ErrPaymentAmount) {
+		t.Errorf("overpayment err = %v", err)
+	}
+	invoice, err = service.RecordPayment(ctx, "1", id, models.RecordPaymentRequest{Amount: 300000, Method: models.PaymentMethodBankTransfer, Reference: "FT123"})
+	if err != nil || invoice.Status != models.InvoiceStatusPaid {
+		t.Fatalf("final payment = %+v, %v", invoice, err)
+	}
+	if status, _ := rdb.HGet(ctx, "icom:1:member:shop1", "status").Result(); status != constants.MEMBER_STATUS_ACTIVE {
+		t.Errorf("shop1 status after paying = %s", status)
+	}
+	if rdb.HExists(ctx, "icom:1:member:shop1", "duesSuspended").Val() {
+		t.Error("shop1 duesSuspended kept after paying")
+	}
+	if _, err := service.RecordPayment(ctx, "1", id, models.RecordPaymentRequest{Amount: 1, Method: models.PaymentMethodCash}); !errors.Is(err, ErrInvoiceSettled) {
+		t.Errorf("payment on paid invoice err = %v", err)
+	}
+	if full, _ := service.GetInvoice(ctx, "1", id); len(full.Payments) != 2 || full.Payments[1].Reference != "FT123" {
+		t.Errorf("payments = %+v", full.Payments)
+	}
+
+	other, _ := service.ListInvoices(ctx, "1", "", "shop2", 1, 20)
+	if _, err := service.WaiveInvoice(ctx, "1", other.Invoices[0].ID, "hardship"); err != nil {
+		t.Fatalf("WaiveInvoice: %v", err)
+	}
+	if status, _ := rdb.HGet(ctx, "icom:1:member:shop2", "status").Result(); status != constants.MEMBER_STATUS_ACTIVE {
+		t.Errorf("shop2 status after waiving = %s", status)
+	}
+
+	dashboard, err := service.GetDuesDashboard(ctx, "1")
+	if err != nil {
+		t.Fatalf("GetDuesDashboard: %v", err)
+	}
+	if dashboard.Statuses[models.InvoiceStatusPaid].Count != 1 || dashboard.Statuses[models.InvoiceStatusWaived].Count != 1 ||
+		dashboard.Billed != 500000 || dashboard.Collected != 500000 || dashboard.Outstanding != 0 ||
+		dashboard.CollectionRate != 1 || dashboard.Suspended != 0 || len(dashboard.Overdue) != 0 {
+		t.Errorf("dashboard = %+v", dashboard)
+	}
+}
+
+func TestFakeGatewayCheckout(t *testing.T) {
+	service, now := setupDues(t, false)
+	ctx := context.Background()
+
+	// The callback lands on the API, which hands it to the dues service
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := service.HandlePaymentCallback(r.Context(), FakeGatewayName, r.Header, body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer api.Close()
+	t.Setenv("PAYMENT_BASE_URL", api.URL)
+
+	gateway := NewFakeGateway("secret")
+	RegisterPaymentGateway(gateway)
+	t.Cleanup(func() {
+		gatewaysMu.Lock()
+		delete(gateways, FakeGatewayName)
+		gatewaysMu.Unlock()
+	})
+
+	if _, err := service.processDues(ctx, "1", now.AddDate(0, 0, -20)); err != nil {
+		t.Fatalf("processDues: %v", err)
+	}
+	list, _ := service.ListInvoices(ctx, "1", models.InvoiceStatusIssued, "shop1", 1, 20)
+	if list.Total != 1 {
+		t.Fatalf("issued invoices = %+v", list)
+	}
+	id := list.Invoices[0].ID
+
+	if _, err := service.CreateCheckout(ctx, "1", id, "paypal"); !errors.Is(err, ErrGatewayNotFound) {
+		t.Errorf("unknown provider err = %v", err)
+	}
+	failed, _ := service.CreateCheckout(ctx, "1", id, FakeGatewayName)
+	if err := gateway.Complete(ctx, failed.ID, false); err != nil {
+		t.Fatalf("failing checkout: %v", err)
+	}
+	if checkout, _ := service.GetCheckout(ctx, failed.ID); checkout.Status != models.CheckoutStatusFailed {
+		t.Errorf("failed checkout status = %s", checkout.Status)
+	}
+
+	checkout, err := service.CreateCheckout(ctx, "1", id, FakeGatewayName)
+	if err != nil || checkout.Amount != 500000 || checkout.PayURL != api.URL+"/api/v1/payments/fake/"+checkout.ID {
+		t.Fatalf("CreateCheckout = %+v, %v", checkout, err)
+	}
+	if err := CompleteFakeCheckout(ctx, checkout.ID, true); err != nil {
+		t.Fatalf("CompleteFakeCheckout: %v", err)
+	}
+	// A repeated callback is ignored
+	if err := gateway.Complete(ctx, checkout.ID, true); err != nil {
+		t.Fatalf("repeated callback: %v", err)
+	}
+	invoice, _ := service.GetInvoice(ctx, "1", id)
+	if invoice.Status != models.InvoiceStatusPaid || len(invoice.Payments) != 1 ||
+		invoice.Payments[0].Method != models.PaymentMethodGateway || invoice.Payments[0].Provider != FakeGatewayName {
+		t.Errorf("invoice after checkout = %+v", invoice)
+	}
+	// The checkout is settled together with the payment
+	if settled, _ := service.GetCheckout(ctx, checkout.ID); settled.Status != models.CheckoutStatusSucceeded ||
+		settled.Reference == "" || settled.Reference != invoice.Payments[0].Reference {
+		t.Errorf("checkout after payment = %+v", settled)
+	}
+
+	if _, err := gateway.ParseCallback(http.Header{"X-Fake-Timestamp": {fmt.Sprint(time.Now().Unix())}}, []byte(`{}`)); !errors.Is(err, ErrGatewayCallback) {
+		t.Errorf("unsigned callback err = %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/models"
+)
+
+// icalFeedPast is how far back the iCalendar feed reaches
+const icalFeedPast = 90 * 24 * time.Hour
+
+// icalTime formats an RFC3339 time as an iCalendar UTC date-time
+func icalTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// WriteICalendar writes the events of an iCom that ended at most
+// icalFeedPast ago as an iCalendar feed (RFC 5545)
+func (s *CalendarService) WriteICalendar(ctx context.Context, w io.Writer, icomID string, membersOnly bool) error {
+	name, err := s.rdb.HGet(ctx, fmt.Sprintf("icom:%s", icomID), "name").Result()
+	if err == redis.Nil {
+		return ErrIComNotFound
+	}
+	if err != nil {
+		return err
+	}
+	list, err := s.listEvents(ctx, icomID, time.Now().Add(-icalFeedPast), time.Time{}, membersOnly)
+	if err != nil {
+		return err
+	}
+
+	// Content lines fold and TEXT values escape as in vCard
+	v := newVCardWriter(w)
+	v.line("BEGIN:VCALENDAR")
+	v.line("VERSION:2.0")
+	v.line("PRODID:-//i-Manage//Events//VI")
+	v.line("CALSCALE:GREGORIAN")
+	v.line("METHOD:PUBLISH")
+	v.line("X-WR-CALNAME:" + vcardEscape(name))
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, event := range list {
+		v.line("BEGIN:VEVENT")
+		v.line(fmt.Sprintf("UID:%s-%s@i-manage", icomID, event.ID))
+		v.line("DTSTAMP:" + stamp)
+		v.line("DTSTART:" + icalTime(event.StartsAt))
+		v.line("DTEND:" + icalTime(event.EndsAt))
+		v.line("SUMMARY:" + vcardEscape(event.Title))
+		if event.Description != "" {
+			v.line("DESCRIPTION:" + vcardEscape(event.Description))
+		}
+		if event.Address != "" {
+			v.line("LOCATION:" + vcardEscape(event.Address))
+		}
+		if event.Lat != nil && event.Lng != nil {
+			v.line("GEO:" + strconv.FormatFloat(*event.Lat, 'f', -1, 64) + ";" + strconv.FormatFloat(*event.Lng, 'f', -1, 64))
+		}
+		if event.Visibility == models.EventVisibilityMembers {
+			v.line("CLASS:PRIVATE")
+		}
+		if modified := icalTime(event.Modified); modified != "" {
+			v.line("LAST-MODIFIED:" + modified)
+		}
+		v.line("END:VEVENT")
+	}
+	v.line("END:VCALENDAR")
+	return v.flush()
+}
@@ -0,0 +1,439 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/models"
+)
+
+// Interaction guard errors surfaced to handlers
+var (
+	ErrRateLimited      = errors.New("too many interactions, slow down")
+	ErrAdjustDeltaZero  = errors.New("delta is required for adjust")
+	ErrNothingToRelease = errors.New("no held score to release")
+)
+
+// RateLimitError is returned when a source exceeds its interaction rate
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string { return ErrRateLimited.Error() }
+
+func (e *RateLimitError) Unwrap() error { return ErrRateLimited }
+
+// scoreAuditMax caps the audit trail kept per iCom
+const scoreAuditMax = 1000
+
+// anomalyBaselineDays is how many previous days make up a shop's baseline
+const anomalyBaselineDays = 7
+
+// InteractionGuardConfig tunes de-duplication and rate limiting of public
+// interactions
+type InteractionGuardConfig struct {
+	DedupeWindow  time.Duration // one counted interaction per visitor and shop per window
+	RateWindow    time.Duration // window the limits below apply to
+	IPLimit       int64         // interactions per IP per window
+	VisitorLimit  int64         // interactions per visitor per window
+	FlagTTL       time.Duration // how long a source stays flagged after hitting a limit
+	FlaggedWeight float64       // score a flagged interaction adds; the rest is held
+}
+
+// interactionGuardConfig reads the guard settings from the environment:
+// INTERACTION_DEDUPE_WINDOW (30m), INTERACTION_IP_LIMIT (60/min),
+// INTERACTION_VISITOR_LIMIT (20/min), INTERACTION_FLAG_TTL (24h) and
+// INTERACTION_FLAGGED_WEIGHT (0, i.e. hold everything)
+func interactionGuardConfig() InteractionGuardConfig {
+	cfg := InteractionGuardConfig{
+		DedupeWindow:  30 * time.Minute,
+		RateWindow:    time.Minute,
+		IPLimit:       60,
+		VisitorLimit:  20,
+		FlagTTL:       24 * time.Hour,
+		FlaggedWeight: 0,
+	}
+	if d, err := time.ParseDuration(os.Getenv("INTERACTION_DEDUPE_WINDOW")); err == nil && d > 0 {
+		cfg.DedupeWindow = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("INTERACTION_IP_LIMIT"), 10, 64); err == nil && n > 0 {
+		cfg.IPLimit = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("INTERACTION_VISITOR_LIMIT"), 10, 64); err == nil && n > 0 {
+		cfg.VisitorLimit = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("INTERACTION_FLAG_TTL")); err == nil && d > 0 {
+		cfg.FlagTTL = d
+	}
+	if w, err := strconv.ParseFloat(os.Getenv("INTERACTION_FLAGGED_WEIGHT"), 64); err == nil && w >= 0 && w <= 1 {
+		cfg.FlaggedWeight = w
+	}
+	return cfg
+}
+
+// InteractionService records public interactions with de-duplication, rate
+// limiting and flagging of abusive sources, and lets admins review and correct
+// the resulting scores.
+//
+//	interactions:seen:<icom>:<shop>:<visitor>   de-duplication marker
+//	interactions:rate:<ip|visitor>:<id>:<slot>  fixed-window counters
+//	interactions:flagged:<ip|visitor>:<id>      flagged sources
+//	icom:<id>:interactions:held                 zset of withheld score per shop
+//	icom:<id>:interactions:blocked:day:<date>   zset of blocked attempts per shop
+//	icom:<id>:interactions:audit                list of score adjustments (JSON)
+type InteractionService struct {
+	rdb *redis.Client
+	cfg InteractionGuardConfig
+}
+
+// NewInteractionService creates a new interaction service
+func NewInteractionService() *InteractionService {
+	return &InteractionService{
+		rdb: database.Rdb,
+		cfg: interactionGuardConfig(),
+	}
+}
+
+func heldScoreKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:interactions:held", icomID)
+}
+
+func blockedKey(icomID, day string) string {
+	return fmt.Sprintf("icom:%s:interactions:blocked:day:%s", icomID, day)
+}
+
+func scoreAuditKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:interactions:audit", icomID)
+}
+
+// allowRate counts a hit against a fixed-window limit and reports whether it
+// is within the limit, and if not, how long until the window resets
+func (s *InteractionService) allowRate(ctx context.Context, key string, limit int64, now time.Time) (bool, time.Duration, error) {
+	window := s.cfg.RateWindow
+	slot := now.UnixNano() / int64(window)
+	key = fmt.Sprintf("%s:%d", key, slot)
+
+	pipe := s.rdb.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 2*window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, err
+	}
+	if count.Val() <= limit {
+		return true, 0, nil
+	}
+	reset := time.Unix(0, (slot+1)*int64(window))
+	return false, reset.Sub(now), nil
+}
+
+// RecordInteraction counts an interaction from a visitor and client IP.
+// Repeats from either within the de-duplication window are not counted,
+// sources over the rate limit are rejected and flagged, and interactions from
+// flagged sources add only FlaggedWeight with the remainder held for review.
+// ip must be the connection's peer address, or come from a proxy listed in
+// TRUSTED_PROXIES; a forwarded header the client sets itself would let it
+// spread its interactions over made-up addresses.
+func (s *InteractionService) RecordInteraction(ctx context.Context, icomID, shopID, visitorID, ip string) (*models.InteractionResult, error) {
+	return s.recordInteraction(ctx, icomID, shopID, visitorID, ip, time.Now())
+}
+
+func (s *InteractionService) recordInteraction(ctx context.Context, icomID, shopID, visitorID, ip string, now time.Time) (*models.InteractionResult, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrShopNotFound
+	}
+
+	day := rankDay(now)
+	sources := []string{"ip:" + ip}
+	limits := []int64{s.cfg.IPLimit}
+	if visitorID != "" {
+		sources = append(sources, "visitor:"+visitorID)
+		limits = append(limits, s.cfg.VisitorLimit)
+	}
+
+	for i, src := range sources {
+		ok, retry, err := s.allowRate(ctx, "interactions:rate:"+src, limits[i], now)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			pipe := s.rdb.Pipeline()
+			for _, flagged := range sources {
+				pipe.Set(ctx, "interactions:flagged:"+flagged, now.Format(time.RFC3339), s.cfg.FlagTTL)
+			}
+			pipe.ZIncrBy(ctx, blockedKey(icomID, day), 1, shopID)
+			pipe.Expire(ctx, blockedKey(icomID, day), rankBucketTTL)
+			if _, err := pipe.Exec(ctx); err != nil {
+				return nil, err
+			}
+			return nil, &RateLimitError{RetryAfter: retry}
+		}
+	}
+
+	// Each source keeps its own marker, and an interaction counts only when
+	// all of them are new: a client sending a fresh visitor ID every time is
+	// still a repeat from its address
+	seen := s.rdb.Pipeline()
+	marks := make([]*redis.BoolCmd, len(sources))
+	for i, src := range sources {
+		marks[i] = seen.SetNX(ctx, fmt.Sprintf("interactions:seen:%s:%s:%s", icomID, shopID, src), 1, s.cfg.DedupeWindow)
+	}
+	if _, err := seen.Exec(ctx); err != nil {
+		return nil, err
+	}
+	fresh := true
+	for _, mark := range marks {
+		fresh = fresh && mark.Val()
+	}
+	if !fresh {
+		pipe := s.rdb.Pipeline()
+		pipe.ZIncrBy(ctx, blockedKey(icomID, day), 1, shopID)
+		pipe.Expire(ctx, blockedKey(icomID, day), rankBucketTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+		return &models.InteractionResult{Reason: models.InteractionReasonDuplicate}, nil
+	}
+
+	flagKeys := make([]string, len(sources))
+	for i, src := range sources {
+		flagKeys[i] = "interactions:flagged:" + src
+	}
+	flagged, err := s.rdb.Exists(ctx, flagKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.InteractionResult{Counted: true, Weight: 1}
+	if flagged > 0 {
+		result.Weight = s.cfg.FlaggedWeight
+		result.Reason = models.InteractionReasonFlagged
+	}
+
+	key := rankKey(icomID, "interactions", "")
+	pipe := s.rdb.TxPipeline()
+	if result.Weight > 0 {
+		pipe.ZIncrBy(ctx, key, result.Weight, shopID)
+		incrRankBuckets(ctx, pipe, day, result.Weight, shopID, key)
+		events.Append(ctx, pipe, events.New(events.InteractionRecorded, icomID, shopID, nil))
+	}
+	if result.Weight < 1 {
+		pipe.ZIncrBy(ctx, heldScoreKey(icomID), 1-result.Weight, shopID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AnomalyReport lists the shops whose counted interactions on a day reached
+// minScore and factor times their average over the previous 7 days, or whose
+// blocked attempts reached minScore. Most suspicious first.
+func (s *InteractionService) AnomalyReport(ctx context.Context, icomID string, date time.Time, factor, minScore float64) (*models.InteractionAnomalyReport, error) {
+	if factor <= 0 {
+		factor = 3
+	}
+	if minScore <= 0 {
+		minScore = 20
+	}
+	day := periodStart(models.StatsIntervalDay, date.In(statsLocation()))
+	key := rankKey(icomID, "interactions", "")
+
+	pipe := s.rdb.Pipeline()
+	scoresCmd := pipe.ZRangeByScoreWithScores(ctx, rankBucketKey(key, day.Format("2006-01-02")), &redis.ZRangeBy{Min: strconv.FormatFloat(minScore, 'f', -1, 64), Max: "+inf"})
+	blockedCmd := pipe.ZRangeByScoreWithScores(ctx, blockedKey(icomID, day.Format("2006-01-02")), &redis.ZRangeBy{Min: strconv.FormatFloat(minScore, 'f', -1, 64), Max: "+inf"})
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	candidates := make(map[string]*models.InteractionAnomaly)
+	var order []string
+	for _, z := range append(scoresCmd.Val(), blockedCmd.Val()...) {
+		shopID := z.Member.(string)
+		if candidates[shopID] == nil {
+			candidates[shopID] = &models.InteractionAnomaly{ShopID: shopID}
+			order = append(order, shopID)
+		}
+	}
+
+	report := &models.InteractionAnomalyReport{
+		Date:      day.Format("2006-01-02"),
+		Factor:    factor,
+		MinScore:  minScore,
+		Anomalies: []models.InteractionAnomaly{},
+	}
+	if len(order) == 0 {
+		return report, nil
+	}
+
+	type shopCmds struct {
+		score, blocked, held *redis.FloatCmd
+		baseline             []*redis.FloatCmd
+		name                 *redis.StringCmd
+	}
+	cmds := make([]shopCmds, len(order))
+	pipe = s.rdb.Pipeline()
+	for i, shopID := range order {
+		cmds[i].score = pipe.ZScore(ctx, rankBucketKey(key, day.Format("2006-01-02")), shopID)
+		cmds[i].blocked = pipe.ZScore(ctx, blockedKey(icomID, day.Format("2006-01-02")), shopID)
+		cmds[i].held = pipe.ZScore(ctx, heldScoreKey(icomID), shopID)
+		cmds[i].name = pipe.HGet(ctx, fmt.Sprintf("ishop:%s", shopID), "name")
+		for d := 1; d <= anomalyBaselineDays; d++ {
+			prev := day.AddDate(0, 0, -d).Format("2006-01-02")
+			cmds[i].baseline = append(cmds[i].baseline, pipe.ZScore(ctx, rankBucketKey(key, prev), shopID))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	for i, shopID := range order {
+		a := candidates[shopID]
+		a.Name = cmds[i].name.Val()
+		a.Score = cmds[i].score.Val()
+		a.Blocked = int64(cmds[i].blocked.Val())
+		a.Held = cmds[i].held.Val()
+		var total float64
+		for _, cmd := range cmds[i].baseline {
+			total += cmd.Val()
+		}
+		a.Baseline = total / anomalyBaselineDays
+		a.Ratio = a.Score / maxFloat(a.Baseline, 1)
+
+		spiked := a.Score >= minScore && a.Ratio >= factor
+		if spiked || float64(a.Blocked) >= minScore {
+			report.Anomalies = append(report.Anomalies, *a)
+		}
+	}
+	sort.SliceStable(report.Anomalies, func(i, j int) bool {
+		if report.Anomalies[i].Ratio != report.Anomalies[j].Ratio {
+			return report.Anomalies[i].Ratio > report.Anomalies[j].Ratio
+		}
+		return report.Anomalies[i].Blocked > report.Anomalies[j].Blocked
+	})
+	return report, nil
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// AdjustScore resets, adjusts or releases the held part of a shop's
+// interaction score and records the change in the audit trail
+func (s *InteractionService) AdjustScore(ctx context.Context, icomID, shopID string, req models.AdjustScoreRequest, actor string) (*models.ScoreAuditEntry, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrShopNotFound
+	}
+
+	key := rankKey(icomID, "interactions", "")
+	oldScore, err := s.rdb.ZScore(ctx, key, shopID).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entry := models.ScoreAuditEntry{
+		ID:       fmt.Sprintf("adj_%d", now.UnixNano()),
+		ShopID:   shopID,
+		Action:   req.Action,
+		OldScore: oldScore,
+		Reason:   req.Reason,
+		Actor:    actor,
+		Created:  now.Format(time.RFC3339),
+	}
+
+	pipe := s.rdb.TxPipeline()
+	switch req.Action {
+	case models.ScoreActionReset:
+		entry.Delta = -oldScore
+		pipe.ZAdd(ctx, key, redis.Z{Score: 0, Member: shopID})
+		clearRankBuckets(ctx, pipe, key, shopID)
+		clearRankWindows(ctx, pipe, icomID)
+		pipe.ZRem(ctx, heldScoreKey(icomID), shopID)
+	case models.ScoreActionAdjust:
+		if req.Delta == 0 {
+			return nil, ErrAdjustDeltaZero
+		}
+		entry.Delta = req.Delta
+		pipe.ZIncrBy(ctx, key, req.Delta, shopID)
+		incrRankBuckets(ctx, pipe, rankDay(now), req.Delta, shopID, key)
+	case models.ScoreActionRelease:
+		held, err := s.rdb.ZScore(ctx, heldScoreKey(icomID), shopID).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		if held <= 0 {
+			return nil, ErrNothingToRelease
+		}
+		entry.Delta = held
+		pipe.ZIncrBy(ctx, key, held, shopID)
+		incrRankBuckets(ctx, pipe, rankDay(now), held, shopID, key)
+		pipe.ZRem(ctx, heldScoreKey(icomID), shopID)
+	}
+	entry.NewScore = oldScore + entry.Delta
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	pipe.LPush(ctx, scoreAuditKey(icomID), data)
+	pipe.LTrim(ctx, scoreAuditKey(icomID), 0, scoreAuditMax-1)
+	events.Append(ctx, pipe, events.New(events.ScoreAdjusted, icomID, shopID, events.ScoreAdjustedData{
+		Action:   entry.Action,
+		Delta:    entry.Delta,
+		NewScore: entry.NewScore,
+		Reason:   entry.Reason,
+		Actor:    entry.Actor,
+	}))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ScoreAudit returns a page of an iCom's score adjustments, newest first
+func (s *InteractionService) ScoreAudit(ctx context.Context, icomID string, page, limit int) (*models.ScoreAuditList, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	start := int64((page - 1) * limit)
+
+	pipe := s.rdb.Pipeline()
+	rangeCmd := pipe.LRange(ctx, scoreAuditKey(icomID), start, start+int64(limit)-1)
+	totalCmd := pipe.LLen(ctx, scoreAuditKey(icomID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	entries := make([]models.ScoreAuditEntry, 0, len(rangeCmd.Val()))
+	for _, raw := range rangeCmd.Val() {
+		var entry models.ScoreAuditEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return &models.ScoreAuditList{Entries: entries, Total: int(totalCmd.Val()), Page: page, Limit: limit}, nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"i-manage/internal/models"
+)
+
+func TestRecordInteractionGuards(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1:member:10", "status", "ACTIVE")
+	rdb.HSet(ctx, "icom:1:member:11", "status", "ACTIVE")
+
+	service := NewInteractionService()
+	service.cfg.VisitorLimit = 3
+	service.cfg.FlaggedWeight = 0.5
+	now := time.Date(2026, 10, 14, 12, 0, 30, 0, time.UTC)
+	key := rankKey("1", "interactions", "")
+
+	if _, err := service.recordInteraction(ctx, "1", "99", "v1", "1.1.1.1", now); !errors.Is(err, ErrShopNotFound) {
+		t.Errorf("expected ErrShopNotFound, got %v", err)
+	}
+
+	res, err := service.recordInteraction(ctx, "1", "10", "v1", "1.1.1.1", now)
+	if err != nil || !res.Counted || res.Weight != 1 {
+		t.Fatalf("first interaction: %+v (err %v)", res, err)
+	}
+	res, err = service.recordInteraction(ctx, "1", "10", "v1", "1.1.1.1", now)
+	if err != nil || res.Counted || res.Reason != models.InteractionReasonDuplicate {
+		t.Fatalf("repeat should be a duplicate: %+v (err %v)", res, err)
+	}
+	// A new visitor ID from the same address is still a repeat
+	res, err = service.recordInteraction(ctx, "1", "10", "v2", "1.1.1.1", now)
+	if err != nil || res.Counted || res.Reason != models.InteractionReasonDuplicate {
+		t.Fatalf("new visitor ID should be a duplicate: %+v (err %v)", res, err)
+	}
+
+	// Third request in the minute is still allowed, the fourth trips the visitor limit
+	if _, err := service.recordInteraction(ctx, "1", "11", "v1", "1.1.1.1", now); err != nil {
+		t.Fatalf("interaction on another shop: %v", err)
+	}
+	var rateErr *RateLimitError
+	if _, err := service.recordInteraction(ctx, "1", "11", "v1", "1.1.1.1", now); !errors.As(err, &rateErr) || rateErr.RetryAfter != 30*time.Second {
+		t.Fatalf("expected rate limit with 30s retry, got %v", err)
+	}
+
+	// Next minute the flagged visitor is counted at half weight, the rest held
+	rdb.Del(ctx, "interactions:seen:1:11:visitor:v1", "interactions:seen:1:11:ip:1.1.1.1")
+	res, err = service.recordInteraction(ctx, "1", "11", "v1", "1.1.1.1", now.Add(time.Minute))
+	if err != nil || res.Reason != models.InteractionReasonFlagged || res.Weight != 0.5 {
+		t.Fatalf("expected flagged interaction, got %+v (err %v)", res, err)
+	}
+	if score := rdb.ZScore(ctx, key, "11").Val(); score != 1.5 {
+		t.Errorf("expected score 1.5 for shop 11, got %v", score)
+	}
+	if held := rdb.ZScore(ctx, heldScoreKey("1"), "11").Val(); held != 0.5 {
+		t.Errorf("expected 0.5 held, got %v", held)
+	}
+
+	entry, err := service.AdjustScore(ctx, "1", "11", models.AdjustScoreRequest{Action: models.ScoreActionRelease, Reason: "checked"}, "admin@example.com")
+	if err != nil || entry.Delta != 0.5 || entry.NewScore != 2 {
+		t.Fatalf("release: %+v (err %v)", entry, err)
+	}
+	if _, err := service.AdjustScore(ctx, "1", "11", models.AdjustScoreRequest{Action: models.ScoreActionRelease, Reason: "again"}, ""); !errors.Is(err, ErrNothingToRelease) {
+		t.Errorf("expected ErrNothingToRelease, got %v", err)
+	}
+	if _, err := service.AdjustScore(ctx, "1", "10", models.AdjustScoreRequest{Action: models.ScoreActionReset, Reason: "gaming"}, "admin@example.com"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if score, err := rdb.ZScore(ctx, key, "10").Result(); err != nil || score != 0 {
+		t.Errorf("expected reset score 0, got %v (err %v)", score, err)
+	}
+
+	audit, err := service.ScoreAudit(ctx, "1", 1, 20)
+	if err != nil || audit.Total != 2 || audit.Entries[0].Action != models.ScoreActionReset || audit.Entries[1].Actor != "admin@example.com" {
+		t.Errorf("unexpected audit trail %+v (err %v)", audit, err)
+	}
+}
+
+func TestInteractionAnomalyReport(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	service := NewInteractionService()
+
+	day := time.Date(2026, 10, 14, 12, 0, 0, 0, statsLocation())
+	key := rankKey("1", "interactions", "")
+	// Shop 10 is steadily busy, shop 11 spikes, shop 12 is blocked a lot
+	for d := 1; d <= 7; d++ {
+		rdb.ZIncrBy(ctx, rankBucketKey(key, day.AddDate(0, 0, -d).Format("2006-01-02")), 40, "10")
+		rdb.ZIncrBy(ctx, rankBucketKey(key, day.AddDate(0, 0, -d).Format("2006-01-02")), 2, "11")
+	}
+	rdb.ZIncrBy(ctx, rankBucketKey(key, "2026-10-14"), 45, "10")
+	rdb.ZIncrBy(ctx, rankBucketKey(key, "2026-10-14"), 30, "11")
+	rdb.ZIncrBy(ctx, blockedKey("1", "2026-10-14"), 25, "12")
+	rdb.HSet(ctx, "ishop:11", "name", "Spiky")
+
+	report, err := service.AnomalyReport(ctx, "1", day, 0, 0)
+	if err != nil {
+		t.Fatalf("AnomalyReport: %v", err)
+	}
+	if len(report.Anomalies) != 2 || report.Anomalies[0].ShopID != "11" || report.Anomalies[0].Name != "Spiky" ||
+		report.Anomalies[0].Ratio != 15 || report.Anomalies[1].ShopID != "12" || report.Anomalies[1].Blocked != 25 {
+		t.Errorf("unexpected anomalies %+v", report.Anomalies)
+	}
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/database"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Invite errors surfaced to handlers
+var (
+	ErrInviteNotFound     = errors.New("invite not found")
+	ErrInviteExpired      = errors.New("invite has expired")
+	ErrInviteRevoked      = errors.New("invite has been revoked")
+	ErrInviteExhausted    = errors.New("invite has reached its usage limit")
+	ErrInviteShopRequired = errors.New("either shop_id or shop is required")
+)
+
+const (
+	inviteCodeLength    = 8
+	inviteDefaultExpiry = 7 * 24 * time.Hour
+	// Unambiguous characters so codes can be read out or typed by hand
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+func inviteKey(code string) string {
+	return fmt.Sprintf("invite:%s", code)
+}
+
+func inviteMembersKey(code string) string {
+	return fmt.Sprintf("invite:%s:members", code)
+}
+
+func icomInvitesKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:invites", icomID)
+}
+
+// normalizeInviteCode accepts codes typed in lower case or with separators
+func normalizeInviteCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func generateInviteCode() (string, error) {
+	b := make([]byte, inviteCodeLength)
+	max := big.NewInt(int64(len(inviteCodeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = inviteCodeAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// InviteService manages invitation links and join codes of iComs
+type InviteService struct {
+	rdb           *redis.Client
+	memberService *MemberService
+	ishopService  *IShopService
+}
+
+// NewInviteService creates a new invite service
+func NewInviteService() *InviteService {
+	return &InviteService{
+		rdb:           database.Rdb,
+		memberService: NewMemberService(),
+		ishopService:  NewIShopService(),
+	}
+}
+
+// inviteLink builds the shareable link of an invite. INVITE_BASE_URL points
+// at the join page of the web app, e.g. https://example.com/join
+func inviteLink(code string) string {
+	base := os.Getenv("INVITE_BASE_URL")
+	if base == "" {
+		base = "/join"
+	}
+	return strings.TrimRight(base, "/") + "/" + code
+}
+
+// CreateInvite creates an invitation for an iCom
+func (s *InviteService) CreateInvite(ctx context.Context, icomID string, req models.CreateInviteRequest) (*models.Invite, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrIComNotFound
+	}
+
+	expiry := inviteDefaultExpiry
+	if req.ExpiresInHours > 0 {
+		expiry = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	rank := req.Rank
+	if rank != "" {
+		if err := checkRank(ctx, s.rdb, icomID, rank); err != nil {
+			return nil, err
+		}
+	} else if rank, err = baseRank(ctx, s.rdb, icomID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	invite := models.Invite{
+		IComID:    icomID,
+		Rank:      rank,
+		Role:      req.Role,
+		Note:      req.Note,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: now.Add(expiry).Format(time.RFC3339),
+		Created:   now.Format(time.RFC3339),
+	}
+
+	// Claim a free code; collisions are rare but codes are global
+	for attempt := 0; invite.Code == ""; attempt++ {
+		if attempt == 5 {
+			return nil, fmt.Errorf("could not allocate an invite code")
+		}
+		code, err := generateInviteCode()
+		if err != nil {
+			return nil, err
+		}
+		ok, err := s.rdb.HSetNX(ctx, inviteKey(code), "code", code).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			invite.Code = code
+		}
+	}
+
+	fields, err := hashcodec.Marshal(invite)
+	if err != nil {
+		return nil, err
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, inviteKey(invite.Code), fields)
+	pipe.ZAdd(ctx, icomInvitesKey(icomID), redis.Z{Score: float64(now.Unix()), Member: invite.Code})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	invite.Link = inviteLink(invite.Code)
+	return &invite, nil
+}
+
+// getInvite loads an invite by code
+func (s *InviteService) getInvite(ctx context.Context, code string) (*models.Invite, error) {
+	code = normalizeInviteCode(code)
+	data, err := s.rdb.HGetAll(ctx, inviteKey(code)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrInviteNotFound
+	}
+	invite := &models.Invite{}
+	if err := hashcodec.Unmarshal(data, invite); err != nil {
+		return nil, err
+	}
+	invite.Link = inviteLink(invite.Code)
+	return invite, nil
+}
+
+// GetInvite returns an iCom's invite with the shops that joined through it
+func (s *InviteService) GetInvite(ctx context.Context, icomID, code string) (*models.Invite, error) {
+	invite, err := s.getInvite(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if invite.IComID != icomID {
+		return nil, ErrInviteNotFound
+	}
+	invite.Members, err = s.rdb.ZRange(ctx, inviteMembersKey(invite.Code), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// ListInvites lists an iCom's invites, newest first
+func (s *InviteService) ListInvites(ctx context.Context, icomID string, page, limit int) (*models.InviteListResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	start := int64((page - 1) * limit)
+	stop := start + int64(limit) - 1
+
+	pipe := s.rdb.Pipeline()
+	codesCmd := pipe.ZRevRange(ctx, icomInvitesKey(icomID), start, stop)
+	totalCmd := pipe.ZCard(ctx, icomInvitesKey(icomID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	codes := codesCmd.Val()
+	invites := make([]models.Invite, 0, len(codes))
+	if len(codes) > 0 {
+		pipe := s.rdb.Pipeline()
+		cmds := make([]*redis.MapStringStringCmd, len(codes))
+		for i, code := range codes {
+			cmds[i] = pipe.HGetAll(ctx, inviteKey(code))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for _, cmd := range cmds {
+			data := cmd.Val()
+			if len(data) == 0 {
+				continue
+			}
+			var invite models.Invite
+			if err := hashcodec.Unmarshal(data, &invite); err != nil {
+				return nil, err
+			}
+			invite.Link = inviteLink(invite.Code)
+			invites = append(invites, invite)
+		}
+	}
+
+	return &models.InviteListResponse{
+		Invites: invites,
+		Total:   int(totalCmd.Val()),
+		Page:    page,
+		Limit:   limit,
+	}, nil
+}
+
+// RevokeInvite stops an invite from being used. Shops that already joined
+// keep their membership.
+func (s *InviteService) RevokeInvite(ctx context.Context, icomID, code string) error {
+	invite, err := s.getInvite(ctx, code)
+	if err != nil {
+		return err
+	}
+	if invite.IComID != icomID {
+		return ErrInviteNotFound
+	}
+	if invite.Revoked {
+		return nil
+	}
+	return s.rdb.HSet(ctx, inviteKey(invite.Code), map[string]interface{}{
+		"revoked":     "true",
+		"revokedDate": time.Now().Format(time.RFC3339),
+	}).Err()
+}
+
+// checkUsable reports why an invite cannot be used, if it cannot
+func checkUsable(invite *models.Invite, now time.Time) error {
+	if invite.Revoked {
+		return ErrInviteRevoked
+	}
+	if expires, err := time.Parse(time.RFC3339, invite.ExpiresAt); err == nil && !now.Before(expires) {
+		return ErrInviteExpired
+	}
+	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses {
+		return ErrInviteExhausted
+	}
+	return nil
+}
+
+// GetInviteInfo returns the public details of a usable invite for the join page
+func (s *InviteService) GetInviteInfo(ctx context.Context, code string) (*models.InviteInfo, error) {
+	invite, err := s.getInvite(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUsable(invite, time.Now()); err != nil {
+		return nil, err
+	}
+
+	vals, err := s.rdb.HMGet(ctx, fmt.Sprintf("icom:%s", invite.IComID), "name", "logo", "requireApproval").Result()
+	if err != nil {
+		return nil, err
+	}
+	icom := stringValues(vals, 3)
+
+	remaining := -1
+	if invite.MaxUses > 0 {
+		remaining = invite.MaxUses - invite.Uses
+	}
+	return &models.InviteInfo{
+		Code:            invite.Code,
+		IComID:          invite.IComID,
+		IComName:        icom[0],
+		IComLogo:        icom[1],
+		Rank:            invite.Rank,
+		Role:            invite.Role,
+		ExpiresAt:       invite.ExpiresAt,
+		RemainingUses:   remaining,
+		RequireApproval: icom[2] == "true",
+	}, nil
+}
+
+// Join lets a shop owner join an iCom through an invite. The shop is linked
+// when req.ShopID is set and created from req.Shop otherwise; the membership
+// then goes through the iCom's usual approval, capacity and waitlist rules.
+func (s *InviteService) Join(ctx context.Context, code string, req models.JoinByInviteRequest) (*models.MembershipApplication, error) {
+	if req.ShopID == "" && req.Shop == nil {
+		return nil, ErrInviteShopRequired
+	}
+
+	invite, err := s.getInvite(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUsable(invite, time.Now()); err != nil {
+		return nil, err
+	}
+
+	// Reserve a use up front so concurrent joins cannot exceed the limit
+	key := inviteKey(invite.Code)
+	uses, err := s.rdb.HIncrBy(ctx, key, "uses", 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	release := func() { s.rdb.HIncrBy(ctx, key, "uses", -1) }
+	if invite.MaxUses > 0 && int(uses) > invite.MaxUses {
+		release()
+		return nil, ErrInviteExhausted
+	}
+
+	shopID := req.ShopID
+	created := false
+	if shopID == "" {
+		shopID, err = s.createShop(ctx, invite.IComID, req)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		created = true
+	}
+
+	application, err := s.memberService.apply(ctx, invite.IComID, models.ApplyMembershipRequest{
+		ShopID:  shopID,
+		Message: req.Message,
+	}, invite)
+	if err != nil {
+		release()
+		if created {
+			// Do not leave behind a shop that never joined
+			s.ishopService.DeleteIShop(ctx, shopID)
+		}
+		return nil, err
+	}
+
+	s.rdb.ZAdd(ctx, inviteMembersKey(invite.Code), redis.Z{Score: float64(time.Now().Unix()), Member: shopID})
+	return application, nil
+}
+
+// createShop creates the joining shop after checking it against the iCom's
+// industry and area rules and existing shops
+func (s *InviteService) createShop(ctx context.Context, icomID string, req models.JoinByInviteRequest) (string, error) {
+	rules, err := loadMembershipRules(ctx, s.rdb, icomID)
+	if err != nil {
+		return "", err
+	}
+	shop := req.Shop
+	if violations := rules.checkShop(shop.Industry, shop.Province, shop.District, shop.Ward); len(violations) > 0 {
+		return "", &MembershipRuleError{IComID: icomID, Violations: violations}
+	}
+
+	if !req.IgnoreDuplicates {
+		duplicates, err := s.ishopService.FindDuplicates(ctx, icomID, models.DuplicateCheckRequest{
+			Name:  shop.Name,
+			Phone: shop.Phone,
+			Email: shop.Email,
+			Lat:   shop.Lat,
+			Lng:   shop.Lng,
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(duplicates) > 0 {
+			return "", &DuplicateShopError{Candidates: duplicates}
+		}
+	}
+
+	profile, err := s.ishopService.CreateIShop(ctx, *shop)
+	if err != nil {
+		return "", err
+	}
+	return profile.ID, nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"i-manage/internal/constants"
+	"i-manage/internal/models"
+)
+
+func TestInviteJoin(t *testing.T) {
+	rdb := setupTestRedis(t)
+	seedApplicationFixtures(t, rdb, "false", "true")
+	ctx := context.Background()
+	service := NewInviteService()
+
+	if _, err := service.CreateInvite(ctx, "1", models.CreateInviteRequest{Rank: "VIP"}); !errors.Is(err, ErrTierUndefined) {
+		t.Fatalf("expected ErrTierUndefined for an undefined rank, got %v", err)
+	}
+	seedTiers(t, "1", "VIP")
+	invite, err := service.CreateInvite(ctx, "1", models.CreateInviteRequest{Rank: "VIP", Role: "treasurer", MaxUses: 2})
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	if len(invite.Code) != inviteCodeLength || invite.Link != "/join/"+invite.Code {
+		t.Fatalf("unexpected invite %+v", invite)
+	}
+
+	if _, err := service.Join(ctx, invite.Code, models.JoinByInviteRequest{}); !errors.Is(err, ErrInviteShopRequired) {
+		t.Errorf("expected ErrInviteShopRequired, got %v", err)
+	}
+
+	// Existing shop, code typed in lower case
+	app, err := service.Join(ctx, strings.ToLower(invite.Code[:4])+"-"+invite.Code[4:], models.JoinByInviteRequest{ShopID: "10"})
+	if err != nil {
+		t.Fatalf("Join(10): %v", err)
+	}
+	if app.Status != constants.APPLICATION_STATUS_APPROVED {
+		t.Errorf("expected auto-approved application, got %s", app.Status)
+	}
+	member, _ := rdb.HGetAll(ctx, "icom:1:member:10").Result()
+	if member["rank"] != "VIP" || member["role"] != "treasurer" || member["inviteCode"] != invite.Code {
+		t.Errorf("membership does not carry the invite defaults: %v", member)
+	}
+
+	// New shop
+	if _, err := service.Join(ctx, invite.Code, models.JoinByInviteRequest{Shop: &models.CreateIShopRequest{
+		Name: "Bánh mì 37", Industry: "fnb", Province: "HCM", Lat: 10.77, Lng: 106.7,
+	}}); err != nil {
+		t.Fatalf("Join(new shop): %v", err)
+	}
+
+	if _, err := service.Join(ctx, invite.Code, models.JoinByInviteRequest{ShopID: "11"}); !errors.Is(err, ErrInviteExhausted) {
+		t.Errorf("expected ErrInviteExhausted, got %v", err)
+	}
+
+	got, err := service.GetInvite(ctx, "1", invite.Code)
+	if err != nil || got.Uses != 2 || len(got.Members) != 2 {
+		t.Fatalf("expected 2 uses and members, got %+v (err %v)", got, err)
+	}
+
+	if err := service.RevokeInvite(ctx, "1", invite.Code); err != nil {
+		t.Fatalf("RevokeInvite: %v", err)
+	}
+	if _, err := service.GetInviteInfo(ctx, invite.Code); !errors.Is(err, ErrInviteRevoked) {
+		t.Errorf("expected ErrInviteRevoked, got %v", err)
+	}
+}
+
+func TestInviteJoinFailureReleasesUse(t *testing.T) {
+	rdb := setupTestRedis(t)
+	seedApplicationFixtures(t, rdb, "true", "false")
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1", "allowedIndustries", `["retail"]`)
+	service := NewInviteService()
+
+	invite, err := service.CreateInvite(ctx, "1", models.CreateInviteRequest{MaxUses: 1})
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+
+	var ruleErr *MembershipRuleError
+	if _, err := service.Join(ctx, invite.Code, models.JoinByInviteRequest{ShopID: "10"}); !errors.As(err, &ruleErr) {
+		t.Fatalf("expected a rule violation, got %v", err)
+	}
+	if uses, _ := rdb.HGet(ctx, inviteKey(invite.Code), "uses").Int(); uses != 0 {
+		t.Errorf("expected the reserved use to be released, got %d", uses)
+	}
+}
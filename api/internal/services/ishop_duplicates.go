@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/models"
+)
+
+// Lookup keys used for duplicate detection. RediSearch does not index contact
+// fields, so phone, email and location are kept in dedicated structures.
+const (
+	shopGeoKey             = "ishops:geo"
+	shopLookupBackfillKey  = "ishops:lookup:backfilled"
+	duplicateNameRadius    = 200.0 // meters
+	duplicateMaxCandidates = 10
+)
+
+func shopPhoneKey(phone string) string { return "ishops:phone:" + phone }
+func shopEmailKey(email string) string { return "ishops:email:" + email }
+
+// normalizePhone keeps the digits of a phone number and folds the +84
+// country code into the local 0 prefix. Numbers too short to be reliable
+// return "".
+func normalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	if strings.HasPrefix(digits, "84") && len(digits) >= 11 {
+		digits = "0" + digits[2:]
+	}
+	if len(digits) < 8 {
+		return ""
+	}
+	return digits
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizeName reduces a shop name to its unaccented letters and digits
+func normalizeName(name string) string {
+	return strings.Join(tokenizeText(name), "")
+}
+
+// similarNames reports whether two shop names likely refer to the same
+// business: one normalized name contains the other
+func similarNames(a, b string) bool {
+	a, b = normalizeName(a), normalizeName(b)
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len([]rune(a)) < 4 {
+		return a != "" && a == b
+	}
+	return strings.Contains(b, a)
+}
+
+func validCoordinates(lat, lng float64) bool {
+	return (lat != 0 || lng != 0) && lat >= -85.05112878 && lat <= 85.05112878 && lng >= -180 && lng <= 180
+}
+
+// indexShopContacts adds a shop to the phone, email and geo lookups
+func indexShopContacts(ctx context.Context, pipe redis.Pipeliner, id, phone, email string, lat, lng float64) {
+	if p := normalizePhone(phone); p != "" {
+		pipe.SAdd(ctx, shopPhoneKey(p), id)
+	}
+	if e := normalizeEmail(email); e != "" {
+		pipe.SAdd(ctx, shopEmailKey(e), id)
+	}
+	if validCoordinates(lat, lng) {
+		pipe.GeoAdd(ctx, shopGeoKey, &redis.GeoLocation{Name: id, Latitude: lat, Longitude: lng})
+	}
+}
+
+// unindexShopContacts removes a shop from the phone, email and geo lookups
+func unindexShopContacts(ctx context.Context, pipe redis.Pipeliner, id, phone, email string) {
+	if p := normalizePhone(phone); p != "" {
+		pipe.SRem(ctx, shopPhoneKey(p), id)
+	}
+	if e := normalizeEmail(email); e != "" {
+		pipe.SRem(ctx, shopEmailKey(e), id)
+	}
+	pipe.ZRem(ctx, shopGeoKey, id)
+}
+
+// FindDuplicates suggests existing shops that may be the business described
+// by req: same phone, same email, or a similar name within a short distance.
+// When icomID is set, candidates are flagged if they already belong to it.
+func (s *IShopService) FindDuplicates(ctx context.Context, icomID string, req models.DuplicateCheckRequest) ([]models.DuplicateCandidate, error) {
+	reasons := make(map[string][]string)
+	distances := make(map[string]float64)
+	var order []string
+	add := func(id, reason string) {
+		if _, seen := reasons[id]; !seen {
+			order = append(order, id)
+		}
+		reasons[id] = append(reasons[id], reason)
+	}
+
+	pipe := s.rdb.Pipeline()
+	var phoneCmd, emailCmd *redis.StringSliceCmd
+	if p := normalizePhone(req.Phone); p != "" {
+		phoneCmd = pipe.SMembers(ctx, shopPhoneKey(p))
+	}
+	if e := normalizeEmail(req.Email); e != "" {
+		emailCmd = pipe.SMembers(ctx, shopEmailKey(e))
+	}
+	var geoCmd *redis.GeoLocationCmd
+	if req.Name != "" && validCoordinates(req.Lat, req.Lng) {
+		geoCmd = pipe.GeoRadius(ctx, shopGeoKey, req.Lng, req.Lat, &redis.GeoRadiusQuery{
+			Radius:   duplicateNameRadius,
+			Unit:     "m",
+			WithDist: true,
+			Sort:     "ASC",
+			Count:    50,
+		})
+	}
+	if phoneCmd == nil && emailCmd == nil && geoCmd == nil {
+		return []models.DuplicateCandidate{}, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	if phoneCmd != nil {
+		for _, id := range phoneCmd.Val() {
+			add(id, models.DuplicateReasonPhone)
+		}
+	}
+	if emailCmd != nil {
+		for _, id := range emailCmd.Val() {
+			add(id, models.DuplicateReasonEmail)
+		}
+	}
+
+	// Nearby shops only count when their name is similar
+	var nearby []redis.GeoLocation
+	if geoCmd != nil {
+		nearby = geoCmd.Val()
+	}
+	nearbyNames := make([]*redis.StringCmd, len(nearby))
+	if len(nearby) > 0 {
+		pipe := s.rdb.Pipeline()
+		for i, loc := range nearby {
+			nearbyNames[i] = pipe.HGet(ctx, fmt.Sprintf("ishop:%s", loc.Name), "name")
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+	for i, loc := range nearby {
+		if similarNames(req.Name, nearbyNames[i].Val()) {
+			add(loc.Name, models.DuplicateReasonNameNearby)
+			distances[loc.Name] = loc.Dist
+		}
+	}
+
+	if len(order) > duplicateMaxCandidates {
+		order = order[:duplicateMaxCandidates]
+	}
+
+	pipe = s.rdb.Pipeline()
+	shopCmds := make([]*redis.MapStringStringCmd, len(order))
+	memberCmds := make([]*redis.IntCmd, len(order))
+	for i, id := range order {
+		shopCmds[i] = pipe.HGetAll(ctx, fmt.Sprintf("ishop:%s", id))
+		if icomID != "" {
+			memberCmds[i] = pipe.Exists(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, id))
+		}
+	}
+	if len(order) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+
+	candidates := make([]models.DuplicateCandidate, 0, len(order))
+	for i, id := range order {
+		data := shopCmds[i].Val()
+		if len(data) == 0 {
+			// Stale lookup entry
+			continue
+		}
+		candidate := models.DuplicateCandidate{
+			ShopID:   id,
+			Name:     data["name"],
+			Logo:     data["logo"],
+			Phone:    data["phone"],
+			Email:    data["email"],
+			Province: data["province"],
+			District: data["district"],
+			Street:   data["street"],
+			Distance: distances[id],
+			Reasons:  reasons[id],
+		}
+		if memberCmds[i] != nil {
+			candidate.AlreadyMember = memberCmds[i].Val() > 0
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+// BackfillContactLookup indexes the contacts of shops created before the
+// duplicate lookups existed. It runs once; later calls are no-ops.
+func (s *IShopService) BackfillContactLookup(ctx context.Context) (int, error) {
+	done, err := s.rdb.Exists(ctx, shopLookupBackfillKey).Result()
+	if err != nil || done > 0 {
+		return 0, err
+	}
+
+	indexed := 0
+	iter := s.rdb.Scan(ctx, 0, "ishop:*", 500).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		id := strings.TrimPrefix(key, "ishop:")
+		if strings.Contains(id, ":") {
+			// Sub-keys such as ishop:<id>:icoms
+			continue
+		}
+		vals, err := s.rdb.HMGet(ctx, key, "phone", "email", "lat", "lng").Result()
+		if err != nil {
+			// Not a hash
+			continue
+		}
+		v := stringValues(vals, 4)
+		var lat, lng float64
+		fmt.Sscan(v[2], &lat)
+		fmt.Sscan(v[3], &lng)
+
+		pipe := s.rdb.Pipeline()
+		indexShopContacts(ctx, pipe, id, v[0], v[1], lat, lng)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return indexed, err
+		}
+		indexed++
+	}
+	if err := iter.Err(); err != nil {
+		return indexed, err
+	}
+	return indexed, s.rdb.Set(ctx, shopLookupBackfillKey, "1", 0).Err()
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"i-manage/internal/models"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := map[string]string{
+		"0901 234 567":    "0901234567",
+		"+84 901-234-567": "0901234567",
+		"(028) 3822 1234": "02838221234",
+		"12345":           "",
+		"":                "",
+	}
+	for in, want := range tests {
+		if got := normalizePhone(in); got != want {
+			t.Errorf("normalizePhone(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSimilarNames(t *testing.T) {
+	if !similarNames("Phở Hòa", "PHO HOA Pasteur") {
+		t.Error("expected names to match ignoring accents and suffix")
+	}
+	if similarNames("Cà phê", "Bánh mì") {
+		t.Error("expected different names not to match")
+	}
+}
+
+func TestAddMemberDuplicatesAndLinking(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1", "id", "1", "name", "First iCom")
+	rdb.HSet(ctx, "icom:2", "id", "2", "name", "Second iCom")
+	service := NewMemberService()
+
+	req := models.AddMemberRequest{
+		Name:     "Phở Hòa",
+		Phone:    "0901 234 567",
+		Lat:      10.7769,
+		Lng:      106.7009,
+		Industry: "fnb",
+	}
+	shopID, err := service.AddMember(ctx, "1", req)
+	if err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+
+	// Same phone in another format
+	dup := req
+	dup.Name = "Another name"
+	dup.Phone = "+84901234567"
+	_, err = service.AddMember(ctx, "2", dup)
+	var dupErr *DuplicateShopError
+	if !errors.As(err, &dupErr) || len(dupErr.Candidates) != 1 || dupErr.Candidates[0].ShopID != shopID {
+		t.Fatalf("expected phone duplicate of %s, got %v", shopID, err)
+	}
+
+	// Similar name a few meters away
+	candidates, err := NewIShopService().FindDuplicates(ctx, "1", models.DuplicateCheckRequest{
+		Name: "Pho Hoa Pasteur", Lat: 10.7770, Lng: 106.7010,
+	})
+	if err != nil || len(candidates) != 1 || candidates[0].Reasons[0] != models.DuplicateReasonNameNearby || !candidates[0].AlreadyMember {
+		t.Fatalf("expected nearby name match already in iCom 1, got %+v (err %v)", candidates, err)
+	}
+
+	// Link the existing shop instead, with a rank iCom 2 defines
+	if _, err := service.AddMember(ctx, "2", models.AddMemberRequest{ShopID: shopID, Rank: "VIP"}); !errors.Is(err, ErrTierUndefined) {
+		t.Fatalf("expected ErrTierUndefined for an undefined rank, got %v", err)
+	}
+	seedTiers(t, "2", "VIP")
+	linked, err := service.AddMember(ctx, "2", models.AddMemberRequest{ShopID: shopID, Rank: "VIP", Role: "owner"})
+	if err != nil || linked != shopID {
+		t.Fatalf("expected shop %s to be linked, got %q (err %v)", shopID, linked, err)
+	}
+	if rank, _ := rdb.HGet(ctx, "icom:2:member:"+shopID, "rank").Result(); rank != "VIP" {
+		t.Errorf("expected VIP rank in iCom 2, got %q", rank)
+	}
+	if n, _ := rdb.ZCard(ctx, "ishop:"+shopID+":icoms").Result(); n != 2 {
+		t.Errorf("expected shop in 2 iComs, got %d", n)
+	}
+	if _, err := service.AddMember(ctx, "2", models.AddMemberRequest{ShopID: shopID}); !errors.Is(err, ErrAlreadyMember) {
+		t.Errorf("expected ErrAlreadyMember, got %v", err)
+	}
+
+	// Explicitly creating a separate shop is still possible
+	dup.IgnoreDuplicates = true
+	if other, err := service.AddMember(ctx, "2", dup); err != nil || other == shopID {
+		t.Errorf("expected a new shop, got %q (err %v)", other, err)
+	}
+}
@@ -4,12 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"i-manage/internal/constants"
 	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/hashcodec"
 	"i-manage/internal/models"
 )
 
@@ -53,63 +54,44 @@ func (s *IShopService) CreateIShop(ctx context.Context, req models.CreateIShopRe
 
 	// Create profile
 	profile := models.IShopProfile{
-		ID:          id,
-		CardType:    constants.CARD_TYPE_ISHOP,
-		PackageID:   "",
-		Private:     privateCode,
-		Name:        req.Name,
-		Description: req.Description,
-		Logo:        req.Logo,
-		Banner:      req.Banner,
-		ImageURLs:   string(imageURLs),
-		Province:    req.Province,
-		District:    req.District,
-		Ward:        req.Ward,
-		Street:      req.Street,
-		Lat:         req.Lat,
-		Lng:         req.Lng,
-		Phone:       req.Phone,
-		Email:       req.Email,
-		Website:     req.Website,
-		Industry:    req.Industry,
-		SubIndustry: req.SubIndustry,
-		Status:      constants.STATUS_ACTIVE,
-		Created:     now,
-		Modified:    now,
+		ID:            id,
+		CardType:      constants.CARD_TYPE_ISHOP,
+		PackageID:     "",
+		Private:       privateCode,
+		Name:          req.Name,
+		Description:   req.Description,
+		Logo:          req.Logo,
+		Banner:        req.Banner,
+		ImageURLs:     string(imageURLs),
+		Province:      req.Province,
+		District:      req.District,
+		Ward:          req.Ward,
+		Street:        req.Street,
+		Lat:           req.Lat,
+		Lng:           req.Lng,
+		Phone:         req.Phone,
+		Email:         req.Email,
+		Website:       req.Website,
+		Industry:      req.Industry,
+		SubIndustry:   req.SubIndustry,
+		Status:        constants.STATUS_ACTIVE,
+		PrivateFields: req.PrivateFields,
+		Created:       now,
+		Modified:      now,
 	}
 
-	// Save to Redis
-	key := fmt.Sprintf("ishop:%s", id)
-	err = s.rdb.HSet(ctx, key, map[string]interface{}{
-		"id":          id,
-		"cardType":    profile.CardType,
-		"packageId":   profile.PackageID,
-		"private":     profile.Private,
-		"name":        profile.Name,
-		"description": profile.Description,
-		"logo":        profile.Logo,
-		"banner":      profile.Banner,
-		"imageUrls":   profile.ImageURLs,
-		"province":    profile.Province,
-		"district":    profile.District,
-		"ward":        profile.Ward,
-		"street":      profile.Street,
-		"lat":         profile.Lat,
-		"lng":         profile.Lng,
-		"phone":       profile.Phone,
-		"email":       profile.Email,
-		"website":     profile.Website,
-		"industry":    profile.Industry,
-		"subIndustry": profile.SubIndustry,
-		"status":      profile.Status,
-		"created":     profile.Created,
-		"modified":    profile.Modified,
-		"icoms":       "",
-	}).Err()
-
+	// Save to Redis (icoms starts empty and is managed by MemberService)
+	fields, err := hashcodec.Marshal(profile)
 	if err != nil {
 		return nil, err
 	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, fmt.Sprintf("ishop:%s", id), fields)
+	indexShopContacts(ctx, pipe, id, profile.Phone, profile.Email, profile.Lat, profile.Lng)
+	events.Append(ctx, pipe, events.New(events.IShopCreated, "", id, events.IShopChangedData{Name: profile.Name}))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
 
 	return &profile, nil
 }
@@ -117,50 +99,19 @@ func (s *IShopService) CreateIShop(ctx context.Context, req models.CreateIShopRe
 // GetIShop retrieves iShop profile from Redis
 func (s *IShopService) GetIShop(ctx context.Context, id string) (*models.IShopProfile, error) {
 	key := fmt.Sprintf("ishop:%s", id)
-	exists, err := s.rdb.Exists(ctx, key).Result()
+	data, err := s.rdb.HGetAll(ctx, key).Result()
 	if err != nil {
 		return nil, err
 	}
-	if exists == 0 {
+	if len(data) == 0 {
 		return nil, fmt.Errorf("iShop not found")
 	}
 
-	data, err := s.rdb.HGetAll(ctx, key).Result()
-	if err != nil {
+	profile := &models.IShopProfile{}
+	if err := hashcodec.Unmarshal(data, profile); err != nil {
 		return nil, err
 	}
 
-	// Parse lat/lng
-	lat, _ := strconv.ParseFloat(data["lat"], 64)
-	lng, _ := strconv.ParseFloat(data["lng"], 64)
-
-	profile := &models.IShopProfile{
-		ID:          data["id"],
-		CardType:    data["cardType"],
-		PackageID:   data["packageId"],
-		Private:     data["private"],
-		Name:        data["name"],
-		Description: data["description"],
-		Logo:        data["logo"],
-		Banner:      data["banner"],
-		ImageURLs:   data["imageUrls"],
-		Province:    data["province"],
-		District:    data["district"],
-		Ward:        data["ward"],
-		Street:      data["street"],
-		Lat:         lat,
-		Lng:         lng,
-		Phone:       data["phone"],
-		Email:       data["email"],
-		Website:     data["website"],
-		Industry:    data["industry"],
-		SubIndustry: data["subIndustry"],
-		Status:      data["status"],
-		Created:     data["created"],
-		Modified:    data["modified"],
-		IComs:       data["icoms"],
-	}
-
 	return profile, nil
 }
 
@@ -175,61 +126,81 @@ func (s *IShopService) UpdateIShop(ctx context.Context, id string, req models.Up
 		return fmt.Errorf("iShop not found")
 	}
 
-	updates := make(map[string]interface{})
-	if req.Name != "" {
-		updates["name"] = req.Name
-	}
-	if req.Description != "" {
-		updates["description"] = req.Description
-	}
-	if req.Logo != "" {
-		updates["logo"] = req.Logo
-	}
-	if req.Banner != "" {
-		updates["banner"] = req.Banner
-	}
-	if req.ImageURLs != nil {
-		imageURLs, _ := json.Marshal(req.ImageURLs)
-		updates["imageUrls"] = string(imageURLs)
-	}
-	if req.Province != "" {
-		updates["province"] = req.Province
-	}
-	if req.District != "" {
-		updates["district"] = req.District
-	}
-	if req.Ward != "" {
-		updates["ward"] = req.Ward
-	}
-	if req.Street != "" {
-		updates["street"] = req.Street
-	}
-	if req.Lat != 0 {
-		updates["lat"] = req.Lat
-	}
-	if req.Lng != 0 {
-		updates["lng"] = req.Lng
-	}
-	if req.Phone != "" {
-		updates["phone"] = req.Phone
-	}
-	if req.Email != "" {
-		updates["email"] = req.Email
-	}
-	if req.Website != "" {
-		updates["website"] = req.Website
-	}
-	if req.Industry != "" {
-		updates["industry"] = req.Industry
+	// Industry and location must stay within the rules of the shop's iComs
+	if err := s.CheckShopUpdate(ctx, id, req); err != nil {
+		return err
 	}
-	if req.SubIndustry != "" {
-		updates["subIndustry"] = req.SubIndustry
+
+	updates, err := hashcodec.MarshalPartial(req)
+	if err != nil {
+		return err
 	}
 	// Note: icoms is managed by MemberService
 
 	updates["modified"] = time.Now().Format(time.RFC3339)
 
-	return s.rdb.HSet(ctx, key, updates).Err()
+	// Keep the duplicate-detection lookups in sync with contact changes
+	var contacts []string
+	if req.Phone != "" || req.Email != "" || req.Lat != 0 || req.Lng != 0 {
+		vals, err := s.rdb.HMGet(ctx, key, "phone", "email", "lat", "lng").Result()
+		if err != nil {
+			return err
+		}
+		contacts = stringValues(vals, 4)
+	}
+
+	// Move the shop's industry and area counts in each of its iComs
+	var moved []string
+	var icomIDs []string
+	if req.Industry != "" || req.SubIndustry != "" || req.Province != "" || req.District != "" {
+		vals, err := s.rdb.HMGet(ctx, key, "industry", "subIndustry", "province", "district").Result()
+		if err != nil {
+			return err
+		}
+		moved = stringValues(vals, 4)
+		icomIDs, err = s.rdb.ZRange(ctx, fmt.Sprintf("ishop:%s:icoms", id), 0, -1).Result()
+		if err != nil {
+			return err
+		}
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, key, updates)
+	if moved != nil {
+		next := append([]string(nil), moved...)
+		for i, v := range []string{req.Industry, req.SubIndustry, req.Province, req.District} {
+			if v != "" {
+				next[i] = v
+			}
+		}
+		for _, icomID := range icomIDs {
+			updateMetadataAggregation(ctx, pipe, icomID, moved[0], moved[1], moved[2], moved[3], "", -1)
+			updateMetadataAggregation(ctx, pipe, icomID, next[0], next[1], next[2], next[3], "", 1)
+		}
+	}
+	if contacts != nil {
+		phone, email := contacts[0], contacts[1]
+		var lat, lng float64
+		fmt.Sscan(contacts[2], &lat)
+		fmt.Sscan(contacts[3], &lng)
+		unindexShopContacts(ctx, pipe, id, phone, email)
+		if req.Phone != "" {
+			phone = req.Phone
+		}
+		if req.Email != "" {
+			email = req.Email
+		}
+		if req.Lat != 0 || req.Lng != 0 {
+			lat, lng = req.Lat, req.Lng
+		}
+		indexShopContacts(ctx, pipe, id, phone, email, lat, lng)
+	}
+	events.Append(ctx, pipe, events.New(events.IShopUpdated, "", id, events.IShopChangedData{
+		Name:    req.Name,
+		Changed: events.ChangedFields(updates),
+	}))
+	_, err = pipe.Exec(ctx)
+	return err
 }
 
 // DeleteIShop deletes iShop and removes from all iComs
@@ -245,45 +216,58 @@ func (s *IShopService) DeleteIShop(ctx context.Context, id string) error {
 	industry := shopData["industry"]
 	subIndustry := shopData["subIndustry"]
 
-	// Use pipeline
-	pipe := s.rdb.Pipeline()
+	// Status and rank of each membership, to take the shop out of the indexes
+	memberCmds := make([]*redis.SliceCmd, len(icomIDs))
+	if len(icomIDs) > 0 {
+		pipe := s.rdb.Pipeline()
+		for i, icomID := range icomIDs {
+			memberCmds[i] = pipe.HMGet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, id), "status", "rank")
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return err
+		}
+	}
+
+	// Use transaction so the delete and its event commit together
+	pipe := s.rdb.TxPipeline()
 
 	// Delete main profile
 	pipe.Del(ctx, fmt.Sprintf("ishop:%s", id))
+	unindexShopContacts(ctx, pipe, id, shopData["phone"], shopData["email"])
 
 	// Delete membership list
 	pipe.Del(ctx, icomsKey)
 
 	// Remove from each iCom
-	for _, icomID := range icomIDs {
+	for i, icomID := range icomIDs {
 		// Remove from members set
 		pipe.ZRem(ctx, fmt.Sprintf("icom:%s:members", icomID), id)
 		
 		// Optimization: Cleanup Rankings and Geo
-		pipe.ZRem(ctx, fmt.Sprintf("icom:%s:rank:interactions", icomID), id)
-		pipe.ZRem(ctx, fmt.Sprintf("icom:%s:rank:likes", icomID), id)
+		unrankShop(ctx, pipe, icomID, id)
 		pipe.ZRem(ctx, fmt.Sprintf("icom:%s:geo", icomID), id) // If it exists (legacy)
 
 		// Metadata Aggregation Cleanup (Phase 17)
-		if industry != "" {
-			pipe.ZIncrBy(ctx, fmt.Sprintf("icom:%s:meta:industries", icomID), -1, industry)
-		}
-		if subIndustry != "" {
-			pipe.ZIncrBy(ctx, fmt.Sprintf("icom:%s:meta:sub_industries", icomID), -1, subIndustry)
-		}
-		if province != "" {
-			pipe.ZIncrBy(ctx, fmt.Sprintf("icom:%s:meta:areas", icomID), -1, province)
-		}
-		if district != "" {
-			pipe.ZIncrBy(ctx, fmt.Sprintf("icom:%s:meta:areas", icomID), -1, district)
-		}
+		updateMetadataAggregation(ctx, pipe, icomID, industry, subIndustry, province, district, "", -1)
 
 		// Delete membership details
 		pipe.Del(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, id))
 		// Decrement member count
 		pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "totalMembers", -1)
+		membership := stringValues(memberCmds[i].Val(), 2)
+		if membership[0] != "" {
+			pipe.SRem(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, membership[0]), id)
+		}
+		if membership[1] != "" {
+			pipe.SRem(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, membership[1]), id)
+		}
+		if membership[0] == constants.MEMBER_STATUS_ACTIVE {
+			pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "activeMembers", -1)
+		}
 	}
 
+	events.Append(ctx, pipe, events.New(events.IShopDeleted, "", id, nil))
+
 	_, err := pipe.Exec(ctx)
 	return err
 }
@@ -297,26 +281,39 @@ func (s *IShopService) GetMemberships(ctx context.Context, shopID string) ([]mod
 	}
 
 	memberships := make([]models.IShopMembershipInfo, 0, len(icomIDs))
-	for _, z := range icomIDs {
+	if len(icomIDs) == 0 {
+		return memberships, nil
+	}
+
+	// Fetch iCom name/logo and membership details for all iComs in one round-trip
+	pipe := s.rdb.Pipeline()
+	icomCmds := make([]*redis.SliceCmd, len(icomIDs))
+	memberCmds := make([]*redis.MapStringStringCmd, len(icomIDs))
+	for i, z := range icomIDs {
 		icomID := z.Member.(string)
-		
-		// Get iCom details
-		icomKey := fmt.Sprintf("icom:%s", icomID)
-		icomName, _ := s.rdb.HGet(ctx, icomKey, "name").Result()
-		icomLogo, _ := s.rdb.HGet(ctx, icomKey, "logo").Result()
+		icomCmds[i] = pipe.HMGet(ctx, fmt.Sprintf("icom:%s", icomID), "name", "logo")
+		memberCmds[i] = pipe.HGetAll(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	for i, z := range icomIDs {
+		icomVals := icomCmds[i].Val()
+		icomName, _ := icomVals[0].(string)
+		icomLogo, _ := icomVals[1].(string)
 
-		// Get membership details
-		memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
-		memberData, _ := s.rdb.HGetAll(ctx, memberKey).Result()
+		var detail models.MembershipDetail
+		_ = hashcodec.Unmarshal(memberCmds[i].Val(), &detail)
 
 		memberships = append(memberships, models.IShopMembershipInfo{
-			IComID:     icomID,
+			IComID:     z.Member.(string),
 			IComName:   icomName,
 			IComLogo:   icomLogo,
-			Rank:       memberData["rank"],
-			Status:     memberData["status"],
-			JoinedDate: memberData["joinedDate"],
-			Role:       memberData["role"],
+			Rank:       detail.Rank,
+			Status:     detail.Status,
+			JoinedDate: detail.JoinedDate,
+			Role:       detail.Role,
 			Score:      z.Score,
 		})
 	}
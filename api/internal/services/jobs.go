@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/database"
+	"i-manage/internal/models"
+	"i-manage/internal/workers"
+)
+
+// ErrJobStatus is returned when listing jobs by an unknown status
+var ErrJobStatus = errors.New("unknown job status")
+
+// jobHistoryLimit is how many runs are returned with a job
+const jobHistoryLimit = 20
+
+// NewScheduler creates the job scheduler of the API server with its
+// recurring jobs and one-off job handlers. Schedules are evaluated in the
+// stats time zone.
+func NewScheduler() (*workers.Scheduler, error) {
+	scheduler := workers.NewScheduler(database.Rdb, statsLocation())
+	members := NewMemberService()
+	jobs := []struct {
+		name, spec string
+		fn         func(ctx context.Context) error
+	}{
+		{"tiers", "5 * * * *", members.EvaluateAllTiers},
+		{"dues", "15 * * * *", NewDuesService().ProcessAllDues},
+		{"membership-expiry", "30 * * * *", members.ProcessAllExpiry},
+	}
+	for _, job := range jobs {
+		if err := scheduler.Cron(job.name, job.spec, job.fn, workers.JobOptions{}); err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.name, err)
+		}
+	}
+	scheduler.Handle(AnnouncementPushJob, NewAnnouncementService().PushAnnouncement, workers.JobOptions{})
+	return scheduler, nil
+}
+
+// forEachICom calls fn for every iCom. A failing iCom does not stop the
+// others; the first error is returned once all have been visited so the
+// scheduler retries the job.
+func forEachICom(ctx context.Context, rdb *redis.Client, fn func(icomID string) error) error {
+	icomIDs, err := rdb.ZRange(ctx, "icoms:all", 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	failed := 0
+	for _, icomID := range icomIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := fn(icomID); err != nil {
+			log.Printf("iCom %s: %v", icomID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("%d of %d iComs failed: %w", failed, len(icomIDs), firstErr)
+	}
+	return nil
+}
+
+// JobService exposes the scheduler's jobs
+type JobService struct {
+	rdb *redis.Client
+}
+
+// NewJobService creates a new job service
+func NewJobService() *JobService {
+	return &JobService{rdb: database.Rdb}
+}
+
+// ListJobs returns the jobs in a status, or all of them
+func (s *JobService) ListJobs(ctx context.Context, status string) (*models.JobList, error) {
+	if status != "" && !containsString(models.JobStatuses, status) {
+		return nil, ErrJobStatus
+	}
+	return workers.ListJobs(ctx, s.rdb, status)
+}
+
+// GetJob returns a job with its latest runs
+func (s *JobService) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	return workers.GetJob(ctx, s.rdb, id, jobHistoryLimit)
+}
+
+// RunJob makes a job due now
+func (s *JobService) RunJob(ctx context.Context, id string) (*models.Job, error) {
+	return workers.TriggerJob(ctx, s.rdb, id)
+}
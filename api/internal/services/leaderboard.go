@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/models"
+)
+
+// Leaderboard errors surfaced to handlers
+var (
+	ErrLeaderboardPeriod   = errors.New("period must be all, today, week, month or 30d")
+	ErrLeaderboardScoring  = errors.New("scoring must be total or decay; decay needs a period other than all")
+	ErrLeaderboardSource   = errors.New("source must be icom or ishop and applies to likes only")
+	ErrLeaderboardHalfLife = errors.New("half_life must be a whole number of days from 1 to 30")
+)
+
+// rankBucketTTL keeps daily ranking buckets long enough for every period
+const rankBucketTTL = 40 * 24 * time.Hour
+
+// leaderboardCacheTTL is how long a merged window is reused before it is
+// rebuilt from the daily buckets
+const leaderboardCacheTTL = 30 * time.Second
+
+// defaultHalfLifeDays is the decay half-life when none is given; half-lives
+// are whole days up to maxHalfLifeDays, so a caller cannot build an endless
+// number of cached windows
+const (
+	defaultHalfLifeDays = 7
+	maxHalfLifeDays     = 30
+)
+
+// maxLeaderboardLimit caps how many entries a leaderboard returns
+const maxLeaderboardLimit = 100
+
+// rankKey is the all-time ranking of an iCom; source narrows likes to where
+// they were given
+func rankKey(icomID, rankType, source string) string {
+	if rankType == "likes" && source != "" {
+		return fmt.Sprintf("icom:%s:rank:likes:source:%s", icomID, source)
+	}
+	return fmt.Sprintf("icom:%s:rank:%s", icomID, rankType)
+}
+
+// leaderboardWindowsKey is the set of merged windows of an iCom built within
+// the last leaderboardCacheTTL, so a ranking change can drop them
+func leaderboardWindowsKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:leaderboard:windows", icomID)
+}
+
+// rankBucketKey is the ranking of a single day, derived from an all-time key:
+//
+//	icom:<id>:rank:<type>[:source:<source>]:day:<YYYY-MM-DD>
+func rankBucketKey(key, day string) string {
+	return key + ":day:" + day
+}
+
+// rankDay is the bucket day of t in the statistics time zone
+func rankDay(t time.Time) string {
+	return t.In(statsLocation()).Format("2006-01-02")
+}
+
+// incrRankBuckets queues the daily counterpart of a ZINCRBY on each all-time key
+func incrRankBuckets(ctx context.Context, pipe redis.Pipeliner, day string, delta float64, shopID string, keys ...string) {
+	for _, key := range keys {
+		bucket := rankBucketKey(key, day)
+		pipe.ZIncrBy(ctx, bucket, delta, shopID)
+		pipe.Expire(ctx, bucket, rankBucketTTL)
+	}
+}
+
+// leaderboardDays returns the bucket days of a period ending today, oldest first
+func leaderboardDays(period string, today time.Time) ([]time.Time, error) {
+	var first time.Time
+	switch period {
+	case models.LeaderboardPeriodToday:
+		first = today
+	case models.LeaderboardPeriodWeek:
+		first = periodStart(models.StatsIntervalWeek, today)
+	case models.LeaderboardPeriodMonth:
+		first = periodStart(models.StatsIntervalMonth, today)
+	case models.LeaderboardPeriodLast30Days:
+		first = today.AddDate(0, 0, -29)
+	default:
+		return nil, ErrLeaderboardPeriod
+	}
+
+	var days []time.Time
+	for d := periodStart(models.StatsIntervalDay, first); !d.After(today); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// GetPeriodLeaderboard ranks shops over a period. The all-time period reads
+// the running totals; other periods merge the daily buckets with ZUNIONSTORE,
+// weighting each day by its age when decay scoring is requested.
+func (s *IComService) GetPeriodLeaderboard(ctx context.Context, icomID string, req models.LeaderboardRequest) ([]models.LeaderboardEntry, error) {
+	return s.periodLeaderboard(ctx, icomID, req, time.Now().In(statsLocation()))
+}
+
+func (s *IComService) periodLeaderboard(ctx context.Context, icomID string, req models.LeaderboardRequest, now time.Time) ([]models.LeaderboardEntry, error) {
+	if req.Period == "" {
+		req.Period = models.LeaderboardPeriodAll
+	}
+	if req.Scoring == "" {
+		req.Scoring = models.LeaderboardScoringTotal
+	}
+	if req.Scoring != models.LeaderboardScoringTotal && req.Scoring != models.LeaderboardScoringDecay {
+		return nil, ErrLeaderboardScoring
+	}
+	if req.Source != "" && (req.Type != "likes" || !slices.Contains(models.LikeSources, req.Source)) {
+		return nil, ErrLeaderboardSource
+	}
+	if req.HalfLifeDays != 0 && (req.HalfLifeDays < 1 || req.HalfLifeDays > maxHalfLifeDays || req.HalfLifeDays != math.Trunc(req.HalfLifeDays)) {
+		return nil, ErrLeaderboardHalfLife
+	}
+	req.Limit = min(max(req.Limit, 1), maxLeaderboardLimit)
+	if req.Period == models.LeaderboardPeriodAll {
+		if req.Scoring == models.LeaderboardScoringDecay {
+			return nil, ErrLeaderboardScoring
+		}
+		return s.GetLeaderboard(ctx, icomID, req.Type, req.Source, req.Limit)
+	}
+	if req.HalfLifeDays <= 0 {
+		req.HalfLifeDays = defaultHalfLifeDays
+	}
+
+	today := periodStart(models.StatsIntervalDay, now)
+	days, err := leaderboardDays(req.Period, today)
+	if err != nil {
+		return nil, err
+	}
+
+	base := rankKey(icomID, req.Type, req.Source)
+	key := rankBucketKey(base, today.Format("2006-01-02"))
+	if len(days) > 1 || req.Scoring == models.LeaderboardScoringDecay {
+		key = fmt.Sprintf("%s:window:%s:%s", base, req.Period, today.Format("2006-01-02"))
+		if req.Scoring == models.LeaderboardScoringDecay {
+			key += fmt.Sprintf(":decay:%g", req.HalfLifeDays)
+		}
+		if err := s.mergeRankBuckets(ctx, icomID, key, base, days, today, req); err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := s.rdb.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min:   "(0",
+		Max:   "+inf",
+		Count: int64(req.Limit),
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	return s.leaderboardEntries(ctx, results)
+}
+
+// mergeRankBuckets builds the merged window at dest unless a recent copy exists
+func (s *IComService) mergeRankBuckets(ctx context.Context, icomID, dest, base string, days []time.Time, today time.Time, req models.LeaderboardRequest) error {
+	exists, err := s.rdb.Exists(ctx, dest).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+
+	store := &redis.ZStore{
+		Keys:    make([]string, len(days)),
+		Weights: make([]float64, len(days)),
+	}
+	for i, d := range days {
+		store.Keys[i] = rankBucketKey(base, d.Format("2006-01-02"))
+		store.Weights[i] = 1
+		if req.Scoring == models.LeaderboardScoringDecay {
+			age := today.Sub(d).Hours() / 24
+			store.Weights[i] = math.Pow(0.5, age/req.HalfLifeDays)
+		}
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.ZUnionStore(ctx, dest, store)
+	pipe.Expire(ctx, dest, leaderboardCacheTTL)
+	pipe.SAdd(ctx, leaderboardWindowsKey(icomID), dest)
+	pipe.Expire(ctx, leaderboardWindowsKey(icomID), leaderboardCacheTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// unrankShop queues the removal of a shop from an iCom's rankings, including
+// the daily buckets still retained, and from its like ledger
+func unrankShop(ctx context.Context, pipe redis.Pipeliner, icomID, shopID string) {
+	for _, rankType := range []string{"interactions", "likes"} {
+		key := rankKey(icomID, rankType, "")
+		pipe.ZRem(ctx, key, shopID)
+		clearRankBuckets(ctx, pipe, key, shopID)
+	}
+	for _, src := range models.LikeSources {
+		key := rankKey(icomID, "likes", src)
+		pipe.ZRem(ctx, key, shopID)
+		clearRankBuckets(ctx, pipe, key, shopID)
+	}
+	clearRankWindows(ctx, pipe, icomID)
+	clearLikeLedger(ctx, pipe, icomID, shopID)
+}
+
+// clearRankBuckets queues the removal of a shop from the retained daily
+// buckets of an all-time key
+func clearRankBuckets(ctx context.Context, pipe redis.Pipeliner, key, shopID string) {
+	today := time.Now().In(statsLocation())
+	for d := 0; d < int(rankBucketTTL/(24*time.Hour)); d++ {
+		pipe.ZRem(ctx, rankBucketKey(key, today.AddDate(0, 0, -d).Format("2006-01-02")), shopID)
+	}
+}
+
+// dropWindows deletes the merged windows listed in a windows set, and the set
+var dropWindows = redis.NewScript(`
+for _, key in ipairs(redis.call("SMEMBERS", KEYS[1])) do
+	redis.call("DEL", key)
+end
+return redis.call("DEL", KEYS[1])
+`)
+
+// clearRankWindows queues the removal of an iCom's cached merged windows, so
+// the next leaderboard is built from the buckets as they are now
+func clearRankWindows(ctx context.Context, pipe redis.Pipeliner, icomID string) {
+	dropWindows.Eval(ctx, pipe, []string{leaderboardWindowsKey(icomID)})
+}
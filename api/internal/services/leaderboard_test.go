@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"i-manage/internal/models"
+)
+
+func TestPeriodLeaderboard(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	service := NewIComService()
+
+	// Wednesday 2026-10-14; shop 10 was busy last month, shop 11 this week
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	key := rankKey("1", "interactions", "")
+	rdb.ZIncrBy(ctx, rankBucketKey(key, "2026-09-20"), 50, "10")
+	rdb.ZIncrBy(ctx, rankBucketKey(key, "2026-10-12"), 4, "11")
+	rdb.ZIncrBy(ctx, rankBucketKey(key, "2026-10-14"), 3, "11")
+	rdb.ZIncrBy(ctx, rankBucketKey(key, "2026-10-14"), 1, "10")
+	rdb.ZIncrBy(ctx, key, 51, "10")
+	rdb.ZIncrBy(ctx, key, 7, "11")
+
+	top := func(req models.LeaderboardRequest) []models.LeaderboardEntry {
+		t.Helper()
+		req.Type, req.Limit = "interactions", 10
+		entries, err := service.periodLeaderboard(ctx, "1", req, now)
+		if err != nil {
+			t.Fatalf("periodLeaderboard(%+v): %v", req, err)
+		}
+		return entries
+	}
+
+	if e := top(models.LeaderboardRequest{}); len(e) != 2 || e[0].ShopID != "10" || e[0].Score != 51 {
+		t.Errorf("unexpected all-time leaderboard %+v", e)
+	}
+	if e := top(models.LeaderboardRequest{Period: models.LeaderboardPeriodToday}); len(e) != 2 || e[0].ShopID != "11" || e[0].Score != 3 {
+		t.Errorf("unexpected today leaderboard %+v", e)
+	}
+	if e := top(models.LeaderboardRequest{Period: models.LeaderboardPeriodWeek}); e[0].ShopID != "11" || e[0].Score != 7 {
+		t.Errorf("unexpected weekly leaderboard %+v", e)
+	}
+	if e := top(models.LeaderboardRequest{Period: models.LeaderboardPeriodLast30Days}); e[0].ShopID != "10" || e[0].Score != 51 {
+		t.Errorf("unexpected 30-day leaderboard %+v", e)
+	}
+	// Decay: 50 interactions 24 days ago weigh 50/16 with a 6-day half-life
+	decayed := top(models.LeaderboardRequest{Period: models.LeaderboardPeriodLast30Days, Scoring: models.LeaderboardScoringDecay, HalfLifeDays: 6})
+	if decayed[0].ShopID != "11" || decayed[1].Score != 50.0/16+1 {
+		t.Errorf("unexpected decayed leaderboard %+v", decayed)
+	}
+
+	if _, err := service.periodLeaderboard(ctx, "1", models.LeaderboardRequest{Period: "year"}, now); !errors.Is(err, ErrLeaderboardPeriod) {
+		t.Errorf("expected ErrLeaderboardPeriod, got %v", err)
+	}
+	if _, err := service.periodLeaderboard(ctx, "1", models.LeaderboardRequest{Scoring: models.LeaderboardScoringDecay}, now); !errors.Is(err, ErrLeaderboardScoring) {
+		t.Errorf("expected ErrLeaderboardScoring, got %v", err)
+	}
+
+	// Inputs that name Redis keys are checked, and limits clamped
+	for _, req := range []models.LeaderboardRequest{
+		{Type: "interactions", Source: "icom"},
+		{Type: "likes", Source: "elsewhere"},
+	} {
+		if _, err := service.periodLeaderboard(ctx, "1", req, now); !errors.Is(err, ErrLeaderboardSource) {
+			t.Errorf("source %+v: expected ErrLeaderboardSource, got %v", req, err)
+		}
+	}
+	for _, halfLife := range []float64{0.5, 6.5, 31, -1} {
+		req := models.LeaderboardRequest{Type: "interactions", Period: models.LeaderboardPeriodWeek,
+			Scoring: models.LeaderboardScoringDecay, HalfLifeDays: halfLife}
+		if _, err := service.periodLeaderboard(ctx, "1", req, now); !errors.Is(err, ErrLeaderboardHalfLife) {
+			t.Errorf("half_life %v: expected ErrLeaderboardHalfLife, got %v", halfLife, err)
+		}
+	}
+	e, err := service.periodLeaderboard(ctx, "1", models.LeaderboardRequest{Type: "interactions", Limit: -1}, now)
+	if err != nil || len(e) != 1 {
+		t.Errorf("negative limit returned %d entries (err %v), want 1", len(e), err)
+	}
+}
+
+func TestUnrankShopClearsBucketsAndWindows(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	service := NewIComService()
+
+	if _, err := service.ToggleLike(ctx, "1", "10", "visitor", models.LikeSourceIShop); err != nil {
+		t.Fatalf("ToggleLike: %v", err)
+	}
+	req := models.LeaderboardRequest{Type: "likes", Source: models.LikeSourceIShop, Period: models.LeaderboardPeriodWeek,
+		Scoring: models.LeaderboardScoringDecay, Limit: 10}
+	if e, err := service.GetPeriodLeaderboard(ctx, "1", req); err != nil || len(e) != 1 {
+		t.Fatalf("GetPeriodLeaderboard = %+v, %v", e, err)
+	}
+
+	pipe := rdb.TxPipeline()
+	unrankShop(ctx, pipe, "1", "10")
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("unrankShop: %v", err)
+	}
+	bucket := rankBucketKey(rankKey("1", "likes", models.LikeSourceIShop), rankDay(time.Now()))
+	if n := rdb.ZCard(ctx, bucket).Val(); n != 0 {
+		t.Errorf("source bucket still ranks %d shops", n)
+	}
+	if n := rdb.Exists(ctx, leaderboardWindowsKey("1")).Val(); n != 0 {
+		t.Error("cached windows were not dropped")
+	}
+	if e, err := service.GetPeriodLeaderboard(ctx, "1", req); err != nil || len(e) != 0 {
+		t.Errorf("leaderboard after unranking = %+v, %v", e, err)
+	}
+}
+
+func TestToggleLikeUpdatesDailyBucket(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	service := NewIComService()
+
+	if _, err := service.ToggleLike(ctx, "1", "10", "visitor", "icom"); err != nil {
+		t.Fatalf("ToggleLike: %v", err)
+	}
+	bucket := rankBucketKey(rankKey("1", "likes", "icom"), rankDay(time.Now()))
+	if score, _ := rdb.ZScore(ctx, bucket, "10").Result(); score != 1 {
+		t.Errorf("expected like in daily bucket, got %v", score)
+	}
+	if ttl := rdb.TTL(ctx, bucket).Val(); ttl <= 0 {
+		t.Errorf("expected daily bucket to expire, got TTL %v", ttl)
+	}
+	if _, err := service.ToggleLike(ctx, "1", "10", "visitor", "icom"); err != nil {
+		t.Fatalf("ToggleLike: %v", err)
+	}
+	if score, _ := rdb.ZScore(ctx, bucket, "10").Result(); score != 0 {
+		t.Errorf("expected unlike to be taken off the same day, got %v", score)
+	}
+}
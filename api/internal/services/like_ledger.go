@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/events"
+	"i-manage/internal/models"
+)
+
+// The like ledger is the durable record of who liked which shop in which iCom.
+// The like leaderboards are counters derived from it and can be reconciled
+// against it:
+//
+//	icom:<icom>:likes:<shop>          zset of visitor -> liked at (unix ms)
+//	icom:<icom>:likes:<shop>:source   hash of visitor -> source
+//	ishop:<shop>:likes:icoms          set of iComs the shop has likes in
+
+func likeLedgerKey(icomID, shopID string) string {
+	return fmt.Sprintf("icom:%s:likes:%s", icomID, shopID)
+}
+
+func likeSourceKey(icomID, shopID string) string {
+	return fmt.Sprintf("icom:%s:likes:%s:source", icomID, shopID)
+}
+
+func shopLikeIComsKey(shopID string) string {
+	return fmt.Sprintf("ishop:%s:likes:icoms", shopID)
+}
+
+// clearLikeLedger queues the removal of a shop's likes in an iCom
+func clearLikeLedger(ctx context.Context, pipe redis.Pipeliner, icomID, shopID string) {
+	pipe.Del(ctx, likeLedgerKey(icomID, shopID), likeSourceKey(icomID, shopID))
+	pipe.SRem(ctx, shopLikeIComsKey(shopID), icomID)
+}
+
+// ToggleLike likes a shop for a visitor, or takes the like back if the
+// visitor already liked it in this iCom. An unlike is subtracted from the
+// source and day the like was counted in.
+func (s *IComService) ToggleLike(ctx context.Context, icomID, shopID string, visitorID string, source string) (string, error) {
+	ledgerKey := likeLedgerKey(icomID, shopID)
+	sourceKey := likeSourceKey(icomID, shopID)
+	totalKey := rankKey(icomID, "likes", "")
+
+	var status string
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		likedAt, err := tx.ZScore(ctx, ledgerKey, visitorID).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		liked := err == nil
+
+		likedSource := source
+		if liked {
+			if src, _ := tx.HGet(ctx, sourceKey, visitorID).Result(); src != "" {
+				likedSource = src
+			}
+		}
+
+		now := time.Now()
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			switch {
+			case liked:
+				// HÀNH ĐỘNG UNLIKE
+				day := rankDay(time.UnixMilli(int64(likedAt)))
+				pipe.ZRem(ctx, ledgerKey, visitorID)
+				pipe.HDel(ctx, sourceKey, visitorID)
+				pipe.ZIncrBy(ctx, totalKey, -1, shopID)
+				pipe.ZIncrBy(ctx, rankKey(icomID, "likes", likedSource), -1, shopID)
+				incrRankBuckets(ctx, pipe, day, -1, shopID, totalKey, rankKey(icomID, "likes", likedSource))
+				events.Append(ctx, pipe, events.New(events.ShopUnliked, icomID, shopID, events.LikeData{VisitorID: visitorID, Source: likedSource}))
+				status = "unliked"
+			default:
+				// HÀNH ĐỘNG LIKE
+				pipe.ZAdd(ctx, ledgerKey, redis.Z{Score: float64(now.UnixMilli()), Member: visitorID})
+				pipe.HSet(ctx, sourceKey, visitorID, source)
+				pipe.SAdd(ctx, shopLikeIComsKey(shopID), icomID)
+				pipe.ZIncrBy(ctx, totalKey, 1, shopID)
+				pipe.ZIncrBy(ctx, rankKey(icomID, "likes", source), 1, shopID)
+				incrRankBuckets(ctx, pipe, rankDay(now), 1, shopID, totalKey, rankKey(icomID, "likes", source))
+				events.Append(ctx, pipe, events.New(events.ShopLiked, icomID, shopID, events.LikeData{VisitorID: visitorID, Source: source}))
+				status = "liked"
+			}
+			return nil
+		})
+		return err
+	}, ledgerKey)
+	if err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// CheckLikeStatus checks if a visitor has liked a shop in an iCom
+func (s *IComService) CheckLikeStatus(ctx context.Context, icomID, shopID string, visitorID string) (bool, error) {
+	_, err := s.rdb.ZScore(ctx, likeLedgerKey(icomID, shopID), visitorID).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ReconcileLikes compares the like leaderboards of an iCom with the ledger
+// and, when fix is set, rewrites the all-time scores of the shops that
+// drifted. Daily buckets are left alone.
+func (s *IComService) ReconcileLikes(ctx context.Context, icomID string, fix bool) (*models.LikeReconcileReport, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrIComNotFound
+	}
+
+	// Every member plus anything still ranked
+	shopIDs, err := s.rdb.ZRange(ctx, fmt.Sprintf("icom:%s:members", icomID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	ranked, err := s.rdb.ZRange(ctx, rankKey(icomID, "likes", ""), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]bool, len(shopIDs))
+	for _, id := range shopIDs {
+		members[id] = true
+	}
+	for _, id := range ranked {
+		if !members[id] {
+			shopIDs = append(shopIDs, id)
+		}
+	}
+
+	scoreKeys := map[string]string{"total": rankKey(icomID, "likes", "")}
+	for _, src := range models.LikeSources {
+		scoreKeys[src] = rankKey(icomID, "likes", src)
+	}
+
+	report := &models.LikeReconcileReport{Checked: len(shopIDs), Mismatches: []models.LikeMismatch{}}
+	for start := 0; start < len(shopIDs); start += exportBatchSize {
+		batch := shopIDs[start:min(start+exportBatchSize, len(shopIDs))]
+
+		pipe := s.rdb.Pipeline()
+		sourceCmds := make([]*redis.StringSliceCmd, len(batch))
+		scoreCmds := make([]map[string]*redis.FloatCmd, len(batch))
+		for i, shopID := range batch {
+			sourceCmds[i] = pipe.HVals(ctx, likeSourceKey(icomID, shopID))
+			scoreCmds[i] = make(map[string]*redis.FloatCmd, len(scoreKeys))
+			for name, key := range scoreKeys {
+				scoreCmds[i][name] = pipe.ZScore(ctx, key, shopID)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		var mismatches []models.LikeMismatch
+		for i, shopID := range batch {
+			ledger := map[string]int64{"total": 0}
+			for _, src := range models.LikeSources {
+				ledger[src] = 0
+			}
+			for _, src := range sourceCmds[i].Val() {
+				ledger["total"]++
+				ledger[src]++
+			}
+			scores := make(map[string]float64, len(scoreKeys))
+			drifted := false
+			for name, cmd := range scoreCmds[i] {
+				scores[name] = cmd.Val()
+				drifted = drifted || scores[name] != float64(ledger[name])
+			}
+			if drifted {
+				mismatches = append(mismatches, models.LikeMismatch{ShopID: shopID, Ledger: ledger, Scores: scores})
+			}
+		}
+
+		if fix && len(mismatches) > 0 {
+			pipe := s.rdb.TxPipeline()
+			for _, m := range mismatches {
+				for name, key := range scoreKeys {
+					// Shops that are no longer members drop out of the ranking
+					if m.Ledger[name] == 0 && !members[m.ShopID] {
+						pipe.ZRem(ctx, key, m.ShopID)
+						continue
+					}
+					pipe.ZAdd(ctx, key, redis.Z{Score: float64(m.Ledger[name]), Member: m.ShopID})
+				}
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return nil, err
+			}
+		}
+		report.Mismatches = append(report.Mismatches, mismatches...)
+	}
+	report.Fixed = fix
+	return report, nil
+}
+
+// GetLikes summarises a shop's likes per iCom and lists the most recent
+// likers across all of them
+func (s *IShopService) GetLikes(ctx context.Context, shopID string, recentLimit int) (*models.IShopLikesResponse, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("ishop:%s", shopID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, fmt.Errorf("iShop not found")
+	}
+	if recentLimit < 1 || recentLimit > 100 {
+		recentLimit = 20
+	}
+
+	icomIDs, err := s.rdb.SMembers(ctx, shopLikeIComsKey(shopID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(icomIDs)
+
+	pipe := s.rdb.Pipeline()
+	nameCmds := make([]*redis.StringCmd, len(icomIDs))
+	sourceCmds := make([]*redis.MapStringStringCmd, len(icomIDs))
+	recentCmds := make([]*redis.ZSliceCmd, len(icomIDs))
+	for i, icomID := range icomIDs {
+		nameCmds[i] = pipe.HGet(ctx, fmt.Sprintf("icom:%s", icomID), "name")
+		sourceCmds[i] = pipe.HGetAll(ctx, likeSourceKey(icomID, shopID))
+		recentCmds[i] = pipe.ZRevRangeWithScores(ctx, likeLedgerKey(icomID, shopID), 0, int64(recentLimit-1))
+	}
+	if len(icomIDs) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+
+	response := &models.IShopLikesResponse{
+		ShopID: shopID,
+		ByICom: make([]models.IComLikeCount, 0, len(icomIDs)),
+		Recent: []models.LikeRecord{},
+	}
+	type recentLike struct {
+		record models.LikeRecord
+		at     int64 // unix ms
+	}
+	var recent []recentLike
+	for i, icomID := range icomIDs {
+		sources := sourceCmds[i].Val()
+		count := models.IComLikeCount{
+			IComID:   icomID,
+			IComName: nameCmds[i].Val(),
+			Count:    int64(len(sources)),
+			BySource: make(map[string]int64),
+		}
+		for _, src := range sources {
+			count.BySource[src]++
+		}
+		response.Total += count.Count
+		response.ByICom = append(response.ByICom, count)
+
+		for _, z := range recentCmds[i].Val() {
+			visitorID := z.Member.(string)
+			recent = append(recent, recentLike{
+				record: models.LikeRecord{VisitorID: visitorID, IComID: icomID, Source: sources[visitorID]},
+				at:     int64(z.Score),
+			})
+		}
+	}
+
+	// Newest first across iComs
+	sort.SliceStable(recent, func(i, j int) bool { return recent[i].at > recent[j].at })
+	if len(recent) > recentLimit {
+		recent = recent[:recentLimit]
+	}
+	for _, r := range recent {
+		r.record.LikedAt = time.UnixMilli(r.at).UTC().Format(time.RFC3339)
+		response.Recent = append(response.Recent, r.record)
+	}
+	return response, nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestToggleLikeLedger(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	service := NewIComService()
+	rdb.HSet(ctx, "icom:1", "name", "One")
+	rdb.HSet(ctx, "icom:2", "name", "Two")
+	rdb.HSet(ctx, "ishop:10", "name", "Shop")
+
+	// A like given yesterday is taken back from yesterday's bucket
+	yesterday := time.Now().AddDate(0, 0, -1)
+	rdb.ZAdd(ctx, likeLedgerKey("1", "10"), redis.Z{Score: float64(yesterday.UnixMilli()), Member: "old"})
+	rdb.HSet(ctx, likeSourceKey("1", "10"), "old", "ishop")
+	rdb.ZIncrBy(ctx, rankKey("1", "likes", ""), 1, "10")
+	rdb.ZIncrBy(ctx, rankKey("1", "likes", "ishop"), 1, "10")
+	bucket := rankBucketKey(rankKey("1", "likes", "ishop"), rankDay(yesterday))
+	rdb.ZIncrBy(ctx, bucket, 1, "10")
+
+	if status, err := service.ToggleLike(ctx, "1", "10", "old", "icom"); err != nil || status != "unliked" {
+		t.Fatalf("ToggleLike = %q, %v; want unliked", status, err)
+	}
+	if score, _ := rdb.ZScore(ctx, rankKey("1", "likes", "ishop"), "10").Result(); score != 0 {
+		t.Errorf("ishop score = %v, want 0", score)
+	}
+	if score, _ := rdb.ZScore(ctx, bucket, "10").Result(); score != 0 {
+		t.Errorf("yesterday's bucket = %v, want 0", score)
+	}
+
+	// Likes are scoped to the iCom they were given in
+	if status, _ := service.ToggleLike(ctx, "1", "10", "v1", "icom"); status != "liked" {
+		t.Fatalf("first toggle = %q, want liked", status)
+	}
+	if status, _ := service.ToggleLike(ctx, "2", "10", "v1", "ishop"); status != "liked" {
+		t.Fatalf("toggle in another iCom = %q, want liked", status)
+	}
+	time.Sleep(2 * time.Millisecond)
+	service.ToggleLike(ctx, "2", "10", "v2", "ishop")
+	if liked, _ := service.CheckLikeStatus(ctx, "1", "10", "v2"); liked {
+		t.Error("v2 should not have liked shop 10 in iCom 1")
+	}
+	if liked, _ := service.CheckLikeStatus(ctx, "2", "10", "v2"); !liked {
+		t.Error("v2 should have liked shop 10 in iCom 2")
+	}
+
+	likes, err := NewIShopService().GetLikes(ctx, "10", 2)
+	if err != nil {
+		t.Fatalf("GetLikes: %v", err)
+	}
+	if likes.Total != 3 || len(likes.ByICom) != 2 || likes.ByICom[1].BySource["ishop"] != 2 {
+		t.Errorf("unexpected counts %+v", likes)
+	}
+	if len(likes.Recent) != 2 || likes.Recent[0].VisitorID != "v2" {
+		t.Errorf("unexpected recent likers %+v", likes.Recent)
+	}
+	if _, err := NewIShopService().GetLikes(ctx, "99", 0); err == nil {
+		t.Error("expected error for missing iShop")
+	}
+}
+
+func TestToggleLikeIgnoresLegacyLikers(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	service := NewIComService()
+
+	// The pre-ledger liker set was kept per shop, not per iCom
+	rdb.SAdd(ctx, "shop:10:likers", "v1")
+
+	if liked, _ := service.CheckLikeStatus(ctx, "2", "10", "v1"); liked {
+		t.Fatal("a like from the shop-wide set should not count in another iCom")
+	}
+	if status, _ := service.ToggleLike(ctx, "2", "10", "v1", "icom"); status != "liked" {
+		t.Fatalf("toggle = %q, want liked", status)
+	}
+	if score, _ := rdb.ZScore(ctx, rankKey("2", "likes", ""), "10").Result(); score != 1 {
+		t.Errorf("total score = %v, want 1", score)
+	}
+}
+
+func TestReconcileLikes(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	service := NewIComService()
+	rdb.HSet(ctx, "icom:1", "name", "One")
+	rdb.ZAdd(ctx, "icom:1:members", redis.Z{Score: 1, Member: "10"}, redis.Z{Score: 2, Member: "11"})
+
+	service.ToggleLike(ctx, "1", "10", "v1", "icom")
+	service.ToggleLike(ctx, "1", "11", "v1", "ishop")
+	// Drift: a lost decrement on shop 10 and a stale score for a former member
+	rdb.ZIncrBy(ctx, rankKey("1", "likes", ""), 2, "10")
+	rdb.ZIncrBy(ctx, rankKey("1", "likes", ""), 4, "12")
+
+	report, err := service.ReconcileLikes(ctx, "1", false)
+	if err != nil {
+		t.Fatalf("ReconcileLikes: %v", err)
+	}
+	if report.Checked != 3 || len(report.Mismatches) != 2 || report.Fixed {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if score, _ := rdb.ZScore(ctx, rankKey("1", "likes", ""), "10").Result(); score != 3 {
+		t.Errorf("dry run changed score to %v", score)
+	}
+
+	if _, err := service.ReconcileLikes(ctx, "1", true); err != nil {
+		t.Fatalf("ReconcileLikes fix: %v", err)
+	}
+	if score, _ := rdb.ZScore(ctx, rankKey("1", "likes", ""), "10").Result(); score != 1 {
+		t.Errorf("score after fix = %v, want 1", score)
+	}
+	if n, _ := rdb.ZCard(ctx, rankKey("1", "likes", "")).Result(); n != 2 {
+		t.Errorf("former member still ranked, %d entries", n)
+	}
+	if report, _ := service.ReconcileLikes(ctx, "1", false); len(report.Mismatches) != 0 {
+		t.Errorf("mismatches after fix: %+v", report.Mismatches)
+	}
+	if _, err := service.ReconcileLikes(ctx, "9", false); err != ErrIComNotFound {
+		t.Errorf("missing iCom err = %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/live"
+)
+
+// LiveService turns domain events into live updates for the public iCom page
+type LiveService struct {
+	rdb *redis.Client
+}
+
+// NewLiveService creates a new live service
+func NewLiveService() *LiveService {
+	return &LiveService{
+		rdb: database.Rdb,
+	}
+}
+
+// LeaderboardDelta is the data of a leaderboard update
+type LeaderboardDelta struct {
+	RankType string  `json:"rank_type"`
+	ShopID   string  `json:"shop_id"`
+	Score    float64 `json:"score"`
+	Position int64   `json:"position"` // 1-based, highest score first
+}
+
+// LiveMemberJoined is the data of a member.joined update
+type LiveMemberJoined struct {
+	ShopID string `json:"shop_id"`
+	Name   string `json:"name"`
+	Logo   string `json:"logo"`
+	Rank   string `json:"rank"`
+}
+
+// LiveLikes is the data of a likes update
+type LiveLikes struct {
+	ShopID string `json:"shop_id"`
+	Likes  int    `json:"likes"`
+	Liked  bool   `json:"liked"` // false when the event was an unlike
+}
+
+// HandleEvent publishes the live updates for a domain event. It is the
+// handler of the "live" event subscriber.
+func (s *LiveService) HandleEvent(ctx context.Context, evt events.Event) error {
+	switch evt.Type {
+	case events.MemberAdded, events.MemberApproved:
+		rank := "MEMBER"
+		if evt.Type == events.MemberAdded {
+			var d events.MemberAddedData
+			if err := evt.Decode(&d); err != nil {
+				return err
+			}
+			if d.Status != constants.MEMBER_STATUS_ACTIVE {
+				// Shown once the application is approved
+				return nil
+			}
+			rank = d.Rank
+		} else {
+			var d events.MemberDecisionData
+			if err := evt.Decode(&d); err != nil {
+				return err
+			}
+			if d.Auto {
+				return nil
+			}
+			rank, _ = s.rdb.HGet(ctx, fmt.Sprintf("icom:%s:member:%s", evt.IComID, evt.ShopID), "rank").Result()
+		}
+		vals, err := s.rdb.HMGet(ctx, fmt.Sprintf("ishop:%s", evt.ShopID), "name", "logo").Result()
+		if err != nil {
+			return err
+		}
+		name, _ := vals[0].(string)
+		logo, _ := vals[1].(string)
+		_, err = live.Publish(ctx, evt.IComID, live.TypeMemberJoined, LiveMemberJoined{
+			ShopID: evt.ShopID,
+			Name:   name,
+			Logo:   logo,
+			Rank:   rank,
+		})
+		return err
+
+	case events.InteractionRecorded:
+		delta, err := s.leaderboardDelta(ctx, evt.IComID, evt.ShopID, "interactions")
+		if err != nil {
+			return err
+		}
+		_, err = live.Publish(ctx, evt.IComID, live.TypeLeaderboard, delta)
+		return err
+
+	case events.ShopLiked, events.ShopUnliked:
+		delta, err := s.leaderboardDelta(ctx, evt.IComID, evt.ShopID, "likes")
+		if err != nil {
+			return err
+		}
+		if _, err := live.Publish(ctx, evt.IComID, live.TypeLikes, LiveLikes{
+			ShopID: evt.ShopID,
+			Likes:  int(delta.Score),
+			Liked:  evt.Type == events.ShopLiked,
+		}); err != nil {
+			return err
+		}
+		_, err = live.Publish(ctx, evt.IComID, live.TypeLeaderboard, delta)
+		return err
+	}
+	return nil
+}
+
+// leaderboardDelta reads a shop's current score and position in a ranking
+func (s *LiveService) leaderboardDelta(ctx context.Context, icomID, shopID, rankType string) (*LeaderboardDelta, error) {
+	key := fmt.Sprintf("icom:%s:rank:%s", icomID, rankType)
+
+	pipe := s.rdb.Pipeline()
+	scoreCmd := pipe.ZScore(ctx, key, shopID)
+	rankCmd := pipe.ZRevRank(ctx, key, shopID)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	delta := &LeaderboardDelta{RankType: rankType, ShopID: shopID, Score: scoreCmd.Val()}
+	if rankCmd.Err() == nil {
+		delta.Position = rankCmd.Val() + 1
+	}
+	return delta, nil
+}
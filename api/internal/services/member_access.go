@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/models"
+)
+
+// Member shops do not sign in, so a manager issues each member an access
+// token to put in the links and calendar subscriptions it is given. The
+// token identifies the shop on public endpoints that show members more.
+//
+//	icom:<id>:access:<token>   shop ID the token was issued to
+//
+// The membership hash keeps the current token as accessToken; issuing a new
+// one revokes the old.
+
+func memberAccessKey(icomID, token string) string {
+	return fmt.Sprintf("icom:%s:access:%s", icomID, token)
+}
+
+func generateAccessToken() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return "mbr_" + hex.EncodeToString(b)
+}
+
+// IssueAccessToken gives a member a new access token, revoking the one it
+// had. The returned access is the only response that includes the token.
+func (s *MemberService) IssueAccessToken(ctx context.Context, icomID, shopID string) (*models.MemberAccess, error) {
+	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
+	access := &models.MemberAccess{ShopID: shopID, Token: generateAccessToken()}
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, memberKey, "status", "accessToken").Result()
+		if err != nil {
+			return err
+		}
+		fields := stringValues(values, 2)
+		if fields[0] == "" {
+			return fmt.Errorf("membership not found")
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if fields[1] != "" {
+				pipe.Del(ctx, memberAccessKey(icomID, fields[1]))
+			}
+			pipe.Set(ctx, memberAccessKey(icomID, access.Token), shopID, 0)
+			pipe.HSet(ctx, memberKey, "accessToken", access.Token)
+			return nil
+		})
+		return err
+	}, memberKey)
+	if err != nil {
+		return nil, err
+	}
+	return access, nil
+}
+
+// RevokeAccessToken takes a member's access token back
+func (s *MemberService) RevokeAccessToken(ctx context.Context, icomID, shopID string) error {
+	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
+	return s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, memberKey, "status", "accessToken").Result()
+		if err != nil {
+			return err
+		}
+		fields := stringValues(values, 2)
+		if fields[0] == "" {
+			return fmt.Errorf("membership not found")
+		}
+		if fields[1] == "" {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, memberAccessKey(icomID, fields[1]))
+			pipe.HDel(ctx, memberKey, "accessToken")
+			return nil
+		})
+		return err
+	}, memberKey)
+}
+
+// accessMember returns the active member shop an access token was issued
+// to, or "" when the token is unknown or the shop is no longer active
+func accessMember(ctx context.Context, rdb *redis.Client, icomID, token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	shopID, err := rdb.Get(ctx, memberAccessKey(icomID, token)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	active, err := isActiveMember(ctx, rdb, icomID, shopID)
+	if err != nil || !active {
+		return "", err
+	}
+	return shopID, nil
+}
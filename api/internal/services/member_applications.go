@@ -0,0 +1,525 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/events"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Membership application errors surfaced to handlers
+var (
+	ErrIComNotFound         = errors.New("iCom not found")
+	ErrShopNotFound         = errors.New("shop not found")
+	ErrAlreadyMember        = errors.New("shop is already a member of this iCom")
+	ErrApplicationNotFound  = errors.New("application not found")
+	ErrApplicationDecided   = errors.New("application has already been decided")
+	ErrAlreadyWaitlisted    = errors.New("shop is already on the waitlist")
+	ErrApplicationWaitlist  = errors.New("application is on the waitlist and cannot be approved yet")
+	ErrRejectReasonRequired = errors.New("a reason is required to reject an application")
+)
+
+func applicationKey(icomID, shopID string) string {
+	return fmt.Sprintf("icom:%s:application:%s", icomID, shopID)
+}
+
+func applicationQueueKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:applications", icomID)
+}
+
+func waitlistKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:waitlist", icomID)
+}
+
+// Apply submits a shop's application to join an iCom.
+//
+// The shop must satisfy the iCom's industry and area rules. When the iCom is
+// full, or others are already waiting, the application goes to the waitlist if
+// the iCom has one and is refused otherwise. Admitted applicants wait in the
+// review queue with a PENDING membership when the iCom requires approval or
+// does not auto-activate members, and are activated immediately otherwise.
+func (s *MemberService) Apply(ctx context.Context, icomID string, req models.ApplyMembershipRequest) (*models.MembershipApplication, error) {
+	return s.apply(ctx, icomID, req, nil)
+}
+
+// apply implements Apply; invite, when set, grants its rank and role and is
+// recorded on the application and membership
+func (s *MemberService) apply(ctx context.Context, icomID string, req models.ApplyMembershipRequest, invite *models.Invite) (*models.MembershipApplication, error) {
+	rules, err := loadMembershipRules(ctx, s.rdb, icomID)
+	if err != nil {
+		return nil, err
+	}
+
+	shop, err := s.ishopService.GetIShop(ctx, req.ShopID)
+	if err != nil {
+		if err.Error() == "iShop not found" {
+			return nil, ErrShopNotFound
+		}
+		return nil, err
+	}
+
+	pipe := s.rdb.Pipeline()
+	memberCmd := pipe.Exists(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, req.ShopID))
+	waitingCmd := pipe.ZScore(ctx, waitlistKey(icomID), req.ShopID)
+	waitlistCmd := pipe.ZCard(ctx, waitlistKey(icomID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if memberCmd.Val() > 0 {
+		return nil, ErrAlreadyMember
+	}
+	if waitingCmd.Err() == nil {
+		return nil, ErrAlreadyWaitlisted
+	}
+
+	if violations := rules.checkShop(shop.Industry, shop.Province, shop.District, shop.Ward); len(violations) > 0 {
+		return nil, &MembershipRuleError{IComID: icomID, Violations: violations}
+	}
+
+	rank, err := baseRank(ctx, s.rdb, icomID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	application := models.MembershipApplication{
+		ShopID:      req.ShopID,
+		IComID:      icomID,
+		ShopName:    shop.Name,
+		ShopLogo:    shop.Logo,
+		Status:      constants.APPLICATION_STATUS_PENDING,
+		Message:     req.Message,
+		Rank:        rank,
+		AppliedDate: now.Format(time.RFC3339),
+	}
+	if invite != nil {
+		// The invite's tier may have been removed since it was created
+		if err := checkRank(ctx, s.rdb, icomID, invite.Rank); err != nil {
+			return nil, err
+		}
+		application.Rank = invite.Rank
+		application.Role = invite.Role
+		application.InviteCode = invite.Code
+	}
+
+	// Nobody jumps the waitlist, even when a seat has just freed up
+	full := waitlistCmd.Val() > 0
+	if !full && rules.MaxMembers > 0 {
+		occupied, err := occupiedSeats(ctx, s.rdb, icomID)
+		if err != nil {
+			return nil, err
+		}
+		full = !rules.hasCapacity(occupied)
+	}
+	if full {
+		if !rules.Waitlist {
+			return nil, &MembershipRuleError{IComID: icomID, Violations: []models.RuleViolation{rules.capacityViolation()}}
+		}
+		return s.waitlist(ctx, application)
+	}
+
+	// The seat may have been taken since it was counted
+	var ruleErr *MembershipRuleError
+	if err := s.admit(ctx, rules, shop, &application); err != nil {
+		if errors.As(err, &ruleErr) && ruleErr.capacityOnly() && rules.Waitlist {
+			return s.waitlist(ctx, application)
+		}
+		return nil, err
+	}
+	return &application, nil
+}
+
+// waitlist records an application that waits for a free seat
+func (s *MemberService) waitlist(ctx context.Context, application models.MembershipApplication) (*models.MembershipApplication, error) {
+	application.Status = constants.APPLICATION_STATUS_WAITLISTED
+	appFields, err := hashcodec.MarshalPartial(application)
+	if err != nil {
+		return nil, err
+	}
+
+	key := applicationKey(application.IComID, application.ShopID)
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, appFields)
+	pipe.ZAdd(ctx, waitlistKey(application.IComID), redis.Z{Score: float64(time.Now().UnixNano()), Member: application.ShopID})
+	events.Append(ctx, pipe, events.New(events.MemberWaitlisted, application.IComID, application.ShopID, events.MemberApplicationData{
+		Message: application.Message,
+	}))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return &application, nil
+}
+
+// admit creates the membership for an accepted application, either PENDING in
+// the review queue or ACTIVE when the iCom auto-activates without approval
+func (s *MemberService) admit(ctx context.Context, rules membershipRules, shop *models.IShopProfile, application *models.MembershipApplication) error {
+	icomID, shopID := application.IComID, application.ShopID
+	membership := models.MembershipDetail{
+		ShopID:     shopID,
+		IComID:     icomID,
+		Rank:       application.Rank,
+		Role:       application.Role,
+		Status:     constants.MEMBER_STATUS_PENDING,
+		InviteCode: application.InviteCode,
+	}
+	if membership.Rank == "" {
+		// Applications from before ranks were recorded
+		base, err := baseRank(ctx, s.rdb, icomID)
+		if err != nil {
+			return err
+		}
+		membership.Rank = base
+	}
+
+	autoAccept := !rules.RequireApproval && rules.AutoActivate
+	application.Status = constants.APPLICATION_STATUS_PENDING
+	if autoAccept {
+		application.Status = constants.APPLICATION_STATUS_APPROVED
+		application.DecidedDate = time.Now().Format(time.RFC3339)
+		membership.Status = constants.MEMBER_STATUS_ACTIVE
+	}
+
+	appFields, err := hashcodec.MarshalPartial(*application)
+	if err != nil {
+		return err
+	}
+
+	return s.joinICom(ctx, icomID, shop, membership, func(pipe redis.Pipeliner) {
+		// Replace any earlier, decided application
+		pipe.Del(ctx, applicationKey(icomID, shopID))
+		pipe.HSet(ctx, applicationKey(icomID, shopID), appFields)
+		if !autoAccept {
+			pipe.ZAdd(ctx, applicationQueueKey(icomID), redis.Z{Score: float64(time.Now().Unix()), Member: shopID})
+		}
+		events.Append(ctx, pipe, events.New(events.MemberApplied, icomID, shopID, events.MemberApplicationData{
+			Message: application.Message,
+		}))
+		if autoAccept {
+			events.Append(ctx, pipe, events.New(events.MemberApproved, icomID, shopID, events.MemberDecisionData{Auto: true}))
+		}
+	})
+}
+
+// PromoteWaitlist admits waitlisted applicants, oldest first, while the iCom
+// has free seats. Applicants that no longer satisfy the industry or area rules
+// are rejected. It returns how many applicants were admitted.
+func (s *MemberService) PromoteWaitlist(ctx context.Context, icomID string) (int, error) {
+	rules, err := loadMembershipRules(ctx, s.rdb, icomID)
+	if err != nil {
+		return 0, err
+	}
+
+	promoted := 0
+	for {
+		occupied, err := occupiedSeats(ctx, s.rdb, icomID)
+		if err != nil {
+			return promoted, err
+		}
+		if !rules.hasCapacity(occupied) {
+			return promoted, nil
+		}
+
+		// ZPOPMIN claims the applicant, so concurrent promoters never admit twice
+		popped, err := s.rdb.ZPopMin(ctx, waitlistKey(icomID), 1).Result()
+		if err != nil || len(popped) == 0 {
+			return promoted, err
+		}
+		shopID, _ := popped[0].Member.(string)
+
+		data, err := s.rdb.HGetAll(ctx, applicationKey(icomID, shopID)).Result()
+		if err != nil {
+			return promoted, err
+		}
+		var application models.MembershipApplication
+		_ = hashcodec.Unmarshal(data, &application)
+		application.ShopID, application.IComID = shopID, icomID
+
+		shop, err := s.ishopService.GetIShop(ctx, shopID)
+		if err != nil {
+			// Shop deleted while waiting
+			s.rdb.Del(ctx, applicationKey(icomID, shopID))
+			continue
+		}
+		if violations := rules.checkShop(shop.Industry, shop.Province, shop.District, shop.Ward); len(violations) > 0 {
+			reason := (&MembershipRuleError{IComID: icomID, Violations: violations}).Error()
+			pipe := s.rdb.TxPipeline()
+			pipe.HSet(ctx, applicationKey(icomID, shopID), map[string]interface{}{
+				"status":      constants.APPLICATION_STATUS_REJECTED,
+				"reason":      reason,
+				"decidedDate": time.Now().Format(time.RFC3339),
+			})
+			events.Append(ctx, pipe, events.New(events.MemberRejected, icomID, shopID, events.MemberDecisionData{Reason: reason}))
+			if _, err := pipe.Exec(ctx); err != nil {
+				return promoted, err
+			}
+			continue
+		}
+
+		if err := s.admit(ctx, rules, shop, &application); err != nil {
+			// Put the applicant back at the head of the line; a concurrent
+			// join may have taken the seat since it was counted
+			s.rdb.ZAdd(ctx, waitlistKey(icomID), popped[0])
+			var ruleErr *MembershipRuleError
+			if errors.As(err, &ruleErr) && ruleErr.capacityOnly() {
+				return promoted, nil
+			}
+			return promoted, err
+		}
+		promoted++
+	}
+}
+
+// HandleWaitlistEvent promotes waitlisted applicants when a seat frees up or
+// the iCom's limit changes. It is the handler of the "waitlist" event
+// subscriber.
+func (s *MemberService) HandleWaitlistEvent(ctx context.Context, evt events.Event) error {
+	switch evt.Type {
+	case events.MemberRemoved, events.MemberRejected:
+	case events.MemberStatusChanged:
+		var d events.MemberStatusChangedData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		if d.NewStatus == "" || holdsSeat(d.NewStatus) {
+			return nil
+		}
+	case events.IComUpdated:
+		var d events.IComChangedData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		relevant := false
+		for _, field := range d.Changed {
+			if field == "maxMembers" || field == "waitlistEnabled" {
+				relevant = true
+			}
+		}
+		if !relevant {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	_, err := s.PromoteWaitlist(ctx, evt.IComID)
+	if err == ErrIComNotFound {
+		return nil
+	}
+	return err
+}
+
+// ListApplications returns a page of the review queue, oldest application first
+func (s *MemberService) ListApplications(ctx context.Context, icomID string, page, limit int) (*models.ApplicationListResponse, error) {
+	return s.listApplicationQueue(ctx, icomID, applicationQueueKey(icomID), page, limit)
+}
+
+// ListWaitlist returns a page of the waitlist in promotion order
+func (s *MemberService) ListWaitlist(ctx context.Context, icomID string, page, limit int) (*models.ApplicationListResponse, error) {
+	return s.listApplicationQueue(ctx, icomID, waitlistKey(icomID), page, limit)
+}
+
+// listApplicationQueue pages through a sorted set of applicant shop IDs
+func (s *MemberService) listApplicationQueue(ctx context.Context, icomID, queueKey string, page, limit int) (*models.ApplicationListResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	start := int64((page - 1) * limit)
+	stop := int64(page*limit - 1)
+
+	pipe := s.rdb.Pipeline()
+	rangeCmd := pipe.ZRange(ctx, queueKey, start, stop)
+	totalCmd := pipe.ZCard(ctx, queueKey)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	shopIDs := rangeCmd.Val()
+
+	applications := make([]models.MembershipApplication, 0, len(shopIDs))
+	if len(shopIDs) > 0 {
+		pipe = s.rdb.Pipeline()
+		appCmds := make([]*redis.MapStringStringCmd, len(shopIDs))
+		shopCmds := make([]*redis.SliceCmd, len(shopIDs))
+		for i, shopID := range shopIDs {
+			appCmds[i] = pipe.HGetAll(ctx, applicationKey(icomID, shopID))
+			shopCmds[i] = pipe.HMGet(ctx, fmt.Sprintf("ishop:%s", shopID), "name", "logo")
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		for i, shopID := range shopIDs {
+			var app models.MembershipApplication
+			_ = hashcodec.Unmarshal(appCmds[i].Val(), &app)
+			app.ShopID = shopID
+			app.IComID = icomID
+			if vals := shopCmds[i].Val(); len(vals) == 2 {
+				app.ShopName, _ = vals[0].(string)
+				app.ShopLogo, _ = vals[1].(string)
+			}
+			applications = append(applications, app)
+		}
+	}
+
+	return &models.ApplicationListResponse{
+		Applications: applications,
+		Total:        int(totalCmd.Val()),
+		Page:         page,
+		Limit:        limit,
+	}, nil
+}
+
+// ApproveApplication activates a pending membership
+func (s *MemberService) ApproveApplication(ctx context.Context, icomID, shopID, reason string) error {
+	return s.decide(ctx, icomID, shopID, true, reason)
+}
+
+// RejectApplication removes a pending membership and records the reason
+func (s *MemberService) RejectApplication(ctx context.Context, icomID, shopID, reason string) error {
+	if reason == "" {
+		return ErrRejectReasonRequired
+	}
+	return s.decide(ctx, icomID, shopID, false, reason)
+}
+
+// BulkReview applies the same decision to many applications. Each application
+// is decided independently; failures are reported per shop.
+func (s *MemberService) BulkReview(ctx context.Context, icomID string, req models.BulkReviewRequest) ([]models.BulkReviewResult, error) {
+	approve := req.Decision == "approve"
+	if !approve && req.Reason == "" {
+		return nil, ErrRejectReasonRequired
+	}
+
+	status := constants.APPLICATION_STATUS_REJECTED
+	if approve {
+		status = constants.APPLICATION_STATUS_APPROVED
+	}
+
+	results := make([]models.BulkReviewResult, 0, len(req.ShopIDs))
+	for _, shopID := range req.ShopIDs {
+		result := models.BulkReviewResult{ShopID: shopID}
+		if err := s.decide(ctx, icomID, shopID, approve, req.Reason); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Status = status
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// decide approves or rejects one pending application. The application key is
+// watched so that concurrent decisions on the same application cannot both
+// apply.
+func (s *MemberService) decide(ctx context.Context, icomID, shopID string, approve bool, reason string) error {
+	appKey := applicationKey(icomID, shopID)
+	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
+
+	return s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		appStatus, err := tx.HGet(ctx, appKey, "status").Result()
+		if err == redis.Nil {
+			return ErrApplicationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now().Format(time.RFC3339)
+
+		if appStatus == constants.APPLICATION_STATUS_WAITLISTED {
+			if approve {
+				return ErrApplicationWaitlist
+			}
+			// Rejecting a waitlisted applicant only takes it off the waitlist
+			_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, appKey, map[string]interface{}{
+					"status":      constants.APPLICATION_STATUS_REJECTED,
+					"reason":      reason,
+					"decidedDate": now,
+				})
+				pipe.ZRem(ctx, waitlistKey(icomID), shopID)
+				events.Append(ctx, pipe, events.New(events.MemberRejected, icomID, shopID, events.MemberDecisionData{Reason: reason}))
+				return nil
+			})
+			return err
+		}
+		if appStatus != constants.APPLICATION_STATUS_PENDING {
+			return ErrApplicationDecided
+		}
+
+		memberData, err := tx.HGetAll(ctx, memberKey).Result()
+		if err != nil {
+			return err
+		}
+		if len(memberData) == 0 {
+			return ErrApplicationNotFound
+		}
+		if memberData["status"] != constants.MEMBER_STATUS_PENDING {
+			// Settled by a direct status change
+			return ErrApplicationDecided
+		}
+
+		if approve {
+			// The shop may have changed, or the rules tightened, since it applied
+			rules, err := loadMembershipRules(ctx, s.rdb, icomID)
+			if err != nil {
+				return err
+			}
+			shop, err := s.ishopService.GetIShop(ctx, shopID)
+			if err != nil {
+				return err
+			}
+			if err := checkAdmission(ctx, s.rdb, rules, shop, false); err != nil {
+				return err
+			}
+		}
+
+		decision := map[string]interface{}{
+			"reason":      reason,
+			"decidedDate": now,
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if approve {
+				decision["status"] = constants.APPLICATION_STATUS_APPROVED
+				s.activateMembership(ctx, pipe, icomID, shopID, memberData["status"])
+				events.Append(ctx, pipe, events.New(events.MemberApproved, icomID, shopID, events.MemberDecisionData{Reason: reason}))
+				events.Append(ctx, pipe, events.New(events.MemberStatusChanged, icomID, shopID, events.MemberStatusChangedData{
+					OldStatus: memberData["status"],
+					NewStatus: constants.MEMBER_STATUS_ACTIVE,
+				}))
+			} else {
+				decision["status"] = constants.APPLICATION_STATUS_REJECTED
+				shopData, _ := s.rdb.HGetAll(ctx, fmt.Sprintf("ishop:%s", shopID)).Result()
+				s.removeMembership(ctx, pipe, icomID, shopID, memberData, shopData)
+				events.Append(ctx, pipe, events.New(events.MemberRejected, icomID, shopID, events.MemberDecisionData{Reason: reason}))
+			}
+			pipe.HSet(ctx, appKey, decision)
+			pipe.ZRem(ctx, applicationQueueKey(icomID), shopID)
+			return nil
+		})
+		return err
+	}, appKey)
+}
+
+// activateMembership queues the writes that move a membership to ACTIVE
+func (s *MemberService) activateMembership(ctx context.Context, pipe redis.Pipeliner, icomID, shopID, oldStatus string) {
+	active := constants.MEMBER_STATUS_ACTIVE
+
+	pipe.HSet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), "status", active)
+	pipe.HSet(ctx, fmt.Sprintf("ishop:%s:icom:%s", shopID, icomID), "status", active)
+	pipe.SRem(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, oldStatus), shopID)
+	pipe.SAdd(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, active), shopID)
+	if oldStatus != active {
+		pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "activeMembers", 1)
+	}
+}
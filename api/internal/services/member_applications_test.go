@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/models"
+)
+
+func seedApplicationFixtures(t *testing.T, rdb *redis.Client, requireApproval, autoActivate string) {
+	t.Helper()
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1", "id", "1", "name", "Test iCom", "requireApproval", requireApproval, "autoActivate", autoActivate)
+	for _, id := range []string{"10", "11"} {
+		rdb.HSet(ctx, "ishop:"+id, "id", id, "name", "Shop "+id, "industry", "fnb", "province", "HCM")
+	}
+}
+
+func TestApplicationApproveAndReject(t *testing.T) {
+	rdb := setupTestRedis(t)
+	seedApplicationFixtures(t, rdb, "true", "false")
+	ctx := context.Background()
+	service := NewMemberService()
+
+	for _, shopID := range []string{"10", "11"} {
+		app, err := service.Apply(ctx, "1", models.ApplyMembershipRequest{ShopID: shopID, Message: "hi"})
+		if err != nil {
+			t.Fatalf("Apply(%s): %v", shopID, err)
+		}
+		if app.Status != constants.APPLICATION_STATUS_PENDING {
+			t.Errorf("expected pending application, got %s", app.Status)
+		}
+	}
+	if _, err := service.Apply(ctx, "1", models.ApplyMembershipRequest{ShopID: "10"}); !errors.Is(err, ErrAlreadyMember) {
+		t.Errorf("expected ErrAlreadyMember, got %v", err)
+	}
+
+	queue, err := service.ListApplications(ctx, "1", 1, 20)
+	if err != nil || queue.Total != 2 || queue.Applications[0].ShopName != "Shop 10" {
+		t.Fatalf("unexpected queue %+v (err %v)", queue, err)
+	}
+
+	if err := service.ApproveApplication(ctx, "1", "10", ""); err != nil {
+		t.Fatalf("ApproveApplication: %v", err)
+	}
+	if err := service.ApproveApplication(ctx, "1", "10", ""); !errors.Is(err, ErrApplicationDecided) {
+		t.Errorf("expected ErrApplicationDecided, got %v", err)
+	}
+	if status, _ := rdb.HGet(ctx, "icom:1:member:10", "status").Result(); status != constants.MEMBER_STATUS_ACTIVE {
+		t.Errorf("expected ACTIVE membership, got %q", status)
+	}
+	if active, _ := rdb.HGet(ctx, "icom:1", "activeMembers").Int(); active != 1 {
+		t.Errorf("expected 1 active member, got %d", active)
+	}
+
+	if err := service.RejectApplication(ctx, "1", "11", ""); !errors.Is(err, ErrRejectReasonRequired) {
+		t.Errorf("expected ErrRejectReasonRequired, got %v", err)
+	}
+	if err := service.RejectApplication(ctx, "1", "11", "outside our area"); err != nil {
+		t.Fatalf("RejectApplication: %v", err)
+	}
+	if n, _ := rdb.Exists(ctx, "icom:1:member:11").Result(); n != 0 {
+		t.Error("rejected membership should be removed")
+	}
+	if reason, _ := rdb.HGet(ctx, "icom:1:application:11", "reason").Result(); reason != "outside our area" {
+		t.Errorf("expected reason to be recorded, got %q", reason)
+	}
+
+	pending, _ := NewIComService().CountMembersByStatus(ctx, "1", constants.MEMBER_STATUS_PENDING)
+	queued, _ := rdb.ZCard(ctx, "icom:1:applications").Result()
+	if pending != 0 || queued != 0 {
+		t.Errorf("expected empty review queue, got %d pending and %d queued", pending, queued)
+	}
+}
+
+func TestApplicationAutoActivate(t *testing.T) {
+	rdb := setupTestRedis(t)
+	seedApplicationFixtures(t, rdb, "false", "true")
+	ctx := context.Background()
+
+	app, err := NewMemberService().Apply(ctx, "1", models.ApplyMembershipRequest{ShopID: "10"})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if app.Status != constants.APPLICATION_STATUS_APPROVED {
+		t.Errorf("expected immediate approval, got %s", app.Status)
+	}
+	if status, _ := rdb.HGet(ctx, "icom:1:member:10", "status").Result(); status != constants.MEMBER_STATUS_ACTIVE {
+		t.Errorf("expected ACTIVE membership, got %q", status)
+	}
+}
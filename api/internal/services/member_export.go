@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+	"i-manage/internal/spreadsheet"
+)
+
+// Member export errors surfaced to handlers
+var (
+	ErrExportFormat = errors.New("format must be csv, xlsx or vcf")
+	ErrExportColumn = errors.New("unknown export column")
+)
+
+// exportBatchSize is how many members are loaded per round-trip while
+// streaming an export
+const exportBatchSize = 500
+
+// privateFieldColumns maps ShopPrivateFields to the columns they hide
+var privateFieldColumns = map[string][]string{
+	"phone":    {"phone"},
+	"email":    {"email"},
+	"website":  {"website"},
+	"street":   {"street"},
+	"location": {"lat", "lng"},
+}
+
+// PrepareExport checks the iCom exists, validates an export request and fills
+// in the defaults. Call it before writing any response so errors can still be
+// reported.
+func (s *MemberService) PrepareExport(ctx context.Context, icomID string, req *models.MemberExportRequest) error {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrIComNotFound
+	}
+
+	if req.Format == "" {
+		req.Format = models.ExportFormatCSV
+	}
+	switch req.Format {
+	case models.ExportFormatCSV, models.ExportFormatXLSX, models.ExportFormatVCard:
+	default:
+		return ErrExportFormat
+	}
+
+	if len(req.Columns) == 0 {
+		req.Columns = models.DefaultMemberExportColumns
+		return nil
+	}
+	known := make(map[string]bool, len(models.MemberExportColumns))
+	for _, c := range models.MemberExportColumns {
+		known[c] = true
+	}
+	for _, c := range req.Columns {
+		if !known[c] {
+			return fmt.Errorf("%w %q", ErrExportColumn, c)
+		}
+	}
+	return nil
+}
+
+// exportMember is one member as seen by an export
+type exportMember struct {
+	shop       models.IShopProfile
+	membership models.MembershipDetail
+}
+
+// value returns a column of the member, or "" when it is hidden
+func (m exportMember) value(column string, hidden map[string]bool) string {
+	if hidden[column] {
+		return ""
+	}
+	s, ms := m.shop, m.membership
+	switch column {
+	case "shop_id":
+		return s.ID
+	case "name":
+		return s.Name
+	case "description":
+		return s.Description
+	case "logo":
+		return s.Logo
+	case "industry":
+		return s.Industry
+	case "sub_industry":
+		return s.SubIndustry
+	case "phone":
+		return s.Phone
+	case "email":
+		return s.Email
+	case "website":
+		return s.Website
+	case "street":
+		return s.Street
+	case "ward":
+		return s.Ward
+	case "district":
+		return s.District
+	case "province":
+		return s.Province
+	case "lat":
+		if s.Lat == 0 && s.Lng == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(s.Lat, 'f', -1, 64)
+	case "lng":
+		if s.Lat == 0 && s.Lng == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(s.Lng, 'f', -1, 64)
+	case "rank":
+		return ms.Rank
+	case "role":
+		return ms.Role
+	case "status":
+		return ms.Status
+	case "joined_date":
+		return ms.JoinedDate
+	}
+	return ""
+}
+
+// hiddenColumns lists the columns a shop keeps out of public exports
+func (m exportMember) hiddenColumns(public bool) map[string]bool {
+	hidden := make(map[string]bool)
+	if !public {
+		return hidden
+	}
+	for _, f := range m.shop.PrivateFields {
+		for _, c := range privateFieldColumns[f] {
+			hidden[c] = true
+		}
+	}
+	return hidden
+}
+
+// memberMatcher applies FilterMembersRequest criteria and GlobalSearch style
+// prefix matching of the query to a member
+type memberMatcher struct {
+	filter models.FilterMembersRequest
+	tokens []string
+}
+
+func newMemberMatcher(filter models.FilterMembersRequest) memberMatcher {
+	return memberMatcher{filter: filter, tokens: tokenizeText(filter.Query)}
+}
+
+func equalOrUnset(want, got string) bool {
+	return want == "" || strings.EqualFold(strings.TrimSpace(want), strings.TrimSpace(got))
+}
+
+func (f memberMatcher) match(m exportMember) bool {
+	s, ms := m.shop, m.membership
+	if !equalOrUnset(f.filter.Industry, s.Industry) ||
+		!equalOrUnset(f.filter.SubIndustry, s.SubIndustry) ||
+		!equalOrUnset(f.filter.Province, s.Province) ||
+		!equalOrUnset(f.filter.District, s.District) ||
+		!equalOrUnset(f.filter.Ward, s.Ward) ||
+		!equalOrUnset(f.filter.Status, ms.Status) ||
+		!equalOrUnset(f.filter.Rank, ms.Rank) {
+		return false
+	}
+	if len(f.tokens) == 0 {
+		return true
+	}
+
+	words := tokenizeText(strings.Join([]string{s.Name, s.Industry, s.SubIndustry, s.Province, s.District, s.Ward}, " "))
+	for _, t := range f.tokens {
+		found := false
+		for _, w := range words {
+			if strings.HasPrefix(w, t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportMembers streams the members matching req to w in join order and
+// returns how many were written. Members are loaded in batches, so memory use
+// does not grow with the size of the iCom. req must have been through
+// PrepareExport.
+func (s *MemberService) ExportMembers(ctx context.Context, icomID string, req models.MemberExportRequest, w io.Writer) (int, error) {
+	matcher := newMemberMatcher(req.Filter)
+	if req.Public {
+		// Pending, suspended and former members are not listed publicly
+		matcher.filter.Status = constants.MEMBER_STATUS_ACTIVE
+	}
+
+	var write func(m exportMember) error
+	var finish func() error
+	if req.Format == models.ExportFormatVCard {
+		vw := newVCardWriter(w)
+		write = func(m exportMember) error { return vw.write(m, m.hiddenColumns(req.Public)) }
+		finish = vw.flush
+	} else {
+		sw, err := spreadsheet.NewWriter(req.Format, w)
+		if err != nil {
+			return 0, err
+		}
+		if err := sw.WriteRow(req.Columns); err != nil {
+			return 0, err
+		}
+		row := make([]string, len(req.Columns))
+		write = func(m exportMember) error {
+			hidden := m.hiddenColumns(req.Public)
+			for i, c := range req.Columns {
+				row[i] = m.value(c, hidden)
+			}
+			return sw.WriteRow(row)
+		}
+		finish = sw.Close
+	}
+
+	written := 0
+	membersKey := fmt.Sprintf("icom:%s:members", icomID)
+	for start := int64(0); ; start += exportBatchSize {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		shopIDs, err := s.rdb.ZRange(ctx, membersKey, start, start+exportBatchSize-1).Result()
+		if err != nil {
+			return written, err
+		}
+
+		members, err := s.loadExportMembers(ctx, icomID, shopIDs)
+		if err != nil {
+			return written, err
+		}
+		for _, m := range members {
+			if !matcher.match(m) {
+				continue
+			}
+			if err := write(m); err != nil {
+				return written, err
+			}
+			written++
+		}
+
+		if len(shopIDs) < exportBatchSize {
+			break
+		}
+	}
+	return written, finish()
+}
+
+// loadExportMembers reads the shop and membership of a batch of members
+func (s *MemberService) loadExportMembers(ctx context.Context, icomID string, shopIDs []string) ([]exportMember, error) {
+	if len(shopIDs) == 0 {
+		return nil, nil
+	}
+	pipe := s.rdb.Pipeline()
+	shopCmds := make([]*redis.MapStringStringCmd, len(shopIDs))
+	memberCmds := make([]*redis.MapStringStringCmd, len(shopIDs))
+	for i, shopID := range shopIDs {
+		shopCmds[i] = pipe.HGetAll(ctx, fmt.Sprintf("ishop:%s", shopID))
+		memberCmds[i] = pipe.HGetAll(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	members := make([]exportMember, 0, len(shopIDs))
+	for i, shopID := range shopIDs {
+		if len(shopCmds[i].Val()) == 0 {
+			continue
+		}
+		var m exportMember
+		_ = hashcodec.Unmarshal(shopCmds[i].Val(), &m.shop)
+		_ = hashcodec.Unmarshal(memberCmds[i].Val(), &m.membership)
+		m.shop.ID = shopID
+		members = append(members, m)
+	}
+	return members, nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/models"
+	"i-manage/internal/spreadsheet"
+)
+
+func seedExportFixtures(t *testing.T) {
+	t.Helper()
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1", "id", "1", "name", "Test iCom")
+	shops := []struct {
+		id, name, phone, status, private string
+	}{
+		{"10", "Phở Hà Nội", "0901000010", constants.MEMBER_STATUS_ACTIVE, `["phone"]`},
+		{"11", "Bánh Mì Sài Gòn", "0901000011", constants.MEMBER_STATUS_ACTIVE, ""},
+		{"12", "Phở Bò Pending", "0901000012", constants.MEMBER_STATUS_PENDING, ""},
+	}
+	for i, s := range shops {
+		rdb.HSet(ctx, "ishop:"+s.id, "id", s.id, "name", s.name, "phone", s.phone,
+			"industry", "fnb", "province", "HCM", "lat", "10.7", "lng", "106.6", "privateFields", s.private)
+		rdb.HSet(ctx, "icom:1:member:"+s.id, "status", s.status, "rank", "MEMBER")
+		rdb.ZAdd(ctx, "icom:1:members", redis.Z{Score: float64(i), Member: s.id})
+	}
+}
+
+func TestExportMembersCSV(t *testing.T) {
+	seedExportFixtures(t)
+	ctx := context.Background()
+	service := NewMemberService()
+
+	req := models.MemberExportRequest{Columns: []string{"shop_id", "name", "phone", "status"}}
+	if err := service.PrepareExport(ctx, "1", &req); err != nil {
+		t.Fatalf("PrepareExport: %v", err)
+	}
+	var buf bytes.Buffer
+	n, err := service.ExportMembers(ctx, "1", req, &buf)
+	if err != nil || n != 3 {
+		t.Fatalf("ExportMembers wrote %d rows (err %v)", n, err)
+	}
+	rows, err := spreadsheet.ReadCSV(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ReadCSV: %v", err)
+	}
+	if len(rows) != 4 || rows[1][2] != "0901000010" {
+		t.Errorf("admin export should include every member and field, got %v", rows)
+	}
+
+	// Public exports hide private fields and non-active members; q prefix-matches
+	req.Public = true
+	req.Filter.Query = "pho"
+	buf.Reset()
+	if n, err := service.ExportMembers(ctx, "1", req, &buf); err != nil || n != 1 {
+		t.Fatalf("public export wrote %d rows (err %v)", n, err)
+	}
+	rows, _ = spreadsheet.ReadCSV(buf.Bytes())
+	if rows[1][0] != "10" || rows[1][2] != "" {
+		t.Errorf("expected shop 10 without phone, got %v", rows[1])
+	}
+}
+
+func TestExportMembersValidationAndVCard(t *testing.T) {
+	seedExportFixtures(t)
+	ctx := context.Background()
+	service := NewMemberService()
+
+	if err := service.PrepareExport(ctx, "1", &models.MemberExportRequest{Format: "pdf"}); !errors.Is(err, ErrExportFormat) {
+		t.Errorf("expected ErrExportFormat, got %v", err)
+	}
+	if err := service.PrepareExport(ctx, "1", &models.MemberExportRequest{Columns: []string{"secret"}}); !errors.Is(err, ErrExportColumn) {
+		t.Errorf("expected ErrExportColumn, got %v", err)
+	}
+	if err := service.PrepareExport(ctx, "2", &models.MemberExportRequest{}); !errors.Is(err, ErrIComNotFound) {
+		t.Errorf("expected ErrIComNotFound, got %v", err)
+	}
+
+	req := models.MemberExportRequest{Format: models.ExportFormatVCard, Public: true}
+	if err := service.PrepareExport(ctx, "1", &req); err != nil {
+		t.Fatalf("PrepareExport: %v", err)
+	}
+	var buf bytes.Buffer
+	if n, err := service.ExportMembers(ctx, "1", req, &buf); err != nil || n != 2 {
+		t.Fatalf("vCard export wrote %d cards (err %v)", n, err)
+	}
+	out := buf.String()
+	if strings.Count(out, "BEGIN:VCARD") != 2 || strings.Contains(out, "0901000010") ||
+		!strings.Contains(out, "TEL;VALUE=uri;TYPE=work:tel:0901000011") ||
+		!strings.Contains(out, "GEO:geo:10.7,106.6") {
+		t.Errorf("unexpected vCard output:\n%s", out)
+	}
+}
+
+func TestVCardLineFolding(t *testing.T) {
+	var buf bytes.Buffer
+	v := newVCardWriter(&buf)
+	v.line("NOTE:" + strings.Repeat("ộ", 60))
+	v.flush()
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line of %d octets not folded", len(line))
+		}
+	}
+}
@@ -0,0 +1,746 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/database"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+	"i-manage/internal/spreadsheet"
+	"i-manage/internal/workers"
+)
+
+// Member import errors surfaced to handlers
+var (
+	ErrImportNotFound    = errors.New("import not found")
+	ErrImportEmpty       = errors.New("file has no data rows")
+	ErrImportTooLarge    = errors.New("file has too many rows")
+	ErrImportOnDuplicate = errors.New("on_duplicate must be skip, link or create")
+)
+
+// ImportMappingError reports mapping entries that do not fit the file
+type ImportMappingError struct {
+	Problems []string
+}
+
+func (e *ImportMappingError) Error() string {
+	return "invalid column mapping: " + strings.Join(e.Problems, "; ")
+}
+
+const (
+	importMaxRows       = 5000
+	importPreviewSample = 20
+	importPreviewErrors = 500
+	importProgressEvery = 10
+	importPollInterval  = 2 * time.Second
+	importLeaseTTL      = time.Minute
+	importClaimScan     = 10 // queued jobs looked at per claim
+	importFileTTL       = 7 * 24 * time.Hour
+	importQueueKey      = "imports:queue"
+)
+
+func importKey(id string) string       { return fmt.Sprintf("import:%s", id) }
+func importFileKey(id string) string   { return fmt.Sprintf("import:%s:file", id) }
+func importErrorsKey(id string) string { return fmt.Sprintf("import:%s:errors", id) }
+func icomImportsKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:imports", icomID)
+}
+func icomImportByHashKey(icomID, hash string) string {
+	return fmt.Sprintf("icom:%s:imports:file:%s", icomID, hash)
+}
+
+// icomImportedRowsKey maps row fingerprints to the shop each row became, so
+// re-imported rows are skipped
+func icomImportedRowsKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:import:rows", icomID)
+}
+
+// importFields maps the JSON names of importable AddMemberRequest fields to
+// their struct field index
+var importFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(models.AddMemberRequest{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || name == "ignore_duplicates" {
+			continue
+		}
+		fields[name] = i
+	}
+	return fields
+}()
+
+// importHeaderAliases are common column headers (English and Vietnamese)
+// for fields whose JSON name differs
+var importHeaderAliases = map[string]string{
+	"shop_name": "name", "ten": "name", "ten_cua_hang": "name",
+	"latitude": "lat", "vi_do": "lat",
+	"longitude": "lng", "lon": "lng", "long": "lng", "kinh_do": "lng",
+	"phone_number": "phone", "so_dien_thoai": "phone", "sdt": "phone", "dien_thoai": "phone",
+	"nganh": "industry", "nganh_nghe": "industry",
+	"tinh": "province", "tinh_thanh": "province", "thanh_pho": "province",
+	"quan": "district", "quan_huyen": "district",
+	"phuong": "ward", "phuong_xa": "ward",
+	"dia_chi": "street", "address": "street",
+	"hang": "rank", "vai_tro": "role", "trang_thai": "status",
+}
+
+// normalizeHeader turns a column header into a snake_case key without accents
+func normalizeHeader(header string) string {
+	return strings.Join(tokenizeText(strings.ReplaceAll(strings.ToLower(header), "đ", "d")), "_")
+}
+
+// resolveImportMapping returns the column index of every mapped field.
+// Explicit mapping entries win over headers that match a field name.
+func resolveImportMapping(headers []string, mapping map[string]string) (map[string]int, error) {
+	columns := make(map[string]int)
+	byHeader := make(map[string]int, len(headers))
+	for i, h := range headers {
+		key := normalizeHeader(h)
+		if _, dup := byHeader[key]; !dup && key != "" {
+			byHeader[key] = i
+		}
+	}
+
+	for i, h := range headers {
+		key := normalizeHeader(h)
+		if alias, ok := importHeaderAliases[key]; ok {
+			key = alias
+		}
+		if _, ok := importFields[key]; ok {
+			if _, taken := columns[key]; !taken {
+				columns[key] = i
+			}
+		}
+	}
+
+	var problems []string
+	for field, header := range mapping {
+		if _, ok := importFields[field]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown field %q", field))
+			continue
+		}
+		if header == "" {
+			// Explicitly unmapped
+			delete(columns, field)
+			continue
+		}
+		col, ok := byHeader[normalizeHeader(header)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("column %q for field %q not found", header, field))
+			continue
+		}
+		columns[field] = col
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, &ImportMappingError{Problems: problems}
+	}
+	return columns, nil
+}
+
+// parseImportRow builds an AddMemberRequest from a row and validates it the
+// same way POST /icom/:id/members does
+func parseImportRow(values []string, columns map[string]int) (models.AddMemberRequest, []models.ImportRowError) {
+	var req models.AddMemberRequest
+	var errs []models.ImportRowError
+	rv := reflect.ValueOf(&req).Elem()
+
+	for field, col := range columns {
+		if col >= len(values) {
+			continue
+		}
+		raw := strings.TrimSpace(values[col])
+		if raw == "" {
+			continue
+		}
+		fv := rv.Field(importFields[field])
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(raw)
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(strings.ReplaceAll(raw, ",", "."), 64)
+			if err != nil {
+				errs = append(errs, models.ImportRowError{Field: field, Message: fmt.Sprintf("%q is not a number", raw)})
+				continue
+			}
+			fv.SetFloat(f)
+		case reflect.Slice:
+			parts := strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ';' || r == '|' || r == '\n' })
+			list := make([]string, 0, len(parts))
+			for _, p := range parts {
+				if p = strings.TrimSpace(p); p != "" {
+					list = append(list, p)
+				}
+			}
+			fv.Set(reflect.ValueOf(list))
+		}
+	}
+
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		var verrs validator.ValidationErrors
+		if !errors.As(err, &verrs) {
+			errs = append(errs, models.ImportRowError{Message: err.Error()})
+		}
+		for _, fe := range verrs {
+			errs = append(errs, models.ImportRowError{Field: jsonFieldName(fe.StructField()), Message: validationMessage(fe)})
+		}
+	}
+	return req, errs
+}
+
+func jsonFieldName(structField string) string {
+	if f, ok := reflect.TypeOf(models.AddMemberRequest{}).FieldByName(structField); ok {
+		return strings.Split(f.Tag.Get("json"), ",")[0]
+	}
+	return structField
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_without":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
+
+// importRowFingerprint identifies a row's content independently of its
+// position in the file
+func importRowFingerprint(req models.AddMemberRequest) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// parsedImport is a file read and mapped for import
+type parsedImport struct {
+	format  string
+	headers []string
+	rows    [][]string
+	columns map[string]int
+}
+
+func parseImportFile(fileName string, data []byte, mapping map[string]string) (*parsedImport, error) {
+	format, err := spreadsheet.DetectFormat(fileName, data)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := spreadsheet.Read(fileName, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 {
+		return nil, ErrImportEmpty
+	}
+	if len(rows)-1 > importMaxRows {
+		return nil, fmt.Errorf("%w: %d rows, at most %d", ErrImportTooLarge, len(rows)-1, importMaxRows)
+	}
+	columns, err := resolveImportMapping(rows[0], mapping)
+	if err != nil {
+		return nil, err
+	}
+	return &parsedImport{format: format, headers: rows[0], rows: rows[1:], columns: columns}, nil
+}
+
+// resolvedMapping reports the mapping as field -> column header
+func (p *parsedImport) resolvedMapping() map[string]string {
+	out := make(map[string]string, len(p.columns))
+	for field, col := range p.columns {
+		out[field] = p.headers[col]
+	}
+	return out
+}
+
+// ImportService imports members in bulk from CSV and XLSX files
+type ImportService struct {
+	rdb           *redis.Client
+	memberService *MemberService
+}
+
+// NewImportService creates a new import service
+func NewImportService() *ImportService {
+	return &ImportService{
+		rdb:           database.Rdb,
+		memberService: NewMemberService(),
+	}
+}
+
+func validOnDuplicate(mode string) bool {
+	switch mode {
+	case "", models.ImportOnDuplicateSkip, models.ImportOnDuplicateLink, models.ImportOnDuplicateCreate:
+		return true
+	}
+	return false
+}
+
+// Preview validates every row of a file without importing anything
+func (s *ImportService) Preview(ctx context.Context, icomID, fileName string, data []byte, opts models.ImportOptions) (*models.ImportPreview, error) {
+	if !validOnDuplicate(opts.OnDuplicate) {
+		return nil, ErrImportOnDuplicate
+	}
+	parsed, err := parseImportFile(fileName, data, opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &models.ImportPreview{
+		FileName:  fileName,
+		Format:    parsed.format,
+		Columns:   parsed.headers,
+		Mapping:   parsed.resolvedMapping(),
+		TotalRows: len(parsed.rows),
+		Errors:    []models.ImportRowError{},
+		Sample:    []models.AddMemberRequest{},
+	}
+
+	tiers, err := loadTiers(ctx, s.rdb, icomID)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints := make([]string, 0, len(parsed.rows))
+	for i, values := range parsed.rows {
+		req, rowErrs := parseImportRow(values, parsed.columns)
+		if len(rowErrs) == 0 {
+			rowErrs = checkImportRank(tiers, req.Rank)
+		}
+		if len(rowErrs) > 0 {
+			preview.InvalidRows++
+			for _, e := range rowErrs {
+				if len(preview.Errors) < importPreviewErrors {
+					e.Row = i + 2
+					preview.Errors = append(preview.Errors, e)
+				}
+			}
+			continue
+		}
+		preview.ValidRows++
+		fingerprints = append(fingerprints, importRowFingerprint(req))
+		if len(preview.Sample) < importPreviewSample {
+			preview.Sample = append(preview.Sample, req)
+		}
+	}
+
+	if len(fingerprints) > 0 {
+		imported, err := s.rdb.HMGet(ctx, icomImportedRowsKey(icomID), fingerprints...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range imported {
+			if v != nil {
+				preview.AlreadyImported++
+			}
+		}
+	}
+	return preview, nil
+}
+
+// StartImport queues a background import of a file. Uploading the same file
+// with the same options again returns the existing job instead of starting a
+// new one, unless that job failed; rows imported before are always skipped.
+func (s *ImportService) StartImport(ctx context.Context, icomID, fileName string, data []byte, opts models.ImportOptions) (*models.ImportJob, bool, error) {
+	if !validOnDuplicate(opts.OnDuplicate) {
+		return nil, false, ErrImportOnDuplicate
+	}
+	if opts.OnDuplicate == "" {
+		opts.OnDuplicate = models.ImportOnDuplicateSkip
+	}
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if exists == 0 {
+		return nil, false, ErrIComNotFound
+	}
+
+	// Reject unreadable files and bad mappings up front
+	parsed, err := parseImportFile(fileName, data, opts.Mapping)
+	if err != nil {
+		return nil, false, err
+	}
+	mapping := parsed.resolvedMapping()
+
+	h := sha256.New()
+	h.Write(data)
+	optsJSON, _ := json.Marshal(models.ImportOptions{Mapping: mapping, OnDuplicate: opts.OnDuplicate})
+	h.Write(optsJSON)
+	fileHash := hex.EncodeToString(h.Sum(nil))
+
+	if jobID, err := s.rdb.Get(ctx, icomImportByHashKey(icomID, fileHash)).Result(); err == nil {
+		job, err := s.GetImport(ctx, icomID, jobID)
+		if err == nil && job.Status != models.ImportStatusFailed {
+			return job, true, nil
+		}
+	}
+
+	now := time.Now()
+	job := models.ImportJob{
+		ID:          fmt.Sprintf("imp_%d", now.UnixNano()),
+		IComID:      icomID,
+		FileName:    fileName,
+		FileHash:    fileHash,
+		Mapping:     mapping,
+		OnDuplicate: opts.OnDuplicate,
+		Status:      models.ImportStatusQueued,
+		TotalRows:   len(parsed.rows),
+		Created:     now.Format(time.RFC3339),
+	}
+	fields, err := hashcodec.Marshal(job)
+	if err != nil {
+		return nil, false, err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, importKey(job.ID), fields)
+	pipe.Set(ctx, importFileKey(job.ID), data, importFileTTL)
+	pipe.Set(ctx, icomImportByHashKey(icomID, fileHash), job.ID, importFileTTL)
+	pipe.ZAdd(ctx, icomImportsKey(icomID), redis.Z{Score: float64(now.Unix()), Member: job.ID})
+	pipe.ZAdd(ctx, importQueueKey, redis.Z{Score: float64(now.UnixMilli()), Member: job.ID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, false, err
+	}
+	return &job, false, nil
+}
+
+// GetImport returns an import job of an iCom
+func (s *ImportService) GetImport(ctx context.Context, icomID, jobID string) (*models.ImportJob, error) {
+	data, err := s.rdb.HGetAll(ctx, importKey(jobID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || data["icomId"] != icomID {
+		return nil, ErrImportNotFound
+	}
+	job := &models.ImportJob{}
+	if err := hashcodec.Unmarshal(data, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ListImports lists an iCom's import jobs, newest first
+func (s *ImportService) ListImports(ctx context.Context, icomID string, page, limit int) (*models.ImportJobList, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	start := int64((page - 1) * limit)
+
+	pipe := s.rdb.Pipeline()
+	idsCmd := pipe.ZRevRange(ctx, icomImportsKey(icomID), start, start+int64(limit)-1)
+	totalCmd := pipe.ZCard(ctx, icomImportsKey(icomID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	ids := idsCmd.Val()
+	jobs := make([]models.ImportJob, 0, len(ids))
+	if len(ids) > 0 {
+		pipe := s.rdb.Pipeline()
+		cmds := make([]*redis.MapStringStringCmd, len(ids))
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, importKey(id))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for _, cmd := range cmds {
+			if len(cmd.Val()) == 0 {
+				continue
+			}
+			var job models.ImportJob
+			if err := hashcodec.Unmarshal(cmd.Val(), &job); err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, job)
+		}
+	}
+
+	return &models.ImportJobList{Jobs: jobs, Total: int(totalCmd.Val()), Page: page, Limit: limit}, nil
+}
+
+// ImportErrors returns the per-row errors of an import job together with the
+// file's header row, for the downloadable error report
+func (s *ImportService) ImportErrors(ctx context.Context, icomID, jobID string) ([]string, []models.ImportRowError, error) {
+	job, err := s.GetImport(ctx, icomID, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := s.rdb.LRange(ctx, importErrorsKey(jobID), 0, -1).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	rowErrs := make([]models.ImportRowError, 0, len(raw))
+	for _, r := range raw {
+		var e models.ImportRowError
+		if json.Unmarshal([]byte(r), &e) == nil {
+			rowErrs = append(rowErrs, e)
+		}
+	}
+
+	var headers []string
+	if data, err := s.rdb.Get(ctx, importFileKey(jobID)).Bytes(); err == nil {
+		if rows, err := spreadsheet.Read(job.FileName, data); err == nil && len(rows) > 0 {
+			headers = rows[0]
+		}
+	}
+	return headers, rowErrs, nil
+}
+
+// RunImports processes queued import jobs until ctx is cancelled. It is run
+// as a background worker.
+func (s *ImportService) RunImports(ctx context.Context) error {
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.processQueued(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("imports: processing queue failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// processQueued runs queued jobs one at a time, oldest first. A job stays
+// in the queue while it runs, guarded by a lease that the worker renews; if
+// the worker dies the lease runs out and the job is picked up again, with
+// the rows imported before the crash skipped.
+func (s *ImportService) processQueued(ctx context.Context) error {
+	for ctx.Err() == nil {
+		ran, err := s.runNext(ctx)
+		if err != nil || !ran {
+			return err
+		}
+	}
+	return nil
+}
+
+// runNext runs the oldest queued job that no other worker holds. It reports
+// whether a job was run.
+func (s *ImportService) runNext(ctx context.Context) (bool, error) {
+	jobIDs, err := s.rdb.ZRange(ctx, importQueueKey, 0, importClaimScan-1).Result()
+	if err != nil {
+		return false, err
+	}
+	for _, jobID := range jobIDs {
+		lease := workers.NewLease(s.rdb, "import:"+jobID, importLeaseTTL)
+		held, err := lease.Hold(ctx, func(runCtx context.Context) error {
+			return s.claimedJob(ctx, runCtx, jobID)
+		})
+		if err != nil || held {
+			return held, err
+		}
+	}
+	return false, nil
+}
+
+// claimedJob runs a job while its lease is held and takes it off the queue
+// once it has completed or failed. runCtx is cancelled on shutdown (ctx
+// done) or when the lease is lost; the job is left queued in both cases.
+func (s *ImportService) claimedJob(ctx, runCtx context.Context, jobID string) error {
+	// Another worker may have finished the job since the queue was read
+	if _, err := s.rdb.ZScore(runCtx, importQueueKey, jobID).Result(); err == redis.Nil {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err := s.runJob(runCtx, jobID)
+	if err != nil && runCtx.Err() != nil {
+		if ctx.Err() != nil {
+			// Shutting down: resume later, finished rows are skipped then
+			s.rdb.HSet(context.Background(), importKey(jobID), "status", models.ImportStatusQueued)
+		}
+		return nil
+	}
+	pipe := s.rdb.TxPipeline()
+	if err != nil {
+		pipe.HSet(ctx, importKey(jobID), map[string]interface{}{
+			"status":   models.ImportStatusFailed,
+			"error":    err.Error(),
+			"finished": time.Now().Format(time.RFC3339),
+		})
+	}
+	pipe.ZRem(ctx, importQueueKey, jobID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// runJob imports every row of a job's file
+func (s *ImportService) runJob(ctx context.Context, jobID string) error {
+	data, err := s.rdb.HGetAll(ctx, importKey(jobID)).Result()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	var job models.ImportJob
+	if err := hashcodec.Unmarshal(data, &job); err != nil {
+		return err
+	}
+
+	file, err := s.rdb.Get(ctx, importFileKey(jobID)).Bytes()
+	if err == redis.Nil {
+		return fmt.Errorf("uploaded file has expired")
+	}
+	if err != nil {
+		return err
+	}
+	parsed, err := parseImportFile(job.FileName, file, job.Mapping)
+	if err != nil {
+		return err
+	}
+
+	// A resumed job starts over; rows imported earlier are skipped
+	job.Status = models.ImportStatusRunning
+	job.Started = time.Now().Format(time.RFC3339)
+	job.Processed, job.Added, job.Linked, job.Skipped, job.Failed = 0, 0, 0, 0, 0
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, importErrorsKey(jobID))
+	s.saveProgress(ctx, pipe, &job)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	for i, values := range parsed.rows {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rowErrs := s.importRow(ctx, &job, values, parsed.columns)
+		job.Processed++
+
+		pipe := s.rdb.Pipeline()
+		for _, e := range rowErrs {
+			e.Row = i + 2
+			e.Values = values
+			encoded, _ := json.Marshal(e)
+			pipe.RPush(ctx, importErrorsKey(jobID), encoded)
+		}
+		if job.Processed%importProgressEvery == 0 || job.Processed == len(parsed.rows) {
+			s.saveProgress(ctx, pipe, &job)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+
+	job.Status = models.ImportStatusCompleted
+	job.Finished = time.Now().Format(time.RFC3339)
+	pipe = s.rdb.TxPipeline()
+	s.saveProgress(ctx, pipe, &job)
+	pipe.Expire(ctx, importErrorsKey(jobID), importFileTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *ImportService) saveProgress(ctx context.Context, pipe redis.Pipeliner, job *models.ImportJob) {
+	pipe.HSet(ctx, importKey(job.ID), map[string]interface{}{
+		"status":    job.Status,
+		"processed": job.Processed,
+		"added":     job.Added,
+		"linked":    job.Linked,
+		"skipped":   job.Skipped,
+		"failed":    job.Failed,
+		"started":   job.Started,
+		"finished":  job.Finished,
+	})
+}
+
+// checkImportRank reports a row whose rank is not one of the iCom's tiers
+func checkImportRank(tiers []models.MembershipTier, rank string) []models.ImportRowError {
+	if rank == "" {
+		return nil
+	}
+	if _, ok := findTier(tiers, rank); !ok {
+		return []models.ImportRowError{{Field: "rank", Message: fmt.Sprintf("%q is not a tier of this iCom", rank)}}
+	}
+	return nil
+}
+
+// importRow imports one row and updates the job counters. It returns the
+// errors to report for the row.
+func (s *ImportService) importRow(ctx context.Context, job *models.ImportJob, values []string, columns map[string]int) []models.ImportRowError {
+	req, rowErrs := parseImportRow(values, columns)
+	if len(rowErrs) == 0 && req.Rank != "" {
+		tiers, err := loadTiers(ctx, s.rdb, job.IComID)
+		if err != nil {
+			job.Failed++
+			return []models.ImportRowError{{Message: err.Error()}}
+		}
+		rowErrs = checkImportRank(tiers, req.Rank)
+	}
+	if len(rowErrs) > 0 {
+		job.Failed++
+		return rowErrs
+	}
+
+	fingerprint := importRowFingerprint(req)
+	rowsKey := icomImportedRowsKey(job.IComID)
+	if done, _ := s.rdb.HExists(ctx, rowsKey, fingerprint).Result(); done {
+		job.Skipped++
+		return nil
+	}
+
+	req.IgnoreDuplicates = job.OnDuplicate == models.ImportOnDuplicateCreate
+	shopID, err := s.memberService.AddMember(ctx, job.IComID, req)
+
+	var dupErr *DuplicateShopError
+	if errors.As(err, &dupErr) {
+		if job.OnDuplicate != models.ImportOnDuplicateLink {
+			job.Skipped++
+			return []models.ImportRowError{{Message: fmt.Sprintf("possible duplicate of shop %s (%s)", dupErr.Candidates[0].ShopID, dupErr.Candidates[0].Name)}}
+		}
+		shopID, err = s.memberService.AddMember(ctx, job.IComID, models.AddMemberRequest{
+			ShopID: dupErr.Candidates[0].ShopID,
+			Rank:   req.Rank,
+			Status: req.Status,
+			Role:   req.Role,
+		})
+		if errors.Is(err, ErrAlreadyMember) {
+			s.rdb.HSet(ctx, rowsKey, fingerprint, dupErr.Candidates[0].ShopID)
+			job.Skipped++
+			return nil
+		}
+		if err == nil {
+			s.rdb.HSet(ctx, rowsKey, fingerprint, shopID)
+			job.Linked++
+			return nil
+		}
+	}
+	if err != nil {
+		job.Failed++
+		return []models.ImportRowError{{Message: err.Error()}}
+	}
+
+	s.rdb.HSet(ctx, rowsKey, fingerprint, shopID)
+	if req.ShopID != "" {
+		job.Linked++
+	} else {
+		job.Added++
+	}
+	return nil
+}
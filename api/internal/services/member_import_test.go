@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"i-manage/internal/models"
+	"i-manage/internal/workers"
+)
+
+const importTestCSV = "Tên cửa hàng,Ngành,Vĩ độ,Kinh độ,Email,Hạng\n" +
+	"Phở Hòa,fnb,10.7769,106.7009,hoa@example.com,VIP\n" +
+	"Bánh mì,fnb,,106.70,,\n" +
+	"Cơm tấm,fnb,10.78,106.71,not-an-email,\n" +
+	"Trà sữa,fnb,10.79,106.72,,\n"
+
+func TestImportPreview(t *testing.T) {
+	rdb := setupTestRedis(t)
+	service := NewImportService()
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1", "id", "1", "name", "Test iCom")
+
+	preview, err := service.Preview(ctx, "1", "members.csv", []byte(importTestCSV), models.ImportOptions{
+		Mapping: map[string]string{"rank": "Hạng"},
+	})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if preview.TotalRows != 4 || preview.ValidRows != 1 || preview.InvalidRows != 3 {
+		t.Fatalf("unexpected counts %+v", preview)
+	}
+	if preview.Errors[0].Row != 2 || preview.Errors[0].Field != "rank" {
+		t.Errorf("expected the undefined VIP rank to be reported, got %+v", preview.Errors)
+	}
+
+	// With the VIP tier defined
+	seedTiers(t, "1", "VIP")
+	preview, err = service.Preview(ctx, "1", "members.csv", []byte(importTestCSV), models.ImportOptions{
+		Mapping: map[string]string{"rank": "Hạng"},
+	})
+	if err != nil || preview.ValidRows != 2 || preview.InvalidRows != 2 {
+		t.Fatalf("unexpected preview %+v (err %v)", preview, err)
+	}
+	if preview.Errors[0].Row != 3 || preview.Errors[0].Field != "lat" || preview.Errors[1].Field != "email" {
+		t.Errorf("unexpected errors %+v", preview.Errors)
+	}
+	if preview.Sample[0].Name != "Phở Hòa" || preview.Sample[0].Rank != "VIP" || preview.Sample[0].Lat != 10.7769 {
+		t.Errorf("unexpected sample %+v", preview.Sample[0])
+	}
+
+	var mappingErr *ImportMappingError
+	if _, err := service.Preview(ctx, "1", "members.csv", []byte(importTestCSV), models.ImportOptions{
+		Mapping: map[string]string{"colour": "Ngành", "phone": "Phone"},
+	}); !errors.As(err, &mappingErr) || len(mappingErr.Problems) != 2 {
+		t.Errorf("expected two mapping problems, got %v", err)
+	}
+}
+
+func TestImportJobIsIdempotent(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1", "id", "1", "name", "Test iCom")
+	seedTiers(t, "1", "VIP")
+	service := NewImportService()
+
+	job, existing, err := service.StartImport(ctx, "1", "members.csv", []byte(importTestCSV), models.ImportOptions{})
+	if err != nil || existing {
+		t.Fatalf("StartImport: %v (existing %v)", err, existing)
+	}
+	if err := service.processQueued(ctx); err != nil {
+		t.Fatalf("processQueued: %v", err)
+	}
+
+	done, err := service.GetImport(ctx, "1", job.ID)
+	if err != nil {
+		t.Fatalf("GetImport: %v", err)
+	}
+	if done.Status != models.ImportStatusCompleted || done.Processed != 4 || done.Added != 2 || done.Failed != 2 {
+		t.Fatalf("unexpected job %+v", done)
+	}
+	headers, rowErrs, err := service.ImportErrors(ctx, "1", job.ID)
+	if err != nil || len(headers) != 6 || len(rowErrs) != 2 || rowErrs[0].Values[0] != "Bánh mì" {
+		t.Fatalf("unexpected error report %v %+v (err %v)", headers, rowErrs, err)
+	}
+
+	// Same upload again
+	again, existing, err := service.StartImport(ctx, "1", "members.csv", []byte(importTestCSV), models.ImportOptions{})
+	if err != nil || !existing || again.ID != job.ID {
+		t.Fatalf("expected the existing job, got %+v (existing %v, err %v)", again, existing, err)
+	}
+
+	// A corrected file: the rows imported before are skipped
+	fixed := importTestCSV + "Bún bò,fnb,10.80,106.73,,\n"
+	next, _, err := service.StartImport(ctx, "1", "members-v2.csv", []byte(fixed), models.ImportOptions{})
+	if err != nil {
+		t.Fatalf("StartImport(v2): %v", err)
+	}
+	if err := service.processQueued(ctx); err != nil {
+		t.Fatalf("processQueued: %v", err)
+	}
+	done, _ = service.GetImport(ctx, "1", next.ID)
+	if done.Added != 1 || done.Skipped != 2 {
+		t.Errorf("expected 1 added and 2 skipped, got %+v", done)
+	}
+	if n, _ := rdb.ZCard(ctx, "icom:1:members").Result(); n != 3 {
+		t.Errorf("expected 3 members, got %d", n)
+	}
+}
+
+func TestImportJobResumesAfterWorkerDies(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1", "id", "1", "name", "Test iCom")
+	seedTiers(t, "1", "VIP")
+	service := NewImportService()
+
+	job, _, err := service.StartImport(ctx, "1", "members.csv", []byte(importTestCSV), models.ImportOptions{})
+	if err != nil {
+		t.Fatalf("StartImport: %v", err)
+	}
+
+	// A worker claims the job and dies while running it
+	dead := workers.NewLease(rdb, "import:"+job.ID, time.Minute)
+	if ok, err := dead.Acquire(ctx); err != nil || !ok {
+		t.Fatalf("Acquire: %v (ok %v)", err, ok)
+	}
+	rdb.HSet(ctx, importKey(job.ID), "status", models.ImportStatusRunning)
+
+	// While the dead worker's lease lasts, nobody else runs the job
+	if err := service.processQueued(ctx); err != nil {
+		t.Fatalf("processQueued: %v", err)
+	}
+	if got, _ := service.GetImport(ctx, "1", job.ID); got.Status != models.ImportStatusRunning {
+		t.Fatalf("expected the job to wait for the lease, got %+v", got)
+	}
+
+	// The lease runs out and the job is picked up again
+	rdb.Del(ctx, dead.Key())
+	if err := service.processQueued(ctx); err != nil {
+		t.Fatalf("processQueued: %v", err)
+	}
+	done, err := service.GetImport(ctx, "1", job.ID)
+	if err != nil || done.Status != models.ImportStatusCompleted || done.Processed != 4 || done.Added != 2 {
+		t.Fatalf("expected the orphaned job to complete, got %+v (err %v)", done, err)
+	}
+	if n, _ := rdb.ZCard(ctx, importQueueKey).Result(); n != 0 {
+		t.Errorf("expected an empty queue, got %d jobs", n)
+	}
+}
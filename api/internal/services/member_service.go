@@ -3,7 +3,6 @@ package services
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"time"
 
 	"strings"
@@ -15,6 +14,8 @@ import (
 	"golang.org/x/text/unicode/norm"
 	"i-manage/internal/constants"
 	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/hashcodec"
 	"i-manage/internal/models"
 )
 
@@ -32,8 +33,73 @@ func NewMemberService() *MemberService {
 	}
 }
 
-// AddMember adds a shop to iCom (creates iShop and establishes membership)
+// DuplicateShopError is returned by AddMember when the shop to be created
+// looks like one that already exists
+type DuplicateShopError struct {
+	Candidates []models.DuplicateCandidate
+}
+
+func (e *DuplicateShopError) Error() string {
+	return fmt.Sprintf("found %d existing shop(s) that may be the same business; link one with shop_id or set ignore_duplicates", len(e.Candidates))
+}
+
+// AddMember adds a shop to iCom. With req.ShopID the existing iShop is linked;
+// otherwise a new iShop is created, unless it looks like a duplicate.
 func (s *MemberService) AddMember(ctx context.Context, icomID string, req models.AddMemberRequest) (string, error) {
+	// Set default values; an explicit rank must be one of the iCom's tiers
+	rank := req.Rank
+	if rank != "" {
+		if err := checkRank(ctx, s.rdb, icomID, rank); err != nil {
+			return "", err
+		}
+	} else {
+		base, err := baseRank(ctx, s.rdb, icomID)
+		if err != nil {
+			return "", err
+		}
+		rank = base
+	}
+	status := req.Status
+	if status == "" {
+		status = constants.MEMBER_STATUS_ACTIVE
+	}
+
+	// Enforce the iCom's capacity, industry and area rules before creating anything
+	rules, err := loadMembershipRules(ctx, s.rdb, icomID)
+	if err != nil {
+		return "", err
+	}
+
+	if req.ShopID != "" {
+		return s.linkShop(ctx, rules, req.ShopID, rank, status, req.Role)
+	}
+
+	candidate := &models.IShopProfile{
+		Industry: req.Industry,
+		Province: req.Province,
+		District: req.District,
+		Ward:     req.Ward,
+	}
+	if err := checkAdmission(ctx, s.rdb, rules, candidate, holdsSeat(status)); err != nil {
+		return "", err
+	}
+
+	if !req.IgnoreDuplicates {
+		duplicates, err := s.ishopService.FindDuplicates(ctx, icomID, models.DuplicateCheckRequest{
+			Name:  req.Name,
+			Phone: req.Phone,
+			Email: req.Email,
+			Lat:   req.Lat,
+			Lng:   req.Lng,
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(duplicates) > 0 {
+			return "", &DuplicateShopError{Candidates: duplicates}
+		}
+	}
+
 	// Create iShop first
 	createShopReq := models.CreateIShopRequest{
 		Name:        req.Name,
@@ -61,112 +127,182 @@ func (s *MemberService) AddMember(ctx context.Context, icomID string, req models
 
 	shopID := shopProfile.ID
 
-	// Set default values
-	rank := req.Rank
-	if rank == "" {
-		rank = "MEMBER"
+	membership := models.MembershipDetail{
+		ShopID: shopID,
+		IComID: icomID,
+		Rank:   rank,
+		Status: status,
+		Role:   req.Role,
 	}
-	status := req.Status
-	if status == "" {
-		status = constants.MEMBER_STATUS_ACTIVE
+	if err := s.joinICom(ctx, icomID, shopProfile, membership, nil); err != nil {
+		// Rollback: delete the created shop
+		s.ishopService.DeleteIShop(ctx, shopID)
+		return "", err
 	}
 
-	now := time.Now()
-	joinedDate := now.Format(time.RFC3339)
-	timestamp := float64(now.Unix())
+	return shopID, nil
+}
 
-	// Use transaction to atomically add member
-	pipe := s.rdb.TxPipeline()
+// linkShop makes an existing iShop a member of an iCom with its own rank,
+// role and status
+func (s *MemberService) linkShop(ctx context.Context, rules membershipRules, shopID, rank, status, role string) (string, error) {
+	shop, err := s.ishopService.GetIShop(ctx, shopID)
+	if err != nil {
+		if err.Error() == "iShop not found" {
+			return "", ErrShopNotFound
+		}
+		return "", err
+	}
+	shop.ID = shopID
 
-	// 1. Add to members sorted set (score = join timestamp)
-	pipe.ZAdd(ctx, fmt.Sprintf("icom:%s:members", icomID), redis.Z{
-		Score:  timestamp,
-		Member: shopID,
-	})
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s:member:%s", rules.IComID, shopID)).Result()
+	if err != nil {
+		return "", err
+	}
+	if exists > 0 {
+		return "", ErrAlreadyMember
+	}
 
-	// 2-8. Manual Indexing REMOVED (Replaced by RediSearch)
-	// No need to SAdd to: ind, sub, loc, search, geo, status, rank keys.
-	// RediSearch indexes `ishop` profile automatically based on HASH fields.
-	// Geo index is maintained by `ishop` service logic (or should be).
-	
-	// Note: We still might need `geo` key if we use GEOSEARCH command specifically 
-	// separate from RediSearch for some legacy reason, but optimization plan says to consolidate.
-	// However, `AddMember` explicitly calls `pipe.GeoAdd`. 
-	// If `GeoSearch` handler relies on `icom:ID:geo`, we must KEEP it or REFACTOR `GeoSearch`.
-	// Optimization Plan Point 3 says: "Remove shop from icom:{id}:geo".
-	// This implies we SHOULD NOT add it here either.
-	// So I will remove it.
-
-	// 9. Save membership details
-	pipe.HSet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), map[string]interface{}{
-		"shopId":     shopID,
-		"icomId":     icomID,
-		"rank":       rank,
-		"status":     status,
-		"joinedDate": joinedDate,
-		"role":       req.Role,
-	})
+	if err := checkAdmission(ctx, s.rdb, rules, shop, holdsSeat(status)); err != nil {
+		return "", err
+	}
 
-	// 10. Increment total members count
-	pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "totalMembers", 1)
-	if status == constants.MEMBER_STATUS_ACTIVE {
-		pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "activeMembers", 1)
+	membership := models.MembershipDetail{
+		ShopID: shopID,
+		IComID: rules.IComID,
+		Rank:   rank,
+		Status: status,
+		Role:   role,
 	}
+	if err := s.joinICom(ctx, rules.IComID, shop, membership, nil); err != nil {
+		return "", err
+	}
+	return shopID, nil
+}
 
-	// 11. Add to shop's iComs list (for reverse lookup) & Update icoms TAG in shop profile
-	icomName, _ := s.rdb.HGet(ctx, fmt.Sprintf("icom:%s", icomID), "name").Result()
-	pipe.ZAdd(ctx, fmt.Sprintf("ishop:%s:icoms", shopID), redis.Z{
-		Score:  timestamp,
-		Member: icomID,
-	})
-	
-	// 12. Update iCom Metadata Aggregation (Phase 17)
-	s.updateMetadataAggregation(ctx, pipe, icomID, req.Industry, req.SubIndustry, req.Province, req.District, req.Ward, 1)
-
-	pipe.HSet(ctx, fmt.Sprintf("ishop:%s:icom:%s", shopID, icomID), map[string]interface{}{
-		"icomId":     icomID,
-		"icomName":   icomName,
-		"rank":       rank,
-		"status":     status,
-		"joinedDate": joinedDate,
-		"role":       req.Role,
-	})
+// joinICom establishes the membership of an existing shop in an iCom in one
+// transaction. extra, when set, queues additional writes in the same
+// transaction (e.g. an application record).
+func (s *MemberService) joinICom(ctx context.Context, icomID string, shop *models.IShopProfile, membership models.MembershipDetail, extra func(pipe redis.Pipeliner)) error {
+	shopID := shop.ID
+	rank := membership.Rank
+	status := membership.Status
+
+	now := time.Now()
+	timestamp := float64(now.Unix())
+	if membership.JoinedDate == "" {
+		membership.JoinedDate = now.Format(time.RFC3339)
+	}
 
-	// Get current icoms and append new one
+	// Active members of an iCom whose memberships expire start their first term
+	if status == constants.MEMBER_STATUS_ACTIVE && membership.ExpiresAt == "" {
+		policy, err := loadRenewalPolicy(ctx, s.rdb, icomID)
+		if err != nil {
+			return err
+		}
+		if policy.TermMonths > 0 {
+			membership.ExpiresAt = now.AddDate(0, policy.TermMonths, 0).UTC().Format(time.RFC3339)
+		}
+	}
+
+	// Use transaction to atomically add member. A member holding a seat
+	// takes it in the same transaction that checks it is free, and the shop
+	// is watched so joins to other iComs do not overwrite its icoms TAG.
 	shopKey := fmt.Sprintf("ishop:%s", shopID)
-	currentIComs, err := s.rdb.HGet(ctx, shopKey, "icoms").Result()
-	if err != nil && err != redis.Nil {
-		fmt.Printf("DEBUG: HGet icoms error: %v\n", err)
-	}
-	newIComs := icomID
-	if currentIComs != "" {
-		// Ensure uniqueness and append
-		ids := strings.Fields(currentIComs)
-		exists := false
-		for _, id := range ids {
-			if id == icomID {
-				exists = true
-				break
+	return watchSeats(ctx, s.rdb, icomID, func(tx *redis.Tx) error {
+		if holdsSeat(status) {
+			if err := reserveSeat(ctx, tx, icomID); err != nil {
+				return err
 			}
 		}
-		if !exists {
-			newIComs = currentIComs + " " + icomID
-		} else {
-			newIComs = currentIComs
+		pipe := tx.TxPipeline()
+
+		// 1. Add to members sorted set (score = join timestamp)
+		pipe.ZAdd(ctx, fmt.Sprintf("icom:%s:members", icomID), redis.Z{
+			Score:  timestamp,
+			Member: shopID,
+		})
+
+		// 2-8. Manual Indexing REMOVED (Replaced by RediSearch)
+		// No need to SAdd to: ind, sub, loc, search, geo keys.
+		// RediSearch indexes `ishop` profile automatically based on HASH fields.
+		// Status and rank sets are membership data, not shop data, so they are
+		// still maintained here (FilterMembers and the review queue use them).
+		pipe.SAdd(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, status), shopID)
+		pipe.SAdd(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, rank), shopID)
+		if expiresAt, err := time.Parse(time.RFC3339, membership.ExpiresAt); err == nil {
+			pipe.ZAdd(ctx, memberExpiryKey(icomID), redis.Z{Score: float64(expiresAt.Unix()), Member: shopID})
 		}
-	}
-	fmt.Printf("DEBUG: Setting icoms for shop %s to: [%s]\n", shopID, newIComs)
-	pipe.HSet(ctx, shopKey, "icoms", newIComs)
 
-	// Execute transaction
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		// Rollback: delete the created shop
-		s.ishopService.DeleteIShop(ctx, shopID)
-		return "", err
-	}
+		// 9. Save membership details
+		memberFields, err := hashcodec.MarshalPartial(membership)
+		if err != nil {
+			return err
+		}
+		pipe.HSet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), memberFields)
 
-	return shopID, nil
+		// 10. Increment total members count
+		pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "totalMembers", 1)
+		if status == constants.MEMBER_STATUS_ACTIVE {
+			pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "activeMembers", 1)
+		}
+
+		// 11. Add to shop's iComs list (for reverse lookup) & Update icoms TAG in shop profile
+		icomName, _ := s.rdb.HGet(ctx, fmt.Sprintf("icom:%s", icomID), "name").Result()
+		pipe.ZAdd(ctx, fmt.Sprintf("ishop:%s:icoms", shopID), redis.Z{
+			Score:  timestamp,
+			Member: icomID,
+		})
+
+		// 12. Update iCom Metadata Aggregation (Phase 17)
+		updateMetadataAggregation(ctx, pipe, icomID, shop.Industry, shop.SubIndustry, shop.Province, shop.District, shop.Ward, 1)
+
+		// Reverse-lookup copy carries the iCom name instead of the shop ID
+		shopMembership := membership
+		shopMembership.ShopID = ""
+		shopMembership.IComName = icomName
+		shopMemberFields, _ := hashcodec.MarshalPartial(shopMembership)
+		pipe.HSet(ctx, fmt.Sprintf("ishop:%s:icom:%s", shopID, icomID), shopMemberFields)
+
+		// Get current icoms and append new one
+		currentIComs, err := tx.HGet(ctx, shopKey, "icoms").Result()
+		if err != nil && err != redis.Nil {
+			fmt.Printf("DEBUG: HGet icoms error: %v\n", err)
+		}
+		newIComs := icomID
+		if currentIComs != "" {
+			// Ensure uniqueness and append
+			ids := strings.Fields(currentIComs)
+			exists := false
+			for _, id := range ids {
+				if id == icomID {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				newIComs = currentIComs + " " + icomID
+			} else {
+				newIComs = currentIComs
+			}
+		}
+		fmt.Printf("DEBUG: Setting icoms for shop %s to: [%s]\n", shopID, newIComs)
+		pipe.HSet(ctx, shopKey, "icoms", newIComs)
+
+		events.Append(ctx, pipe, events.New(events.MemberAdded, icomID, shopID, events.MemberAddedData{
+			Rank:   rank,
+			Status: status,
+			Role:   membership.Role,
+		}))
+
+		if extra != nil {
+			extra(pipe)
+		}
+
+		// Execute transaction
+		_, err = pipe.Exec(ctx)
+		return err
+	}, shopKey)
 }
 
 // RemoveMember removes a shop from iCom
@@ -182,6 +318,18 @@ func (s *MemberService) RemoveMember(ctx context.Context, icomID, shopID string)
 	shopData, _ := s.rdb.HGetAll(ctx, fmt.Sprintf("ishop:%s", shopID)).Result()
 
 	pipe := s.rdb.TxPipeline()
+	s.removeMembership(ctx, pipe, icomID, shopID, memberData, shopData)
+	events.Append(ctx, pipe, events.New(events.MemberRemoved, icomID, shopID, events.MemberRemovedData{
+		Status: memberData["status"],
+	}))
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// removeMembership queues every write that takes a shop out of an iCom
+func (s *MemberService) removeMembership(ctx context.Context, pipe redis.Pipeliner, icomID, shopID string, memberData, shopData map[string]string) {
+	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
 
 	// 1. Remove from members sorted set
 	pipe.ZRem(ctx, fmt.Sprintf("icom:%s:members", icomID), shopID)
@@ -215,9 +363,10 @@ func (s *MemberService) RemoveMember(ctx context.Context, icomID, shopID string)
 
 	// 5. Remove from geo index
 	pipe.ZRem(ctx, fmt.Sprintf("icom:%s:geo", icomID), shopID)
+	pipe.ZRem(ctx, memberExpiryKey(icomID), shopID)
 
 	// 5b. Update iCom Metadata Aggregation (Phase 17)
-	s.updateMetadataAggregation(ctx, pipe, icomID, shopData["industry"], shopData["subIndustry"], shopData["province"], shopData["district"], shopData["ward"], -1)
+	updateMetadataAggregation(ctx, pipe, icomID, shopData["industry"], shopData["subIndustry"], shopData["province"], shopData["district"], shopData["ward"], -1)
 
 	// 6. Remove from status index
 	if status := memberData["status"]; status != "" {
@@ -229,12 +378,14 @@ func (s *MemberService) RemoveMember(ctx context.Context, icomID, shopID string)
 		pipe.SRem(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, rank), shopID)
 	}
 
-	// 7. Delete membership details
+	// 7. Delete membership details and revoke the member's access token
 	pipe.Del(ctx, memberKey)
+	if token := memberData["accessToken"]; token != "" {
+		pipe.Del(ctx, memberAccessKey(icomID, token))
+	}
 
 	// 8. Remove from ranking sets
-	pipe.ZRem(ctx, fmt.Sprintf("icom:%s:rank:interactions", icomID), shopID)
-	pipe.ZRem(ctx, fmt.Sprintf("icom:%s:rank:likes", icomID), shopID)
+	unrankShop(ctx, pipe, icomID, shopID)
 
 	// 9. Decrement member counts
 	pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "totalMembers", -1)
@@ -246,8 +397,19 @@ func (s *MemberService) RemoveMember(ctx context.Context, icomID, shopID string)
 	pipe.ZRem(ctx, fmt.Sprintf("ishop:%s:icoms", shopID), icomID)
 	pipe.Del(ctx, fmt.Sprintf("ishop:%s:icom:%s", shopID, icomID))
 
-	_, err = pipe.Exec(ctx)
-	return err
+	// 11. Drop the iCom from the shop's icoms TAG so search no longer matches it
+	if current := shopData["icoms"]; current != "" {
+		remaining := make([]string, 0)
+		for _, id := range strings.Fields(current) {
+			if id != icomID {
+				remaining = append(remaining, id)
+			}
+		}
+		pipe.HSet(ctx, fmt.Sprintf("ishop:%s", shopID), "icoms", strings.Join(remaining, " "))
+	}
+
+	// 12. Leave the review queue if the membership was still an application
+	pipe.ZRem(ctx, fmt.Sprintf("icom:%s:applications", icomID), shopID)
 }
 
 // GetMemberDetail gets membership details
@@ -258,23 +420,34 @@ func (s *MemberService) GetMemberDetail(ctx context.Context, icomID, shopID stri
 		return nil, fmt.Errorf("membership not found")
 	}
 
+	detail := &models.MembershipDetail{}
+	if err := hashcodec.Unmarshal(data, detail); err != nil {
+		return nil, err
+	}
+
 	// Get iCom name
-	icomName, _ := s.rdb.HGet(ctx, fmt.Sprintf("icom:%s", icomID), "name").Result()
-
-	return &models.MembershipDetail{
-		ShopID:     data["shopId"],
-		IComID:     data["icomId"],
-		IComName:   icomName,
-		Rank:       data["rank"],
-		Status:     data["status"],
-		JoinedDate: data["joinedDate"],
-		Role:       data["role"],
-		Benefits:   data["benefits"],
-	}, nil
+	detail.IComName, _ = s.rdb.HGet(ctx, fmt.Sprintf("icom:%s", icomID), "name").Result()
+
+	// Benefits come from the member's tier
+	if tiers, err := loadTiers(ctx, s.rdb, icomID); err == nil {
+		if tier, ok := findTier(tiers, detail.Rank); ok && tier.Benefits != "" {
+			detail.Benefits = tier.Benefits
+		}
+	}
+
+	return detail, nil
 }
 
 // UpdateMemberStatus updates member rank/status
 func (s *MemberService) UpdateMemberStatus(ctx context.Context, icomID, shopID string, req models.UpdateMemberStatusRequest) error {
+	return s.updateMemberStatusGuarded(ctx, icomID, shopID, req, nil, nil)
+}
+
+// updateMemberStatusGuarded is UpdateMemberStatus for internal callers that
+// tie the change to the membership they saw. check runs first in the
+// transaction on the membership read through it, and extra adds writes to
+// the change; nil means none.
+func (s *MemberService) updateMemberStatusGuarded(ctx context.Context, icomID, shopID string, req models.UpdateMemberStatusRequest, check func(member map[string]string) error, extra func(pipe redis.Pipeliner)) error {
 	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
 	
 	// Get current data
@@ -283,44 +456,117 @@ func (s *MemberService) UpdateMemberStatus(ctx context.Context, icomID, shopID s
 		return fmt.Errorf("membership not found")
 	}
 
-	updates := make(map[string]interface{})
-	pipe := s.rdb.TxPipeline()
-
-	// Update rank
+	// The rank must be one of the iCom's tiers
 	if req.Rank != "" && req.Rank != currentData["rank"] {
-		updates["rank"] = req.Rank
-		// Move to new rank index
-		pipe.SRem(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, currentData["rank"]), shopID)
-		pipe.SAdd(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, req.Rank), shopID)
-	}
-
-	// Update status
-	if req.Status != "" && req.Status != currentData["status"] {
-		updates["status"] = req.Status
-		// Move to new status index
-		pipe.SRem(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, currentData["status"]), shopID)
-		pipe.SAdd(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, req.Status), shopID)
-
-		// Update active member count
-		if currentData["status"] == constants.MEMBER_STATUS_ACTIVE && req.Status != constants.MEMBER_STATUS_ACTIVE {
-			pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "activeMembers", -1)
-		} else if currentData["status"] != constants.MEMBER_STATUS_ACTIVE && req.Status == constants.MEMBER_STATUS_ACTIVE {
-			pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "activeMembers", 1)
+		if err := checkRank(ctx, s.rdb, icomID, req.Rank); err != nil {
+			return err
 		}
 	}
 
-	// Update role
-	if req.Role != "" {
-		updates["role"] = req.Role
+	// Taking a seat, or activating, must satisfy the iCom's current rules
+	if req.Status != "" && req.Status != currentData["status"] &&
+		(req.Status == constants.MEMBER_STATUS_ACTIVE || holdsSeat(req.Status) && !holdsSeat(currentData["status"])) {
+		rules, err := loadMembershipRules(ctx, s.rdb, icomID)
+		if err != nil {
+			return err
+		}
+		shop, err := s.ishopService.GetIShop(ctx, shopID)
+		if err != nil {
+			return err
+		}
+		if err := checkAdmission(ctx, s.rdb, rules, shop, !holdsSeat(currentData["status"])); err != nil {
+			return err
+		}
 	}
 
-	// Apply updates
-	if len(updates) > 0 {
-		pipe.HSet(ctx, memberKey, updates)
+	// Returning to a term after it lapsed starts a new one
+	var policy models.RenewalPolicy
+	if req.Status != "" && holdsTerm(req.Status) && !holdsTerm(currentData["status"]) {
+		if policy, err = loadRenewalPolicy(ctx, s.rdb, icomID); err != nil {
+			return err
+		}
 	}
 
-	_, err = pipe.Exec(ctx)
-	return err
+	// Moving into a seat takes it in the same transaction that checks it is free
+	return watchSeats(ctx, s.rdb, icomID, func(tx *redis.Tx) error {
+		currentData, err := tx.HGetAll(ctx, memberKey).Result()
+		if err != nil || len(currentData) == 0 {
+			return fmt.Errorf("membership not found")
+		}
+		if check != nil {
+			if err := check(currentData); err != nil {
+				return err
+			}
+		}
+		if req.Status != "" && holdsSeat(req.Status) && !holdsSeat(currentData["status"]) {
+			if err := reserveSeat(ctx, tx, icomID); err != nil {
+				return err
+			}
+		}
+
+		updates := make(map[string]interface{})
+		pipe := tx.TxPipeline()
+
+		// Update rank
+		if req.Rank != "" && req.Rank != currentData["rank"] {
+			updates["rank"] = req.Rank
+			// Move to new rank index
+			pipe.SRem(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, currentData["rank"]), shopID)
+			pipe.SAdd(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, req.Rank), shopID)
+		}
+
+		// Update status
+		if req.Status != "" && req.Status != currentData["status"] {
+			updates["status"] = req.Status
+			// Move to new status index
+			pipe.SRem(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, currentData["status"]), shopID)
+			pipe.SAdd(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, req.Status), shopID)
+
+			// Leaving PENDING through a direct status change settles the application
+			if currentData["status"] == constants.MEMBER_STATUS_PENDING {
+				pipe.ZRem(ctx, applicationQueueKey(icomID), shopID)
+			}
+
+			// A lapsed expiry date would expire the membership again on the
+			// next scheduler pass
+			if holdsTerm(req.Status) && !holdsTerm(currentData["status"]) {
+				s.restartTerm(ctx, pipe, icomID, shopID, currentData["expiresAt"], policy, time.Now())
+			}
+
+			// Update active member count
+			if currentData["status"] == constants.MEMBER_STATUS_ACTIVE && req.Status != constants.MEMBER_STATUS_ACTIVE {
+				pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "activeMembers", -1)
+			} else if currentData["status"] != constants.MEMBER_STATUS_ACTIVE && req.Status == constants.MEMBER_STATUS_ACTIVE {
+				pipe.HIncrBy(ctx, fmt.Sprintf("icom:%s", icomID), "activeMembers", 1)
+			}
+		}
+
+		// Update role
+		if req.Role != "" {
+			updates["role"] = req.Role
+		}
+
+		// Apply updates
+		if len(updates) == 0 {
+			return nil
+		}
+		pipe.HSet(ctx, memberKey, updates)
+		if extra != nil {
+			extra(pipe)
+		}
+
+		change := events.MemberStatusChangedData{Role: req.Role}
+		if _, ok := updates["status"]; ok {
+			change.OldStatus, change.NewStatus = currentData["status"], req.Status
+		}
+		if _, ok := updates["rank"]; ok {
+			change.OldRank, change.NewRank = currentData["rank"], req.Rank
+		}
+		events.Append(ctx, pipe, events.New(events.MemberStatusChanged, icomID, shopID, change))
+
+		_, err = pipe.Exec(ctx)
+		return err
+	}, memberKey)
 }
 
 // UpdateMemberOrder updates the display order of a member
@@ -335,23 +581,23 @@ func (s *MemberService) UpdateMemberOrder(ctx context.Context, icomID, shopID st
 		return fmt.Errorf("membership not found")
 	}
 
+	pipe := s.rdb.TxPipeline()
+
 	// Update displayOrder in membership hash
-	err = s.rdb.HSet(ctx, memberKey, "displayOrder", displayOrder).Err()
-	if err != nil {
-		return err
-	}
+	pipe.HSet(ctx, memberKey, "displayOrder", displayOrder)
 
 	// Update score in sorted set (this controls the display order)
-	membersKey := fmt.Sprintf("icom:%s:members", icomID)
-	err = s.rdb.ZAdd(ctx, membersKey, redis.Z{
+	pipe.ZAdd(ctx, fmt.Sprintf("icom:%s:members", icomID), redis.Z{
 		Score:  float64(displayOrder),
 		Member: shopID,
-	}).Err()
-	if err != nil {
-		return err
-	}
+	})
 
-	return nil
+	events.Append(ctx, pipe, events.New(events.MemberOrderChanged, icomID, shopID, events.MemberOrderChangedData{
+		DisplayOrder: displayOrder,
+	}))
+
+	_, err = pipe.Exec(ctx)
+	return err
 }
 
 // ListMembers lists all members with pagination
@@ -366,21 +612,20 @@ func (s *MemberService) ListMembers(ctx context.Context, icomID string, page, li
 	start := int64((page - 1) * limit)
 	stop := int64(page*limit - 1)
 
-	// Get members from sorted set
-	shopIDs, err := s.rdb.ZRange(ctx, fmt.Sprintf("icom:%s:members", icomID), start, stop).Result()
-	if err != nil {
+	// Get page of members and total count in one round-trip
+	membersKey := fmt.Sprintf("icom:%s:members", icomID)
+	pipe := s.rdb.Pipeline()
+	rangeCmd := pipe.ZRange(ctx, membersKey, start, stop)
+	totalCmd := pipe.ZCard(ctx, membersKey)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
 		return nil, err
 	}
+	shopIDs := rangeCmd.Val()
+	total := totalCmd.Val()
 
-	// Get total count
-	total, _ := s.rdb.ZCard(ctx, fmt.Sprintf("icom:%s:members", icomID)).Result()
-
-	members := make([]models.MemberSummary, 0, len(shopIDs))
-	for _, shopID := range shopIDs {
-		summary, err := s.getMemberSummary(ctx, icomID, shopID)
-		if err == nil {
-			members = append(members, *summary)
-		}
+	members, err := s.getMemberSummaries(ctx, icomID, shopIDs)
+	if err != nil {
+		return nil, err
 	}
 
 	return &models.MemberListResponse{
@@ -472,12 +717,9 @@ func (s *MemberService) FilterMembers(ctx context.Context, icomID string, req mo
 
 	paginatedIDs := shopIDs[start:end]
 
-	members := make([]models.MemberSummary, 0, len(paginatedIDs))
-	for _, shopID := range paginatedIDs {
-		summary, err := s.getMemberSummary(ctx, icomID, shopID)
-		if err == nil {
-			members = append(members, *summary)
-		}
+	members, err := s.getMemberSummaries(ctx, icomID, paginatedIDs)
+	if err != nil {
+		return nil, err
 	}
 
 	return &models.MemberListResponse{
@@ -572,7 +814,10 @@ func (s *MemberService) GlobalSearch(ctx context.Context, icomID string, query s
 		}, nil
 	}
 
-	members := make([]models.MemberSummary, 0)
+	// Collect shop IDs and indexed fields first, then fetch membership details
+	// for the whole page in one pipeline
+	shopIDs := make([]string, 0)
+	shopFields := make([]map[string]string, 0)
 
 	// STRATEGY 1: Map Response (RESP3)
 	if isMapResponse {
@@ -599,33 +844,14 @@ func (s *MemberService) GlobalSearch(ctx context.Context, icomID string, query s
 					}
 				}
 
-				// Common mapping logic
-				lat, _ := strconv.ParseFloat(fieldMap["lat"], 64)
-				lng, _ := strconv.ParseFloat(fieldMap["lng"], 64)
-
-				memberData, _ := s.rdb.HGetAll(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID)).Result()
-
-				members = append(members, models.MemberSummary{
-					ShopID:      shopID,
-					Name:        fieldMap["name"],
-					Logo:        fieldMap["logo"],
-					Industry:    fieldMap["industry"],
-					SubIndustry: fieldMap["subIndustry"],
-					Province:    fieldMap["province"],
-					District:    fieldMap["district"],
-					Ward:        fieldMap["ward"],
-					Rank:        memberData["rank"],
-					Status:      memberData["status"],
-					JoinedDate:  memberData["joinedDate"],
-					Lat:         lat,
-					Lng:         lng,
-				})
+				shopIDs = append(shopIDs, shopID)
+				shopFields = append(shopFields, fieldMap)
 			}
 		}
 	} else {
 		// STRATEGY 2: Slice Response (RESP2)
 		// Format: [total, key1, fields1, key2, fields2...]
-		for i := 1; i < len(resSlice); i += 2 {
+		for i := 1; i+1 < len(resSlice); i += 2 {
 			key, ok := resSlice[i].(string)
 			if !ok {
 				continue
@@ -646,27 +872,19 @@ func (s *MemberService) GlobalSearch(ctx context.Context, icomID string, query s
 				}
 			}
 
-			lat, _ := strconv.ParseFloat(fieldMap["lat"], 64)
-			lng, _ := strconv.ParseFloat(fieldMap["lng"], 64)
+			shopIDs = append(shopIDs, shopID)
+			shopFields = append(shopFields, fieldMap)
+		}
+	}
 
-			memberData, _ := s.rdb.HGetAll(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID)).Result()
+	memberData, err := s.getMembershipData(ctx, icomID, shopIDs)
+	if err != nil {
+		return nil, err
+	}
 
-			members = append(members, models.MemberSummary{
-				ShopID:      shopID,
-				Name:        fieldMap["name"],
-				Logo:        fieldMap["logo"],
-				Industry:    fieldMap["industry"],
-				SubIndustry: fieldMap["subIndustry"],
-				Province:    fieldMap["province"],
-				District:    fieldMap["district"],
-				Ward:        fieldMap["ward"],
-				Rank:        memberData["rank"],
-				Status:      memberData["status"],
-				JoinedDate:  memberData["joinedDate"],
-				Lat:         lat,
-				Lng:         lng,
-			})
-		}
+	members := make([]models.MemberSummary, len(shopIDs))
+	for i, shopID := range shopIDs {
+		members[i] = buildMemberSummary(shopID, shopFields[i], memberData[i])
 	}
 
 	return &models.MemberListResponse{
@@ -695,52 +913,99 @@ func (s *MemberService) GeoSearch(ctx context.Context, icomID string, req models
 		return nil, err
 	}
 
-	members := make([]models.MemberSummary, 0, len(results))
-	for _, result := range results {
-		shopID := result.Name
-		summary, err := s.getMemberSummary(ctx, icomID, shopID)
-		if err == nil {
-			members = append(members, *summary)
+	shopIDs := make([]string, len(results))
+	for i, result := range results {
+		shopIDs[i] = result.Name
+	}
+
+	return s.getMemberSummaries(ctx, icomID, shopIDs)
+}
+
+// getMemberSummaries fetches shop profiles and membership details for a page of
+// shops in a single pipelined round-trip. Shops whose profile no longer exists
+// are skipped; the order of shopIDs is preserved.
+func (s *MemberService) getMemberSummaries(ctx context.Context, icomID string, shopIDs []string) ([]models.MemberSummary, error) {
+	members := make([]models.MemberSummary, 0, len(shopIDs))
+	if len(shopIDs) == 0 {
+		return members, nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	shopCmds := make([]*redis.MapStringStringCmd, len(shopIDs))
+	memberCmds := make([]*redis.MapStringStringCmd, len(shopIDs))
+	for i, shopID := range shopIDs {
+		shopCmds[i] = pipe.HGetAll(ctx, fmt.Sprintf("ishop:%s", shopID))
+		memberCmds[i] = pipe.HGetAll(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	for i, shopID := range shopIDs {
+		shopData := shopCmds[i].Val()
+		if len(shopData) == 0 {
+			continue
 		}
+		members = append(members, buildMemberSummary(shopID, shopData, memberCmds[i].Val()))
 	}
 
 	return members, nil
 }
 
-// getMemberSummary gets a brief summary of a member
-func (s *MemberService) getMemberSummary(ctx context.Context, icomID, shopID string) (*models.MemberSummary, error) {
-	// Get shop data
-	shopData, err := s.rdb.HGetAll(ctx, fmt.Sprintf("ishop:%s", shopID)).Result()
-	if err != nil || len(shopData) == 0 {
-		return nil, fmt.Errorf("shop not found")
+// getMembershipData fetches membership hashes for many shops in one round-trip
+func (s *MemberService) getMembershipData(ctx context.Context, icomID string, shopIDs []string) ([]map[string]string, error) {
+	result := make([]map[string]string, len(shopIDs))
+	if len(shopIDs) == 0 {
+		return result, nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(shopIDs))
+	for i, shopID := range shopIDs {
+		cmds[i] = pipe.HGetAll(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
 	}
 
-	// Get membership data
-	memberData, _ := s.rdb.HGetAll(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID)).Result()
+	for i, cmd := range cmds {
+		result[i] = cmd.Val()
+	}
+	return result, nil
+}
 
-	// Parse coordinates
-	lat, _ := s.rdb.HGet(ctx, fmt.Sprintf("ishop:%s", shopID), "lat").Float64()
-	lng, _ := s.rdb.HGet(ctx, fmt.Sprintf("ishop:%s", shopID), "lng").Float64()
+// buildMemberSummary maps raw shop and membership hashes onto a MemberSummary
+func buildMemberSummary(shopID string, shopData, memberData map[string]string) models.MemberSummary {
+	var shop models.IShopProfile
+	var membership models.MembershipDetail
+	_ = hashcodec.Unmarshal(shopData, &shop)
+	_ = hashcodec.Unmarshal(memberData, &membership)
 
-	return &models.MemberSummary{
+	return models.MemberSummary{
 		ShopID:      shopID,
-		Name:        shopData["name"],
-		Logo:        shopData["logo"],
-		Industry:    shopData["industry"],
-		SubIndustry: shopData["subIndustry"],
-		Province:    shopData["province"],
-		District:    shopData["district"],
-		Ward:        shopData["ward"],
-		Rank:        memberData["rank"],
-		Status:      memberData["status"],
-		JoinedDate:  memberData["joinedDate"],
-		Lat:         lat,
-		Lng:         lng,
-	}, nil
+		Name:        shop.Name,
+		Logo:        shop.Logo,
+		Industry:    shop.Industry,
+		SubIndustry: shop.SubIndustry,
+		Province:    shop.Province,
+		District:    shop.District,
+		Ward:        shop.Ward,
+		Rank:        membership.Rank,
+		Status:      membership.Status,
+		JoinedDate:  membership.JoinedDate,
+		Lat:         shop.Lat,
+		Lng:         shop.Lng,
+	}
 }
 
 // tokenize breaks a string into normalized tokens for indexing
 func (s *MemberService) tokenize(text string) []string {
+	return tokenizeText(text)
+}
+
+// tokenizeText lowercases text, strips Vietnamese diacritics and splits it
+// into words
+func tokenizeText(text string) []string {
 	// 1. Remove accents/diacritics
 	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
 	normalized, _, _ := transform.String(t, text)
@@ -753,8 +1018,9 @@ func (s *MemberService) tokenize(text string) []string {
 	return strings.FieldsFunc(normalized, f)
 }
 
-// updateMetadataAggregation updates the reference counts for industries and areas
-func (s *MemberService) updateMetadataAggregation(ctx context.Context, pipe redis.Pipeliner, icomID string, industry, subIndustry, province, district, ward string, delta float64) {
+// updateMetadataAggregation updates the reference counts for industries and
+// areas, and the province and district counts of the stats breakdown
+func updateMetadataAggregation(ctx context.Context, pipe redis.Pipeliner, icomID string, industry, subIndustry, province, district, ward string, delta float64) {
 	if industry != "" {
 		pipe.ZIncrBy(ctx, fmt.Sprintf("icom:%s:meta:industries", icomID), delta, industry)
 	}
@@ -769,4 +1035,12 @@ func (s *MemberService) updateMetadataAggregation(ctx context.Context, pipe redi
 	if district != "" {
 		pipe.ZIncrBy(ctx, fmt.Sprintf("icom:%s:meta:areas", icomID), delta, district)
 	}
+
+	// Province and district on their own, for the stats breakdown
+	if province != "" {
+		pipe.ZIncrBy(ctx, metaProvincesKey(icomID), delta, province)
+	}
+	if district != "" {
+		pipe.ZIncrBy(ctx, metaDistrictsKey(icomID), delta, district)
+	}
 }
@@ -0,0 +1,481 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/events"
+	"i-manage/internal/models"
+)
+
+// Membership renewal errors surfaced to handlers
+var (
+	ErrRenewalDisabled   = errors.New("memberships of this iCom do not expire")
+	ErrRenewalNotAllowed = errors.New("pending memberships cannot be renewed")
+)
+
+// errTermRunning stops a lapse when the membership was renewed or changed
+// after the expiry pass found it due
+var errTermRunning = errors.New("membership term is still running")
+
+// defaultReminderDays are the reminders sent ahead of an expiry
+var defaultReminderDays = []int{30, 7, 1}
+
+// Membership terms are stored per iCom:
+//
+//	icom:<id>:renewal    JSON renewal policy
+//	icom:<id>:expiry     zset of ACTIVE and SUSPENDED members by expiry (unix)
+//
+// The membership hash carries expiresAt and remindedDays, the tightest
+// reminder already sent for the current term.
+
+func renewalPolicyKey(icomID string) string { return fmt.Sprintf("icom:%s:renewal", icomID) }
+func memberExpiryKey(icomID string) string  { return fmt.Sprintf("icom:%s:expiry", icomID) }
+
+// loadRenewalPolicy returns the renewal policy of an iCom with its defaults
+func loadRenewalPolicy(ctx context.Context, rdb *redis.Client, icomID string) (models.RenewalPolicy, error) {
+	var policy models.RenewalPolicy
+	raw, err := rdb.Get(ctx, renewalPolicyKey(icomID)).Result()
+	if err != nil && err != redis.Nil {
+		return policy, err
+	}
+	if err == nil {
+		_ = json.Unmarshal([]byte(raw), &policy)
+	}
+	withRenewalDefaults(&policy)
+	return policy, nil
+}
+
+func withRenewalDefaults(policy *models.RenewalPolicy) {
+	if policy.Mode == "" {
+		policy.Mode = models.RenewalModeManual
+	}
+	if len(policy.ReminderDays) == 0 {
+		policy.ReminderDays = append([]int(nil), defaultReminderDays...)
+	}
+	// Largest first, without duplicates
+	sort.Sort(sort.Reverse(sort.IntSlice(policy.ReminderDays)))
+	days := policy.ReminderDays[:1]
+	for _, d := range policy.ReminderDays[1:] {
+		if d != days[len(days)-1] {
+			days = append(days, d)
+		}
+	}
+	policy.ReminderDays = days
+}
+
+// termEnd returns the end of the membership term containing now, counted in
+// terms of the policy from the day the member joined
+func termEnd(policy models.RenewalPolicy, joined, now time.Time) time.Time {
+	_, end := duesPeriod(joined, policy.TermMonths, now)
+	return end
+}
+
+// holdsTerm reports whether a membership status runs against an expiry date
+func holdsTerm(status string) bool {
+	return status == constants.MEMBER_STATUS_ACTIVE || status == constants.MEMBER_STATUS_SUSPENDED
+}
+
+// GetRenewalPolicy returns the renewal policy of an iCom
+func (s *MemberService) GetRenewalPolicy(ctx context.Context, icomID string) (*models.RenewalPolicy, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrIComNotFound
+	}
+	policy, err := loadRenewalPolicy(ctx, s.rdb, icomID)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SetRenewalPolicy replaces the renewal policy of an iCom. Turning expiry on
+// gives every current member the end of their running term, counted from
+// the day they joined; turning it off clears the expiry dates.
+func (s *MemberService) SetRenewalPolicy(ctx context.Context, icomID string, policy models.RenewalPolicy) (*models.RenewalPolicy, error) {
+	if _, err := s.GetRenewalPolicy(ctx, icomID); err != nil {
+		return nil, err
+	}
+	withRenewalDefaults(&policy)
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+	tx := s.rdb.TxPipeline()
+	tx.Set(ctx, renewalPolicyKey(icomID), data, 0)
+	events.Append(ctx, tx, events.New(events.IComUpdated, icomID, "", events.IComChangedData{Changed: []string{"renewal"}}))
+	if _, err := tx.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	if policy.TermMonths == 0 {
+		return &policy, s.clearExpiry(ctx, icomID)
+	}
+	if _, err := s.assignExpiry(ctx, icomID, policy, time.Now()); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// clearExpiry drops the expiry dates of an iCom's memberships
+func (s *MemberService) clearExpiry(ctx context.Context, icomID string) error {
+	shopIDs, err := s.rdb.ZRange(ctx, fmt.Sprintf("icom:%s:members", icomID), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(shopIDs); start += exportBatchSize {
+		pipe := s.rdb.Pipeline()
+		for _, shopID := range shopIDs[start:min(start+exportBatchSize, len(shopIDs))] {
+			pipe.HDel(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), "expiresAt", "remindedDays")
+			pipe.HDel(ctx, fmt.Sprintf("ishop:%s:icom:%s", shopID, icomID), "expiresAt")
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return s.rdb.Del(ctx, memberExpiryKey(icomID)).Err()
+}
+
+// assignExpiry gives the members holding a term that have no expiry date
+// the end of their running term
+func (s *MemberService) assignExpiry(ctx context.Context, icomID string, policy models.RenewalPolicy, now time.Time) (int, error) {
+	shopIDs, err := s.rdb.SUnion(ctx,
+		fmt.Sprintf("icom:%s:status:%s", icomID, constants.MEMBER_STATUS_ACTIVE),
+		fmt.Sprintf("icom:%s:status:%s", icomID, constants.MEMBER_STATUS_SUSPENDED),
+	).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	assigned := 0
+	for start := 0; start < len(shopIDs); start += exportBatchSize {
+		batch := shopIDs[start:min(start+exportBatchSize, len(shopIDs))]
+
+		pipe := s.rdb.Pipeline()
+		cmds := make([]*redis.SliceCmd, len(batch))
+		for i, shopID := range batch {
+			cmds[i] = pipe.HMGet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), "expiresAt", "joinedDate")
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return assigned, err
+		}
+
+		pipe = s.rdb.Pipeline()
+		for i, shopID := range batch {
+			values := stringValues(cmds[i].Val(), 2)
+			expiresAt, err := time.Parse(time.RFC3339, values[0])
+			if err != nil {
+				joined, err := time.Parse(time.RFC3339, values[1])
+				if err != nil {
+					joined = now
+				}
+				expiresAt = termEnd(policy, joined, now)
+				s.writeExpiry(ctx, pipe, icomID, shopID, expiresAt)
+				assigned++
+			}
+			// Keep the index in step with the hash (ZADD is idempotent)
+			pipe.ZAdd(ctx, memberExpiryKey(icomID), redis.Z{Score: float64(expiresAt.Unix()), Member: shopID})
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return assigned, err
+		}
+	}
+	return assigned, nil
+}
+
+// writeExpiry queues a new expiry date for a membership and resets its reminders
+func (s *MemberService) writeExpiry(ctx context.Context, pipe redis.Pipeliner, icomID, shopID string, expiresAt time.Time) {
+	value := expiresAt.UTC().Format(time.RFC3339)
+	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
+	pipe.HSet(ctx, memberKey, "expiresAt", value)
+	pipe.HDel(ctx, memberKey, "remindedDays")
+	pipe.HSet(ctx, fmt.Sprintf("ishop:%s:icom:%s", shopID, icomID), "expiresAt", value)
+	pipe.ZAdd(ctx, memberExpiryKey(icomID), redis.Z{Score: float64(expiresAt.Unix()), Member: shopID})
+}
+
+// restartTerm starts a new term for a membership returning to a term status
+// when its expiry date has passed. Without a term policy the stale date is
+// dropped instead.
+func (s *MemberService) restartTerm(ctx context.Context, pipe redis.Pipeliner, icomID, shopID, expiresAt string, policy models.RenewalPolicy, now time.Time) {
+	if current, err := time.Parse(time.RFC3339, expiresAt); err != nil || current.After(now) {
+		return
+	}
+	if policy.TermMonths > 0 {
+		s.writeExpiry(ctx, pipe, icomID, shopID, now.AddDate(0, policy.TermMonths, 0))
+		return
+	}
+	pipe.HDel(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), "expiresAt", "remindedDays")
+	pipe.HDel(ctx, fmt.Sprintf("ishop:%s:icom:%s", shopID, icomID), "expiresAt")
+	pipe.ZRem(ctx, memberExpiryKey(icomID), shopID)
+}
+
+// RenewMembership extends a membership by months, or by the policy term.
+// A running term is extended from its end; a lapsed one from today, and the
+// membership becomes ACTIVE again if the iCom's rules allow it.
+func (s *MemberService) RenewMembership(ctx context.Context, icomID, shopID string, months int) (*models.MembershipRenewal, error) {
+	policy, err := loadRenewalPolicy(ctx, s.rdb, icomID)
+	if err != nil {
+		return nil, err
+	}
+	if months == 0 {
+		months = policy.TermMonths
+	}
+	if policy.TermMonths == 0 || months == 0 {
+		return nil, ErrRenewalDisabled
+	}
+
+	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
+	membership, err := s.rdb.HMGet(ctx, memberKey, "status", "expiresAt").Result()
+	if err != nil {
+		return nil, err
+	}
+	values := stringValues(membership, 2)
+	if values[0] == "" {
+		return nil, fmt.Errorf("membership not found")
+	}
+	if values[0] == constants.MEMBER_STATUS_PENDING {
+		return nil, ErrRenewalNotAllowed
+	}
+
+	now := time.Now()
+	from := duesDay(now)
+	if current, err := time.Parse(time.RFC3339, values[1]); err == nil && current.After(now) {
+		from = current
+	}
+	expiresAt := from.AddDate(0, months, 0)
+
+	status := values[0]
+	if status == constants.MEMBER_STATUS_EXPIRED {
+		if err := s.UpdateMemberStatus(ctx, icomID, shopID, models.UpdateMemberStatusRequest{
+			Status: constants.MEMBER_STATUS_ACTIVE,
+		}); err != nil {
+			return nil, err
+		}
+		status = constants.MEMBER_STATUS_ACTIVE
+	}
+
+	renewal := &models.MembershipRenewal{
+		ShopID:       shopID,
+		Status:       status,
+		OldExpiresAt: values[1],
+		ExpiresAt:    expiresAt.UTC().Format(time.RFC3339),
+	}
+	pipe := s.rdb.TxPipeline()
+	s.writeExpiry(ctx, pipe, icomID, shopID, expiresAt)
+	events.Append(ctx, pipe, events.New(events.MemberRenewed, icomID, shopID, events.MemberRenewedData{
+		OldExpiresAt: renewal.OldExpiresAt,
+		NewExpiresAt: renewal.ExpiresAt,
+	}))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return renewal, nil
+}
+
+// ProcessExpiry runs one pass of the expiry scheduler over an iCom
+func (s *MemberService) ProcessExpiry(ctx context.Context, icomID string) (*models.ExpiryRun, error) {
+	if _, err := s.GetRenewalPolicy(ctx, icomID); err != nil {
+		return nil, err
+	}
+	return s.processExpiry(ctx, icomID, time.Now())
+}
+
+func (s *MemberService) processExpiry(ctx context.Context, icomID string, now time.Time) (*models.ExpiryRun, error) {
+	run := &models.ExpiryRun{IComID: icomID}
+	policy, err := loadRenewalPolicy(ctx, s.rdb, icomID)
+	if err != nil || policy.TermMonths == 0 {
+		return run, err
+	}
+	if run.Assigned, err = s.assignExpiry(ctx, icomID, policy, now); err != nil {
+		return nil, err
+	}
+
+	// Lapse (or renew) the terms that ended before the grace period
+	lapseBefore := now.AddDate(0, 0, -policy.GraceDays)
+	due, err := s.rdb.ZRangeByScore(ctx, memberExpiryKey(icomID), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(lapseBefore.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, shopID := range due {
+		renewed, err := s.lapseMembership(ctx, icomID, shopID, policy, now)
+		if errors.Is(err, errTermRunning) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if renewed {
+			run.Renewed++
+		} else {
+			run.Expired++
+		}
+	}
+
+	// Remind the members whose term ends within the longest reminder
+	upcoming, err := s.rdb.ZRangeByScoreWithScores(ctx, memberExpiryKey(icomID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(now.Unix(), 10),
+		Max: strconv.FormatInt(now.AddDate(0, 0, policy.ReminderDays[0]).Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, z := range upcoming {
+		sent, err := s.remindExpiry(ctx, icomID, z.Member.(string), time.Unix(int64(z.Score), 0), policy, now)
+		if err != nil {
+			return nil, err
+		}
+		if sent {
+			run.Reminded++
+		}
+	}
+	return run, nil
+}
+
+// lapseMembership ends a term: under an automatic policy the membership is
+// renewed for as many terms as it takes to cover today, otherwise it becomes
+// EXPIRED. It reports whether the membership was renewed. The term is read
+// again under WATCH, so a renewal committed since the pass found it due
+// wins and errTermRunning is returned.
+func (s *MemberService) lapseMembership(ctx context.Context, icomID, shopID string, policy models.RenewalPolicy, now time.Time) (bool, error) {
+	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
+	membership, err := s.rdb.HMGet(ctx, memberKey, "status", "expiresAt").Result()
+	if err != nil {
+		return false, err
+	}
+	values := stringValues(membership, 2)
+	if !holdsTerm(values[0]) {
+		return false, s.rdb.ZRem(ctx, memberExpiryKey(icomID), shopID).Err()
+	}
+
+	// stillDue checks a membership read in the transaction
+	lapseBefore := now.AddDate(0, 0, -policy.GraceDays)
+	stillDue := func(status, expiresAt string) error {
+		if !holdsTerm(status) {
+			return errTermRunning
+		}
+		if current, err := time.Parse(time.RFC3339, expiresAt); err == nil && current.After(lapseBefore) {
+			return errTermRunning
+		}
+		return nil
+	}
+
+	if policy.Mode == models.RenewalModeAuto {
+		err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+			membership, err := tx.HMGet(ctx, memberKey, "status", "expiresAt").Result()
+			if err != nil {
+				return err
+			}
+			values := stringValues(membership, 2)
+			if err := stillDue(values[0], values[1]); err != nil {
+				return err
+			}
+			expiresAt, err := time.Parse(time.RFC3339, values[1])
+			if err != nil {
+				expiresAt = now
+			}
+			for !expiresAt.After(now) {
+				expiresAt = expiresAt.AddDate(0, policy.TermMonths, 0)
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				s.writeExpiry(ctx, pipe, icomID, shopID, expiresAt)
+				events.Append(ctx, pipe, events.New(events.MemberRenewed, icomID, shopID, events.MemberRenewedData{
+					OldExpiresAt: values[1],
+					NewExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+					Auto:         true,
+				}))
+				return nil
+			})
+			return err
+		}, memberKey)
+		return err == nil, err
+	}
+
+	// UpdateMemberStatus moves the status indexes, frees the seat and
+	// decrements activeMembers
+	return false, s.updateMemberStatusGuarded(ctx, icomID, shopID, models.UpdateMemberStatusRequest{
+		Status: constants.MEMBER_STATUS_EXPIRED,
+	}, func(member map[string]string) error {
+		return stillDue(member["status"], member["expiresAt"])
+	}, func(pipe redis.Pipeliner) {
+		pipe.ZRem(ctx, memberExpiryKey(icomID), shopID)
+	})
+}
+
+// remindExpiry sends the tightest reminder due for a term, unless it was
+// already sent. It reports whether a reminder was sent.
+func (s *MemberService) remindExpiry(ctx context.Context, icomID, shopID string, expiresAt time.Time, policy models.RenewalPolicy, now time.Time) (bool, error) {
+	daysLeft := int(math.Ceil(expiresAt.Sub(now).Hours() / 24))
+	reminder := 0
+	for _, d := range policy.ReminderDays {
+		if d >= daysLeft {
+			reminder = d
+		}
+	}
+	if reminder == 0 {
+		return false, nil
+	}
+
+	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, shopID)
+	sent := false
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		membership, err := tx.HMGet(ctx, memberKey, "status", "remindedDays").Result()
+		if err != nil {
+			return err
+		}
+		values := stringValues(membership, 2)
+		if !holdsTerm(values[0]) {
+			return nil
+		}
+		if last, err := strconv.Atoi(values[1]); err == nil && last <= reminder {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, memberKey, "remindedDays", reminder)
+			events.Append(ctx, pipe, events.New(events.MembershipExpiring, icomID, shopID, events.MembershipExpiringData{
+				ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+				DaysLeft:  daysLeft,
+				AutoRenew: policy.Mode == models.RenewalModeAuto,
+			}))
+			return nil
+		})
+		sent = err == nil
+		return err
+	}, memberKey)
+	return sent, err
+}
+
+// ProcessAllExpiry sends expiry reminders and lapses or renews ended terms
+// in every iCom with a renewal policy. It runs as the "membership-expiry"
+// scheduler job.
+func (s *MemberService) ProcessAllExpiry(ctx context.Context) error {
+	return forEachICom(ctx, s.rdb, func(icomID string) error {
+		if exists, err := s.rdb.Exists(ctx, renewalPolicyKey(icomID)).Result(); err != nil || exists == 0 {
+			return err
+		}
+		run, err := s.processExpiry(ctx, icomID, time.Now())
+		if err != nil {
+			return err
+		}
+		if run.Assigned+run.Reminded+run.Renewed+run.Expired > 0 {
+			log.Printf("expiry: iCom %s: %d assigned, %d reminded, %d renewed, %d expired",
+				icomID, run.Assigned, run.Reminded, run.Renewed, run.Expired)
+		}
+		return nil
+	})
+}
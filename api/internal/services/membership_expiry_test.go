@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/events"
+	"i-manage/internal/models"
+)
+
+// setupExpiry creates iCom 1 with two active members joined 40 days ago and
+// a monthly renewal policy, and returns the expiry date they were given
+func setupExpiry(t *testing.T, policy models.RenewalPolicy) (*MemberService, time.Time) {
+	t.Helper()
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+
+	rdb.HSet(ctx, "icom:1", "id", "1", "activeMembers", 2)
+	joined := time.Now().AddDate(0, 0, -40).Format(time.RFC3339)
+	for _, shopID := range []string{"shop1", "shop2"} {
+		rdb.HSet(ctx, fmt.Sprintf("icom:1:member:%s", shopID), "shopId", shopID, "rank", "MEMBER",
+			"status", constants.MEMBER_STATUS_ACTIVE, "joinedDate", joined)
+		rdb.SAdd(ctx, "icom:1:status:ACTIVE", shopID)
+		rdb.ZAdd(ctx, "icom:1:members", redis.Z{Member: shopID})
+		rdb.HSet(ctx, fmt.Sprintf("ishop:%s", shopID), "id", shopID, "name", shopID)
+	}
+
+	service := NewMemberService()
+	if _, err := service.SetRenewalPolicy(ctx, "1", policy); err != nil {
+		t.Fatalf("SetRenewalPolicy: %v", err)
+	}
+	return service, memberExpiresAt(t, service, "shop1")
+}
+
+func memberExpiresAt(t *testing.T, s *MemberService, shopID string) time.Time {
+	t.Helper()
+	value, _ := s.rdb.HGet(context.Background(), "icom:1:member:"+shopID, "expiresAt").Result()
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("%s expiresAt = %q", shopID, value)
+	}
+	return expiresAt
+}
+
+func countEvents(t *testing.T, s *MemberService, eventType events.Type) int {
+	t.Helper()
+	msgs, err := s.rdb.XRange(context.Background(), events.StreamKey, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("XRange: %v", err)
+	}
+	n := 0
+	for _, msg := range msgs {
+		if msg.Values["type"] == string(eventType) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMembershipExpiryManual(t *testing.T) {
+	service, expiresAt := setupExpiry(t, models.RenewalPolicy{TermMonths: 1})
+	ctx := context.Background()
+
+	// Members get the end of their running term, the second month
+	if !expiresAt.After(time.Now()) || expiresAt.After(time.Now().AddDate(0, 1, 0)) {
+		t.Fatalf("expiresAt = %v", expiresAt)
+	}
+	if n, _ := service.rdb.ZCard(ctx, memberExpiryKey("1")).Result(); n != 2 {
+		t.Fatalf("expiry index has %d members", n)
+	}
+
+	// Each reminder is sent once
+	for _, tt := range []struct {
+		now      time.Time
+		reminded int
+	}{
+		{expiresAt.AddDate(0, 0, -10), 2},
+		{expiresAt.AddDate(0, 0, -9), 0},
+		{expiresAt.AddDate(0, 0, -5), 2},
+		{expiresAt.AddDate(0, 0, -4), 0},
+	} {
+		run, err := service.processExpiry(ctx, "1", tt.now)
+		if err != nil {
+			t.Fatalf("processExpiry: %v", err)
+		}
+		if run.Reminded != tt.reminded || run.Expired != 0 {
+			t.Errorf("run at %v = %+v, want %d reminded", tt.now, run, tt.reminded)
+		}
+	}
+	if n := countEvents(t, service, events.MembershipExpiring); n != 4 {
+		t.Errorf("%d expiring events, want 4", n)
+	}
+
+	// Renewing a running membership extends it from its expiry date
+	renewal, err := service.RenewMembership(ctx, "1", "shop2", 0)
+	if err != nil {
+		t.Fatalf("RenewMembership: %v", err)
+	}
+	if want := expiresAt.AddDate(0, 1, 0); !memberExpiresAt(t, service, "shop2").Equal(want) {
+		t.Errorf("renewed expiresAt = %s, want %v", renewal.ExpiresAt, want)
+	}
+
+	run, err := service.processExpiry(ctx, "1", expiresAt.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("processExpiry: %v", err)
+	}
+	if run.Expired != 1 {
+		t.Errorf("run = %+v, want 1 expired", run)
+	}
+	status, _ := service.rdb.HGet(ctx, "icom:1:member:shop1", "status").Result()
+	active, _ := service.rdb.HGet(ctx, "icom:1", "activeMembers").Result()
+	if status != constants.MEMBER_STATUS_EXPIRED || active != "1" {
+		t.Errorf("after expiry status = %s, activeMembers = %s", status, active)
+	}
+	if _, err := service.rdb.ZScore(ctx, memberExpiryKey("1"), "shop1").Result(); err == nil {
+		t.Error("expired member still in the expiry index")
+	}
+
+	// Renewing a lapsed membership reactivates it from today
+	renewal, err = service.RenewMembership(ctx, "1", "shop1", 2)
+	if err != nil {
+		t.Fatalf("RenewMembership expired: %v", err)
+	}
+	active, _ = service.rdb.HGet(ctx, "icom:1", "activeMembers").Result()
+	if renewal.Status != constants.MEMBER_STATUS_ACTIVE || active != "2" {
+		t.Errorf("reactivated status = %s, activeMembers = %s", renewal.Status, active)
+	}
+	if !memberExpiresAt(t, service, "shop1").After(time.Now().AddDate(0, 1, 0)) {
+		t.Errorf("reactivated expiresAt = %s", renewal.ExpiresAt)
+	}
+}
+
+func TestMembershipExpiryAuto(t *testing.T) {
+	service, expiresAt := setupExpiry(t, models.RenewalPolicy{TermMonths: 1, Mode: models.RenewalModeAuto, GraceDays: 3})
+	ctx := context.Background()
+
+	// Nothing happens during the grace period
+	run, err := service.processExpiry(ctx, "1", expiresAt.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("processExpiry: %v", err)
+	}
+	if run.Renewed+run.Expired+run.Reminded != 0 {
+		t.Errorf("run in grace = %+v", run)
+	}
+
+	run, err = service.processExpiry(ctx, "1", expiresAt.AddDate(0, 0, 4))
+	if err != nil {
+		t.Fatalf("processExpiry: %v", err)
+	}
+	if run.Renewed != 2 || run.Expired != 0 {
+		t.Errorf("run after grace = %+v", run)
+	}
+	if got, want := memberExpiresAt(t, service, "shop1"), expiresAt.AddDate(0, 1, 0); !got.Equal(want) {
+		t.Errorf("auto renewed expiresAt = %v, want %v", got, want)
+	}
+	if n := countEvents(t, service, events.MemberRenewed); n != 2 {
+		t.Errorf("%d renewed events, want 2", n)
+	}
+
+	// Turning expiry off clears the dates
+	if _, err := service.SetRenewalPolicy(ctx, "1", models.RenewalPolicy{}); err != nil {
+		t.Fatalf("SetRenewalPolicy: %v", err)
+	}
+	if value, _ := service.rdb.HGet(ctx, "icom:1:member:shop1", "expiresAt").Result(); value != "" {
+		t.Errorf("expiresAt after disabling = %q", value)
+	}
+	if _, err := service.RenewMembership(ctx, "1", "shop1", 0); !errors.Is(err, ErrRenewalDisabled) {
+		t.Errorf("renew without a term err = %v", err)
+	}
+}
+
+func TestReactivatingExpiredMemberStartsNewTerm(t *testing.T) {
+	service, _ := setupExpiry(t, models.RenewalPolicy{TermMonths: 1})
+	ctx := context.Background()
+
+	// shop1's term ended yesterday
+	lapsed := time.Now().AddDate(0, 0, -1)
+	pipe := service.rdb.TxPipeline()
+	service.writeExpiry(ctx, pipe, "1", "shop1", lapsed)
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("writeExpiry: %v", err)
+	}
+	if run, err := service.processExpiry(ctx, "1", time.Now()); err != nil || run.Expired != 1 {
+		t.Fatalf("processExpiry = %+v, %v", run, err)
+	}
+
+	if err := service.UpdateMemberStatus(ctx, "1", "shop1", models.UpdateMemberStatusRequest{
+		Status: constants.MEMBER_STATUS_ACTIVE,
+	}); err != nil {
+		t.Fatalf("UpdateMemberStatus: %v", err)
+	}
+	if !memberExpiresAt(t, service, "shop1").After(time.Now()) {
+		t.Errorf("reactivated member kept the lapsed expiry")
+	}
+
+	// The next scheduler pass leaves the reactivated member alone
+	if run, err := service.processExpiry(ctx, "1", time.Now()); err != nil || run.Expired != 0 {
+		t.Errorf("processExpiry = %+v, %v, want none expired", run, err)
+	}
+	status, _ := service.rdb.HGet(ctx, "icom:1:member:shop1", "status").Result()
+	if status != constants.MEMBER_STATUS_ACTIVE {
+		t.Errorf("status = %s, want ACTIVE", status)
+	}
+}
+
+func TestExpiryKeepsMembershipRenewedMeanwhile(t *testing.T) {
+	service, expiresAt := setupExpiry(t, models.RenewalPolicy{TermMonths: 1})
+	ctx := context.Background()
+
+	// The pass finds shop1 due, but a renewal committed before the lapse
+	// moved its expiry into next month
+	now := expiresAt.Add(time.Hour)
+	pipe := service.rdb.TxPipeline()
+	service.writeExpiry(ctx, pipe, "1", "shop1", expiresAt.AddDate(0, 1, 0))
+	pipe.ZAdd(ctx, memberExpiryKey("1"), redis.Z{Score: float64(expiresAt.Unix()), Member: "shop1"})
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+
+	run, err := service.processExpiry(ctx, "1", now)
+	if err != nil {
+		t.Fatalf("processExpiry: %v", err)
+	}
+	if run.Expired != 1 {
+		t.Errorf("run = %+v, want only shop2 expired", run)
+	}
+	status, _ := service.rdb.HGet(ctx, "icom:1:member:shop1", "status").Result()
+	if status != constants.MEMBER_STATUS_ACTIVE {
+		t.Errorf("renewed member status = %s, want ACTIVE", status)
+	}
+}
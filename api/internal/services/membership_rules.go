@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Membership rule names used in violations
+const (
+	RuleCapacity = "capacity"
+	RuleIndustry = "industry"
+	RuleArea     = "area"
+)
+
+// MembershipRuleError is returned when a shop does not satisfy an iCom's
+// membership rules
+type MembershipRuleError struct {
+	IComID     string
+	Violations []models.RuleViolation
+}
+
+func (e *MembershipRuleError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+	return fmt.Sprintf("membership rules of iCom %s not satisfied: %s", e.IComID, strings.Join(msgs, "; "))
+}
+
+// membershipRules are the admission rules configured on an iCom
+type membershipRules struct {
+	IComID     string
+	MaxMembers int // 0 means unlimited
+	Industries []string
+	Areas      []string
+	Waitlist   bool
+
+	RequireApproval bool
+	AutoActivate    bool
+}
+
+// rulesFromProfile reads the admission rules from an iCom profile
+func rulesFromProfile(p models.IComProfile) membershipRules {
+	r := membershipRules{
+		IComID:          p.ID,
+		MaxMembers:      p.MaxMembers,
+		Waitlist:        p.WaitlistEnabled == "true",
+		RequireApproval: p.RequireApproval == "true",
+		AutoActivate:    p.AutoActivate == "true",
+	}
+	// Stored as JSON arrays; "null" or invalid JSON means no restriction
+	_ = json.Unmarshal([]byte(p.AllowedIndustries), &r.Industries)
+	_ = json.Unmarshal([]byte(p.OperatingAreas), &r.Areas)
+	return r
+}
+
+func containsFold(list []string, value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false
+	}
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkShop returns the industry and area rules a shop breaks
+func (r membershipRules) checkShop(industry, province, district, ward string) []models.RuleViolation {
+	var violations []models.RuleViolation
+
+	if len(r.Industries) > 0 && !containsFold(r.Industries, industry) {
+		violations = append(violations, models.RuleViolation{
+			Rule:    RuleIndustry,
+			Message: fmt.Sprintf("industry %q is not allowed (allowed: %s)", industry, strings.Join(r.Industries, ", ")),
+		})
+	}
+
+	if len(r.Areas) > 0 && !containsFold(r.Areas, province) && !containsFold(r.Areas, district) && !containsFold(r.Areas, ward) {
+		violations = append(violations, models.RuleViolation{
+			Rule:    RuleArea,
+			Message: fmt.Sprintf("location %s is outside the operating areas (%s)", joinNonEmpty(", ", ward, district, province), strings.Join(r.Areas, ", ")),
+		})
+	}
+
+	return violations
+}
+
+// hasCapacity reports whether another member fits next to occupied seats
+func (r membershipRules) hasCapacity(occupied int) bool {
+	return r.MaxMembers <= 0 || occupied < r.MaxMembers
+}
+
+func (r membershipRules) capacityViolation() models.RuleViolation {
+	return models.RuleViolation{
+		Rule:    RuleCapacity,
+		Message: fmt.Sprintf("iCom has reached its limit of %d members", r.MaxMembers),
+	}
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	if len(out) == 0 {
+		return "(unknown)"
+	}
+	return strings.Join(out, sep)
+}
+
+// holdsSeat reports whether a membership status counts towards MaxMembers
+func holdsSeat(status string) bool {
+	return status == constants.MEMBER_STATUS_ACTIVE || status == constants.MEMBER_STATUS_PENDING
+}
+
+// loadMembershipRules reads the admission rules of an iCom
+func loadMembershipRules(ctx context.Context, rdb redis.Cmdable, icomID string) (membershipRules, error) {
+	data, err := rdb.HGetAll(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return membershipRules{}, err
+	}
+	if len(data) == 0 {
+		return membershipRules{}, ErrIComNotFound
+	}
+
+	var profile models.IComProfile
+	if err := hashcodec.Unmarshal(data, &profile); err != nil {
+		return membershipRules{}, err
+	}
+	profile.ID = icomID
+	return rulesFromProfile(profile), nil
+}
+
+// occupiedSeats counts ACTIVE and PENDING members of an iCom. Pending
+// applications hold a seat so that approving them can never exceed the limit.
+func occupiedSeats(ctx context.Context, rdb redis.Cmdable, icomID string) (int, error) {
+	pipe := rdb.Pipeline()
+	activeCmd := pipe.HGet(ctx, fmt.Sprintf("icom:%s", icomID), "activeMembers")
+	pendingCmd := pipe.SCard(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, constants.MEMBER_STATUS_PENDING))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, err
+	}
+	active, _ := activeCmd.Int()
+	return active + int(pendingCmd.Val()), nil
+}
+
+// seatRetries bounds how often a seat is re-checked when concurrent writes
+// keep changing the seat count
+const seatRetries = 10
+
+// watchSeats runs fn in a transaction that watches the keys holding an
+// iCom's seat count: the iCom hash (maxMembers, activeMembers) and the
+// PENDING status set. A write that takes a seat must check for a free one
+// inside fn, through tx, so that no concurrent write can take the same seat
+// in between. fn is retried when the seat count changed before it committed.
+func watchSeats(ctx context.Context, rdb *redis.Client, icomID string, fn func(tx *redis.Tx) error, keys ...string) error {
+	keys = append([]string{
+		fmt.Sprintf("icom:%s", icomID),
+		fmt.Sprintf("icom:%s:status:%s", icomID, constants.MEMBER_STATUS_PENDING),
+	}, keys...)
+	var err error
+	for i := 0; i < seatRetries; i++ {
+		if err = rdb.Watch(ctx, fn, keys...); err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return err
+}
+
+// reserveSeat fails with a capacity violation when an iCom has no free seat.
+// It must run inside watchSeats.
+func reserveSeat(ctx context.Context, tx *redis.Tx, icomID string) error {
+	rules, err := loadMembershipRules(ctx, tx, icomID)
+	if err != nil {
+		return err
+	}
+	if rules.MaxMembers <= 0 {
+		return nil
+	}
+	occupied, err := occupiedSeats(ctx, tx, icomID)
+	if err != nil {
+		return err
+	}
+	if !rules.hasCapacity(occupied) {
+		return &MembershipRuleError{IComID: icomID, Violations: []models.RuleViolation{rules.capacityViolation()}}
+	}
+	return nil
+}
+
+// capacityOnly reports whether the iCom being full is the only rule broken
+func (e *MembershipRuleError) capacityOnly() bool {
+	return len(e.Violations) == 1 && e.Violations[0].Rule == RuleCapacity
+}
+
+// checkAdmission verifies that a shop may take a seat in an iCom now. The
+// seat count is only a pre-check; the write taking the seat re-checks it
+// with reserveSeat.
+func checkAdmission(ctx context.Context, rdb redis.Cmdable, rules membershipRules, shop *models.IShopProfile, needsSeat bool) error {
+	violations := rules.checkShop(shop.Industry, shop.Province, shop.District, shop.Ward)
+
+	if needsSeat && rules.MaxMembers > 0 {
+		occupied, err := occupiedSeats(ctx, rdb, rules.IComID)
+		if err != nil {
+			return err
+		}
+		if !rules.hasCapacity(occupied) {
+			violations = append(violations, rules.capacityViolation())
+		}
+	}
+
+	if len(violations) > 0 {
+		return &MembershipRuleError{IComID: rules.IComID, Violations: violations}
+	}
+	return nil
+}
+
+// ViolationReport lists members that break the iCom's current industry, area
+// or capacity rules, e.g. after the rules were tightened. Seats are counted in
+// join order, so the most recent seat holders are reported as over capacity.
+func (s *MemberService) ViolationReport(ctx context.Context, icomID string) (*models.ViolationReport, error) {
+	rules, err := loadMembershipRules(ctx, s.rdb, icomID)
+	if err != nil {
+		return nil, err
+	}
+
+	shopIDs, err := s.rdb.ZRange(ctx, fmt.Sprintf("icom:%s:members", icomID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.rdb.Pipeline()
+	shopCmds := make([]*redis.SliceCmd, len(shopIDs))
+	memberCmds := make([]*redis.SliceCmd, len(shopIDs))
+	for i, shopID := range shopIDs {
+		shopCmds[i] = pipe.HMGet(ctx, fmt.Sprintf("ishop:%s", shopID), "name", "industry", "province", "district", "ward")
+		memberCmds[i] = pipe.HMGet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), "status", "joinedDate")
+	}
+	if len(shopIDs) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+
+	type seat struct {
+		index  int
+		joined string
+	}
+	members := make([]models.MemberViolation, len(shopIDs))
+	var seats []seat
+	for i, shopID := range shopIDs {
+		shop := stringValues(shopCmds[i].Val(), 5)
+		membership := stringValues(memberCmds[i].Val(), 2)
+
+		members[i] = models.MemberViolation{
+			ShopID:     shopID,
+			Name:       shop[0],
+			Status:     membership[0],
+			Industry:   shop[1],
+			Province:   shop[2],
+			District:   shop[3],
+			Violations: rules.checkShop(shop[1], shop[2], shop[3], shop[4]),
+		}
+		if holdsSeat(membership[0]) {
+			seats = append(seats, seat{index: i, joined: membership[1]})
+		}
+	}
+
+	report := &models.ViolationReport{
+		MaxMembers:        rules.MaxMembers,
+		OccupiedSeats:     len(seats),
+		AllowedIndustries: rules.Industries,
+		OperatingAreas:    rules.Areas,
+		Members:           []models.MemberViolation{},
+	}
+	if report.AllowedIndustries == nil {
+		report.AllowedIndustries = []string{}
+	}
+	if report.OperatingAreas == nil {
+		report.OperatingAreas = []string{}
+	}
+
+	if rules.MaxMembers > 0 && len(seats) > rules.MaxMembers {
+		report.OverCapacity = len(seats) - rules.MaxMembers
+		// RFC3339 dates in the same zone sort chronologically as strings
+		sort.SliceStable(seats, func(a, b int) bool { return seats[a].joined < seats[b].joined })
+		for _, st := range seats[rules.MaxMembers:] {
+			members[st.index].Violations = append(members[st.index].Violations, rules.capacityViolation())
+		}
+	}
+
+	for _, m := range members {
+		if len(m.Violations) > 0 {
+			report.Members = append(report.Members, m)
+		}
+	}
+	return report, nil
+}
+
+// stringValues converts an HMGET reply to strings, padding missing fields
+func stringValues(vals []interface{}, n int) []string {
+	out := make([]string, n)
+	for i := 0; i < n && i < len(vals); i++ {
+		out[i], _ = vals[i].(string)
+	}
+	return out
+}
+
+// CheckShopUpdate verifies that changing a shop's industry or location keeps
+// it within the rules of every iCom where it holds a seat
+func (s *IShopService) CheckShopUpdate(ctx context.Context, shopID string, req models.UpdateIShopRequest) error {
+	if req.Industry == "" && req.Province == "" && req.District == "" && req.Ward == "" {
+		return nil
+	}
+
+	current, err := s.GetIShop(ctx, shopID)
+	if err != nil {
+		return err
+	}
+	next := *current
+	if req.Industry != "" {
+		next.Industry = req.Industry
+	}
+	if req.Province != "" {
+		next.Province = req.Province
+	}
+	if req.District != "" {
+		next.District = req.District
+	}
+	if req.Ward != "" {
+		next.Ward = req.Ward
+	}
+
+	icomIDs, err := s.rdb.ZRange(ctx, fmt.Sprintf("ishop:%s:icoms", shopID), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, icomID := range icomIDs {
+		status, _ := s.rdb.HGet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), "status").Result()
+		if !holdsSeat(status) {
+			continue
+		}
+		rules, err := loadMembershipRules(ctx, s.rdb, icomID)
+		if err == ErrIComNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if violations := rules.checkShop(next.Industry, next.Province, next.District, next.Ward); len(violations) > 0 {
+			return &MembershipRuleError{IComID: icomID, Violations: violations}
+		}
+	}
+	return nil
+}
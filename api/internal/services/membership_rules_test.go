@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"i-manage/internal/constants"
+	"i-manage/internal/models"
+)
+
+func TestMembershipRulesCheckShop(t *testing.T) {
+	rules := rulesFromProfile(models.IComProfile{
+		ID:                "1",
+		AllowedIndustries: `["FnB","retail"]`,
+		OperatingAreas:    `["Quận 1","Hà Nội"]`,
+	})
+
+	tests := []struct {
+		name                               string
+		industry, province, district, ward string
+		want                               []string
+	}{
+		{"allowed", "fnb", "Hồ Chí Minh", "quận 1", "", nil},
+		{"province match", "Retail", "Hà Nội", "Ba Đình", "", nil},
+		{"wrong industry", "spa", "Hà Nội", "", "", []string{RuleIndustry}},
+		{"outside area", "fnb", "Đà Nẵng", "Hải Châu", "", []string{RuleArea}},
+		{"both", "", "", "", "", []string{RuleIndustry, RuleArea}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rules.checkShop(tt.industry, tt.province, tt.district, tt.ward)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected violations %v, got %+v", tt.want, got)
+			}
+			for i, v := range got {
+				if v.Rule != tt.want[i] {
+					t.Errorf("violation %d: expected %s, got %s", i, tt.want[i], v.Rule)
+				}
+			}
+		})
+	}
+
+	if v := rulesFromProfile(models.IComProfile{}).checkShop("", "", "", ""); len(v) != 0 {
+		t.Errorf("iCom without rules should accept any shop, got %+v", v)
+	}
+}
+
+func TestWaitlistPromotion(t *testing.T) {
+	rdb := setupTestRedis(t)
+	seedApplicationFixtures(t, rdb, "false", "true")
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1", "maxMembers", 1, "waitlistEnabled", "true")
+	service := NewMemberService()
+
+	if _, err := service.Apply(ctx, "1", models.ApplyMembershipRequest{ShopID: "10"}); err != nil {
+		t.Fatalf("Apply(10): %v", err)
+	}
+	app, err := service.Apply(ctx, "1", models.ApplyMembershipRequest{ShopID: "11"})
+	if err != nil {
+		t.Fatalf("Apply(11): %v", err)
+	}
+	if app.Status != constants.APPLICATION_STATUS_WAITLISTED {
+		t.Fatalf("expected waitlisted application, got %s", app.Status)
+	}
+	if _, err := service.Apply(ctx, "1", models.ApplyMembershipRequest{ShopID: "11"}); !errors.Is(err, ErrAlreadyWaitlisted) {
+		t.Errorf("expected ErrAlreadyWaitlisted, got %v", err)
+	}
+
+	// Still full: nothing to promote
+	if n, err := service.PromoteWaitlist(ctx, "1"); err != nil || n != 0 {
+		t.Fatalf("expected no promotion while full, got %d (err %v)", n, err)
+	}
+
+	if err := service.RemoveMember(ctx, "1", "10"); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	if n, err := service.PromoteWaitlist(ctx, "1"); err != nil || n != 1 {
+		t.Fatalf("expected one promotion, got %d (err %v)", n, err)
+	}
+	if status, _ := rdb.HGet(ctx, "icom:1:member:11", "status").Result(); status != constants.MEMBER_STATUS_ACTIVE {
+		t.Errorf("expected promoted shop to be ACTIVE, got %q", status)
+	}
+	if queued, _ := rdb.ZCard(ctx, "icom:1:waitlist").Result(); queued != 0 {
+		t.Errorf("expected empty waitlist, got %d", queued)
+	}
+}
+
+func TestConcurrentJoinsRespectCapacity(t *testing.T) {
+	rdb := setupTestRedis(t)
+	seedApplicationFixtures(t, rdb, "false", "true")
+	ctx := context.Background()
+	rdb.HSet(ctx, "icom:1", "maxMembers", 3)
+	service := NewMemberService()
+
+	var shopIDs []string
+	for i := 20; i < 30; i++ {
+		id := fmt.Sprint(i)
+		rdb.HSet(ctx, "ishop:"+id, "id", id, "name", "Shop "+id, "industry", "fnb", "province", "HCM")
+		shopIDs = append(shopIDs, id)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(shopIDs))
+	for i, id := range shopIDs {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			_, errs[i] = service.AddMember(ctx, "1", models.AddMemberRequest{ShopID: id})
+		}(i, id)
+	}
+	wg.Wait()
+
+	joined := 0
+	for i, err := range errs {
+		var ruleErr *MembershipRuleError
+		switch {
+		case err == nil:
+			joined++
+		case errors.As(err, &ruleErr) && ruleErr.capacityOnly():
+		default:
+			t.Errorf("AddMember(%s): %v", shopIDs[i], err)
+		}
+	}
+	occupied, _ := occupiedSeats(ctx, rdb, "1")
+	if joined != 3 || occupied != 3 {
+		t.Fatalf("expected 3 seats taken, got %d joined and %d occupied", joined, occupied)
+	}
+}
+
+func TestConcurrentJoinsKeepEveryICom(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	rdb.HSet(ctx, "ishop:20", "id", "20", "name", "Shop 20")
+	service := NewMemberService()
+
+	icomIDs := []string{"1", "2", "3", "4", "5"}
+	var wg sync.WaitGroup
+	for _, icomID := range icomIDs {
+		rdb.HSet(ctx, "icom:"+icomID, "id", icomID, "name", "iCom "+icomID)
+		wg.Add(1)
+		go func(icomID string) {
+			defer wg.Done()
+			if _, err := service.AddMember(ctx, icomID, models.AddMemberRequest{ShopID: "20"}); err != nil {
+				t.Errorf("AddMember(%s): %v", icomID, err)
+			}
+		}(icomID)
+	}
+	wg.Wait()
+
+	icoms := strings.Fields(rdb.HGet(ctx, "ishop:20", "icoms").Val())
+	if len(icoms) != len(icomIDs) {
+		t.Fatalf("icoms TAG = %v, want all of %v", icoms, icomIDs)
+	}
+}
+
+func TestViolationReport(t *testing.T) {
+	rdb := setupTestRedis(t)
+	seedApplicationFixtures(t, rdb, "false", "true")
+	ctx := context.Background()
+	service := NewMemberService()
+
+	for _, shopID := range []string{"10", "11"} {
+		if _, err := service.Apply(ctx, "1", models.ApplyMembershipRequest{ShopID: shopID}); err != nil {
+			t.Fatalf("Apply(%s): %v", shopID, err)
+		}
+	}
+	rdb.HSet(ctx, "ishop:11", "industry", "spa")
+
+	// Tighten the rules after both shops joined
+	rdb.HSet(ctx, "icom:1", "maxMembers", 1, "allowedIndustries", `["fnb"]`)
+
+	report, err := service.ViolationReport(ctx, "1")
+	if err != nil {
+		t.Fatalf("ViolationReport: %v", err)
+	}
+	if report.OccupiedSeats != 2 || report.OverCapacity != 1 {
+		t.Errorf("expected 2 seats and 1 over capacity, got %d and %d", report.OccupiedSeats, report.OverCapacity)
+	}
+	if len(report.Members) != 1 || report.Members[0].ShopID != "11" || len(report.Members[0].Violations) != 2 {
+		t.Errorf("expected shop 11 with industry and capacity violations, got %+v", report.Members)
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"i-manage/internal/models"
+)
+
+// ErrNotificationChannel is returned for a notification channel that is not registered
+var ErrNotificationChannel = errors.New("unknown notification channel")
+
+// InboxChannelName is the name of the built-in channel that delivers to the
+// in-app inbox of a shop
+const InboxChannelName = "inbox"
+
+// NotificationChannel delivers notifications to shops through one medium,
+// such as the in-app inbox, email or push. The NotificationService is the
+// inbox channel.
+type NotificationChannel interface {
+	// Name identifies the channel in requests
+	Name() string
+	// Notify delivers a notification to a shop. n.ID stays the same when a
+	// delivery is retried.
+	Notify(ctx context.Context, shopID string, n models.Notification) error
+}
+
+var (
+	notificationChannelsMu sync.RWMutex
+	notificationChannels   = make(map[string]NotificationChannel)
+)
+
+// RegisterNotificationChannel makes a notification channel available to
+// announcements
+func RegisterNotificationChannel(ch NotificationChannel) {
+	notificationChannelsMu.Lock()
+	defer notificationChannelsMu.Unlock()
+	notificationChannels[ch.Name()] = ch
+}
+
+func notificationChannel(name string) (NotificationChannel, error) {
+	if name == InboxChannelName {
+		return NewNotificationService(), nil
+	}
+	notificationChannelsMu.RLock()
+	defer notificationChannelsMu.RUnlock()
+	if ch, ok := notificationChannels[name]; ok {
+		return ch, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotificationChannel, name)
+}
+
+// Name implements NotificationChannel
+func (s *NotificationService) Name() string { return InboxChannelName }
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/models"
+)
+
+// notificationInboxSize is how many notifications a shop's inbox keeps
+const notificationInboxSize = 200
+
+// NotificationService delivers notifications to shop inboxes
+type NotificationService struct {
+	rdb *redis.Client
+}
+
+// NewNotificationService creates a new notification service
+func NewNotificationService() *NotificationService {
+	return &NotificationService{
+		rdb: database.Rdb,
+	}
+}
+
+func notificationInboxKey(shopID string) string {
+	return fmt.Sprintf("ishop:%s:notifications", shopID)
+}
+
+// Notify adds a notification to a shop's inbox
+func (s *NotificationService) Notify(ctx context.Context, shopID string, n models.Notification) error {
+	if n.ID == "" {
+		n.ID = fmt.Sprintf("ntf_%d", time.Now().UnixNano())
+	}
+	if n.Created == "" {
+		n.Created = time.Now().Format(time.RFC3339)
+	}
+	raw, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	key := notificationInboxKey(shopID)
+	pipe := s.rdb.TxPipeline()
+	pipe.LPush(ctx, key, raw)
+	pipe.LTrim(ctx, key, 0, notificationInboxSize-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// ListNotifications returns a page of a shop's inbox, newest first
+func (s *NotificationService) ListNotifications(ctx context.Context, shopID string, page, limit int) (*models.NotificationListResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	start := int64((page - 1) * limit)
+	stop := int64(page*limit - 1)
+
+	key := notificationInboxKey(shopID)
+	pipe := s.rdb.Pipeline()
+	rangeCmd := pipe.LRange(ctx, key, start, stop)
+	totalCmd := pipe.LLen(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	notifications := make([]models.Notification, 0, len(rangeCmd.Val()))
+	for _, raw := range rangeCmd.Val() {
+		var n models.Notification
+		if err := json.Unmarshal([]byte(raw), &n); err != nil {
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+
+	return &models.NotificationListResponse{
+		Notifications: notifications,
+		Total:         int(totalCmd.Val()),
+		Page:          page,
+		Limit:         limit,
+	}, nil
+}
+
+// HandleEvent notifies shops about decisions that concern them. It is the
+// handler of the "notifications" event subscriber.
+func (s *NotificationService) HandleEvent(ctx context.Context, evt events.Event) error {
+	n := models.Notification{
+		// Derived from the event so a redelivered event is recognisable
+		ID:     "ntf_" + evt.ID,
+		IComID: evt.IComID,
+	}
+
+	switch evt.Type {
+	case events.MemberApproved, events.MemberRejected:
+		var d events.MemberDecisionData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		icomName := s.icomName(ctx, evt.IComID)
+		if evt.Type == events.MemberApproved {
+			n.Type = models.NotificationApplicationApproved
+			n.Title = fmt.Sprintf("Welcome to %s", icomName)
+			n.Body = fmt.Sprintf("Your application to join %s has been approved.", icomName)
+		} else {
+			n.Type = models.NotificationApplicationRejected
+			n.Title = fmt.Sprintf("Application to %s declined", icomName)
+			n.Body = fmt.Sprintf("Your application to join %s was not approved.", icomName)
+		}
+		if d.Reason != "" {
+			n.Body += " Reason: " + d.Reason
+		}
+	case events.MembershipExpiring:
+		var d events.MembershipExpiringData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		icomName := s.icomName(ctx, evt.IComID)
+		n.Type = models.NotificationMembershipExpiring
+		n.Title = fmt.Sprintf("Your membership of %s ends in %d days", icomName, d.DaysLeft)
+		if d.DaysLeft == 1 {
+			n.Title = fmt.Sprintf("Your membership of %s ends tomorrow", icomName)
+		}
+		if d.AutoRenew {
+			n.Body = fmt.Sprintf("Your membership of %s renews automatically on %s.", icomName, notificationDate(d.ExpiresAt))
+		} else {
+			n.Body = fmt.Sprintf("Your membership of %s expires on %s. Renew it to stay an active member.", icomName, notificationDate(d.ExpiresAt))
+		}
+	case events.MemberRenewed:
+		var d events.MemberRenewedData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		icomName := s.icomName(ctx, evt.IComID)
+		n.Type = models.NotificationMembershipRenewed
+		n.Title = fmt.Sprintf("Membership of %s renewed", icomName)
+		n.Body = fmt.Sprintf("Your membership of %s now runs until %s.", icomName, notificationDate(d.NewExpiresAt))
+	case events.MemberStatusChanged:
+		var d events.MemberStatusChangedData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		if d.NewStatus != constants.MEMBER_STATUS_EXPIRED {
+			return nil
+		}
+		icomName := s.icomName(ctx, evt.IComID)
+		n.Type = models.NotificationMembershipExpired
+		n.Title = fmt.Sprintf("Membership of %s expired", icomName)
+		n.Body = fmt.Sprintf("Your membership of %s has expired. Renew it to become an active member again.", icomName)
+	case events.RSVPPromoted:
+		var d events.RSVPData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		// Visitors have no inbox
+		if evt.ShopID == "" {
+			return nil
+		}
+		event, err := s.rdb.HMGet(ctx, calendarEventKey(evt.IComID, d.EventID), "title", "startsAt").Result()
+		if err != nil {
+			return err
+		}
+		values := stringValues(event, 2)
+		n.Type = models.NotificationEventSeatConfirmed
+		n.Title = fmt.Sprintf("You have a seat at %s", values[0])
+		n.Body = fmt.Sprintf("A seat freed up and you are now going to %s on %s.", values[0], notificationDate(values[1]))
+	default:
+		return nil
+	}
+	return s.Notify(ctx, evt.ShopID, n)
+}
+
+// icomName returns the name of an iCom, or its ID when it has none
+func (s *NotificationService) icomName(ctx context.Context, icomID string) string {
+	name, _ := s.rdb.HGet(ctx, fmt.Sprintf("icom:%s", icomID), "name").Result()
+	if name == "" {
+		return icomID
+	}
+	return name
+}
+
+// notificationDate formats an RFC3339 date for a notification
+func notificationDate(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return t.In(statsLocation()).Format("02/01/2006")
+}
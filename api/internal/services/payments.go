@@ -0,0 +1,362 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/database"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Payment errors surfaced to handlers
+var (
+	ErrGatewayNotFound  = errors.New("payment provider not found")
+	ErrGatewayCallback  = errors.New("invalid payment callback")
+	ErrCheckoutNotFound = errors.New("checkout not found")
+)
+
+const (
+	// checkoutTTL is how long an unfinished checkout can still be completed
+	checkoutTTL = 7 * 24 * time.Hour
+	// fakeGatewayTolerance is the clock skew accepted on fake gateway callbacks
+	fakeGatewayTolerance = 5 * time.Minute
+)
+
+// PaymentGateway is a payment provider invoices can be paid through
+type PaymentGateway interface {
+	// Name identifies the provider in routes and payment records
+	Name() string
+	// CreateCheckout registers a checkout with the provider and returns the
+	// URL the payer completes it at. The provider reports the outcome by
+	// posting to callbackURL.
+	CreateCheckout(ctx context.Context, checkout models.Checkout, callbackURL string) (string, error)
+	// ParseCallback authenticates a callback and decodes the outcome
+	ParseCallback(header http.Header, body []byte) (*models.GatewayCallback, error)
+}
+
+var (
+	gatewaysMu sync.RWMutex
+	gateways   = make(map[string]PaymentGateway)
+)
+
+// RegisterPaymentGateway makes a payment provider available to checkouts
+func RegisterPaymentGateway(g PaymentGateway) {
+	gatewaysMu.Lock()
+	defer gatewaysMu.Unlock()
+	gateways[g.Name()] = g
+}
+
+func paymentGateway(name string) (PaymentGateway, error) {
+	gatewaysMu.RLock()
+	defer gatewaysMu.RUnlock()
+	if g, ok := gateways[name]; ok {
+		return g, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrGatewayNotFound, name)
+}
+
+// paymentBaseURL is where payment providers reach this API. PAYMENT_BASE_URL
+// overrides the local address, e.g. https://api.example.com
+func paymentBaseURL() string {
+	if base := os.Getenv("PAYMENT_BASE_URL"); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	port := os.Getenv("APP_PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port
+}
+
+func checkoutKey(id string) string { return fmt.Sprintf("checkout:%s", id) }
+
+// CreateCheckout starts paying what is left on an invoice through a payment provider
+func (s *DuesService) CreateCheckout(ctx context.Context, icomID, invoiceID, provider string) (*models.Checkout, error) {
+	gateway, err := paymentGateway(provider)
+	if err != nil {
+		return nil, err
+	}
+	invoice, err := s.GetInvoice(ctx, icomID, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if settled(invoice) {
+		return nil, ErrInvoiceSettled
+	}
+
+	now := time.Now()
+	checkout := models.Checkout{
+		ID:        fmt.Sprintf("chk_%d", now.UnixNano()),
+		IComID:    icomID,
+		InvoiceID: invoiceID,
+		Provider:  provider,
+		Amount:    invoice.Amount - invoice.PaidAmount,
+		Currency:  invoice.Currency,
+		Status:    models.CheckoutStatusPending,
+		Created:   now.UTC().Format(time.RFC3339),
+		Modified:  now.UTC().Format(time.RFC3339),
+	}
+	callbackURL := paymentBaseURL() + "/api/v1/payments/callback/" + provider
+	if checkout.PayURL, err = gateway.CreateCheckout(ctx, checkout, callbackURL); err != nil {
+		return nil, err
+	}
+
+	fields, err := hashcodec.Marshal(checkout)
+	if err != nil {
+		return nil, err
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, checkoutKey(checkout.ID), fields)
+	pipe.Expire(ctx, checkoutKey(checkout.ID), checkoutTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+// errCheckoutSettled aborts settling a checkout that another callback
+// settled first
+var errCheckoutSettled = errors.New("checkout already settled")
+
+// HandlePaymentCallback applies the outcome a payment provider reported for a
+// checkout. A successful checkout is settled in the same transaction that
+// records its payment, so a crash leaves either both or neither and the
+// provider's retry completes it. Callbacks for a checkout that was already
+// completed are ignored.
+func (s *DuesService) HandlePaymentCallback(ctx context.Context, provider string, header http.Header, body []byte) error {
+	gateway, err := paymentGateway(provider)
+	if err != nil {
+		return err
+	}
+	callback, err := gateway.ParseCallback(header, body)
+	if err != nil {
+		return err
+	}
+	if callback.Status != models.CheckoutStatusSucceeded && callback.Status != models.CheckoutStatusFailed {
+		return fmt.Errorf("%w: unknown status %q", ErrGatewayCallback, callback.Status)
+	}
+
+	checkout, err := s.GetCheckout(ctx, callback.CheckoutID)
+	if err != nil {
+		return err
+	}
+	if checkout.Provider != provider {
+		return ErrCheckoutNotFound
+	}
+	if checkout.Status != models.CheckoutStatusPending {
+		return nil
+	}
+	if callback.Status == models.CheckoutStatusSucceeded && callback.Amount != checkout.Amount {
+		return fmt.Errorf("%w: paid %d, expected %d", ErrGatewayCallback, callback.Amount, checkout.Amount)
+	}
+
+	// Concurrent callbacks: only the one that finds the checkout pending
+	// inside its transaction settles it
+	key := checkoutKey(checkout.ID)
+	pending := &invoiceGuard{key: key, check: func(tx *redis.Tx) error {
+		status, err := tx.HGet(ctx, key, "status").Result()
+		if err == redis.Nil {
+			return ErrCheckoutNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if status != models.CheckoutStatusPending {
+			return errCheckoutSettled
+		}
+		return nil
+	}}
+	now := time.Now().UTC().Format(time.RFC3339)
+	settle := func(pipe redis.Pipeliner) {
+		pipe.HSet(ctx, key,
+			"status", callback.Status,
+			"reference", callback.Reference,
+			"modified", now,
+		)
+	}
+
+	if callback.Status == models.CheckoutStatusFailed {
+		return s.settleCheckout(ctx, pending, settle)
+	}
+	_, err = s.applyPaymentGuarded(ctx, checkout.IComID, models.Payment{
+		ID:         fmt.Sprintf("pay_%d", time.Now().UnixNano()),
+		InvoiceID:  checkout.InvoiceID,
+		Amount:     callback.Amount,
+		Method:     models.PaymentMethodGateway,
+		Provider:   provider,
+		Reference:  callback.Reference,
+		PaidAt:     now,
+		RecordedAt: now,
+	}, pending, settle)
+	switch {
+	case errors.Is(err, errCheckoutSettled):
+		return nil
+	case errors.Is(err, ErrInvoiceSettled), errors.Is(err, ErrPaymentAmount):
+		// Paid another way in the meantime; the money has to be refunded by hand
+		log.Printf("payments: checkout %s of invoice %s paid after the invoice was settled: %v", checkout.ID, checkout.InvoiceID, err)
+		return s.settleCheckout(ctx, pending, settle)
+	}
+	return err
+}
+
+// settleCheckout marks a checkout as completed without recording a payment
+func (s *DuesService) settleCheckout(ctx context.Context, pending *invoiceGuard, settle func(redis.Pipeliner)) error {
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		if err := pending.check(tx); err != nil {
+			return err
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			settle(pipe)
+			return nil
+		})
+		return err
+	}, pending.key)
+	if errors.Is(err, errCheckoutSettled) {
+		return nil
+	}
+	return err
+}
+
+// GetCheckout returns a checkout
+func (s *DuesService) GetCheckout(ctx context.Context, checkoutID string) (*models.Checkout, error) {
+	data, err := s.rdb.HGetAll(ctx, checkoutKey(checkoutID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var checkout models.Checkout
+	if len(data) == 0 || hashcodec.Unmarshal(data, &checkout) != nil {
+		return nil, ErrCheckoutNotFound
+	}
+	return &checkout, nil
+}
+
+// FakeGatewayName is the provider name of the local fake gateway
+const FakeGatewayName = "fake"
+
+// FakeGateway is a local stand-in for a payment provider, for development
+// and tests. A checkout is paid by completing it (see CompleteFakeCheckout),
+// which posts a signed callback the way a real provider would.
+type FakeGateway struct {
+	rdb    *redis.Client
+	client *http.Client
+	secret string
+}
+
+// NewFakeGateway creates the fake gateway. Callbacks are signed with secret,
+// or with a random one when it is empty.
+func NewFakeGateway(secret string) *FakeGateway {
+	if secret == "" {
+		secret = generateWebhookSecret()
+	}
+	return &FakeGateway{
+		rdb:    database.Rdb,
+		client: &http.Client{Timeout: webhookTimeout},
+		secret: secret,
+	}
+}
+
+func fakeCheckoutKey(id string) string { return fmt.Sprintf("fakegw:checkout:%s", id) }
+
+// Name implements PaymentGateway
+func (g *FakeGateway) Name() string { return FakeGatewayName }
+
+// CreateCheckout implements PaymentGateway
+func (g *FakeGateway) CreateCheckout(ctx context.Context, checkout models.Checkout, callbackURL string) (string, error) {
+	key := fakeCheckoutKey(checkout.ID)
+	pipe := g.rdb.TxPipeline()
+	pipe.HSet(ctx, key, "amount", checkout.Amount, "currency", checkout.Currency, "callbackUrl", callbackURL)
+	pipe.Expire(ctx, key, checkoutTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return paymentBaseURL() + "/api/v1/payments/fake/" + checkout.ID, nil
+}
+
+// Complete pays (or fails) a fake checkout and posts the callback
+func (g *FakeGateway) Complete(ctx context.Context, checkoutID string, succeed bool) error {
+	data, err := g.rdb.HGetAll(ctx, fakeCheckoutKey(checkoutID)).Result()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return ErrCheckoutNotFound
+	}
+	callback := models.GatewayCallback{
+		CheckoutID: checkoutID,
+		Reference:  fmt.Sprintf("fake_%d", time.Now().UnixNano()),
+		Status:     models.CheckoutStatusFailed,
+	}
+	if succeed {
+		callback.Status = models.CheckoutStatusSucceeded
+		callback.Amount, _ = strconv.ParseInt(data["amount"], 10, 64)
+	}
+	body, err := json.Marshal(callback)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, data["callbackUrl"], bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Fake-Timestamp", timestamp)
+	req.Header.Set("X-Fake-Signature", SignWebhookPayload(g.secret, timestamp, body))
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("payment callback answered %s", resp.Status)
+	}
+	return nil
+}
+
+// ParseCallback implements PaymentGateway
+func (g *FakeGateway) ParseCallback(header http.Header, body []byte) (*models.GatewayCallback, error) {
+	timestamp := header.Get("X-Fake-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing timestamp", ErrGatewayCallback)
+	}
+	if skew := time.Since(time.Unix(sent, 0)); skew > fakeGatewayTolerance || skew < -fakeGatewayTolerance {
+		return nil, fmt.Errorf("%w: stale timestamp", ErrGatewayCallback)
+	}
+	expected := SignWebhookPayload(g.secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Fake-Signature"))) {
+		return nil, fmt.Errorf("%w: bad signature", ErrGatewayCallback)
+	}
+	var callback models.GatewayCallback
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGatewayCallback, err)
+	}
+	return &callback, nil
+}
+
+// CompleteFakeCheckout completes a checkout of the fake gateway, when it is enabled
+func CompleteFakeCheckout(ctx context.Context, checkoutID string, succeed bool) error {
+	gateway, err := paymentGateway(FakeGatewayName)
+	if err != nil {
+		return err
+	}
+	fake, ok := gateway.(*FakeGateway)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrGatewayNotFound, FakeGatewayName)
+	}
+	return fake.Complete(ctx, checkoutID, succeed)
+}
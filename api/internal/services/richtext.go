@@ -0,0 +1,168 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// richTextTags lists the elements rich text may use, with the attributes
+// kept on each
+var richTextTags = map[string][]string{
+	"p": nil, "br": nil, "hr": nil,
+	"b": nil, "strong": nil, "i": nil, "em": nil, "u": nil, "s": nil,
+	"h2": nil, "h3": nil, "h4": nil,
+	"blockquote": nil, "pre": nil, "code": nil,
+	"ul": nil, "ol": nil, "li": nil,
+	"a":   {"href", "title"},
+	"img": {"src", "alt"},
+}
+
+// richTextDropped lists the elements dropped together with their content
+var richTextDropped = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true,
+	"noscript": true, "template": true, "textarea": true, "select": true, "title": true,
+}
+
+// richTextVoid lists the allowed elements that have no end tag
+var richTextVoid = map[string]bool{"br": true, "hr": true, "img": true}
+
+// richTextBlock lists the allowed elements that break lines
+var richTextBlock = map[string]bool{
+	"p": true, "br": true, "hr": true, "h2": true, "h3": true, "h4": true,
+	"blockquote": true, "pre": true, "ul": true, "ol": true, "li": true,
+}
+
+// richTextURL reports whether a link or image URL is safe to keep: absolute
+// http(s), or mailto for links
+func richTextURL(value string, mailto bool) bool {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return mailto
+	}
+	return false
+}
+
+// sanitizeRichText keeps the allowed elements and attributes of an HTML
+// fragment and drops the rest, keeping their text. Elements left open are
+// closed so the fragment can be embedded in a page or feed as is.
+func sanitizeRichText(body string) string {
+	var b strings.Builder
+	var open []string
+	skip := 0 // depth inside dropped elements
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		tok := z.Token()
+		switch tt {
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(html.EscapeString(tok.Data))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if richTextDropped[tok.Data] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			attrs, ok := richTextTags[tok.Data]
+			if !ok || skip > 0 {
+				continue
+			}
+			// A new list item or paragraph ends the previous one
+			if (tok.Data == "li" || tok.Data == "p") && len(open) > 0 && open[len(open)-1] == tok.Data {
+				b.WriteString("</" + tok.Data + ">")
+				open = open[:len(open)-1]
+			}
+			b.WriteString("<" + tok.Data)
+			for _, attr := range tok.Attr {
+				if attr.Namespace != "" || !containsString(attrs, attr.Key) {
+					continue
+				}
+				if (attr.Key == "href" && !richTextURL(attr.Val, true)) || (attr.Key == "src" && !richTextURL(attr.Val, false)) {
+					continue
+				}
+				b.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+			}
+			if tok.Data == "a" {
+				b.WriteString(` rel="nofollow noopener noreferrer"`)
+			}
+			b.WriteString(">")
+			if !richTextVoid[tok.Data] {
+				open = append(open, tok.Data)
+			}
+		case html.EndTagToken:
+			if richTextDropped[tok.Data] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			// Close the elements opened since the matching start tag; stray
+			// end tags are dropped
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != tok.Data {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
+
+// richTextExcerpt returns the text of a sanitized HTML fragment with
+// whitespace collapsed, cut to at most n characters
+func richTextExcerpt(body string, n int) string {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		switch tt {
+		case html.TextToken:
+			b.Write(z.Text())
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			// Block elements separate words, inline ones do not
+			if name, _ := z.TagName(); richTextBlock[string(name)] {
+				b.WriteByte(' ')
+			}
+		}
+	}
+	text := strings.Join(strings.Fields(b.String()), " ")
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+// richTextEmpty reports whether a sanitized HTML fragment shows nothing:
+// no text and no image
+func richTextEmpty(body string) bool {
+	return richTextExcerpt(body, 1) == "" && !strings.Contains(body, "<img")
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/database"
+	"i-manage/internal/models"
+)
+
+// roundTripCounter is a go-redis hook that counts network round-trips:
+// every single command and every pipeline counts as one.
+type roundTripCounter struct {
+	n atomic.Int64
+}
+
+func (h *roundTripCounter) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *roundTripCounter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.n.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *roundTripCounter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.n.Add(1)
+		return next(ctx, cmds)
+	}
+}
+
+var benchPageSizes = []int{20, 50, 100}
+
+const (
+	benchIComID      = "2000100101"
+	benchMultiShopID = "1000100109999"
+)
+
+// setupBenchRedis starts an in-memory Redis, points database.Rdb at it and
+// seeds one iCom with the given number of member shops.
+func setupBenchRedis(b *testing.B, members int) *roundTripCounter {
+	b.Helper()
+
+	mr := miniredis.RunT(b)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), Protocol: 2})
+	b.Cleanup(func() { rdb.Close() })
+
+	counter := &roundTripCounter{}
+	rdb.AddHook(counter)
+
+	prev := database.Rdb
+	database.Rdb = rdb
+	b.Cleanup(func() { database.Rdb = prev })
+
+	ctx := context.Background()
+	pipe := rdb.Pipeline()
+	pipe.HSet(ctx, "icom:"+benchIComID, "id", benchIComID, "name", "Bench iCom", "logo", "logo.png", "maxMembers", 500)
+	pipe.ZAdd(ctx, "icoms:all", redis.Z{Score: 1, Member: benchIComID})
+
+	for i := 0; i < members; i++ {
+		shopID := fmt.Sprintf("10001001%04d", i)
+		lat := 10.7 + float64(i)*0.0001
+		lng := 106.6 + float64(i)*0.0001
+
+		pipe.HSet(ctx, "ishop:"+shopID, map[string]interface{}{
+			"id": shopID, "name": fmt.Sprintf("Shop %d", i), "logo": "shop.png",
+			"industry": "fnb", "subIndustry": "cafe", "province": "HCM",
+			"district": "Q1", "ward": "Ben Nghe", "lat": lat, "lng": lng,
+			"icoms": benchIComID,
+		})
+		pipe.ZAdd(ctx, "icom:"+benchIComID+":members", redis.Z{Score: float64(i), Member: shopID})
+		pipe.HSet(ctx, fmt.Sprintf("icom:%s:member:%s", benchIComID, shopID), map[string]interface{}{
+			"shopId": shopID, "icomId": benchIComID, "rank": "MEMBER", "status": "ACTIVE",
+			"joinedDate": "2026-01-01T00:00:00Z",
+		})
+		pipe.SAdd(ctx, "icom:"+benchIComID+":status:ACTIVE", shopID)
+		pipe.GeoAdd(ctx, "icom:"+benchIComID+":geo", &redis.GeoLocation{Name: shopID, Latitude: lat, Longitude: lng})
+		pipe.ZAdd(ctx, "icom:"+benchIComID+":rank:interactions", redis.Z{Score: float64(members - i), Member: shopID})
+		pipe.ZAdd(ctx, "ishop:"+shopID+":icoms", redis.Z{Score: 1, Member: benchIComID})
+
+		boardID := fmt.Sprintf("board_%d", i)
+		pipe.RPush(ctx, "icom:"+benchIComID+":board", boardID)
+		pipe.HSet(ctx, fmt.Sprintf("icom:%s:board:%s", benchIComID, boardID), "memberId", boardID, "name", "Board", "role", "member")
+
+		actionID := fmt.Sprintf("action_%d", i)
+		pipe.RPush(ctx, "icom:"+benchIComID+":actions", actionID)
+		pipe.HSet(ctx, fmt.Sprintf("icom:%s:action:%s", benchIComID, actionID), "actionId", actionID, "type", "url", "title", "Go", "url", "https://example.com", "order", i)
+	}
+
+	// A shop that belongs to many iComs, for GetMemberships
+	for i := 0; i < members; i++ {
+		icomID := fmt.Sprintf("2000100109%04d", i)
+		pipe.HSet(ctx, "icom:"+icomID, "id", icomID, "name", "Other iCom", "logo", "logo.png")
+		pipe.HSet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, benchMultiShopID), "rank", "MEMBER", "status", "ACTIVE")
+		pipe.ZAdd(ctx, "ishop:"+benchMultiShopID+":icoms", redis.Z{Score: float64(i), Member: icomID})
+		pipe.ZAdd(ctx, "icoms:all", redis.Z{Score: float64(i + 2), Member: icomID})
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		b.Fatalf("seed failed: %v", err)
+	}
+
+	counter.n.Store(0)
+	return counter
+}
+
+// runRoundTripBench runs fn for every page size and reports round-trips per call
+func runRoundTripBench(b *testing.B, fn func(ctx context.Context, limit int) error) {
+	for _, size := range benchPageSizes {
+		b.Run(fmt.Sprintf("page=%d", size), func(b *testing.B) {
+			counter := setupBenchRedis(b, size)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := fn(ctx, size); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(counter.n.Load())/float64(b.N), "roundtrips/op")
+		})
+	}
+}
+
+func BenchmarkListMembers(b *testing.B) {
+	runRoundTripBench(b, func(ctx context.Context, limit int) error {
+		res, err := NewMemberService().ListMembers(ctx, benchIComID, 1, limit)
+		if err == nil && len(res.Members) != limit {
+			err = fmt.Errorf("got %d members, want %d", len(res.Members), limit)
+		}
+		return err
+	})
+}
+
+func BenchmarkFilterMembers(b *testing.B) {
+	runRoundTripBench(b, func(ctx context.Context, limit int) error {
+		res, err := NewMemberService().FilterMembers(ctx, benchIComID, models.FilterMembersRequest{
+			Status: "ACTIVE",
+			Page:   1,
+			Limit:  limit,
+		})
+		if err == nil && len(res.Members) != limit {
+			err = fmt.Errorf("got %d members, want %d", len(res.Members), limit)
+		}
+		return err
+	})
+}
+
+func BenchmarkGeoSearch(b *testing.B) {
+	runRoundTripBench(b, func(ctx context.Context, limit int) error {
+		res, err := NewMemberService().GeoSearch(ctx, benchIComID, models.GeoSearchRequest{
+			Lat: 10.7, Lng: 106.6, Radius: 50,
+		})
+		if err == nil && len(res) != limit {
+			err = fmt.Errorf("got %d members, want %d", len(res), limit)
+		}
+		return err
+	})
+}
+
+func BenchmarkGetBoardMembers(b *testing.B) {
+	runRoundTripBench(b, func(ctx context.Context, limit int) error {
+		res, err := NewIComService().GetBoardMembers(ctx, benchIComID)
+		if err == nil && len(res) != limit {
+			err = fmt.Errorf("got %d board members, want %d", len(res), limit)
+		}
+		return err
+	})
+}
+
+func BenchmarkGetActions(b *testing.B) {
+	runRoundTripBench(b, func(ctx context.Context, limit int) error {
+		res, err := NewIComService().GetActions(ctx, benchIComID)
+		if err == nil && len(res) != limit {
+			err = fmt.Errorf("got %d actions, want %d", len(res), limit)
+		}
+		return err
+	})
+}
+
+func BenchmarkGetLeaderboard(b *testing.B) {
+	runRoundTripBench(b, func(ctx context.Context, limit int) error {
+		res, err := NewIComService().GetLeaderboard(ctx, benchIComID, "interactions", "", limit)
+		if err == nil && len(res) != limit {
+			err = fmt.Errorf("got %d entries, want %d", len(res), limit)
+		}
+		return err
+	})
+}
+
+func BenchmarkListIComs(b *testing.B) {
+	runRoundTripBench(b, func(ctx context.Context, limit int) error {
+		res, err := NewIComService().ListIComs(ctx, 1, limit)
+		if err == nil && len(res.IComs) != limit {
+			err = fmt.Errorf("got %d iComs, want %d", len(res.IComs), limit)
+		}
+		return err
+	})
+}
+
+func BenchmarkGetMemberships(b *testing.B) {
+	runRoundTripBench(b, func(ctx context.Context, limit int) error {
+		res, err := NewIShopService().GetMemberships(ctx, benchMultiShopID)
+		if err == nil && len(res) != limit {
+			err = fmt.Errorf("got %d memberships, want %d", len(res), limit)
+		}
+		return err
+	})
+}
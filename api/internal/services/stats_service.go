@@ -0,0 +1,442 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/models"
+)
+
+// Statistics errors surfaced to handlers
+var (
+	ErrStatsInterval = errors.New("interval must be day, week or month")
+	ErrStatsMetric   = errors.New("unknown metric")
+	ErrStatsRange    = errors.New("invalid date range")
+)
+
+// statsMaxPoints bounds the number of periods in one time series
+const statsMaxPoints = 400
+
+// statsDedupeTTL is how long an applied event is remembered, which covers
+// redelivery of events that failed to be acknowledged
+const statsDedupeTTL = 48 * time.Hour
+
+// statsIntervals lists the granularities counters are kept at
+var statsIntervals = []string{models.StatsIntervalDay, models.StatsIntervalWeek, models.StatsIntervalMonth}
+
+// StatsService maintains and reads iCom statistics. Time series are kept as
+// per-period counters updated from domain events by the "stats" subscriber:
+//
+//	icom:<id>:stats:<metric>:<interval>  hash of period label -> count
+type StatsService struct {
+	rdb *redis.Client
+	loc *time.Location
+}
+
+var (
+	statsLocOnce sync.Once
+	statsLoc     *time.Location
+)
+
+// statsLocation returns the time zone statistics and leaderboard periods
+// follow: STATS_TIMEZONE, default Asia/Ho_Chi_Minh
+func statsLocation() *time.Location {
+	statsLocOnce.Do(func() {
+		name := os.Getenv("STATS_TIMEZONE")
+		if name == "" {
+			name = "Asia/Ho_Chi_Minh"
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			loc = time.UTC
+		}
+		statsLoc = loc
+	})
+	return statsLoc
+}
+
+// NewStatsService creates a new statistics service
+func NewStatsService() *StatsService {
+	return &StatsService{
+		rdb: database.Rdb,
+		loc: statsLocation(),
+	}
+}
+
+func statsKey(icomID, metric, interval string) string {
+	return fmt.Sprintf("icom:%s:stats:%s:%s", icomID, metric, interval)
+}
+
+// periodStart returns the first instant of the period containing t
+func periodStart(interval string, t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch interval {
+	case models.StatsIntervalWeek:
+		// ISO weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, t.Location())
+	case models.StatsIntervalMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// nextPeriod returns the start of the period following the one starting at start
+func nextPeriod(interval string, start time.Time) time.Time {
+	switch interval {
+	case models.StatsIntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case models.StatsIntervalMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// periodLabel names the period containing t
+func periodLabel(interval string, t time.Time) string {
+	switch interval {
+	case models.StatsIntervalWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case models.StatsIntervalMonth:
+		return t.Format("2006-01")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// eventMetric returns the metric an event counts towards and by how much
+func eventMetric(evt events.Event) (string, int64, error) {
+	switch evt.Type {
+	case events.MemberAdded:
+		var d events.MemberAddedData
+		if err := evt.Decode(&d); err != nil {
+			return "", 0, err
+		}
+		if d.Status == constants.MEMBER_STATUS_ACTIVE {
+			return models.StatsMetricJoins, 1, nil
+		}
+	case events.MemberStatusChanged:
+		var d events.MemberStatusChangedData
+		if err := evt.Decode(&d); err != nil {
+			return "", 0, err
+		}
+		// Approval of a pending or waitlisted member; reinstating a suspended
+		// member or renewing an expired one is not a new join
+		if d.NewStatus == constants.MEMBER_STATUS_ACTIVE &&
+			d.OldStatus != constants.MEMBER_STATUS_ACTIVE &&
+			d.OldStatus != constants.MEMBER_STATUS_SUSPENDED &&
+			d.OldStatus != constants.MEMBER_STATUS_EXPIRED {
+			return models.StatsMetricJoins, 1, nil
+		}
+	case events.MemberRemoved:
+		var d events.MemberRemovedData
+		if err := evt.Decode(&d); err != nil {
+			return "", 0, err
+		}
+		if d.Status != constants.MEMBER_STATUS_PENDING {
+			return models.StatsMetricLeaves, 1, nil
+		}
+	case events.ShopLiked:
+		return models.StatsMetricLikes, 1, nil
+	case events.ShopUnliked:
+		return models.StatsMetricLikes, -1, nil
+	case events.InteractionRecorded:
+		return models.StatsMetricInteractions, 1, nil
+	}
+	return "", 0, nil
+}
+
+// HandleEvent updates the time series counters. It is the handler of the
+// "stats" event subscriber; redelivered events are counted once.
+func (s *StatsService) HandleEvent(ctx context.Context, evt events.Event) error {
+	if evt.IComID == "" {
+		return nil
+	}
+	metric, delta, err := eventMetric(evt)
+	if err != nil || metric == "" {
+		return err
+	}
+
+	seenKey := "stats:event:" + evt.ID
+	fresh, err := s.rdb.SetNX(ctx, seenKey, 1, statsDedupeTTL).Result()
+	if err != nil || !fresh {
+		return err
+	}
+
+	at := evt.OccurredAt.In(s.loc)
+	pipe := s.rdb.TxPipeline()
+	for _, interval := range statsIntervals {
+		pipe.HIncrBy(ctx, statsKey(evt.IComID, metric, interval), periodLabel(interval, at), delta)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		// Let the redelivery count it
+		s.rdb.Del(ctx, seenKey)
+		return err
+	}
+	return nil
+}
+
+// TimeSeries returns the requested metrics per period between req.From and
+// req.To. Periods without activity are reported as zero.
+func (s *StatsService) TimeSeries(ctx context.Context, icomID string, req models.StatsTimeSeriesRequest) (*models.StatsTimeSeriesResponse, error) {
+	interval := req.Interval
+	if interval == "" {
+		interval = models.StatsIntervalDay
+	}
+	switch interval {
+	case models.StatsIntervalDay, models.StatsIntervalWeek, models.StatsIntervalMonth:
+	default:
+		return nil, ErrStatsInterval
+	}
+
+	metrics := req.Metrics
+	if len(metrics) == 0 {
+		metrics = models.StatsMetrics
+	}
+	for _, m := range metrics {
+		known := false
+		for _, k := range models.StatsMetrics {
+			known = known || k == m
+		}
+		if !known {
+			return nil, fmt.Errorf("%w %q", ErrStatsMetric, m)
+		}
+	}
+
+	to := time.Now().In(s.loc)
+	if req.To != "" {
+		t, err := time.ParseInLocation("2006-01-02", req.To, s.loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: to must be YYYY-MM-DD", ErrStatsRange)
+		}
+		to = t
+	}
+	var from time.Time
+	if req.From != "" {
+		t, err := time.ParseInLocation("2006-01-02", req.From, s.loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: from must be YYYY-MM-DD", ErrStatsRange)
+		}
+		from = t
+	} else {
+		// Default to the last 30 days, 12 weeks or 12 months
+		switch interval {
+		case models.StatsIntervalWeek:
+			from = to.AddDate(0, 0, -7*11)
+		case models.StatsIntervalMonth:
+			from = to.AddDate(0, -11, 0)
+		default:
+			from = to.AddDate(0, 0, -29)
+		}
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("%w: from is after to", ErrStatsRange)
+	}
+
+	var starts []time.Time
+	var labels []string
+	for p := periodStart(interval, from); !p.After(to); p = nextPeriod(interval, p) {
+		if len(starts) == statsMaxPoints {
+			return nil, fmt.Errorf("%w: more than %d %ss", ErrStatsRange, statsMaxPoints, interval)
+		}
+		starts = append(starts, p)
+		labels = append(labels, periodLabel(interval, p))
+	}
+
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(metrics))
+	for i, m := range metrics {
+		cmds[i] = pipe.HMGet(ctx, statsKey(icomID, m, interval), labels...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	response := &models.StatsTimeSeriesResponse{
+		Interval: interval,
+		From:     from.Format("2006-01-02"),
+		To:       to.Format("2006-01-02"),
+		Timezone: s.loc.String(),
+		Series:   make([]models.StatsSeries, 0, len(metrics)),
+	}
+	for i, m := range metrics {
+		series := models.StatsSeries{Metric: m, Points: make([]models.StatsPoint, len(labels))}
+		for j, raw := range stringValues(cmds[i].Val(), len(labels)) {
+			var v int64
+			fmt.Sscan(raw, &v)
+			series.Points[j] = models.StatsPoint{
+				Period: labels[j],
+				Start:  starts[j].Format("2006-01-02"),
+				Value:  v,
+			}
+			series.Total += v
+		}
+		response.Series = append(response.Series, series)
+	}
+	return response, nil
+}
+
+// memberStatuses lists the statuses a membership can have
+var memberStatuses = []string{
+	constants.MEMBER_STATUS_ACTIVE,
+	constants.MEMBER_STATUS_PENDING,
+	constants.MEMBER_STATUS_SUSPENDED,
+	constants.MEMBER_STATUS_EXPIRED,
+}
+
+// statsLocationsBackfillKey marks that the province and district counts of
+// existing iComs have been built
+const statsLocationsBackfillKey = "icoms:meta:locations:backfilled"
+
+// metaProvincesKey and metaDistrictsKey count an iCom's members by the
+// province and district of their shop. They are maintained together with
+// the other metadata aggregates when shops join, leave or move.
+func metaProvincesKey(icomID string) string { return fmt.Sprintf("icom:%s:meta:provinces", icomID) }
+func metaDistrictsKey(icomID string) string { return fmt.Sprintf("icom:%s:meta:districts", icomID) }
+
+// Breakdown counts the members of an iCom by status, rank, industry,
+// sub-industry, province and district. Status and rank come from the sizes
+// of the membership indexes, the rest from the maintained metadata
+// aggregates, so the cost does not grow with the number of members.
+func (s *StatsService) Breakdown(ctx context.Context, icomID string) (*models.IComStatsResponse, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrIComNotFound
+	}
+	tiers, err := loadTiers(ctx, s.rdb, icomID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.IComStatsResponse{
+		StatusBreakdown:      make(map[string]int),
+		RankBreakdown:        make(map[string]int),
+		IndustryBreakdown:    make(map[string]int),
+		SubIndustryBreakdown: make(map[string]int),
+		ProvinceBreakdown:    make(map[string]int),
+		DistrictBreakdown:    make(map[string]int),
+	}
+
+	pipe := s.rdb.Pipeline()
+	totalCmd := pipe.ZCard(ctx, fmt.Sprintf("icom:%s:members", icomID))
+	statusCmds := make([]*redis.IntCmd, len(memberStatuses))
+	for i, status := range memberStatuses {
+		statusCmds[i] = pipe.SCard(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, status))
+	}
+	rankCmds := make([]*redis.IntCmd, len(tiers))
+	for i, tier := range tiers {
+		rankCmds[i] = pipe.SCard(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, tier.Code))
+	}
+	positive := &redis.ZRangeBy{Min: "(0", Max: "+inf"}
+	industries := pipe.ZRangeByScoreWithScores(ctx, fmt.Sprintf("icom:%s:meta:industries", icomID), positive)
+	subIndustries := pipe.ZRangeByScoreWithScores(ctx, fmt.Sprintf("icom:%s:meta:sub_industries", icomID), positive)
+	provinces := pipe.ZRangeByScoreWithScores(ctx, metaProvincesKey(icomID), positive)
+	districts := pipe.ZRangeByScoreWithScores(ctx, metaDistrictsKey(icomID), positive)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	stats.TotalMembers = int(totalCmd.Val())
+	for i, status := range memberStatuses {
+		if n := statusCmds[i].Val(); n > 0 {
+			stats.StatusBreakdown[status] = int(n)
+		}
+	}
+	for i, tier := range tiers {
+		if n := rankCmds[i].Val(); n > 0 {
+			stats.RankBreakdown[tier.Code] = int(n)
+		}
+	}
+	countScores(stats.IndustryBreakdown, industries.Val())
+	countScores(stats.SubIndustryBreakdown, subIndustries.Val())
+	countScores(stats.ProvinceBreakdown, provinces.Val())
+	countScores(stats.DistrictBreakdown, districts.Val())
+
+	stats.ActiveMembers = stats.StatusBreakdown[constants.MEMBER_STATUS_ACTIVE]
+	stats.PendingMembers = stats.StatusBreakdown[constants.MEMBER_STATUS_PENDING]
+	return stats, nil
+}
+
+func countScores(counts map[string]int, zs []redis.Z) {
+	for _, z := range zs {
+		counts[z.Member.(string)] = int(z.Score)
+	}
+}
+
+// BackfillLocationCounts builds the province and district counts of iComs
+// created before they were maintained. It runs once; later calls are no-ops.
+func (s *StatsService) BackfillLocationCounts(ctx context.Context) (int, error) {
+	done, err := s.rdb.Exists(ctx, statsLocationsBackfillKey).Result()
+	if err != nil || done > 0 {
+		return 0, err
+	}
+
+	built := 0
+	err = forEachICom(ctx, s.rdb, func(icomID string) error {
+		provinces := make(map[string]int)
+		districts := make(map[string]int)
+		membersKey := fmt.Sprintf("icom:%s:members", icomID)
+		for start := int64(0); ; start += exportBatchSize {
+			shopIDs, err := s.rdb.ZRange(ctx, membersKey, start, start+exportBatchSize-1).Result()
+			if err != nil {
+				return err
+			}
+			pipe := s.rdb.Pipeline()
+			shopCmds := make([]*redis.SliceCmd, len(shopIDs))
+			for i, shopID := range shopIDs {
+				shopCmds[i] = pipe.HMGet(ctx, fmt.Sprintf("ishop:%s", shopID), "province", "district")
+			}
+			if len(shopIDs) > 0 {
+				if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+					return err
+				}
+			}
+			for i := range shopIDs {
+				shop := stringValues(shopCmds[i].Val(), 2)
+				countNonEmpty(provinces, shop[0])
+				countNonEmpty(districts, shop[1])
+			}
+			if len(shopIDs) < exportBatchSize {
+				break
+			}
+		}
+
+		pipe := s.rdb.TxPipeline()
+		pipe.Del(ctx, metaProvincesKey(icomID), metaDistrictsKey(icomID))
+		for province, n := range provinces {
+			pipe.ZAdd(ctx, metaProvincesKey(icomID), redis.Z{Score: float64(n), Member: province})
+		}
+		for district, n := range districts {
+			pipe.ZAdd(ctx, metaDistrictsKey(icomID), redis.Z{Score: float64(n), Member: district})
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		built++
+		return nil
+	})
+	if err != nil {
+		return built, err
+	}
+	return built, s.rdb.Set(ctx, statsLocationsBackfillKey, "1", 0).Err()
+}
+
+func countNonEmpty(counts map[string]int, key string) {
+	if key != "" {
+		counts[key]++
+	}
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/events"
+	"i-manage/internal/models"
+)
+
+func TestStatsTimeSeries(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+	service := NewStatsService()
+	service.loc = time.UTC
+
+	at := func(day string) time.Time {
+		d, _ := time.Parse("2006-01-02", day)
+		return d.Add(10 * time.Hour)
+	}
+	record := func(id string, evt events.Event, day string) {
+		t.Helper()
+		evt.ID = id
+		evt.OccurredAt = at(day)
+		if err := service.HandleEvent(ctx, evt); err != nil {
+			t.Fatalf("HandleEvent(%s): %v", id, err)
+		}
+	}
+	record("1-0", events.New(events.MemberAdded, "1", "10", events.MemberAddedData{Status: constants.MEMBER_STATUS_ACTIVE}), "2026-10-05")
+	record("2-0", events.New(events.MemberAdded, "1", "11", events.MemberAddedData{Status: constants.MEMBER_STATUS_PENDING}), "2026-10-05")
+	record("3-0", events.New(events.MemberStatusChanged, "1", "11", events.MemberStatusChangedData{
+		OldStatus: constants.MEMBER_STATUS_PENDING, NewStatus: constants.MEMBER_STATUS_ACTIVE,
+	}), "2026-10-12")
+	record("4-0", events.New(events.MemberStatusChanged, "1", "11", events.MemberStatusChangedData{
+		OldStatus: constants.MEMBER_STATUS_SUSPENDED, NewStatus: constants.MEMBER_STATUS_ACTIVE,
+	}), "2026-10-12")
+	record("5-0", events.New(events.MemberRemoved, "1", "10", events.MemberRemovedData{Status: constants.MEMBER_STATUS_ACTIVE}), "2026-11-02")
+	// Redelivered events are counted once
+	record("5-0", events.New(events.MemberRemoved, "1", "10", events.MemberRemovedData{Status: constants.MEMBER_STATUS_ACTIVE}), "2026-11-02")
+
+	daily, err := service.TimeSeries(ctx, "1", models.StatsTimeSeriesRequest{From: "2026-10-05", To: "2026-10-12"})
+	if err != nil {
+		t.Fatalf("TimeSeries: %v", err)
+	}
+	joins := daily.Series[0]
+	if joins.Metric != models.StatsMetricJoins || len(joins.Points) != 8 || joins.Total != 2 ||
+		joins.Points[0].Value != 1 || joins.Points[7].Value != 1 {
+		t.Errorf("unexpected daily joins %+v", joins)
+	}
+
+	monthly, err := service.TimeSeries(ctx, "1", models.StatsTimeSeriesRequest{
+		From: "2026-10-01", To: "2026-11-30", Interval: models.StatsIntervalMonth,
+		Metrics: []string{models.StatsMetricLeaves},
+	})
+	if err != nil {
+		t.Fatalf("TimeSeries: %v", err)
+	}
+	if leaves := monthly.Series[0]; leaves.Points[0].Value != 0 || leaves.Points[1].Period != "2026-11" || leaves.Points[1].Value != 1 {
+		t.Errorf("unexpected monthly leaves %+v", leaves)
+	}
+
+	weekly, _ := service.TimeSeries(ctx, "1", models.StatsTimeSeriesRequest{From: "2026-10-05", To: "2026-10-18", Interval: models.StatsIntervalWeek})
+	if p := weekly.Series[0].Points; len(p) != 2 || p[0].Period != "2026-W41" || p[0].Start != "2026-10-05" || p[1].Value != 1 {
+		t.Errorf("unexpected weekly joins %+v", p)
+	}
+
+	if _, err := service.TimeSeries(ctx, "1", models.StatsTimeSeriesRequest{Interval: "hour"}); !errors.Is(err, ErrStatsInterval) {
+		t.Errorf("expected ErrStatsInterval, got %v", err)
+	}
+	if _, err := service.TimeSeries(ctx, "1", models.StatsTimeSeriesRequest{From: "2026-10-12", To: "2026-10-01"}); !errors.Is(err, ErrStatsRange) {
+		t.Errorf("expected ErrStatsRange, got %v", err)
+	}
+}
+
+func TestStatsBreakdown(t *testing.T) {
+	rdb := setupTestRedis(t)
+	seedApplicationFixtures(t, rdb, "false", "true")
+	ctx := context.Background()
+	members := NewMemberService()
+	for _, s := range []struct{ id, status string }{{"10", constants.MEMBER_STATUS_ACTIVE}, {"11", constants.MEMBER_STATUS_PENDING}} {
+		if _, err := members.AddMember(ctx, "1", models.AddMemberRequest{ShopID: s.id, Status: s.status}); err != nil {
+			t.Fatalf("AddMember(%s): %v", s.id, err)
+		}
+	}
+
+	stats, err := NewStatsService().Breakdown(ctx, "1")
+	if err != nil {
+		t.Fatalf("Breakdown: %v", err)
+	}
+	if stats.TotalMembers != 2 || stats.ActiveMembers != 1 || stats.PendingMembers != 1 ||
+		stats.RankBreakdown["MEMBER"] != 2 || stats.ProvinceBreakdown["HCM"] != 2 ||
+		stats.IndustryBreakdown["fnb"] != 2 || len(stats.IndustryBreakdown) != 1 {
+		t.Errorf("unexpected breakdown %+v", stats)
+	}
+
+	// Moving a shop and removing a member keep the counts up to date
+	if err := NewIShopService().UpdateIShop(ctx, "11", models.UpdateIShopRequest{Province: "Hà Nội", District: "Ba Đình"}); err != nil {
+		t.Fatalf("UpdateIShop: %v", err)
+	}
+	if err := members.RemoveMember(ctx, "1", "10"); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	stats, _ = NewStatsService().Breakdown(ctx, "1")
+	if stats.TotalMembers != 1 || stats.ActiveMembers != 0 || len(stats.ProvinceBreakdown) != 1 ||
+		stats.ProvinceBreakdown["Hà Nội"] != 1 || stats.DistrictBreakdown["Ba Đình"] != 1 {
+		t.Errorf("unexpected breakdown after changes %+v", stats)
+	}
+
+	// Counts of iComs from before they were maintained are built once
+	rdb.Del(ctx, metaProvincesKey("1"), metaDistrictsKey("1"))
+	rdb.ZAdd(ctx, "icoms:all", redis.Z{Score: 1, Member: "1"})
+	if n, err := NewStatsService().BackfillLocationCounts(ctx); err != nil || n != 1 {
+		t.Fatalf("BackfillLocationCounts = %d, %v", n, err)
+	}
+	stats, _ = NewStatsService().Breakdown(ctx, "1")
+	if stats.ProvinceBreakdown["Hà Nội"] != 1 || stats.DistrictBreakdown["Ba Đình"] != 1 {
+		t.Errorf("unexpected breakdown after backfill %+v", stats)
+	}
+
+	if _, err := NewStatsService().Breakdown(ctx, "2"); !errors.Is(err, ErrIComNotFound) {
+		t.Errorf("expected ErrIComNotFound, got %v", err)
+	}
+}
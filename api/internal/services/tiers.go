@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/events"
+	"i-manage/internal/models"
+)
+
+// Tier errors surfaced to handlers
+var (
+	ErrTierUndefined = errors.New("rank is not a tier of this iCom")
+	ErrTierInvalid   = errors.New("invalid tiers")
+	ErrTierInUse     = errors.New("tier still has members")
+)
+
+// tierAuditMax caps the tier audit trail kept per iCom
+const tierAuditMax = 1000
+
+// tierCode keeps tier codes apart from the lowercase leaderboard keys that
+// share the icom:<id>:rank: prefix with the rank indexes
+var tierCode = regexp.MustCompile(`^[A-Z0-9_]{1,32}$`)
+
+// Tiers are stored as a JSON list, lowest first:
+//
+//	icom:<id>:tiers         JSON array of tiers
+//	icom:<id>:tiers:audit   list of tier changes (JSON), newest first
+
+func tiersKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:tiers", icomID)
+}
+
+func tierAuditKey(icomID string) string {
+	return fmt.Sprintf("icom:%s:tiers:audit", icomID)
+}
+
+// defaultTiers is the tier list of an iCom that has not defined its own
+func defaultTiers() []models.MembershipTier {
+	return []models.MembershipTier{{Code: models.DefaultTierCode, Name: "Member"}}
+}
+
+// loadTiers returns the tiers of an iCom, lowest first
+func loadTiers(ctx context.Context, rdb *redis.Client, icomID string) ([]models.MembershipTier, error) {
+	raw, err := rdb.Get(ctx, tiersKey(icomID)).Result()
+	if err == redis.Nil {
+		return defaultTiers(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tiers []models.MembershipTier
+	if err := json.Unmarshal([]byte(raw), &tiers); err != nil || len(tiers) == 0 {
+		return defaultTiers(), nil
+	}
+	for i := range tiers {
+		tiers[i].Level = i
+	}
+	return tiers, nil
+}
+
+// findTier returns the tier with the given code
+func findTier(tiers []models.MembershipTier, code string) (models.MembershipTier, bool) {
+	for _, t := range tiers {
+		if t.Code == code {
+			return t, true
+		}
+	}
+	return models.MembershipTier{}, false
+}
+
+// baseRank returns the rank new members of an iCom get when none is given
+func baseRank(ctx context.Context, rdb *redis.Client, icomID string) (string, error) {
+	tiers, err := loadTiers(ctx, rdb, icomID)
+	if err != nil {
+		return "", err
+	}
+	return tiers[0].Code, nil
+}
+
+// checkRank rejects a rank that is not one of the iCom's tiers
+func checkRank(ctx context.Context, rdb *redis.Client, icomID, rank string) error {
+	tiers, err := loadTiers(ctx, rdb, icomID)
+	if err != nil {
+		return err
+	}
+	if _, ok := findTier(tiers, rank); !ok {
+		return fmt.Errorf("%w: %s", ErrTierUndefined, rank)
+	}
+	return nil
+}
+
+// GetTiers returns the tiers of an iCom, lowest first
+func (s *MemberService) GetTiers(ctx context.Context, icomID string) ([]models.MembershipTier, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("icom:%s", icomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrIComNotFound
+	}
+	return loadTiers(ctx, s.rdb, icomID)
+}
+
+// SetTiers replaces the tiers of an iCom. Codes are upper-cased; a tier
+// can only be dropped once no member holds it.
+func (s *MemberService) SetTiers(ctx context.Context, icomID string, tiers []models.MembershipTier) ([]models.MembershipTier, error) {
+	current, err := s.GetTiers(ctx, icomID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(tiers))
+	for i := range tiers {
+		t := &tiers[i]
+		t.Code = strings.ToUpper(strings.TrimSpace(t.Code))
+		t.Level = i
+		if !tierCode.MatchString(t.Code) {
+			return nil, fmt.Errorf("%w: code %q must be 1-32 letters, digits or underscores", ErrTierInvalid, t.Code)
+		}
+		if seen[t.Code] {
+			return nil, fmt.Errorf("%w: duplicate code %s", ErrTierInvalid, t.Code)
+		}
+		seen[t.Code] = true
+		if t.Promotion != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("%w: the base tier %s cannot have a promotion rule", ErrTierInvalid, t.Code)
+			}
+			if t.Promotion.ScoreType == "" {
+				t.Promotion.ScoreType = constants.RANK_TYPE_INTERACTIONS
+			}
+		}
+	}
+
+	pipe := s.rdb.Pipeline()
+	holders := make(map[string]*redis.IntCmd)
+	for _, t := range current {
+		if !seen[t.Code] {
+			holders[t.Code] = pipe.SCard(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, t.Code))
+		}
+	}
+	if len(holders) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for code, cmd := range holders {
+		if cmd.Val() > 0 {
+			return nil, fmt.Errorf("%w: %d member(s) hold %s", ErrTierInUse, cmd.Val(), code)
+		}
+	}
+
+	data, err := json.Marshal(tiers)
+	if err != nil {
+		return nil, err
+	}
+	tx := s.rdb.TxPipeline()
+	tx.Set(ctx, tiersKey(icomID), data, 0)
+	events.Append(ctx, tx, events.New(events.IComUpdated, icomID, "", events.IComChangedData{Changed: []string{"tiers"}}))
+	if _, err := tx.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return tiers, nil
+}
+
+// tierTarget returns the tier a member qualifies for: the highest automatic
+// tier whose rule is met, or the base tier
+func tierTarget(tiers []models.MembershipTier, scores map[string]float64, memberDays int) models.MembershipTier {
+	for i := len(tiers) - 1; i > 0; i-- {
+		rule := tiers[i].Promotion
+		if rule == nil {
+			continue
+		}
+		if scores[rule.ScoreType] >= rule.MinScore && memberDays >= rule.MinMemberDays {
+			return tiers[i]
+		}
+	}
+	return tiers[0]
+}
+
+// EvaluateTiers moves the active members of an iCom between its automatic
+// tiers according to their leaderboard scores and membership age. Members on
+// a hand-assigned tier, or on a rank the iCom no longer defines, are left
+// alone. With dryRun the changes are only reported.
+func (s *MemberService) EvaluateTiers(ctx context.Context, icomID string, dryRun bool) (*models.TierEvaluation, error) {
+	return s.evaluateTiers(ctx, icomID, dryRun, time.Now())
+}
+
+func (s *MemberService) evaluateTiers(ctx context.Context, icomID string, dryRun bool, now time.Time) (*models.TierEvaluation, error) {
+	tiers, err := s.GetTiers(ctx, icomID)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.TierEvaluation{IComID: icomID, DryRun: dryRun, Changes: []models.TierChange{}}
+
+	automatic := false
+	for _, t := range tiers {
+		automatic = automatic || t.Promotion != nil
+	}
+	if !automatic {
+		return result, nil
+	}
+
+	shopIDs, err := s.rdb.SMembers(ctx, fmt.Sprintf("icom:%s:status:%s", icomID, constants.MEMBER_STATUS_ACTIVE)).Result()
+	if err != nil {
+		return nil, err
+	}
+	scoreTypes := []string{constants.RANK_TYPE_INTERACTIONS, constants.RANK_TYPE_LIKES}
+
+	for start := 0; start < len(shopIDs); start += exportBatchSize {
+		batch := shopIDs[start:min(start+exportBatchSize, len(shopIDs))]
+
+		pipe := s.rdb.Pipeline()
+		memberCmds := make([]*redis.SliceCmd, len(batch))
+		scoreCmds := make([][]*redis.FloatCmd, len(batch))
+		for i, shopID := range batch {
+			memberCmds[i] = pipe.HMGet(ctx, fmt.Sprintf("icom:%s:member:%s", icomID, shopID), "rank", "joinedDate")
+			for _, rankType := range scoreTypes {
+				scoreCmds[i] = append(scoreCmds[i], pipe.ZScore(ctx, rankKey(icomID, rankType, ""), shopID))
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		for i, shopID := range batch {
+			membership := stringValues(memberCmds[i].Val(), 2)
+			current, ok := findTier(tiers, membership[0])
+			if !ok || current.Level > 0 && current.Promotion == nil {
+				continue
+			}
+			result.Evaluated++
+
+			scores := make(map[string]float64, len(scoreTypes))
+			for j, rankType := range scoreTypes {
+				scores[rankType] = scoreCmds[i][j].Val()
+			}
+			memberDays := 0
+			if joined, err := time.Parse(time.RFC3339, membership[1]); err == nil {
+				memberDays = int(now.Sub(joined).Hours() / 24)
+			}
+
+			target := tierTarget(tiers, scores, memberDays)
+			if target.Code == current.Code {
+				continue
+			}
+			change := models.TierChange{
+				ShopID:     shopID,
+				From:       current.Code,
+				To:         target.Code,
+				Reason:     models.TierChangePromotion,
+				MemberDays: memberDays,
+				Created:    now.UTC().Format(time.RFC3339),
+			}
+			if target.Level < current.Level {
+				change.Reason = models.TierChangeDemotion
+			}
+			if target.Promotion != nil {
+				change.Score = scores[target.Promotion.ScoreType]
+			} else if current.Promotion != nil {
+				change.Score = scores[current.Promotion.ScoreType]
+			}
+
+			if !dryRun {
+				applied, err := s.applyTierChange(ctx, icomID, change)
+				if err != nil {
+					return nil, err
+				}
+				if !applied {
+					continue
+				}
+			}
+			result.Changes = append(result.Changes, change)
+		}
+	}
+	return result, nil
+}
+
+// applyTierChange moves a member to a new rank unless the rank was changed
+// since it was read, and records the change in the audit trail
+func (s *MemberService) applyTierChange(ctx context.Context, icomID string, change models.TierChange) (bool, error) {
+	memberKey := fmt.Sprintf("icom:%s:member:%s", icomID, change.ShopID)
+	entry, err := json.Marshal(change)
+	if err != nil {
+		return false, err
+	}
+
+	applied := false
+	err = s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		rank, err := tx.HGet(ctx, memberKey, "rank").Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if rank != change.From {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, memberKey, "rank", change.To)
+			pipe.SRem(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, change.From), change.ShopID)
+			pipe.SAdd(ctx, fmt.Sprintf("icom:%s:rank:%s", icomID, change.To), change.ShopID)
+			pipe.LPush(ctx, tierAuditKey(icomID), entry)
+			pipe.LTrim(ctx, tierAuditKey(icomID), 0, tierAuditMax-1)
+			events.Append(ctx, pipe, events.New(events.MemberStatusChanged, icomID, change.ShopID, events.MemberStatusChangedData{
+				OldRank: change.From,
+				NewRank: change.To,
+			}))
+			return nil
+		})
+		applied = err == nil
+		return err
+	}, memberKey)
+	return applied, err
+}
+
+// TierAudit returns a page of the tier changes made in an iCom, newest first
+func (s *MemberService) TierAudit(ctx context.Context, icomID string, page, limit int) (*models.TierChangeList, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	start := int64((page - 1) * limit)
+
+	pipe := s.rdb.Pipeline()
+	rangeCmd := pipe.LRange(ctx, tierAuditKey(icomID), start, start+int64(limit)-1)
+	totalCmd := pipe.LLen(ctx, tierAuditKey(icomID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	entries := make([]models.TierChange, 0, len(rangeCmd.Val()))
+	for _, raw := range rangeCmd.Val() {
+		var entry models.TierChange
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return &models.TierChangeList{Entries: entries, Total: int(totalCmd.Val()), Page: page, Limit: limit}, nil
+}
+
+// EvaluateAllTiers evaluates the tiers of every iCom. It runs as the
+// "tiers" scheduler job.
+func (s *MemberService) EvaluateAllTiers(ctx context.Context) error {
+	return forEachICom(ctx, s.rdb, func(icomID string) error {
+		result, err := s.EvaluateTiers(ctx, icomID, false)
+		if errors.Is(err, ErrIComNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(result.Changes) > 0 {
+			log.Printf("tiers: iCom %s: %d member(s) changed tier", icomID, len(result.Changes))
+		}
+		return nil
+	})
+}
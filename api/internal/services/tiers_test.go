@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/models"
+)
+
+// seedTiers gives an iCom the base tier plus the given ones
+func seedTiers(t *testing.T, icomID string, codes ...string) {
+	t.Helper()
+	tiers := []models.MembershipTier{{Code: models.DefaultTierCode, Name: "Member"}}
+	for _, code := range codes {
+		tiers = append(tiers, models.MembershipTier{Code: code, Name: code})
+	}
+	if _, err := NewMemberService().SetTiers(context.Background(), icomID, tiers); err != nil {
+		t.Fatalf("SetTiers: %v", err)
+	}
+}
+
+func TestSetTiers(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	service := NewMemberService()
+
+	if _, err := service.GetTiers(ctx, "1"); !errors.Is(err, ErrIComNotFound) {
+		t.Fatalf("missing iCom err = %v", err)
+	}
+	rdb.HSet(ctx, "icom:1", "id", "1")
+
+	tiers, err := service.GetTiers(ctx, "1")
+	if err != nil || len(tiers) != 1 || tiers[0].Code != models.DefaultTierCode {
+		t.Fatalf("default tiers = %+v, %v", tiers, err)
+	}
+
+	invalid := [][]models.MembershipTier{
+		{{Code: "gold card", Name: "Gold"}},
+		{{Code: "SILVER", Name: "Silver"}, {Code: "silver", Name: "Silver again"}},
+		{{Code: "BASE", Name: "Base", Promotion: &models.PromotionRule{MinScore: 1}}},
+	}
+	for _, set := range invalid {
+		if _, err := service.SetTiers(ctx, "1", set); !errors.Is(err, ErrTierInvalid) {
+			t.Errorf("SetTiers(%+v) err = %v, want ErrTierInvalid", set, err)
+		}
+	}
+
+	// MEMBER is still held, so it cannot be dropped
+	rdb.SAdd(ctx, "icom:1:rank:MEMBER", "shop1")
+	if _, err := service.SetTiers(ctx, "1", []models.MembershipTier{{Code: "SILVER", Name: "Silver"}}); !errors.Is(err, ErrTierInUse) {
+		t.Errorf("dropping a held tier err = %v", err)
+	}
+
+	tiers, err = service.SetTiers(ctx, "1", []models.MembershipTier{
+		{Code: "member", Name: "Member"},
+		{Code: "gold", Name: "Gold", Promotion: &models.PromotionRule{MinScore: 100}},
+	})
+	if err != nil {
+		t.Fatalf("SetTiers: %v", err)
+	}
+	if tiers[1].Code != "GOLD" || tiers[1].Level != 1 || tiers[1].Promotion.ScoreType != constants.RANK_TYPE_INTERACTIONS {
+		t.Errorf("stored tier = %+v", tiers[1])
+	}
+	if base, _ := baseRank(ctx, rdb, "1"); base != "MEMBER" {
+		t.Errorf("baseRank = %s", base)
+	}
+	if err := checkRank(ctx, rdb, "1", "PLATINUM"); !errors.Is(err, ErrTierUndefined) {
+		t.Errorf("checkRank(PLATINUM) = %v", err)
+	}
+}
+
+func TestEvaluateTiers(t *testing.T) {
+	rdb := setupTestRedis(t)
+	ctx := context.Background()
+	service := NewMemberService()
+	now := time.Now()
+
+	rdb.HSet(ctx, "icom:1", "id", "1")
+	if _, err := service.SetTiers(ctx, "1", []models.MembershipTier{
+		{Code: "MEMBER", Name: "Member"},
+		{Code: "SILVER", Name: "Silver", Promotion: &models.PromotionRule{MinScore: 10}},
+		{Code: "GOLD", Name: "Gold", Promotion: &models.PromotionRule{MinScore: 50, MinMemberDays: 30}},
+		{Code: "HONORARY", Name: "Honorary"},
+	}); err != nil {
+		t.Fatalf("SetTiers: %v", err)
+	}
+
+	member := func(shopID, rank string, joinedDaysAgo int, score float64) {
+		joined := now.AddDate(0, 0, -joinedDaysAgo).Format(time.RFC3339)
+		rdb.HSet(ctx, fmt.Sprintf("icom:1:member:%s", shopID), "rank", rank, "joinedDate", joined)
+		rdb.SAdd(ctx, "icom:1:status:ACTIVE", shopID)
+		rdb.SAdd(ctx, fmt.Sprintf("icom:1:rank:%s", rank), shopID)
+		rdb.ZAdd(ctx, rankKey("1", constants.RANK_TYPE_INTERACTIONS, ""), redis.Z{Score: score, Member: shopID})
+	}
+	member("new", "MEMBER", 1, 60)      // enough score, too new for gold
+	member("veteran", "SILVER", 90, 60) // gold
+	member("idle", "GOLD", 90, 2)       // back to the base tier
+	member("vip", "HONORARY", 90, 0)    // assigned by hand
+	member("steady", "SILVER", 5, 20)   // stays
+
+	dry, err := service.evaluateTiers(ctx, "1", true, now)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if dry.Evaluated != 4 || len(dry.Changes) != 3 {
+		t.Fatalf("dry run = %+v", dry)
+	}
+	if rank, _ := rdb.HGet(ctx, "icom:1:member:new", "rank").Result(); rank != "MEMBER" {
+		t.Errorf("dry run changed rank to %s", rank)
+	}
+
+	result, err := service.evaluateTiers(ctx, "1", false, now)
+	if err != nil {
+		t.Fatalf("evaluateTiers: %v", err)
+	}
+	want := map[string]string{"new": "SILVER", "veteran": "GOLD", "idle": "MEMBER", "vip": "HONORARY", "steady": "SILVER"}
+	for shopID, rank := range want {
+		if got, _ := rdb.HGet(ctx, fmt.Sprintf("icom:1:member:%s", shopID), "rank").Result(); got != rank {
+			t.Errorf("%s rank = %s, want %s", shopID, got, rank)
+		}
+		if ok, _ := rdb.SIsMember(ctx, fmt.Sprintf("icom:1:rank:%s", rank), shopID).Result(); !ok {
+			t.Errorf("%s missing from rank index %s", shopID, rank)
+		}
+	}
+
+	audit, _ := service.TierAudit(ctx, "1", 1, 20)
+	if audit.Total != len(result.Changes) || audit.Total != 3 {
+		t.Fatalf("audit = %+v", audit)
+	}
+	for _, change := range audit.Entries {
+		if change.ShopID == "idle" && change.Reason != models.TierChangeDemotion {
+			t.Errorf("idle change = %+v", change)
+		}
+		if change.ShopID == "veteran" && (change.Reason != models.TierChangePromotion || change.Score != 60) {
+			t.Errorf("veteran change = %+v", change)
+		}
+	}
+
+	// Nothing left to change
+	if again, _ := service.evaluateTiers(ctx, "1", false, now); len(again.Changes) != 0 {
+		t.Errorf("second evaluation changes = %+v", again.Changes)
+	}
+}
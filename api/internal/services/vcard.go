@@ -0,0 +1,102 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// vcardWriter writes members as vCard 4.0 contacts (RFC 6350)
+type vcardWriter struct {
+	w *bufio.Writer
+}
+
+func newVCardWriter(w io.Writer) *vcardWriter {
+	return &vcardWriter{w: bufio.NewWriter(w)}
+}
+
+// vcardEscape escapes a text value
+func vcardEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// line writes a content line folded at 75 octets without splitting UTF-8
+// characters
+func (v *vcardWriter) line(s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		v.w.WriteString(s[:cut])
+		v.w.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space
+		limit = 74
+	}
+	v.w.WriteString(s)
+	v.w.WriteString("\r\n")
+}
+
+func (v *vcardWriter) write(m exportMember, hidden map[string]bool) error {
+	val := func(c string) string { return m.value(c, hidden) }
+
+	v.line("BEGIN:VCARD")
+	v.line("VERSION:4.0")
+	v.line("KIND:org")
+	v.line("FN:" + vcardEscape(m.shop.Name))
+	v.line("ORG:" + vcardEscape(m.shop.Name))
+	if c := val("industry"); c != "" {
+		v.line("CATEGORIES:" + vcardEscape(c))
+	}
+	if tel := val("phone"); tel != "" {
+		v.line("TEL;VALUE=uri;TYPE=work:tel:" + strings.ReplaceAll(tel, " ", ""))
+	}
+	if email := val("email"); email != "" {
+		v.line("EMAIL;TYPE=work:" + vcardEscape(email))
+	}
+	if url := val("website"); url != "" {
+		v.line("URL:" + url)
+	}
+	if logo := val("logo"); logo != "" {
+		v.line("LOGO:" + logo)
+	}
+
+	// ADR: post office box; extended; street; locality; region; postal code; country
+	street, ward, district, province := val("street"), val("ward"), val("district"), val("province")
+	if street != "" || ward != "" || district != "" || province != "" {
+		v.line("ADR;TYPE=work:;;" + vcardEscape(joinNonBlank(", ", street, ward)) + ";" +
+			vcardEscape(district) + ";" + vcardEscape(province) + ";;")
+	}
+	if lat, lng := val("lat"), val("lng"); lat != "" && lng != "" {
+		v.line("GEO:geo:" + lat + "," + lng)
+	}
+	if rank := val("rank"); rank != "" {
+		v.line("NOTE:" + vcardEscape("Rank: "+rank))
+	}
+	v.line("UID:urn:ishop:" + m.shop.ID)
+	if _, err := v.w.WriteString("END:VCARD\r\n"); err != nil {
+		return err
+	}
+	// Stream contacts out in chunks
+	if v.w.Buffered() > 32<<10 {
+		return v.w.Flush()
+	}
+	return nil
+}
+
+func (v *vcardWriter) flush() error {
+	return v.w.Flush()
+}
+
+func joinNonBlank(sep string, parts ...string) string {
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, sep)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrWebhookURL is returned for a webhook target that is not https on a
+// public host
+var ErrWebhookURL = errors.New("webhook url must be https on a public host")
+
+// webhookBlockedPrefixes are the address ranges webhooks may not reach on
+// top of loopback, private, link-local and multicast addresses
+var webhookBlockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, may map to any IPv4 address
+}
+
+// webhookPublicAddr reports whether a webhook may connect to an address.
+// Cloud metadata endpoints (169.254.169.254, fd00:ec2::254) fall in the
+// link-local and private ranges.
+func webhookPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsMulticast() ||
+		addr.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, prefix := range webhookBlockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhookURL rejects webhook targets that are not https on a public
+// host. Host names are resolved so a name pointing at an internal address
+// is refused at registration; the dialer checks the address again on every
+// delivery in case the name is re-pointed later.
+func (s *WebhookService) checkWebhookURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return ErrWebhookURL
+	}
+	if s.allowLocal {
+		return nil
+	}
+	if u.Scheme != "https" {
+		return ErrWebhookURL
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrWebhookURL
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !webhookPublicAddr(addr) {
+			return ErrWebhookURL
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: %s does not resolve", ErrWebhookURL, host)
+	}
+	for _, addr := range addrs {
+		if !webhookPublicAddr(addr) {
+			return ErrWebhookURL
+		}
+	}
+	return nil
+}
+
+// newWebhookClient builds the HTTP client deliveries are sent with. Its
+// dialer refuses non-public addresses after DNS resolution, so a host name
+// re-pointed at an internal address (DNS rebinding) is still blocked.
+// Proxies from the environment are ignored since the check would then only
+// see the proxy, and redirects are not followed.
+func (s *WebhookService) newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if s.allowLocal {
+				return nil
+			}
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !webhookPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s is not a public address", ErrWebhookURL, address)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   webhookTimeout,
+			ResponseHeaderTimeout: webhookTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,803 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/constants"
+	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Webhook errors surfaced to handlers
+var (
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrDeliveryNotFound    = errors.New("delivery not found")
+	ErrInvalidWebhookEvent = errors.New("invalid webhook event")
+)
+
+const (
+	// webhookQueueKey holds delivery IDs scored by their next attempt (unix ms)
+	webhookQueueKey = "webhooks:queue"
+
+	webhookMaxAttempts   = 8
+	webhookBaseBackoff   = 30 * time.Second
+	webhookMaxBackoff    = 6 * time.Hour
+	webhookTimeout       = 10 * time.Second
+	webhookLogSize       = 100
+	webhookDeliveryTTL   = 30 * 24 * time.Hour
+	webhookPollInterval  = time.Second
+	webhookClaimBatch    = 50
+	webhookClaimLease    = 2 * time.Minute // how long a claimed delivery stays out of the queue
+	webhookSignatureName = "X-IManage-Signature"
+)
+
+// WebhookService manages webhook subscriptions and their deliveries
+type WebhookService struct {
+	rdb    *redis.Client
+	client *http.Client
+	// allowLocal lets tests register http webhooks on local receivers
+	allowLocal bool
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService() *WebhookService {
+	s := &WebhookService{rdb: database.Rdb}
+	s.client = s.newWebhookClient()
+	return s
+}
+
+func webhookKey(id string) string         { return fmt.Sprintf("webhook:%s", id) }
+func webhookListKey(icomID string) string { return fmt.Sprintf("icom:%s:webhooks", icomID) }
+func webhookLogKey(id string) string      { return fmt.Sprintf("webhook:%s:deliveries", id) }
+func webhookFiredKey(id string) string    { return fmt.Sprintf("webhook:%s:likes:fired", id) }
+func webhookDeliveryKey(id string) string { return fmt.Sprintf("webhook:delivery:%s", id) }
+
+// SignWebhookPayload returns the signature header value for a payload:
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the delay before the next attempt after the given
+// number of failed attempts: 30s, 1m, 2m, ... capped at 6h
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookBaseBackoff
+	for i := 1; i < attempts && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > webhookMaxBackoff {
+		d = webhookMaxBackoff
+	}
+	return d
+}
+
+// validateWebhookEvents rejects event names that are not deliverable
+func validateWebhookEvents(names []string) error {
+	for _, name := range names {
+		known := false
+		for _, e := range models.WebhookEvents {
+			if name == e {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, name)
+		}
+	}
+	return nil
+}
+
+// subscribes reports whether the webhook wants the given event
+func subscribes(hook models.Webhook, name string) bool {
+	if !hook.Active {
+		return false
+	}
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, e := range hook.Events {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+func generateWebhookSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// CreateWebhook registers a webhook for an iCom. The returned webhook is the
+// only response that includes the secret.
+func (s *WebhookService) CreateWebhook(ctx context.Context, icomID string, req models.CreateWebhookRequest) (*models.Webhook, error) {
+	if err := validateWebhookEvents(req.Events); err != nil {
+		return nil, err
+	}
+	if err := s.checkWebhookURL(ctx, req.URL); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	hook := models.Webhook{
+		ID:             fmt.Sprintf("wh_%d", time.Now().UnixNano()),
+		IComID:         icomID,
+		URL:            req.URL,
+		Events:         req.Events,
+		Secret:         req.Secret,
+		Active:         req.Active == nil || *req.Active,
+		LikeThresholds: req.LikeThresholds,
+		Created:        now,
+		Modified:       now,
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	if hook.LikeThresholds == nil {
+		hook.LikeThresholds = []int{}
+	}
+	if hook.Secret == "" {
+		hook.Secret = generateWebhookSecret()
+	}
+
+	fields, err := hashcodec.Marshal(hook)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, webhookKey(hook.ID), fields)
+	pipe.SAdd(ctx, webhookListKey(icomID), hook.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return &hook, nil
+}
+
+// getWebhook loads a webhook and checks that it belongs to the iCom
+func (s *WebhookService) getWebhook(ctx context.Context, icomID, webhookID string) (*models.Webhook, error) {
+	data, err := s.rdb.HGetAll(ctx, webhookKey(webhookID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrWebhookNotFound
+	}
+
+	var hook models.Webhook
+	if err := hashcodec.Unmarshal(data, &hook); err != nil {
+		return nil, err
+	}
+	if icomID != "" && hook.IComID != icomID {
+		return nil, ErrWebhookNotFound
+	}
+	return &hook, nil
+}
+
+// GetWebhook returns a webhook without its secret
+func (s *WebhookService) GetWebhook(ctx context.Context, icomID, webhookID string) (*models.Webhook, error) {
+	hook, err := s.getWebhook(ctx, icomID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	hook.Secret = ""
+	return hook, nil
+}
+
+// listWebhooks loads every webhook registered for an iCom in one round-trip
+func (s *WebhookService) listWebhooks(ctx context.Context, icomID string) ([]models.Webhook, error) {
+	ids, err := s.rdb.SMembers(ctx, webhookListKey(icomID)).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, webhookKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	hooks := make([]models.Webhook, 0, len(ids))
+	for _, cmd := range cmds {
+		data := cmd.Val()
+		if len(data) == 0 {
+			continue
+		}
+		var hook models.Webhook
+		if err := hashcodec.Unmarshal(data, &hook); err != nil {
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// ListWebhooks returns the iCom's webhooks without their secrets
+func (s *WebhookService) ListWebhooks(ctx context.Context, icomID string) ([]models.Webhook, error) {
+	hooks, err := s.listWebhooks(ctx, icomID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return hooks, nil
+}
+
+// UpdateWebhook updates a webhook
+func (s *WebhookService) UpdateWebhook(ctx context.Context, icomID, webhookID string, req models.UpdateWebhookRequest) error {
+	if err := validateWebhookEvents(req.Events); err != nil {
+		return err
+	}
+	if req.URL != "" {
+		if err := s.checkWebhookURL(ctx, req.URL); err != nil {
+			return err
+		}
+	}
+	if _, err := s.getWebhook(ctx, icomID, webhookID); err != nil {
+		return err
+	}
+
+	updates, err := hashcodec.MarshalPartial(req)
+	if err != nil {
+		return err
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	updates["modified"] = time.Now().Format(time.RFC3339)
+
+	return s.rdb.HSet(ctx, webhookKey(webhookID), updates).Err()
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (s *WebhookService) DeleteWebhook(ctx context.Context, icomID, webhookID string) error {
+	if _, err := s.getWebhook(ctx, icomID, webhookID); err != nil {
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, webhookKey(webhookID), webhookLogKey(webhookID), webhookFiredKey(webhookID))
+	pipe.SRem(ctx, webhookListKey(icomID), webhookID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ListDeliveries returns a page of a webhook's delivery log, newest first
+func (s *WebhookService) ListDeliveries(ctx context.Context, icomID, webhookID string, page, limit int) (*models.WebhookDeliveryList, error) {
+	if _, err := s.getWebhook(ctx, icomID, webhookID); err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	start := int64((page - 1) * limit)
+	stop := int64(page*limit - 1)
+
+	pipe := s.rdb.Pipeline()
+	rangeCmd := pipe.ZRevRange(ctx, webhookLogKey(webhookID), start, stop)
+	totalCmd := pipe.ZCard(ctx, webhookLogKey(webhookID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	ids := rangeCmd.Val()
+	deliveries := make([]models.WebhookDelivery, 0, len(ids))
+	if len(ids) > 0 {
+		pipe = s.rdb.Pipeline()
+		cmds := make([]*redis.MapStringStringCmd, len(ids))
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, webhookDeliveryKey(id))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for _, cmd := range cmds {
+			data := cmd.Val()
+			if len(data) == 0 {
+				// Expired record still referenced by the log
+				continue
+			}
+			var d models.WebhookDelivery
+			if err := hashcodec.Unmarshal(data, &d); err != nil {
+				continue
+			}
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	return &models.WebhookDeliveryList{
+		Deliveries: deliveries,
+		Total:      int(totalCmd.Val()),
+		Page:       page,
+		Limit:      limit,
+	}, nil
+}
+
+// getDelivery loads a delivery record
+func (s *WebhookService) getDelivery(ctx context.Context, deliveryID string) (*models.WebhookDelivery, error) {
+	data, err := s.rdb.HGetAll(ctx, webhookDeliveryKey(deliveryID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	var d models.WebhookDelivery
+	if err := hashcodec.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ReplayDelivery queues a logged delivery to be sent again with the same
+// payload and delivery ID, so receivers can deduplicate it
+func (s *WebhookService) ReplayDelivery(ctx context.Context, icomID, webhookID, deliveryID string) error {
+	if _, err := s.getWebhook(ctx, icomID, webhookID); err != nil {
+		return err
+	}
+	d, err := s.getDelivery(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	if d.WebhookID != webhookID {
+		return ErrDeliveryNotFound
+	}
+
+	now := time.Now()
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, webhookDeliveryKey(deliveryID), map[string]interface{}{
+		"status":        models.DeliveryStatusPending,
+		"attempts":      0,
+		"error":         "",
+		"nextAttemptAt": now.Format(time.RFC3339),
+		"modified":      now.Format(time.RFC3339),
+	})
+	pipe.Expire(ctx, webhookDeliveryKey(deliveryID), webhookDeliveryTTL)
+	pipe.ZAdd(ctx, webhookQueueKey, redis.Z{Score: float64(now.UnixMilli()), Member: deliveryID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Ping sends a ping event to the webhook right away and returns the result.
+// The ping is logged like any other delivery but is not retried.
+func (s *WebhookService) Ping(ctx context.Context, icomID, webhookID string) (*models.WebhookDelivery, error) {
+	hook, err := s.getWebhook(ctx, icomID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := s.newDelivery(hook, fmt.Sprintf("ping_%d", time.Now().UnixNano()), models.WebhookEventPing, "", "", time.Now(), map[string]string{"message": "ping"})
+	if err != nil {
+		return nil, err
+	}
+	pipe := s.rdb.TxPipeline()
+	s.queueDelivery(ctx, pipe, d, false)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.attempt(ctx, hook, d, false)
+}
+
+// webhookPayload is the JSON body POSTed to subscribers
+type webhookPayload struct {
+	ID         string      `json:"id"`
+	Event      string      `json:"event"`
+	IComID     string      `json:"icom_id"`
+	ShopID     string      `json:"shop_id,omitempty"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data,omitempty"`
+}
+
+// LikesThresholdData is the data of a likes.threshold delivery
+type LikesThresholdData struct {
+	Threshold int `json:"threshold"`
+	Likes     int `json:"likes"`
+}
+
+// newDelivery builds a pending delivery with its payload
+func (s *WebhookService) newDelivery(hook *models.Webhook, sourceID, name, icomID, shopID string, at time.Time, data interface{}) (*models.WebhookDelivery, error) {
+	if icomID == "" {
+		icomID = hook.IComID
+	}
+	id := fmt.Sprintf("dlv_%s_%s", hook.ID, sourceID)
+	body, err := json.Marshal(webhookPayload{
+		ID:         id,
+		Event:      name,
+		IComID:     icomID,
+		ShopID:     shopID,
+		OccurredAt: at.UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	return &models.WebhookDelivery{
+		ID:            id,
+		WebhookID:     hook.ID,
+		Event:         name,
+		SourceEventID: sourceID,
+		Payload:       string(body),
+		Status:        models.DeliveryStatusPending,
+		NextAttemptAt: now,
+		Created:       now,
+		Modified:      now,
+	}, nil
+}
+
+// queueDelivery records a delivery in the webhook's log and, when enqueue is
+// set, schedules it for the delivery worker
+func (s *WebhookService) queueDelivery(ctx context.Context, pipe redis.Pipeliner, d *models.WebhookDelivery, enqueue bool) {
+	fields, _ := hashcodec.Marshal(*d)
+	now := time.Now()
+
+	pipe.HSet(ctx, webhookDeliveryKey(d.ID), fields)
+	pipe.Expire(ctx, webhookDeliveryKey(d.ID), webhookDeliveryTTL)
+	pipe.ZAdd(ctx, webhookLogKey(d.WebhookID), redis.Z{Score: float64(now.UnixMilli()), Member: d.ID})
+	pipe.ZRemRangeByRank(ctx, webhookLogKey(d.WebhookID), 0, -webhookLogSize-1)
+	if enqueue {
+		pipe.ZAdd(ctx, webhookQueueKey, redis.Z{Score: float64(now.UnixMilli()), Member: d.ID})
+	}
+}
+
+// HandleEvent turns a domain event into deliveries for every matching
+// webhook of its iCom. It is the handler of the "webhooks" event subscriber.
+func (s *WebhookService) HandleEvent(ctx context.Context, evt events.Event) error {
+	var name string
+	var data interface{}
+
+	switch evt.Type {
+	case events.MemberAdded:
+		var d events.MemberAddedData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		if d.Status != constants.MEMBER_STATUS_ACTIVE {
+			// Pending members join when their application is approved
+			return nil
+		}
+		name, data = models.WebhookEventMemberJoined, d
+	case events.MemberApplied:
+		var d events.MemberApplicationData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		name, data = models.WebhookEventMemberApplied, d
+	case events.MemberApproved:
+		var d events.MemberDecisionData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		if d.Auto {
+			return nil
+		}
+		name, data = models.WebhookEventMemberJoined, d
+	case events.MemberRejected:
+		var d events.MemberDecisionData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		name, data = models.WebhookEventMemberRejected, d
+	case events.MemberStatusChanged:
+		var d events.MemberStatusChangedData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		name, data = models.WebhookEventMemberStatusChanged, d
+	case events.MemberRemoved:
+		var d events.MemberRemovedData
+		if err := evt.Decode(&d); err != nil {
+			return err
+		}
+		name, data = models.WebhookEventMemberRemoved, d
+	case events.ShopLiked:
+		return s.handleLike(ctx, evt)
+	default:
+		return nil
+	}
+
+	hooks, err := s.listWebhooks(ctx, evt.IComID)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+
+	var deliveries []*models.WebhookDelivery
+	for i := range hooks {
+		if !subscribes(hooks[i], name) {
+			continue
+		}
+		d, err := s.newDelivery(&hooks[i], evt.ID, name, evt.IComID, evt.ShopID, evt.OccurredAt, data)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return s.queueNew(ctx, deliveries)
+}
+
+// handleLike fires likes.threshold once per webhook, shop and threshold when
+// the shop's like count in the iCom reaches a configured threshold
+func (s *WebhookService) handleLike(ctx context.Context, evt events.Event) error {
+	hooks, err := s.listWebhooks(ctx, evt.IComID)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+
+	likes, err := s.rdb.ZScore(ctx, fmt.Sprintf("icom:%s:rank:likes", evt.IComID), evt.ShopID).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	// The fired markers are checked under WATCH and written in the
+	// transaction that queues the deliveries, so a threshold fires once and
+	// a failed attempt leaves it to fire when the event is redelivered
+	var firedKeys []string
+	for _, hook := range hooks {
+		if subscribes(hook, models.WebhookEventLikesThreshold) {
+			firedKeys = append(firedKeys, webhookFiredKey(hook.ID))
+		}
+	}
+	if len(firedKeys) == 0 {
+		return nil
+	}
+	return s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		var deliveries []*models.WebhookDelivery
+		var markers [][2]string
+		for i := range hooks {
+			hook := &hooks[i]
+			if !subscribes(*hook, models.WebhookEventLikesThreshold) {
+				continue
+			}
+			for _, threshold := range hook.LikeThresholds {
+				if int(likes) < threshold {
+					continue
+				}
+				marker := fmt.Sprintf("%s:%d", evt.ShopID, threshold)
+				fired, err := tx.SIsMember(ctx, webhookFiredKey(hook.ID), marker).Result()
+				if err != nil {
+					return err
+				}
+				if fired {
+					continue
+				}
+				d, err := s.newDelivery(hook, evt.ID+"_"+strconv.Itoa(threshold), models.WebhookEventLikesThreshold,
+					evt.IComID, evt.ShopID, evt.OccurredAt, LikesThresholdData{Threshold: threshold, Likes: int(likes)})
+				if err != nil {
+					return err
+				}
+				deliveries = append(deliveries, d)
+				markers = append(markers, [2]string{webhookFiredKey(hook.ID), marker})
+			}
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, d := range deliveries {
+				s.queueDelivery(ctx, pipe, d, true)
+			}
+			for _, m := range markers {
+				pipe.SAdd(ctx, m[0], m[1])
+			}
+			return nil
+		})
+		return err
+	}, firedKeys...)
+}
+
+// queueNew queues deliveries that were not created already, so a domain
+// event redelivered to the subscriber does not send duplicates
+func (s *WebhookService) queueNew(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	exists := make([]*redis.IntCmd, len(deliveries))
+	for i, d := range deliveries {
+		exists[i] = pipe.Exists(ctx, webhookDeliveryKey(d.ID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	tx := s.rdb.TxPipeline()
+	queued := 0
+	for i, d := range deliveries {
+		if exists[i].Val() > 0 {
+			continue
+		}
+		s.queueDelivery(ctx, tx, d, true)
+		queued++
+	}
+	if queued == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx)
+	return err
+}
+
+// claimDelivery claims a due delivery by pushing its score out by the claim
+// lease. Only the caller that finds it still due gets it; if that caller
+// dies mid-attempt the delivery becomes due again once the lease runs out.
+var claimDelivery = redis.NewScript(`
+local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if score and tonumber(score) <= tonumber(ARGV[2]) then
+	redis.call("ZADD", KEYS[1], "XX", ARGV[3], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// RunDeliveries sends queued deliveries as they become due until ctx is
+// cancelled. Several instances can run it: a delivery is claimed by whoever
+// leases it first.
+func (s *WebhookService) RunDeliveries(ctx context.Context) error {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.processDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("webhooks: processing queue failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// processDue claims and sends every delivery whose next attempt is due
+func (s *WebhookService) processDue(ctx context.Context) error {
+	ids, err := s.rdb.ZRangeByScore(ctx, webhookQueueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Count: webhookClaimBatch,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return nil
+		}
+		now := time.Now()
+		claimed, err := claimDelivery.Run(ctx, s.rdb, []string{webhookQueueKey},
+			id, now.UnixMilli(), now.Add(webhookClaimLease).UnixMilli()).Int()
+		if err != nil {
+			return err
+		}
+		if claimed == 0 {
+			continue
+		}
+
+		d, err := s.getDelivery(ctx, id)
+		if err == ErrDeliveryNotFound {
+			s.rdb.ZRem(ctx, webhookQueueKey, id)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		hook, err := s.getWebhook(ctx, "", d.WebhookID)
+		if err != nil {
+			s.finish(ctx, d, 0, "webhook deleted", false)
+			continue
+		}
+		if !hook.Active {
+			s.finish(ctx, d, 0, "webhook inactive", false)
+			continue
+		}
+		if _, err := s.attempt(ctx, hook, d, true); err != nil {
+			log.Printf("webhooks: delivery %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// attempt POSTs a delivery to its webhook and records the outcome. When retry
+// is set, failures are rescheduled with exponential backoff.
+func (s *WebhookService) attempt(ctx context.Context, hook *models.Webhook, d *models.WebhookDelivery, retry bool) (*models.WebhookDelivery, error) {
+	body := []byte(d.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return s.finish(ctx, d, 0, err.Error(), false)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "i-Manage-Webhooks/1.0")
+	req.Header.Set("X-IManage-Event", d.Event)
+	req.Header.Set("X-IManage-Delivery", d.ID)
+	req.Header.Set("X-IManage-Timestamp", timestamp)
+	req.Header.Set(webhookSignatureName, SignWebhookPayload(hook.Secret, timestamp, body))
+
+	code := 0
+	errMsg := ""
+	resp, err := s.client.Do(req)
+	if err != nil {
+		errMsg = err.Error()
+	} else {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		code = resp.StatusCode
+		if code < 200 || code > 299 {
+			errMsg = fmt.Sprintf("unexpected status %d", code)
+		}
+	}
+
+	return s.finish(ctx, d, code, errMsg, retry)
+}
+
+// finish stores the result of an attempt and reschedules failed deliveries
+func (s *WebhookService) finish(ctx context.Context, d *models.WebhookDelivery, code int, errMsg string, retry bool) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	d.Attempts++
+	d.ResponseCode = code
+	d.Error = errMsg
+	d.Modified = now.Format(time.RFC3339)
+	d.NextAttemptAt = ""
+
+	var next time.Time
+	switch {
+	case errMsg == "":
+		d.Status = models.DeliveryStatusSucceeded
+	case retry && d.Attempts < webhookMaxAttempts:
+		d.Status = models.DeliveryStatusPending
+		next = now.Add(webhookBackoff(d.Attempts))
+		d.NextAttemptAt = next.Format(time.RFC3339)
+	default:
+		d.Status = models.DeliveryStatusFailed
+	}
+
+	fields, err := hashcodec.Marshal(*d)
+	if err != nil {
+		return d, err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, webhookDeliveryKey(d.ID), fields)
+	if !next.IsZero() {
+		pipe.ZAdd(ctx, webhookQueueKey, redis.Z{Score: float64(next.UnixMilli()), Member: d.ID})
+	} else {
+		// Settled: release the claim
+		pipe.ZRem(ctx, webhookQueueKey, d.ID)
+	}
+	_, err = pipe.Exec(ctx)
+	return d, err
+}
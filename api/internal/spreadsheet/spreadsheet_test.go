@@ -0,0 +1,74 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadCSVDetectsDelimiter(t *testing.T) {
+	data := []byte("\xef\xbb\xbfname;industry;lat\n\"Phở; Hòa\";fnb;10.7\n\n")
+	rows, err := Read("members.csv", data)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	want := [][]string{{"name", "industry", "lat"}, {"Phở; Hòa", "fnb", "10.7"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %q, want %q", rows, want)
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name, body string) {
+		w, _ := zw.Create(name)
+		w.Write([]byte(body))
+	}
+	add("xl/workbook.xml", `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Members" r:id="rId1"/></sheets></workbook>`)
+	add("xl/_rels/workbook.xml.rels", `<Relationships><Relationship Id="rId1" Target="worksheets/members.xml"/></Relationships>`)
+	add("xl/sharedStrings.xml", `<sst><si><t>name</t></si><si><r><t>Phở </t></r><r><t>Hòa</t></r></si></sst>`)
+	add("xl/worksheets/members.xml", `<worksheet><sheetData>
+		<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>lat</t></is></c></row>
+		<row r="3"><c r="A3" t="s"><v>1</v></c><c r="C3"><v>10.7769</v></c></row>
+	</sheetData></worksheet>`)
+	zw.Close()
+
+	rows, err := Read("members.xlsx", buf.Bytes())
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	want := [][]string{{"name", "", "lat"}, nil, {"Phở Hòa", "", "10.7769"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %q, want %q", rows, want)
+	}
+}
+
+func TestXLSXWriterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatXLSX, &buf)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	want := [][]string{{"name", "phone", "note"}, {"Phở & Cơm <1>", "", "line\nbreak"}}
+	for _, row := range want {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatalf("WriteRow: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := ReadXLSX(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ReadXLSX: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if columnName(27) != "AB" {
+		t.Errorf("columnName(27) = %s", columnName(27))
+	}
+}
@@ -0,0 +1,40 @@
+package workers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	loc := time.UTC
+	from := time.Date(2025, 1, 31, 10, 7, 30, 0, loc) // a Friday
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2025, 1, 31, 10, 15, 0, 0, loc)},
+		{"5 * * * *", time.Date(2025, 1, 31, 11, 5, 0, 0, loc)},
+		{"@daily", time.Date(2025, 2, 1, 0, 0, 0, 0, loc)},
+		{"0 9 * * mon-fri", time.Date(2025, 2, 3, 9, 0, 0, 0, loc)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, loc)},
+		{"30 8 1,15 * 7", time.Date(2025, 2, 1, 8, 30, 0, 0, loc)},
+		{"0 0 1 jan-mar/2 *", time.Date(2025, 3, 1, 0, 0, 0, 0, loc)},
+		{"@every 90m", time.Date(2025, 1, 31, 11, 37, 30, 0, loc)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec, loc)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tt.next) {
+			t.Errorf("%q: Next = %v, want %v", tt.spec, got, tt.next)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "@every 1ms", "@sometimes"} {
+		if _, err := ParseSchedule(spec, loc); err == nil {
+			t.Errorf("ParseSchedule(%q) accepted", spec)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package workers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Lease is a lock in Redis that at most one API instance holds at a time.
+// It expires after its TTL unless the holder renews it, so an instance that
+// dies cannot keep it.
+type Lease struct {
+	rdb   *redis.Client
+	key   string
+	owner string
+	ttl   time.Duration
+}
+
+// renewLease extends the lease only while the caller still owns it
+var renewLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseLease deletes the lease only while the caller still owns it
+var releaseLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// NewLease creates a lease named name, stored at lease:<name>
+func NewLease(rdb *redis.Client, name string, ttl time.Duration) *Lease {
+	return &Lease{
+		rdb:   rdb,
+		key:   "lease:" + name,
+		owner: leaseOwner(),
+		ttl:   ttl,
+	}
+}
+
+// leaseOwner identifies this process among the API instances
+func leaseOwner() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// Key returns the Redis key of the lease
+func (l *Lease) Key() string { return l.key }
+
+// Owner returns the value this lease writes while held
+func (l *Lease) Owner() string { return l.owner }
+
+// Acquire takes the lease if nobody holds it
+func (l *Lease) Acquire(ctx context.Context) (bool, error) {
+	return l.rdb.SetNX(ctx, l.key, l.owner, l.ttl).Result()
+}
+
+// Renew extends the lease for another TTL and reports whether it is still held
+func (l *Lease) Renew(ctx context.Context) (bool, error) {
+	n, err := renewLease.Run(ctx, l.rdb, []string{l.key}, l.owner, l.ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// Release gives the lease up if it is still held
+func (l *Lease) Release(ctx context.Context) error {
+	return releaseLease.Run(ctx, l.rdb, []string{l.key}, l.owner).Err()
+}
+
+// Hold runs fn while holding the lease, renewing it every third of its TTL.
+// It reports false without calling fn when another instance holds the lease.
+// If the lease is lost while fn runs, fn's context is cancelled.
+func (l *Lease) Hold(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	acquired, err := l.Acquire(ctx)
+	if err != nil || !acquired {
+		return false, err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				if held, err := l.Renew(runCtx); err == nil && !held {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err = fn(runCtx)
+	// Release with a fresh context: ctx may already be cancelled on shutdown
+	releaseCtx, cancelRelease := context.WithTimeout(context.Background(), time.Second)
+	defer cancelRelease()
+	if releaseErr := l.Release(releaseCtx); err == nil {
+		err = releaseErr
+	}
+	return true, err
+}
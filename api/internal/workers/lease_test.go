@@ -0,0 +1,54 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLeaseIsExclusive(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	a := NewLease(rdb, "job", time.Minute)
+	b := NewLease(rdb, "job", time.Minute)
+
+	ran := false
+	held, err := a.Hold(ctx, func(ctx context.Context) error {
+		// Another instance cannot take or release the lease meanwhile
+		if ok, _ := b.Hold(ctx, func(context.Context) error { t.Error("second holder ran"); return nil }); ok {
+			t.Error("lease acquired twice")
+		}
+		if err := b.Release(ctx); err != nil {
+			t.Errorf("Release: %v", err)
+		}
+		if owner, _ := rdb.Get(ctx, a.Key()).Result(); owner != a.Owner() {
+			t.Errorf("lease owner = %q", owner)
+		}
+		ran = true
+		return nil
+	})
+	if err != nil || !held || !ran {
+		t.Fatalf("Hold = %v, %v (ran %v)", held, err, ran)
+	}
+	if mr.Exists(a.Key()) {
+		t.Error("lease not released")
+	}
+
+	// An expired lease can be taken over; the old holder notices on renewal
+	if ok, _ := a.Acquire(ctx); !ok {
+		t.Fatal("Acquire after release failed")
+	}
+	mr.FastForward(2 * time.Minute)
+	if ok, _ := b.Acquire(ctx); !ok {
+		t.Fatal("expired lease not taken over")
+	}
+	if ok, _ := a.Renew(ctx); ok {
+		t.Error("renewed a lease held by another instance")
+	}
+}
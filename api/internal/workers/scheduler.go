@@ -0,0 +1,534 @@
+package workers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/hashcodec"
+	"i-manage/internal/models"
+)
+
+// Job errors surfaced to handlers
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobRunning  = errors.New("job is running")
+)
+
+const (
+	// schedulerPoll is how often the scheduler looks for due jobs
+	schedulerPoll = time.Second
+	// schedulerBatch bounds the due jobs started per poll
+	schedulerBatch = 100
+	// jobLeaseTTL bounds how long a dead instance blocks a job; the lease is
+	// renewed while the job runs
+	jobLeaseTTL = time.Minute
+	// jobHistorySize is how many runs each job keeps
+	jobHistorySize = 50
+	// jobRetention is how long finished one-off jobs are kept
+	jobRetention = 7 * 24 * time.Hour
+)
+
+// Jobs are stored in Redis:
+//
+//	jobs:all           zset of job IDs by creation time
+//	jobs:due           zset of job IDs by next run (unix ms)
+//	job:<id>           hash of the job (models.Job)
+//	job:<id>:history   list of JSON runs, newest first
+const (
+	jobsAllKey = "jobs:all"
+	jobsDueKey = "jobs:due"
+)
+
+func jobKey(id string) string        { return "job:" + id }
+func jobHistoryKey(id string) string { return "job:" + id + ":history" }
+
+// JobFunc runs a job. payload is empty for recurring jobs.
+type JobFunc func(ctx context.Context, payload string) error
+
+// JobOptions tune how a job is run. Zero values take the defaults.
+type JobOptions struct {
+	MaxAttempts int           // attempts per run, defaults to 3
+	Backoff     time.Duration // delay before the first retry, doubled for each further one; defaults to 30s
+	Timeout     time.Duration // longest a run may take, defaults to 10m
+}
+
+func (o JobOptions) withDefaults() JobOptions {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 3
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 30 * time.Second
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Minute
+	}
+	return o
+}
+
+// backoff returns the delay before retrying after the given failed attempt
+func (o JobOptions) backoff(attempt int) time.Duration {
+	d := o.Backoff
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	return min(d, time.Hour)
+}
+
+// jobKind is a job handler registered on this instance
+type jobKind struct {
+	fn       JobFunc
+	opts     JobOptions
+	spec     string   // cron expression of recurring jobs
+	schedule Schedule // nil for one-off jobs
+}
+
+// Scheduler runs recurring jobs on cron schedules and one-off jobs at a
+// given time. Jobs are persisted in Redis, so a restart neither loses a
+// one-off job nor skips a recurring job that fell due while no instance was
+// running. Every API instance runs a scheduler; a lease per job makes sure
+// only one of them runs it. Failed runs are retried with exponential backoff.
+type Scheduler struct {
+	rdb      *redis.Client
+	loc      *time.Location
+	instance string
+
+	mu      sync.Mutex
+	kinds   map[string]jobKind
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler that evaluates cron expressions in loc
+func NewScheduler(rdb *redis.Client, loc *time.Location) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		rdb:      rdb,
+		loc:      loc,
+		instance: fmt.Sprintf("%s-%d", host, os.Getpid()),
+		kinds:    make(map[string]jobKind),
+		running:  make(map[string]bool),
+	}
+}
+
+// Cron registers a recurring job named name. Jobs must be registered before
+// the scheduler runs.
+func (s *Scheduler) Cron(name, spec string, fn func(ctx context.Context) error, opts JobOptions) error {
+	schedule, err := ParseSchedule(spec, s.loc)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kinds[name] = jobKind{
+		fn:       func(ctx context.Context, _ string) error { return fn(ctx) },
+		opts:     opts.withDefaults(),
+		spec:     spec,
+		schedule: schedule,
+	}
+	return nil
+}
+
+// Handle registers the handler of one-off jobs of a kind, see EnqueueJob
+func (s *Scheduler) Handle(kind string, fn JobFunc, opts JobOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kinds[kind] = jobKind{fn: fn, opts: opts.withDefaults()}
+}
+
+// Name implements Worker
+func (s *Scheduler) Name() string { return "scheduler" }
+
+// Run implements Worker. It stores the recurring jobs, then starts due jobs
+// until ctx is cancelled and waits for the running ones to return.
+func (s *Scheduler) Run(ctx context.Context) error {
+	if err := s.register(ctx, time.Now()); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(schedulerPoll)
+	defer ticker.Stop()
+	defer s.wg.Wait()
+
+	for {
+		if err := s.dispatch(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("scheduler: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// register stores the recurring jobs. A job keeps its next run across
+// restarts unless its schedule changed.
+func (s *Scheduler) register(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, kind := range s.kinds {
+		if kind.schedule == nil {
+			continue
+		}
+		key := jobKey(name)
+		spec, err := s.rdb.HGet(ctx, key, "schedule").Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		_, err = s.rdb.ZScore(ctx, jobsDueKey, name).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		due := err == nil
+
+		timestamp := now.Format(time.RFC3339)
+		pipe := s.rdb.TxPipeline()
+		pipe.HSetNX(ctx, key, "created", timestamp)
+		pipe.HSetNX(ctx, key, "status", models.JobStatusScheduled)
+		pipe.HSet(ctx, key, "id", name, "kind", name, "schedule", kind.spec, "maxAttempts", kind.opts.MaxAttempts)
+		pipe.ZAddNX(ctx, jobsAllKey, redis.Z{Score: float64(now.Unix()), Member: name})
+		if !due || spec != kind.spec {
+			next := kind.schedule.Next(now)
+			pipe.ZAdd(ctx, jobsDueKey, redis.Z{Score: float64(next.UnixMilli()), Member: name})
+			pipe.HSet(ctx, key, "nextRunAt", next.Format(time.RFC3339), "modified", timestamp)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatch starts the due jobs this instance has a handler for
+func (s *Scheduler) dispatch(ctx context.Context, now time.Time) error {
+	ids, err := s.rdb.ZRangeByScore(ctx, jobsDueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: schedulerBatch,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		kindName, err := s.rdb.HGet(ctx, jobKey(id), "kind").Result()
+		if err == redis.Nil {
+			// The job was deleted; drop its schedule
+			s.rdb.ZRem(ctx, jobsDueKey, id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		kind, ok := s.kinds[kindName]
+		if !ok || s.running[id] {
+			// Another instance may know this kind
+			s.mu.Unlock()
+			continue
+		}
+		s.running[id] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func(id string) {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.running, id)
+				s.mu.Unlock()
+			}()
+			lease := NewLease(s.rdb, "job:"+id, jobLeaseTTL)
+			if _, err := lease.Hold(ctx, func(ctx context.Context) error {
+				return s.attempt(ctx, id, kind)
+			}); err != nil && ctx.Err() == nil {
+				log.Printf("scheduler: job %s: %v", id, err)
+			}
+		}(id)
+	}
+	return nil
+}
+
+// attempt runs a job once while holding its lease and schedules what comes
+// next: the following cron run, a retry, or nothing
+func (s *Scheduler) attempt(ctx context.Context, id string, kind jobKind) error {
+	key := jobKey(id)
+
+	// Another instance may have run the job since it was listed
+	score, err := s.rdb.ZScore(ctx, jobsDueKey, id).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if int64(score) > time.Now().UnixMilli() {
+		return nil
+	}
+
+	values, err := s.rdb.HMGet(ctx, key, "payload", "attempt", "status").Result()
+	if err != nil {
+		return err
+	}
+	payload, _ := values[0].(string)
+	attemptStr, _ := values[1].(string)
+	prevStatus, _ := values[2].(string)
+	attempt, _ := strconv.Atoi(attemptStr)
+
+	started := time.Now()
+	if err := s.rdb.HSet(ctx, key,
+		"status", models.JobStatusRunning,
+		"lastRunAt", started.Format(time.RFC3339),
+		"lastInstance", s.instance,
+		"maxAttempts", kind.opts.MaxAttempts,
+		"modified", started.Format(time.RFC3339),
+	).Err(); err != nil {
+		return err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, kind.opts.Timeout)
+	runErr := runJob(runCtx, kind.fn, payload)
+	cancel()
+	finished := time.Now()
+
+	if ctx.Err() != nil {
+		// Shutting down or the lease was lost: the job is still due and
+		// runs again on the next instance to pick it up
+		s.rdb.HSet(context.Background(), key, "status", prevStatus)
+		return ctx.Err()
+	}
+
+	attempt++
+	run := models.JobRun{
+		JobID:      id,
+		Attempt:    attempt,
+		Status:     models.JobStatusSucceeded,
+		Instance:   s.instance,
+		StartedAt:  started.Format(time.RFC3339),
+		FinishedAt: finished.Format(time.RFC3339),
+		DurationMs: finished.Sub(started).Milliseconds(),
+	}
+	if runErr != nil {
+		run.Status = models.JobStatusFailed
+		run.Error = runErr.Error()
+	}
+	runJSON, _ := json.Marshal(run)
+
+	pipe := s.rdb.TxPipeline()
+	pipe.LPush(ctx, jobHistoryKey(id), runJSON)
+	pipe.LTrim(ctx, jobHistoryKey(id), 0, jobHistorySize-1)
+	pipe.HSet(ctx, key, "lastDurationMs", run.DurationMs, "modified", finished.Format(time.RFC3339))
+
+	var next time.Time
+	status := models.JobStatusSucceeded
+	if runErr == nil {
+		pipe.HIncrBy(ctx, key, "runs", 1)
+		pipe.HDel(ctx, key, "lastError")
+		attempt = 0
+	} else {
+		pipe.HIncrBy(ctx, key, "failures", 1)
+		pipe.HSet(ctx, key, "lastError", runErr.Error())
+		status = models.JobStatusFailed
+		if attempt < kind.opts.MaxAttempts {
+			status = models.JobStatusRetrying
+			next = finished.Add(kind.opts.backoff(attempt))
+		} else if kind.schedule != nil {
+			// A recurring job starts over at its next run
+			attempt = 0
+		}
+	}
+	if next.IsZero() && kind.schedule != nil {
+		next = kind.schedule.Next(finished)
+		if status == models.JobStatusSucceeded {
+			status = models.JobStatusScheduled
+		}
+	}
+	pipe.HSet(ctx, key, "status", status, "attempt", attempt)
+
+	if next.IsZero() {
+		// A finished one-off job is kept for a while for inspection
+		pipe.ZRem(ctx, jobsDueKey, id)
+		pipe.HDel(ctx, key, "nextRunAt")
+		pipe.Expire(ctx, key, jobRetention)
+		pipe.Expire(ctx, jobHistoryKey(id), jobRetention)
+	} else {
+		pipe.ZAdd(ctx, jobsDueKey, redis.Z{Score: float64(next.UnixMilli()), Member: id})
+		pipe.HSet(ctx, key, "nextRunAt", next.Format(time.RFC3339))
+	}
+	_, err = pipe.Exec(ctx)
+
+	if runErr != nil {
+		log.Printf("scheduler: job %s attempt %d failed: %v", id, attempt, runErr)
+	}
+	return err
+}
+
+// runJob calls fn, turning a panic into an error
+func runJob(ctx context.Context, fn JobFunc, payload string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, payload)
+}
+
+// EnqueueJob schedules a one-off job of a kind to run at runAt with payload
+// as its input. The instance that runs it must have a handler for the kind.
+func EnqueueJob(ctx context.Context, rdb *redis.Client, kind, payload string, runAt time.Time) (*models.Job, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	job := models.Job{
+		ID:        "job_" + hex.EncodeToString(b),
+		Kind:      kind,
+		Payload:   payload,
+		Status:    models.JobStatusScheduled,
+		NextRunAt: runAt.Format(time.RFC3339),
+		Created:   now.Format(time.RFC3339),
+		Modified:  now.Format(time.RFC3339),
+	}
+	fields, err := hashcodec.MarshalPartial(job)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, jobKey(job.ID), fields)
+	pipe.ZAdd(ctx, jobsAllKey, redis.Z{Score: float64(now.Unix()), Member: job.ID})
+	pipe.ZAdd(ctx, jobsDueKey, redis.Z{Score: float64(runAt.UnixMilli()), Member: job.ID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs returns the jobs in a status, or all of them, soonest next run
+// first
+func ListJobs(ctx context.Context, rdb *redis.Client, status string) (*models.JobList, error) {
+	ids, err := rdb.ZRange(ctx, jobsAllKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, jobKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	list := &models.JobList{Jobs: []models.Job{}}
+	var expired []interface{}
+	for i, cmd := range cmds {
+		data := cmd.Val()
+		if len(data) == 0 {
+			expired = append(expired, ids[i])
+			continue
+		}
+		var job models.Job
+		if err := hashcodec.Unmarshal(data, &job); err != nil {
+			continue
+		}
+		if status == "" || job.Status == status {
+			list.Jobs = append(list.Jobs, job)
+		}
+	}
+	if len(expired) > 0 {
+		rdb.ZRem(ctx, jobsAllKey, expired...)
+	}
+
+	sort.SliceStable(list.Jobs, func(i, j int) bool {
+		a, b := list.Jobs[i].NextRunAt, list.Jobs[j].NextRunAt
+		if (a == "") != (b == "") {
+			return a != ""
+		}
+		if a != b {
+			return a < b
+		}
+		return list.Jobs[i].ID < list.Jobs[j].ID
+	})
+	list.Total = len(list.Jobs)
+	return list, nil
+}
+
+// GetJob returns a job with its latest runs
+func GetJob(ctx context.Context, rdb *redis.Client, id string, history int) (*models.Job, error) {
+	data, err := rdb.HGetAll(ctx, jobKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrJobNotFound
+	}
+	var job models.Job
+	if err := hashcodec.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+
+	if history <= 0 {
+		return &job, nil
+	}
+	runs, err := rdb.LRange(ctx, jobHistoryKey(id), 0, int64(history)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	job.History = make([]models.JobRun, 0, len(runs))
+	for _, raw := range runs {
+		var run models.JobRun
+		if json.Unmarshal([]byte(raw), &run) == nil {
+			job.History = append(job.History, run)
+		}
+	}
+	return &job, nil
+}
+
+// TriggerJob makes a job due now. A recurring job then carries on with its
+// schedule; a failed one-off job is run again.
+func TriggerJob(ctx context.Context, rdb *redis.Client, id string) (*models.Job, error) {
+	key := jobKey(id)
+	err := rdb.Watch(ctx, func(tx *redis.Tx) error {
+		status, err := tx.HGet(ctx, key, "status").Result()
+		if err == redis.Nil {
+			return ErrJobNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if status == models.JobStatusRunning {
+			return ErrJobRunning
+		}
+		now := time.Now()
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZAdd(ctx, jobsDueKey, redis.Z{Score: float64(now.UnixMilli()), Member: id})
+			pipe.HSet(ctx, key, "status", models.JobStatusScheduled, "attempt", 0,
+				"nextRunAt", now.Format(time.RFC3339), "modified", now.Format(time.RFC3339))
+			pipe.Persist(ctx, key)
+			pipe.Persist(ctx, jobHistoryKey(id))
+			pipe.ZAddNX(ctx, jobsAllKey, redis.Z{Score: float64(now.Unix()), Member: id})
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return GetJob(ctx, rdb, id, 0)
+}
@@ -0,0 +1,106 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"i-manage/internal/models"
+)
+
+func TestSchedulerRetriesAndHistory(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	calls := 0
+	s := NewScheduler(rdb, time.UTC)
+	if err := s.Cron("flaky", "@hourly", func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	}, JobOptions{Backoff: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Cron: %v", err)
+	}
+	if err := s.register(ctx, time.Now()); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	run := func() {
+		t.Helper()
+		if err := s.dispatch(ctx, time.Now()); err != nil {
+			t.Fatalf("dispatch: %v", err)
+		}
+		s.wg.Wait()
+	}
+
+	// Not due before its schedule
+	run()
+	if calls != 0 {
+		t.Fatalf("job ran %d times before it was due", calls)
+	}
+
+	if _, err := TriggerJob(ctx, rdb, "flaky"); err != nil {
+		t.Fatalf("TriggerJob: %v", err)
+	}
+	run()
+	job, err := GetJob(ctx, rdb, "flaky", 10)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if job.Status != models.JobStatusRetrying || job.Attempt != 1 || job.Failures != 1 || job.LastError != "boom" {
+		t.Errorf("after a failure job = %+v", job)
+	}
+
+	// Another instance holding the lease keeps this one from running the job
+	time.Sleep(20 * time.Millisecond)
+	other := NewLease(rdb, "job:flaky", time.Minute)
+	if ok, _ := other.Acquire(ctx); !ok {
+		t.Fatal("Acquire failed")
+	}
+	run()
+	if calls != 1 {
+		t.Errorf("job ran while leased elsewhere")
+	}
+	other.Release(ctx)
+
+	run()
+	job, _ = GetJob(ctx, rdb, "flaky", 10)
+	if calls != 2 || job.Status != models.JobStatusScheduled || job.Attempt != 0 || job.Runs != 1 {
+		t.Errorf("after the retry job = %+v (calls %d)", job, calls)
+	}
+	if next, err := time.Parse(time.RFC3339, job.NextRunAt); err != nil || next.Minute() != 0 || !next.After(time.Now()) {
+		t.Errorf("next run = %q, want the next hour", job.NextRunAt)
+	}
+	if len(job.History) != 2 || job.History[0].Status != models.JobStatusSucceeded || job.History[1].Error != "boom" {
+		t.Errorf("history = %+v", job.History)
+	}
+
+	// One-off jobs run once with their payload
+	var got string
+	s.Handle("echo", func(_ context.Context, payload string) error {
+		got = payload
+		return nil
+	}, JobOptions{})
+	once, err := EnqueueJob(ctx, rdb, "echo", "hello", time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+	run()
+	run()
+	if got != "hello" {
+		t.Errorf("payload = %q", got)
+	}
+	list, err := ListJobs(ctx, rdb, models.JobStatusSucceeded)
+	if err != nil || list.Total != 1 || list.Jobs[0].ID != once.ID || list.Jobs[0].Runs != 1 {
+		t.Errorf("succeeded jobs = %+v, %v", list, err)
+	}
+	if _, err := rdb.ZScore(ctx, jobsDueKey, once.ID).Result(); err != redis.Nil {
+		t.Error("finished one-off job still due")
+	}
+}
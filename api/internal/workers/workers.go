@@ -0,0 +1,111 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// restartDelay is how long a failed worker waits before being restarted
+const restartDelay = 5 * time.Second
+
+// Worker is a long-running background task tied to the server lifecycle.
+// Run must return promptly once ctx is cancelled.
+type Worker interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+type funcWorker struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (w funcWorker) Name() string                  { return w.name }
+func (w funcWorker) Run(ctx context.Context) error { return w.fn(ctx) }
+
+// Func wraps a plain function as a Worker
+func Func(name string, fn func(ctx context.Context) error) Worker {
+	return funcWorker{name: name, fn: fn}
+}
+
+// Manager starts registered workers and stops them together on shutdown
+type Manager struct {
+	mu      sync.Mutex
+	workers []Worker
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewManager creates an empty worker manager
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Register adds a worker. Workers must be registered before Start.
+func (m *Manager) Register(w Worker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.workers = append(m.workers, w)
+}
+
+// Start launches every registered worker in its own goroutine.
+// A worker that returns an error is restarted after a short delay.
+func (m *Manager) Start(parent context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(parent)
+	m.cancel = cancel
+
+	for _, w := range m.workers {
+		m.wg.Add(1)
+		go m.run(ctx, w)
+	}
+}
+
+func (m *Manager) run(ctx context.Context, w Worker) {
+	defer m.wg.Done()
+
+	for {
+		err := w.Run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("worker %s failed: %v", w.Name(), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
+// Shutdown cancels all workers and waits for them to return or for ctx to expire
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	cancel := m.cancel
+	m.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
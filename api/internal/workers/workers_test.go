@@ -0,0 +1,45 @@
+package workers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestManagerShutdownWaitsForWorkers(t *testing.T) {
+	var stopped atomic.Bool
+
+	m := NewManager()
+	m.Register(Func("blocking", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		stopped.Store(true)
+		return ctx.Err()
+	}))
+	m.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+	if !stopped.Load() {
+		t.Errorf("Expected worker to finish before Shutdown returned")
+	}
+}
+
+func TestManagerShutdownTimeout(t *testing.T) {
+	m := NewManager()
+	m.Register(Func("stuck", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}))
+	m.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Shutdown(ctx); err == nil {
+		t.Errorf("Expected Shutdown to time out while a worker is stuck")
+	}
+}
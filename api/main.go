@@ -1,12 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"i-manage/internal/database"
+	"i-manage/internal/events"
+	"i-manage/internal/handlers"
+	"i-manage/internal/live"
 	"i-manage/internal/routes"
+	"i-manage/internal/services"
+	"i-manage/internal/workers"
 	"i-manage/docs"
 )
 
@@ -37,12 +49,32 @@ func main() {
 	database.InitRedis()
 	database.InitRediSearch()
 
+	// One-off index of existing shops for duplicate detection
+	if n, err := services.NewIShopService().BackfillContactLookup(context.Background()); err != nil {
+		log.Printf("Shop contact lookup backfill failed: %v", err)
+	} else if n > 0 {
+		log.Printf("Indexed contacts of %d existing shops", n)
+	}
+
+	// One-off province and district counts of existing iComs for the stats
+	if n, err := services.NewStatsService().BackfillLocationCounts(context.Background()); err != nil {
+		log.Printf("Stats location backfill failed: %v", err)
+	} else if n > 0 {
+		log.Printf("Built location counts of %d existing iComs", n)
+	}
+
 	// Configure Swagger host from environment variable
 	swaggerHost := os.Getenv("SWAGGER_HOST")
 	if swaggerHost != "" {
 		docs.SwaggerInfo.Host = swaggerHost
 	}
 
+	// The local fake payment gateway is for development only
+	if enabled, _ := strconv.ParseBool(os.Getenv("PAYMENT_FAKE_GATEWAY")); enabled {
+		services.RegisterPaymentGateway(services.NewFakeGateway(os.Getenv("PAYMENT_FAKE_GATEWAY_SECRET")))
+		log.Println("Fake payment gateway enabled")
+	}
+
 	r := routes.SetupRouter()
 
 	port := os.Getenv("APP_PORT")
@@ -50,8 +82,65 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Starting server on :%s...\n", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	// Drain timeout for in-flight requests and background workers
+	drainTimeout := 15 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			drainTimeout = d
+		}
 	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers share the server lifecycle
+	bg := workers.NewManager()
+	webhooks := services.NewWebhookService()
+	bg.Register(events.NewSubscriber(events.SubscriberConfig{Group: "webhooks"}, webhooks.HandleEvent))
+	bg.Register(workers.Func("webhooks:deliveries", webhooks.RunDeliveries))
+	bg.Register(events.NewSubscriber(events.SubscriberConfig{Group: "live"}, services.NewLiveService().HandleEvent))
+	bg.Register(live.DefaultHub)
+	bg.Register(events.NewSubscriber(events.SubscriberConfig{Group: "notifications"}, services.NewNotificationService().HandleEvent))
+	bg.Register(workers.Func("imports", services.NewImportService().RunImports))
+	bg.Register(events.NewSubscriber(events.SubscriberConfig{Group: "waitlist"}, services.NewMemberService().HandleWaitlistEvent))
+	bg.Register(events.NewSubscriber(events.SubscriberConfig{Group: "stats"}, services.NewStatsService().HandleEvent))
+	scheduler, err := services.NewScheduler()
+	if err != nil {
+		log.Fatalf("Failed to create job scheduler: %v", err)
+	}
+	bg.Register(scheduler)
+	bg.Start(ctx)
+
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Printf("Starting server on :%s...\n", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutdown signal received, draining...")
+	handlers.MarkDraining()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+	if err := bg.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Background workers shutdown: %v", err)
+	}
+	if err := database.Rdb.Close(); err != nil {
+		log.Printf("Redis close: %v", err)
+	}
+
+	log.Println("Server stopped")
 }
\ No newline at end of file